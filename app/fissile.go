@@ -3,12 +3,15 @@ package app
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/compilator"
@@ -16,8 +19,11 @@ import (
 	"code.cloudfoundry.org/fissile/helm"
 	"code.cloudfoundry.org/fissile/kube"
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/oci"
+	"code.cloudfoundry.org/fissile/registry"
 	"code.cloudfoundry.org/fissile/scripts/compilation"
 	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
 	"github.com/SUSE/stampy"
 	"github.com/SUSE/termui"
 	"github.com/fatih/color"
@@ -34,15 +40,23 @@ const (
 	OutputFormatHuman = "human" // output for human consumption
 	OutputFormatJSON  = "json"  // output as JSON
 	OutputFormatYAML  = "yaml"  // output as YAML
+	OutputFormatSARIF = "sarif" // output as SARIF, for validation reports
 )
 
 // Fissile represents a fissile application
 type Fissile struct {
-	Version   string
-	UI        *termui.UI
-	Manifest  *model.RoleManifest
-	cmdErr    error
-	graphFile *os.File
+	Version  string
+	UI       *termui.UI
+	Manifest *model.RoleManifest
+	// ReleaseDownloads controls fetching of the releases referenced by the
+	// role manifest; an empty cache dir means a cache below the BOSH cache
+	ReleaseDownloads model.ReleaseDownloadOptions
+	// HideManifestWarnings keeps LoadManifest from showing the warnings found
+	// in the role manifest, for machine readable output, or when they are
+	// reported together with the other validation problems
+	HideManifestWarnings bool
+	cmdErr               error
+	graphFile            *os.File
 }
 
 // NewFissileApplication creates a new app.Fissile
@@ -55,17 +69,31 @@ func NewFissileApplication(version string, ui *termui.UI) *Fissile {
 
 // LoadManifest loads the manifest in use by fissile
 func (f *Fissile) LoadManifest(roleManifestPath string, releasePaths, releaseNames, releaseVersions []string, cacheDir string) error {
+	releaseDownloads := f.ReleaseDownloads
+	if releaseDownloads.CacheDir == "" && cacheDir != "" {
+		releaseDownloads.CacheDir = filepath.Join(cacheDir, "releases")
+	}
+
 	roleManifest, err := model.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
-		ReleasePaths:    releasePaths,
-		ReleaseNames:    releaseNames,
-		ReleaseVersions: releaseVersions,
-		BOSHCacheDir:    cacheDir,
-		Grapher:         f})
+		ReleasePaths:     releasePaths,
+		ReleaseNames:     releaseNames,
+		ReleaseVersions:  releaseVersions,
+		BOSHCacheDir:     cacheDir,
+		ReleaseDownloads: releaseDownloads,
+		Grapher:          f})
+	if errs, ok := err.(validation.ErrorList); ok {
+		return &ValidationError{Context: "Error loading roles manifest", Errors: errs}
+	}
 	if err != nil {
 		return fmt.Errorf("Error loading roles manifest: %s", err.Error())
 	}
 
 	f.Manifest = roleManifest
+	if !f.HideManifestWarnings {
+		for _, warning := range roleManifest.Warnings {
+			f.UI.Println(color.YellowString("%s", warning.Error()))
+		}
+	}
 	return nil
 }
 
@@ -179,6 +207,56 @@ func (f *Fissile) ListProperties(outputFormat OutputFormat) error {
 	return nil
 }
 
+// ListOpinions will list the merged light opinions, together with the light
+// opinion file each value came from
+func (f *Fissile) ListOpinions(lightOpinionsPaths []string, darkOpinionsPath string, outputFormat OutputFormat) error {
+	opinions, err := model.NewOpinions(lightOpinionsPaths, darkOpinionsPath)
+	if err != nil {
+		return err
+	}
+
+	type layeredOpinion struct {
+		Value string `json:"value" yaml:"value"`
+		Layer string `json:"layer" yaml:"layer"`
+	}
+	result := make(map[string]layeredOpinion)
+	for property, value := range model.FlattenOpinions(opinions.Light, false) {
+		result[property] = layeredOpinion{Value: value, Layer: opinions.LightLayer(property)}
+	}
+
+	switch outputFormat {
+	case OutputFormatHuman:
+		properties := make([]string, 0, len(result))
+		for property := range result {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		for _, property := range properties {
+			f.UI.Printf("%s: %s %s\n", color.YellowString(property),
+				result[property].Value, color.WhiteString("(%s)", result[property].Layer))
+		}
+	case OutputFormatJSON:
+		buf, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s\n", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	return nil
+}
+
 // SerializePackages returns all packages in loaded releases, keyed by fingerprint
 func (f *Fissile) SerializePackages() (map[string]interface{}, error) {
 	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
@@ -314,13 +392,16 @@ func newPropertyInfo(maybeHash bool) *propertyInfo {
 	}
 }
 
-// Compile will compile a list of dev BOSH releases
-func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath, metricsPath string, instanceGroupNames, releaseNames []string, workerCount int, dockerNetworkMode string, withoutDocker, verbose bool, packageCacheConfigFilename string) error {
+// Compile will compile a list of dev BOSH releases. With dryRun, it only
+// reports which packages would be compiled, in the given output format.
+// Rootless compilation uses the stemcell root filesystem at stemcellRootfs
+// instead of the stemcell image.
+func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath, metricsPath string, instanceGroupNames, releaseNames []string, workerCount int, dockerNetworkMode string, withoutDocker, rootless bool, stemcellRootfs string, verbose bool, packageCacheConfigFilename string, dryRun bool, outputFormat OutputFormat) error {
 	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
 
-	if metricsPath != "" {
+	if metricsPath != "" && !dryRun {
 		stampy.Stamp(metricsPath, "fissile", "compile-packages", "start")
 		defer stampy.Stamp(metricsPath, "fissile", "compile-packages", "done")
 	}
@@ -335,9 +416,11 @@ func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath
 		return err
 	}
 
-	f.UI.Println(color.GreenString("Compiling packages for releases:"))
-	for _, release := range releases {
-		f.UI.Printf("         %s (%s)\n", color.YellowString(release.Name), color.MagentaString(release.Version))
+	if !dryRun {
+		f.UI.Println(color.GreenString("Compiling packages for releases:"))
+		for _, release := range releases {
+			f.UI.Printf("         %s (%s)\n", color.YellowString(release.Name), color.MagentaString(release.Version))
+		}
 	}
 
 	packageStorage, err := compilator.NewPackageStorageFromConfig(packageCacheConfigFilename, targetPath, stemcellImageName)
@@ -345,7 +428,14 @@ func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath
 		return err
 	}
 	var comp *compilator.Compilator
-	if withoutDocker {
+	if withoutDocker && rootless {
+		return fmt.Errorf("Rootless compilation and compilation without docker are mutually exclusive")
+	} else if rootless {
+		comp, err = compilator.NewRootlessCompilator(targetPath, metricsPath, stemcellImageName, stemcellRootfs, compilation.LinuxBase, f.Version, f.UI, f, packageStorage)
+		if err != nil {
+			return fmt.Errorf("Error creating a new compilator: %s", err.Error())
+		}
+	} else if withoutDocker {
 		comp, err = compilator.NewMountNSCompilator(targetPath, metricsPath, stemcellImageName, compilation.LinuxBase, f.Version, f.UI, f, packageStorage)
 		if err != nil {
 			return fmt.Errorf("Error creating a new compilator: %s", err.Error())
@@ -362,6 +452,14 @@ func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath
 		return fmt.Errorf("Error selecting packages to build: %s", err.Error())
 	}
 
+	if dryRun {
+		plan, err := comp.Plan(releases, instanceGroups)
+		if err != nil {
+			return fmt.Errorf("Error planning package compilation: %s", err.Error())
+		}
+		return f.showCompilationPlan(plan, outputFormat)
+	}
+
 	if err := comp.Compile(workerCount, releases, instanceGroups, verbose); err != nil {
 		return fmt.Errorf("Error compiling packages: %s", err.Error())
 	}
@@ -369,6 +467,51 @@ func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath
 	return nil
 }
 
+// showCompilationPlan reports the packages a compilation would handle
+func (f *Fissile) showCompilationPlan(plan []compilator.PlannedPackage, outputFormat OutputFormat) error {
+	switch outputFormat {
+	case OutputFormatHuman:
+		counts := make(map[compilator.PackageSource]int)
+		for _, pkg := range plan {
+			counts[pkg.Source]++
+			dependencies := ""
+			if len(pkg.Dependencies) > 0 {
+				dependencies = color.WhiteString(" needs %s", strings.Join(pkg.Dependencies, ", "))
+			}
+			f.UI.Printf("%-8s %s/%s (%s)%s\n",
+				pkg.Source,
+				color.YellowString(pkg.Release),
+				color.YellowString(pkg.Name),
+				color.MagentaString(pkg.Fingerprint),
+				dependencies)
+		}
+		f.UI.Printf(
+			"%s packages to compile, %s from the package cache, %s already in the work dir.\n",
+			color.GreenString("%d", counts[compilator.PackageSourceCompile]),
+			color.GreenString("%d", counts[compilator.PackageSourceCache]),
+			color.GreenString("%d", counts[compilator.PackageSourceWorkDir]),
+		)
+	case OutputFormatJSON:
+		buf, err := util.JSONMarshal(plan)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(plan)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	return nil
+}
+
 // CleanCache inspects the compilation cache and removes all packages
 // which are not referenced (anymore).
 func (f *Fissile) CleanCache(targetPath string) error {
@@ -431,6 +574,116 @@ func (f *Fissile) CleanCache(targetPath string) error {
 	return nil
 }
 
+// ShowCompilationLog prints the output of the last compilation of a package
+// found in the compilation dir targetPath. The package is given by name, or
+// as release/name if several releases carry a package of that name. When a
+// stemcell is given, only compilations on that stemcell are considered.
+func (f *Fissile) ShowCompilationLog(targetPath, stemcell, packageName string, outputFormat OutputFormat) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	releaseName := ""
+	if parts := strings.SplitN(packageName, "/", 2); len(parts) == 2 {
+		releaseName, packageName = parts[0], parts[1]
+	}
+
+	fingerprints := make(map[string]*model.Package)
+	for _, release := range f.Manifest.LoadedReleases {
+		if releaseName != "" && release.Name != releaseName {
+			continue
+		}
+		for _, pkg := range release.Packages {
+			if pkg.Name == packageName {
+				fingerprints[pkg.Fingerprint] = pkg
+			}
+		}
+	}
+
+	if len(fingerprints) == 0 {
+		return fmt.Errorf("Package %s not found in the loaded releases", packageName)
+	}
+	if len(fingerprints) > 1 {
+		return fmt.Errorf("Package %s is found in several releases; use <release>/%s", packageName, packageName)
+	}
+
+	// Every stemcell has a compilation dir of its own; pick the latest
+	// compilation from any of them
+	compilationDirs, err := filepath.Glob(filepath.Join(targetPath, "*"))
+	if err != nil {
+		return err
+	}
+
+	var compilationLog *compilator.CompilationLog
+	var outputPath string
+	for fingerprint := range fingerprints {
+		for _, compilationDir := range compilationDirs {
+			candidate, err := compilator.ReadCompilationLog(compilationDir, fingerprint)
+			if err != nil {
+				return err
+			}
+			if candidate == nil || (stemcell != "" && candidate.Stemcell != stemcell) {
+				continue
+			}
+			if compilationLog == nil || candidate.Started.After(compilationLog.Started) {
+				compilationLog = candidate
+				outputPath = compilator.CompilationLogOutputPath(compilationDir, fingerprint)
+			}
+		}
+	}
+
+	if compilationLog == nil {
+		return fmt.Errorf("No compilation log found for package %s in %s", packageName, targetPath)
+	}
+
+	output, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		return fmt.Errorf("Error reading compilation log for package %s: %s", packageName, err.Error())
+	}
+
+	switch outputFormat {
+	case OutputFormatHuman:
+		f.UI.Printf("Package:     %s/%s (%s)\n",
+			color.YellowString(compilationLog.Release),
+			color.YellowString(compilationLog.Name),
+			color.MagentaString(compilationLog.Fingerprint))
+		f.UI.Printf("Stemcell:    %s\n", compilationLog.Stemcell)
+		f.UI.Printf("Started:     %s\n", compilationLog.Started.Local().Format(time.RFC1123))
+		f.UI.Printf("Duration:    %s\n", time.Duration(compilationLog.Duration*float64(time.Second)).Round(time.Second))
+		if compilationLog.ExitCode == 0 {
+			f.UI.Printf("Exit code:   %s\n", color.GreenString("%d", compilationLog.ExitCode))
+		} else {
+			f.UI.Printf("Exit code:   %s\n", color.RedString("%d", compilationLog.ExitCode))
+		}
+		if compilationLog.Error != "" {
+			f.UI.Printf("Error:       %s\n", color.RedString(compilationLog.Error))
+		}
+		f.UI.Printf("Log:         %s\n\n", outputPath)
+		f.UI.Printf("%s", output)
+	case OutputFormatJSON, OutputFormatYAML:
+		data := struct {
+			compilator.CompilationLog `yaml:",inline"`
+			Output                    string `json:"output" yaml:"output"`
+		}{*compilationLog, string(output)}
+
+		var buf []byte
+		if outputFormat == OutputFormatJSON {
+			buf, err = util.JSONMarshal(data)
+		} else {
+			buf, err = yaml.Marshal(data)
+		}
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	return nil
+}
+
 // GeneratePackagesRoleImage builds the docker image for the packages layer
 // where all packages are included
 func (f *Fissile) GeneratePackagesRoleImage(stemcellImageName string, roleManifest *model.RoleManifest, noBuild, force bool, instanceGroups model.InstanceGroups, packagesImageBuilder *builder.PackagesImageBuilder, labels map[string]string) error {
@@ -534,22 +787,131 @@ func (f *Fissile) GeneratePackagesRoleTarball(repository string, roleManifest *m
 	return nil
 }
 
+// GeneratePackagesRoleLayout builds the packages layer image into an image
+// layout without a docker daemon. The stemcell image must be in the layout.
+// With an archive directory, the image is also written there for `docker load`.
+func (f *Fissile) GeneratePackagesRoleLayout(roleManifest *model.RoleManifest, noBuild, force bool, instanceGroups model.InstanceGroups, layout *oci.Layout, archiveDirectory string, packagesImageBuilder *builder.PackagesImageBuilder, labels map[string]string) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	packagesLayerImageName, err := packagesImageBuilder.GetPackagesLayerImageName(roleManifest, instanceGroups, f)
+	if err != nil {
+		return fmt.Errorf("Error finding instance group's package name: %s", err.Error())
+	}
+
+	var archivePath string
+	if archiveDirectory != "" {
+		archivePath = filepath.Join(archiveDirectory, fmt.Sprintf("%s.tar", packagesLayerImageName))
+	}
+
+	if !force {
+		hasImage, err := layout.HasImage(packagesLayerImageName)
+		if err != nil {
+			return err
+		}
+		if archivePath != "" {
+			if _, err := os.Stat(archivePath); err != nil {
+				hasImage = false
+			}
+		}
+		if hasImage {
+			f.UI.Printf("Packages layer %s already exists. Skipping ...\n", color.YellowString(packagesLayerImageName))
+			return nil
+		}
+	}
+
+	if noBuild {
+		f.UI.Println("Skipping packages layer image build because of --no-build flag.")
+		return nil
+	}
+
+	f.UI.Printf("Building packages layer image %s without docker ...\n", color.YellowString(packagesLayerImageName))
+
+	// As with tarballs, all packages go into the image; there is no docker
+	// daemon to figure out what we can keep
+	tarPopulator := packagesImageBuilder.NewDockerPopulator(instanceGroups, labels, true)
+	if _, err := layout.Build(packagesLayerImageName, tarPopulator); err != nil {
+		return fmt.Errorf("Error building packages layer image: %s", err.Error())
+	}
+
+	if archivePath != "" {
+		if err := layout.WriteDockerArchive(packagesLayerImageName, archivePath); err != nil {
+			return fmt.Errorf("Error writing packages layer image archive %s: %s", archivePath, err.Error())
+		}
+	}
+	f.UI.Println(color.GreenString("Done."))
+
+	return nil
+}
+
+// openImageLayout opens the image layout images are built into without docker,
+// and makes sure the stemcell image is in it. The stemcell is imported from
+// stemcellArchive, if given, which is either an image archive written by
+// `docker save` or an OCI image layout. It returns the stemcell image ID.
+func (f *Fissile) openImageLayout(layoutDir, stemcellImageName, stemcellArchive string) (*oci.Layout, string, error) {
+	layout, err := oci.OpenLayout(layoutDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if stemcellArchive != "" {
+		f.UI.Printf("Importing stemcell image %s from %s ...\n", color.YellowString(stemcellImageName), stemcellArchive)
+		stemcellImage, err := layout.Import(stemcellArchive, stemcellImageName)
+		if err != nil {
+			return nil, "", err
+		}
+		return layout, stemcellImage.ID(), nil
+	}
+
+	hasImage, err := layout.HasImage(stemcellImageName)
+	if err != nil {
+		return nil, "", err
+	}
+	if !hasImage {
+		return nil, "", fmt.Errorf("Failed to find stemcell image %s in %s. Use --stemcell-archive to import it", stemcellImageName, layoutDir)
+	}
+
+	stemcellImage, err := layout.Image(stemcellImageName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return layout, stemcellImage.ID(), nil
+}
+
 // GenerateRoleImages generates all role images using releases
-func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, repository, stemcellImageName, stemcellImageID, metricsPath string, noBuild, force bool, tagExtra string, instanceGroupNames []string, workerCount int, compiledPackagesPath, lightManifestPath, darkManifestPath, outputDirectory string, labels map[string]string) error {
+func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, repository, stemcellImageName, stemcellImageID, metricsPath string, noBuild, force bool, tagExtra string, instanceGroupNames []string, workerCount int, compiledPackagesPath string, lightManifestPaths []string, darkManifestPath, outputDirectory string, imageFormat builder.ImageFormat, stemcellArchive string, labels map[string]string) error {
 	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
 
+	if imageFormat == "" {
+		imageFormat = builder.ImageFormatContext
+	}
+	switch imageFormat {
+	case builder.ImageFormatContext:
+		if stemcellArchive != "" {
+			return fmt.Errorf("A stemcell archive is only used with the %s and %s image formats", builder.ImageFormatOCI, builder.ImageFormatDockerArchive)
+		}
+	case builder.ImageFormatOCI, builder.ImageFormatDockerArchive:
+		if outputDirectory == "" {
+			return fmt.Errorf("The %s image format requires an output directory", imageFormat)
+		}
+	default:
+		return fmt.Errorf("Invalid image format '%s', expected one of %s, %s, or %s", imageFormat, builder.ImageFormatContext, builder.ImageFormatOCI, builder.ImageFormatDockerArchive)
+	}
+
 	if metricsPath != "" {
 		stampy.Stamp(metricsPath, "fissile", "create-images", "start")
 		defer stampy.Stamp(metricsPath, "fissile", "create-images", "done")
 	}
 
-	opinions, err := model.NewOpinions(lightManifestPath, darkManifestPath)
+	opinions, err := model.NewOpinions(lightManifestPaths, darkManifestPath)
 	if err != nil {
 		return err
 	}
-	if errs := f.validateManifestAndOpinions(f.Manifest, opinions, nil); len(errs) != 0 {
+	if errs := f.validateManifestAndOpinions(f.Manifest, opinions, nil); errs.HasErrors() {
 		return fmt.Errorf(errs.Errors())
 	}
 
@@ -565,6 +927,27 @@ func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, reposit
 		}
 	}
 
+	// Without docker, images are built into an OCI image layout: the output
+	// directory itself, or one in the work dir to export image archives from
+	var layout *oci.Layout
+	var archiveDirectory string
+	if imageFormat != builder.ImageFormatContext {
+		layoutDir := outputDirectory
+		if imageFormat == builder.ImageFormatDockerArchive {
+			layoutDir = filepath.Join(targetPath, "oci-layout")
+			archiveDirectory = outputDirectory
+		}
+
+		var stemcellLayoutID string
+		layout, stemcellLayoutID, err = f.openImageLayout(layoutDir, stemcellImageName, stemcellArchive)
+		if err != nil {
+			return err
+		}
+		if stemcellImageID == "" {
+			stemcellImageID = stemcellLayoutID
+		}
+	}
+
 	packagesImageBuilder, err := builder.NewPackagesImageBuilder(
 		repository,
 		stemcellImageName,
@@ -585,6 +968,8 @@ func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, reposit
 
 	if outputDirectory == "" {
 		err = f.GeneratePackagesRoleImage(stemcellImageName, f.Manifest, noBuild, force, instanceGroups, packagesImageBuilder, labels)
+	} else if layout != nil {
+		err = f.GeneratePackagesRoleLayout(f.Manifest, noBuild, force, instanceGroups, layout, archiveDirectory, packagesImageBuilder, labels)
 	} else {
 		err = f.GeneratePackagesRoleTarball(stemcellImageName, f.Manifest, noBuild, force, instanceGroups, outputDirectory, packagesImageBuilder, labels)
 	}
@@ -601,7 +986,7 @@ func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, reposit
 		stemcellImageName,
 		compiledPackagesPath,
 		targetPath,
-		lightManifestPath,
+		lightManifestPaths,
 		darkManifestPath,
 		metricsPath,
 		tagExtra,
@@ -613,11 +998,167 @@ func (f *Fissile) GenerateRoleImages(targetPath, registry, organization, reposit
 		return err
 	}
 
-	return roleBuilder.BuildRoleImages(instanceGroups, registry, organization, repository, packagesLayerImageName, outputDirectory, force, noBuild, workerCount)
+	return roleBuilder.BuildRoleImages(instanceGroups, registry, organization, repository, packagesLayerImageName, outputDirectory, imageFormat, layout, force, noBuild, workerCount)
+}
+
+// PushRoleImages pushes the role images and the packages layer image built by
+// GenerateRoleImages to the registry, using the registry v2 API. Images built
+// by docker are exported from the daemon first. The digests of the pushed
+// images are added to the digest manifest, if one is given.
+func (f *Fissile) PushRoleImages(targetPath, dockerRegistry, organization, repository, username, password, stemcellImageName, stemcellImageID, tagExtra string, instanceGroupNames []string, compiledPackagesPath string, lightManifestPaths []string, darkManifestPath, outputDirectory string, imageFormat builder.ImageFormat, digestManifestPath string) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	if dockerRegistry == "" {
+		return fmt.Errorf("A docker registry is required to push images")
+	}
+
+	// Images are pushed from an image layout; those built by docker are
+	// exported into the one in the work dir
+	var dockerManager *docker.ImageManager
+	layoutDir := filepath.Join(targetPath, "oci-layout")
+	switch {
+	case outputDirectory == "":
+		var err error
+		dockerManager, err = docker.NewImageManager()
+		if err != nil {
+			return fmt.Errorf("Error connecting to docker: %s", err.Error())
+		}
+	case imageFormat == builder.ImageFormatOCI:
+		layoutDir = outputDirectory
+	case imageFormat == builder.ImageFormatDockerArchive:
+	default:
+		return fmt.Errorf("Images written as build contexts can not be pushed; use the %s or %s image format", builder.ImageFormatOCI, builder.ImageFormatDockerArchive)
+	}
+
+	layout, err := oci.OpenLayout(layoutDir)
+	if err != nil {
+		return err
+	}
+
+	if stemcellImageID == "" && dockerManager == nil {
+		stemcellImage, err := layout.Image(stemcellImageName)
+		if err != nil {
+			return err
+		}
+		stemcellImageID = stemcellImage.ID()
+	}
+
+	packagesImageBuilder, err := builder.NewPackagesImageBuilder(
+		repository,
+		stemcellImageName,
+		stemcellImageID,
+		compiledPackagesPath,
+		targetPath,
+		f.Version,
+		f.UI,
+	)
+	if err != nil {
+		return err
+	}
+
+	instanceGroups, err := f.Manifest.SelectInstanceGroups(instanceGroupNames)
+	if err != nil {
+		return err
+	}
+
+	opinions, err := model.NewOpinions(lightManifestPaths, darkManifestPath)
+	if err != nil {
+		return err
+	}
+
+	// Local names of the images to push, mapped to their name in the registry
+	packagesLayerImageName, err := packagesImageBuilder.GetPackagesLayerImageName(f.Manifest, instanceGroups, f)
+	if err != nil {
+		return err
+	}
+	localNames := []string{packagesLayerImageName}
+	remoteNames := map[string]string{
+		packagesLayerImageName: builder.GetRegistryImageName(dockerRegistry, organization, packagesLayerImageName),
+	}
+	for _, instanceGroup := range instanceGroups {
+		devVersion, err := instanceGroup.GetRoleDevVersion(opinions, tagExtra, f.Version, f)
+		if err != nil {
+			return err
+		}
+
+		localName := builder.GetRoleDevImageName("", "", repository, instanceGroup, devVersion)
+		if dockerManager != nil {
+			localName = builder.GetRoleDevImageName(dockerRegistry, organization, repository, instanceGroup, devVersion)
+		}
+		localNames = append(localNames, localName)
+		remoteNames[localName] = builder.GetRoleDevImageName(dockerRegistry, organization, repository, instanceGroup, devVersion)
+	}
+
+	client, err := registry.NewClient(dockerRegistry, username, password)
+	if err != nil {
+		return err
+	}
+
+	digests := registry.DigestManifest{}
+	if digestManifestPath != "" {
+		digests, err = registry.ReadDigestManifest(digestManifestPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, localName := range localNames {
+		if dockerManager != nil {
+			if err := exportDockerImage(dockerManager, layout, localName); err != nil {
+				return err
+			}
+		}
+
+		_, remoteRepository, tag, err := registry.SplitImageName(remoteNames[localName])
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("Pushing %s ...\n", color.YellowString(remoteNames[localName]))
+		result, err := client.PushImage(layout, localName, remoteRepository, tag)
+		if err != nil {
+			return fmt.Errorf("Error pushing %s: %s", remoteNames[localName], err.Error())
+		}
+		f.UI.Printf("%s@%s (%d blobs uploaded, %d already present)\n",
+			remoteNames[localName], color.GreenString(result.Digest), result.BlobsPushed, result.BlobsSkipped)
+
+		digests[remoteNames[localName]] = result.Digest
+	}
+
+	if digestManifestPath != "" {
+		if err := digests.Write(digestManifestPath); err != nil {
+			return fmt.Errorf("Error writing digest manifest %s: %s", digestManifestPath, err.Error())
+		}
+		f.UI.Printf("Image digests written to %s\n", color.YellowString(digestManifestPath))
+	}
+
+	return nil
+}
+
+// exportDockerImage copies an image from the docker daemon into the layout
+func exportDockerImage(dockerManager *docker.ImageManager, layout *oci.Layout, imageName string) error {
+	archive, err := ioutil.TempFile(layout.Dir(), "export-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := dockerManager.SaveImage(imageName, archive); err != nil {
+		return fmt.Errorf("Error exporting image %s from docker: %s", imageName, err.Error())
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	_, err = layout.Import(archive.Name(), imageName)
+	return err
 }
 
 // ListRoleImages lists all dev role images
-func (f *Fissile) ListRoleImages(registry, organization, repository, opinionsPath, darkOpinionsPath string, existingOnDocker, withVirtualSize bool, tagExtra string) error {
+func (f *Fissile) ListRoleImages(registry, organization, repository string, opinionsPaths []string, darkOpinionsPath string, existingOnDocker, withVirtualSize bool, tagExtra string) error {
 	if withVirtualSize && !existingOnDocker {
 		return fmt.Errorf("Cannot list image virtual sizes if not matching image names with docker")
 	}
@@ -636,7 +1177,7 @@ func (f *Fissile) ListRoleImages(registry, organization, repository, opinionsPat
 		}
 	}
 
-	opinions, err := model.NewOpinions(opinionsPath, darkOpinionsPath)
+	opinions, err := model.NewOpinions(opinionsPaths, darkOpinionsPath)
 	if err != nil {
 		return fmt.Errorf("Error loading opinions: %s", err.Error())
 	}
@@ -834,12 +1375,109 @@ func compareHashes(v1Hash, v2Hash keyHash) *HashDiffs {
 	return &HashDiffs{AddedKeys: added, DeletedKeys: deleted, ChangedValues: changed}
 }
 
+// ImageDigestsFromDocker is the image digest source reading the digests from
+// the docker daemon instead of a digest manifest
+const ImageDigestsFromDocker = "docker"
+
+// LoadImageDigests returns the digests of the role images named by the export
+// settings, for use as kube.ExportSettings.ImageDigests. They are read from
+// the digest manifest at source, as written when pushing images, or from the
+// repository digests known to the docker daemon if source is
+// ImageDigestsFromDocker. A warning is shown for each image docker has no
+// digest for.
+func (f *Fissile) LoadImageDigests(source string, settings kube.ExportSettings) (map[string]string, error) {
+	if source != ImageDigestsFromDocker {
+		digests, err := registry.ReadDigestManifest(source)
+		if err != nil {
+			return nil, err
+		}
+		return digests, nil
+	}
+
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return nil, fmt.Errorf("Releases not loaded")
+	}
+
+	dockerManager, err := docker.NewImageManager()
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to docker: %s", err.Error())
+	}
+
+	digests := map[string]string{}
+	for _, instanceGroup := range f.Manifest.InstanceGroups {
+		devVersion, err := instanceGroup.GetRoleDevVersion(settings.Opinions, settings.TagExtra, f.Version, f)
+		if err != nil {
+			return nil, err
+		}
+		imageName := builder.GetRoleDevImageName(settings.Registry, settings.Organization, settings.Repository, instanceGroup, devVersion)
+		repository := builder.GetRoleImageRepository(settings.Registry, settings.Organization, settings.Repository, instanceGroup)
+
+		image, err := dockerManager.FindImage(imageName)
+		if _, ok := err.(docker.ErrImageNotFound); ok {
+			f.UI.Println(color.YellowString("Warning: image %s not found, there is no digest for instance group %s", imageName, instanceGroup.Name))
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Error looking up image %s: %s", imageName, err.Error())
+		}
+
+		for _, repoDigest := range image.RepoDigests {
+			if strings.HasPrefix(repoDigest, repository+"@") {
+				digests[imageName] = strings.TrimPrefix(repoDigest, repository+"@")
+				break
+			}
+		}
+		if _, ok := digests[imageName]; !ok {
+			f.UI.Println(color.YellowString("Warning: image %s has not been pushed to %s, there is no digest for instance group %s", imageName, repository, instanceGroup.Name))
+		}
+	}
+
+	return digests, nil
+}
+
+// LoadChartMetadata fills the name, version and description of the chart
+// metadata which are not set from the Chart.yaml of an existing chart in the
+// output directory. Regenerating a chart then keeps its version, and with it
+// the name of the secret holding the generated secrets.
+func (f *Fissile) LoadChartMetadata(outputDir string, chart kube.ChartMetadata) (kube.ChartMetadata, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "Chart.yaml"))
+	if os.IsNotExist(err) {
+		return chart, nil
+	}
+	if err != nil {
+		return chart, fmt.Errorf("Error reading the existing chart: %s", err.Error())
+	}
+
+	var existing struct {
+		Name        string `yaml:"name"`
+		Version     string `yaml:"version"`
+		Description string `yaml:"description"`
+	}
+	if err := yaml.Unmarshal(contents, &existing); err != nil {
+		return chart, fmt.Errorf("Error parsing the existing chart: %s", err.Error())
+	}
+
+	if chart.Name == "" {
+		chart.Name = existing.Name
+	}
+	if chart.Version == "" {
+		chart.Version = existing.Version
+	}
+	if chart.Description == "" {
+		chart.Description = existing.Description
+	}
+	return chart, nil
+}
+
 // GenerateKube will create a set of configuration files suitable for deployment
 // on Kubernetes
 func (f *Fissile) GenerateKube(defaultFiles []string, settings kube.ExportSettings) error {
 	var err error
 	settings.RoleManifest = f.Manifest
 
+	if err := settings.CheckNameAffixes(); err != nil {
+		return err
+	}
+
 	if len(defaultFiles) > 0 {
 		f.UI.Println("Loading defaults from env files")
 		settings.Defaults, err = godotenv.Read(defaultFiles...)
@@ -890,9 +1528,175 @@ func (f *Fissile) GenerateKube(defaultFiles []string, settings kube.ExportSettin
 		if err != nil {
 			return err
 		}
+
+		schema, err := kube.MakeValuesSchema(settings)
+		if err != nil {
+			return err
+		}
+		err = f.writeJSON(settings.OutputDir, "values.schema.json", schema)
+		if err != nil {
+			return err
+		}
+
+		err = f.generateChart(settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = f.generateKubeRoles(settings)
+	if err != nil {
+		return err
+	}
+
+	if settings.CreateHelmChart {
+		return nil
+	}
+	return f.generateKubeBundle(settings)
+}
+
+// getKubeConfigPaths returns the paths of the generated kube configs, ordered
+// so that they can be applied at once: secrets and accounts first, then the
+// instance groups by flight stage, in role manifest order. Manual tasks are
+// left out.
+func getKubeConfigPaths(settings kube.ExportSettings) ([]string, error) {
+	var paths []string
+	for _, subDir := range []string{"secrets", "auth"} {
+		matches, err := filepath.Glob(filepath.Join(settings.OutputDir, subDir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+
+	for _, stage := range []model.FlightStage{model.FlightStagePreFlight, model.FlightStageFlight, model.FlightStagePostFlight} {
+		for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+			if instanceGroup.IsColocated() || instanceGroup.Run.FlightStage != stage {
+				continue
+			}
+			paths = append(paths, filepath.Join(settings.OutputDir, string(instanceGroup.Type), fmt.Sprintf("%s.yaml", instanceGroup.Name)))
+		}
+	}
+	return paths, nil
+}
+
+// generateKubeBundle concatenates the generated kube configs into a single
+// file, in the order returned by getKubeConfigPaths.
+func (f *Fissile) generateKubeBundle(settings kube.ExportSettings) error {
+	paths, err := getKubeConfigPaths(settings)
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(settings.OutputDir, "bundle.yaml")
+	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+
+	bundle := &bytes.Buffer{}
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading kube config %s: %s", path, err.Error())
+		}
+		bundle.Write(contents)
+		if len(contents) > 0 && contents[len(contents)-1] != '\n' {
+			bundle.WriteString("\n")
+		}
+	}
+
+	return ioutil.WriteFile(outputPath, bundle.Bytes(), 0644)
+}
+
+// GenerateKustomize will create a kustomize base in the base directory of
+// settings.OutputDir, with the same resources as GenerateKube. The config
+// vars are put into a config map and a secret generated by kustomize. An
+// overlay of the base is written to the overlays directory for each of the
+// overlay env files, named after the file.
+func (f *Fissile) GenerateKustomize(defaultFiles []string, overlayFiles []string, settings kube.ExportSettings) error {
+	var err error
+	settings.RoleManifest = f.Manifest
+	settings.CreateHelmChart = false
+	settings.Kustomize = true
+	outputDir := settings.OutputDir
+	settings.OutputDir = filepath.Join(outputDir, "base")
+
+	if err := settings.CheckNameAffixes(); err != nil {
+		return err
+	}
+
+	if len(defaultFiles) > 0 {
+		f.UI.Println("Loading defaults from env files")
+		settings.Defaults, err = godotenv.Read(defaultFiles...)
+		if err != nil {
+			return err
+		}
+	}
+
+	registryCredentials, err := kube.MakeRegistryCredentials(settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateSecrets("registry-secret.yaml", registryCredentials, settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateAuth(settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateKubeRoles(settings)
+	if err != nil {
+		return err
 	}
 
-	return f.generateKubeRoles(settings)
+	paths, err := getKubeConfigPaths(settings)
+	if err != nil {
+		return err
+	}
+	var resources []string
+	for _, path := range paths {
+		resource, err := filepath.Rel(settings.OutputDir, path)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, filepath.ToSlash(resource))
+	}
+
+	cvs := model.MakeMapOfVariables(settings.RoleManifest)
+	kustomization, err := kube.MakeKustomization(resources, cvs, settings)
+	if err != nil {
+		return err
+	}
+	err = f.writeHelmNode(settings.OutputDir, "kustomization.yaml", kustomization)
+	if err != nil {
+		return err
+	}
+
+	for _, overlayFile := range overlayFiles {
+		defaults, err := godotenv.Read(overlayFile)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(overlayFile), filepath.Ext(overlayFile))
+		overlayDir := filepath.Join(outputDir, "overlays", name)
+		err = os.MkdirAll(overlayDir, 0755)
+		if err != nil {
+			return err
+		}
+		overlay, err := kube.MakeKustomizeOverlay("../../base", cvs, defaults, settings)
+		if err != nil {
+			return fmt.Errorf("Error creating overlay %s: %s", name, err.Error())
+		}
+		err = f.writeHelmNode(overlayDir, "kustomization.yaml", overlay)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (f *Fissile) generateSecrets(fileName string, secrets helm.Node, settings kube.ExportSettings) error {
@@ -1006,6 +1810,54 @@ func (f *Fissile) writeHelmNode(dirName, fileName string, node helm.Node) error
 	return err
 }
 
+// generateChart writes Chart.yaml, and the helpers and notes templates
+// completing the Helm chart
+func (f *Fissile) generateChart(settings kube.ExportSettings) error {
+	chart, err := kube.MakeChart(settings)
+	if err != nil {
+		return err
+	}
+	err = f.writeHelmNode(settings.OutputDir, "Chart.yaml", chart)
+	if err != nil {
+		return err
+	}
+
+	templatesDir := filepath.Join(settings.OutputDir, "templates")
+	err = os.MkdirAll(templatesDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = f.writeText(templatesDir, "_helpers.tpl", kube.MakeHelpers(settings))
+	if err != nil {
+		return err
+	}
+
+	notes, err := kube.MakeNotes(settings)
+	if err != nil {
+		return err
+	}
+	return f.writeText(templatesDir, "NOTES.txt", notes)
+}
+
+func (f *Fissile) writeText(dirName, fileName, text string) error {
+	outputPath := filepath.Join(dirName, fileName)
+	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+
+	return ioutil.WriteFile(outputPath, []byte(text), 0644)
+}
+
+func (f *Fissile) writeJSON(dirName, fileName string, value interface{}) error {
+	outputPath := filepath.Join(dirName, fileName)
+	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %s", fileName, err.Error())
+	}
+	return ioutil.WriteFile(outputPath, append(contents, '\n'), 0644)
+}
+
 func (f *Fissile) generateBoshTaskRole(outputFile *os.File, instanceGroup *model.InstanceGroup, settings kube.ExportSettings) error {
 
 	var node helm.Node
@@ -1156,6 +2008,50 @@ func (f *Fissile) generateKubeRoles(settings kube.ExportSettings) error {
 					return err
 				}
 			}
+
+			pdb, err := kube.NewPodDisruptionBudget(instanceGroup, settings)
+			if err != nil {
+				return err
+			}
+			if pdb != nil {
+				err = enc.Encode(pdb)
+				if err != nil {
+					return err
+				}
+			}
+
+			hpa, err := kube.NewHorizontalPodAutoscaler(instanceGroup, statefulSet, settings)
+			if err != nil {
+				return err
+			}
+			if hpa != nil {
+				err = enc.Encode(hpa)
+				if err != nil {
+					return err
+				}
+			}
+
+			networkPolicy, err := kube.NewNetworkPolicy(instanceGroup, settings)
+			if err != nil {
+				return err
+			}
+			if networkPolicy != nil {
+				err = enc.Encode(networkPolicy)
+				if err != nil {
+					return err
+				}
+			}
+
+			ingress, err := kube.NewIngress(instanceGroup, settings)
+			if err != nil {
+				return err
+			}
+			if ingress != nil {
+				err = enc.Encode(ingress)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -1225,25 +2121,38 @@ func (f *Fissile) GraphEdge(fromNode, toNode string, attrs map[string]string) er
 	return nil
 }
 
-// Validate runs all checks against all inputs
-func (f *Fissile) Validate(lightManifestPath, darkManifestPath string, defaultFiles []string) error {
+// Validate runs all checks against all inputs. Problems found are returned
+// as a *ValidationError, including the warnings of the role manifest. In
+// strict mode warnings are errors.
+func (f *Fissile) Validate(lightManifestPaths []string, darkManifestPath string, defaultFiles []string, outputFormat OutputFormat, strict bool) error {
 	var defaultsFromEnvFiles map[string]string
 	var err error
 
 	if len(defaultFiles) > 0 {
-		f.UI.Println("Loading defaults from env files")
+		if outputFormat == OutputFormatHuman {
+			f.UI.Println("Loading defaults from env files")
+		}
 		defaultsFromEnvFiles, err = godotenv.Read(defaultFiles...)
 		if err != nil {
 			return err
 		}
 	}
 
-	opinions, err := model.NewOpinions(lightManifestPath, darkManifestPath)
+	opinions, err := model.NewOpinions(lightManifestPaths, darkManifestPath)
 	if err != nil {
 		return err
 	}
-	if errs := f.validateManifestAndOpinions(f.Manifest, opinions, defaultsFromEnvFiles); len(errs) != 0 {
-		return fmt.Errorf(errs.Errors())
+	errs := append(validation.ErrorList{}, f.Manifest.Warnings...)
+	errs = append(errs, f.validateManifestAndOpinions(f.Manifest, opinions, defaultsFromEnvFiles)...)
+	if len(errs) != 0 {
+		if strict {
+			errs.Strict()
+		}
+		// The errors of the env file variables are named after them
+		if envSource, err := validation.NewEnvSource(defaultFiles...); err == nil {
+			errs.Locate(envSource)
+		}
+		return &ValidationError{Errors: errs}
 	}
 
 	return nil
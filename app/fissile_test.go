@@ -1,6 +1,7 @@
 package app
 
 import (
+	"archive/tar"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -12,8 +13,11 @@ import (
 	"sync"
 	"testing"
 
+	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/kube"
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/oci"
+	"code.cloudfoundry.org/fissile/registry"
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"github.com/SUSE/termui"
 	"github.com/stretchr/testify/assert"
@@ -76,6 +80,189 @@ func TestListPackages(t *testing.T) {
 	}
 }
 
+func TestShowCompilationLog(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/app/no-instance-groups/no-instance-groups.yml")
+	releasePath := filepath.Join(workDir, "../test-assets/ntp-release")
+
+	compilationDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(compilationDir)
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{releasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err)
+
+	pkg := f.Manifest.LoadedReleases[0].Packages[0]
+
+	err = f.ShowCompilationLog(compilationDir, "", pkg.Name, OutputFormatHuman)
+	assert.Error(err, "Expected an error for a package which was never compiled")
+
+	err = f.ShowCompilationLog(compilationDir, "", "no-such-package", OutputFormatHuman)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "not found")
+	}
+
+	// Compilations on two stemcells
+	for _, log := range []struct{ stemcell, started, output string }{
+		{"old-stemcell", "2018-01-01T10:00:00Z", "old output\n"},
+		{"new-stemcell", "2018-02-01T10:00:00Z", "new output\n"},
+	} {
+		logDir := filepath.Join(compilationDir, log.stemcell+"-hash", pkg.Fingerprint)
+		require.NoError(t, os.MkdirAll(logDir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, "compilation.log"), []byte(log.output), 0644))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, "compilation.yml"), []byte(fmt.Sprintf(
+			"name: %s\nrelease: ntp\nfingerprint: %s\nstemcell: %s\nstarted: %s\nduration: 12.5\nexit_code: 0\n",
+			pkg.Name, pkg.Fingerprint, log.stemcell, log.started)), 0644))
+	}
+
+	output.Reset()
+	err = f.ShowCompilationLog(compilationDir, "", pkg.Release.Name+"/"+pkg.Name, OutputFormatYAML)
+	if assert.NoError(err) {
+		var result map[string]interface{}
+		assert.NoError(yaml.Unmarshal(output.Bytes(), &result))
+		assert.Equal("new-stemcell", result["stemcell"], "Expected the latest compilation")
+		assert.Equal("new output\n", result["output"])
+		assert.Equal(12.5, result["duration"])
+	}
+
+	output.Reset()
+	err = f.ShowCompilationLog(compilationDir, "old-stemcell", pkg.Name, OutputFormatJSON)
+	if assert.NoError(err) {
+		var result map[string]interface{}
+		assert.NoError(json.Unmarshal(output.Bytes(), &result))
+		assert.Equal("old-stemcell", result["stemcell"])
+		assert.Equal("old output\n", result["output"])
+		assert.Equal(float64(0), result["exit_code"])
+	}
+
+	err = f.ShowCompilationLog(compilationDir, "", "other-release/"+pkg.Name, OutputFormatHuman)
+	assert.Error(err, "Expected an error for a package in an unknown release")
+}
+
+func TestGenerateRoleImagesWithoutDocker(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// A stemcell image archive, as written by `docker save`
+	stemcellArchive := filepath.Join(tempDir, "stemcell.tar")
+	stemcellFile, err := os.Create(stemcellArchive)
+	require.NoError(t, err)
+	tarWriter := tar.NewWriter(stemcellFile)
+	for _, entry := range []struct{ name, contents string }{
+		{"config.json", `{"architecture":"amd64","os":"linux","config":{},"rootfs":{"type":"layers","diff_ids":[]}}`},
+		{"manifest.json", `[{"Config":"config.json","RepoTags":["ubuntu:14.04"],"Layers":[]}]`},
+	} {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.contents)), Typeflag: tar.TypeReg}
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(entry.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, stemcellFile.Close())
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	err = f.LoadManifest(
+		filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml"),
+		[]string{filepath.Join(workDir, "../test-assets/tor-boshrelease")},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err)
+
+	opinionsPath := filepath.Join(tempDir, "opinions.yml")
+	require.NoError(t, ioutil.WriteFile(opinionsPath, []byte("properties: {}\n"), 0644))
+
+	generate := func(outputDirectory string, imageFormat builder.ImageFormat, stemcellArchive string) error {
+		return f.GenerateRoleImages(
+			filepath.Join(tempDir, "dockerfiles"),
+			"",
+			"",
+			"fissile-test",
+			"ubuntu:14.04",
+			"",
+			"",
+			false,
+			true,
+			"",
+			nil,
+			2,
+			filepath.Join(workDir, "../test-assets/tor-boshrelease-fake-compiled"),
+			[]string{opinionsPath},
+			opinionsPath,
+			outputDirectory,
+			imageFormat,
+			stemcellArchive,
+			map[string]string{"label": "value"},
+		)
+	}
+
+	err = generate("", builder.ImageFormatOCI, "")
+	assert.Error(err, "Expected an error for the OCI image format without an output directory")
+
+	err = generate(filepath.Join(tempDir, "invalid"), builder.ImageFormat("invalid"), "")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Invalid image format")
+	}
+
+	ociDir := filepath.Join(tempDir, "oci")
+	err = generate(ociDir, builder.ImageFormatOCI, "")
+	if assert.Error(err, "Expected an error without a stemcell") {
+		assert.Contains(err.Error(), "--stemcell-archive")
+	}
+
+	err = generate(ociDir, builder.ImageFormatOCI, stemcellArchive)
+	require.NoError(t, err)
+
+	layout, err := oci.OpenLayout(ociDir)
+	require.NoError(t, err)
+	names, err := layout.ImageNames()
+	require.NoError(t, err)
+	require.Len(t, names, 4)
+	for i, prefix := range []string{"fissile-test-foorole:", "fissile-test-myrole:", "fissile-test-role-packages:", "ubuntu:14.04"} {
+		assert.True(strings.HasPrefix(names[i], prefix), "Expected image %s, got %s", prefix, names[i])
+	}
+
+	packagesImage, err := layout.Image(names[2])
+	require.NoError(t, err)
+	assert.Equal("value", packagesImage.Config.Config.Labels["label"])
+	assert.Len(packagesImage.Manifest.Layers, 1)
+
+	for _, name := range names[:2] {
+		image, err := layout.Image(name)
+		require.NoError(t, err)
+		assert.Equal(packagesImage.Manifest.Layers, image.Manifest.Layers[:1], "Role %s should build on the packages image", name)
+		assert.Len(image.Manifest.Layers, 2)
+		assert.Equal([]string{"/usr/bin/dumb-init", "/opt/fissile/run.sh"}, image.Config.Config.Entrypoint)
+	}
+
+	// Image archives; the stemcell was imported into the work dir
+	archiveDir := filepath.Join(tempDir, "archives")
+	err = generate(archiveDir, builder.ImageFormatDockerArchive, stemcellArchive)
+	require.NoError(t, err)
+	archives, err := filepath.Glob(filepath.Join(archiveDir, "*.tar"))
+	require.NoError(t, err)
+	assert.Len(archives, 3)
+	_, err = os.Stat(filepath.Join(tempDir, "dockerfiles", "oci-layout", "index.json"))
+	assert.NoError(err)
+}
+
 func TestListJobs(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 	assert := assert.New(t)
@@ -148,6 +335,37 @@ func TestListProperties(t *testing.T) {
 	}
 }
 
+func TestListOpinions(t *testing.T) {
+	out := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, out, nil)
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	lightOpinionsPaths := []string{
+		filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/test-opinions/overlay-opinions.yml"),
+	}
+	darkOpinionsPath := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
+
+	f := NewFissileApplication(".", ui)
+
+	err = f.ListOpinions(lightOpinionsPaths, darkOpinionsPath, "json")
+	if assert.NoError(err, "Expected ListOpinions to list the light opinions in JSON") {
+		var opinions map[string]map[string]string
+		assert.NoError(json.Unmarshal(out.Bytes(), &opinions))
+		assert.Equal(map[string]string{"value": "tor.example.com", "layer": lightOpinionsPaths[1]}, opinions["properties.tor.hostname"])
+		assert.Equal(map[string]string{"value": "31", "layer": lightOpinionsPaths[0]}, opinions["properties.tor.int_opinion"])
+	}
+
+	err = f.ListOpinions(lightOpinionsPaths, darkOpinionsPath, "human")
+	assert.NoError(err, "Expected ListOpinions to list the light opinions for human consumption")
+
+	err = f.ListOpinions(lightOpinionsPaths, darkOpinionsPath, "xml")
+	assert.Error(err, "Expected ListOpinions to reject unknown output formats")
+}
+
 var testSerializeInput struct {
 	releases []*model.Release
 	once     sync.Once
@@ -784,3 +1002,200 @@ func TestFissileGenerateKubeRoles(t *testing.T) {
 		assert.NoError(t, err, "Failed to find output %s", name)
 	}
 }
+
+func TestFissileGenerateKubeBundle(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/kube/jobs.yml")
+
+	f := NewFissileApplication(".", ui)
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{releasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err, "Failed to load release from %s", releasePath)
+
+	outDir, err := ioutil.TempDir("", "fissile-test-generate-kube-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "secrets"), 0755))
+	err = ioutil.WriteFile(filepath.Join(outDir, "secrets", "secrets.yaml"), []byte("---\nkind: Secret\n"), 0644)
+	require.NoError(t, err)
+
+	settings := kube.ExportSettings{
+		OutputDir:    outDir,
+		RoleManifest: f.Manifest,
+		Opinions:     model.NewEmptyOpinions(),
+	}
+	require.NoError(t, f.generateKubeRoles(settings))
+	require.NoError(t, f.generateKubeBundle(settings))
+
+	contents, err := ioutil.ReadFile(filepath.Join(outDir, "bundle.yaml"))
+	require.NoError(t, err)
+	bundle := string(contents)
+
+	previous := -1
+	for _, expected := range []string{
+		"kind: Secret",
+		`name: "pre-role"`,
+		`name: "migrate-role"`,
+		`name: "main-role"`,
+		`name: "post-role"`,
+	} {
+		index := strings.Index(bundle, expected)
+		if assert.True(t, index > previous, "Expected %s after the previous configs", expected) {
+			previous = index
+		}
+	}
+}
+
+func TestFissileGenerateKustomize(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/kube/jobs.yml")
+
+	f := NewFissileApplication(".", ui)
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{releasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err, "Failed to load release from %s", releasePath)
+
+	outDir, err := ioutil.TempDir("", "fissile-test-generate-kustomize")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	overlayFile := filepath.Join(outDir, "staging.env")
+	err = ioutil.WriteFile(overlayFile, []byte("KUBERNETES_CLUSTER_DOMAIN=staging.local\n"), 0644)
+	require.NoError(t, err)
+
+	settings := kube.ExportSettings{
+		OutputDir: outDir,
+		Opinions:  model.NewEmptyOpinions(),
+	}
+	require.NoError(t, f.GenerateKustomize(nil, []string{overlayFile}, settings))
+
+	contents, err := ioutil.ReadFile(filepath.Join(outDir, "base", "kustomization.yaml"))
+	require.NoError(t, err)
+	var kustomization struct {
+		Resources []string `yaml:"resources"`
+	}
+	require.NoError(t, yaml.Unmarshal(contents, &kustomization))
+	assert.Equal(t, []string{
+		"secrets/registry-secret.yaml",
+		"auth/account-default.yaml",
+		"auth/auth-clusterrole-nonprivileged.yaml",
+		"bosh-task/pre-role.yaml",
+		"bosh-task/migrate-role.yaml",
+		"bosh/main-role.yaml",
+		"bosh-task/post-role.yaml",
+	}, kustomization.Resources)
+	for _, resource := range kustomization.Resources {
+		assert.FileExists(t, filepath.Join(outDir, "base", resource))
+	}
+	_, err = os.Stat(filepath.Join(outDir, "base", "secrets", "secrets.yaml"))
+	assert.True(t, os.IsNotExist(err), "The secrets are generated by kustomize")
+
+	contents, err = ioutil.ReadFile(filepath.Join(outDir, "overlays", "staging", "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "../../base")
+	assert.Contains(t, string(contents), "KUBERNETES_CLUSTER_DOMAIN=staging.local")
+}
+
+func TestFissileGenerateKubeRolesWithImageDigests(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+
+	f := NewFissileApplication(".", ui)
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{releasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err, "Failed to load release from %s", releasePath)
+
+	outDir, err := ioutil.TempDir("", "fissile-test-generate-kube-roles")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	settings := kube.ExportSettings{
+		OutputDir:      outDir,
+		RoleManifest:   f.Manifest,
+		Registry:       "registry.example.com",
+		Organization:   "org",
+		Repository:     "repo",
+		Opinions:       model.NewEmptyOpinions(),
+		FissileVersion: f.Version,
+	}
+
+	digests := registry.DigestManifest{}
+	for _, instanceGroup := range f.Manifest.InstanceGroups {
+		devVersion, err := instanceGroup.GetRoleDevVersion(settings.Opinions, "", f.Version, nil)
+		require.NoError(t, err)
+		imageName := builder.GetRoleDevImageName(settings.Registry, settings.Organization, settings.Repository, instanceGroup, devVersion)
+		digests[imageName] = "sha256:" + strings.Repeat(instanceGroup.Name[:1], 64)
+	}
+	digestManifestPath := filepath.Join(outDir, "image-digests.yml")
+	require.NoError(t, digests.Write(digestManifestPath))
+
+	settings.ImageDigests, err = f.LoadImageDigests(digestManifestPath, settings)
+	require.NoError(t, err)
+	assert.Len(t, settings.ImageDigests, len(f.Manifest.InstanceGroups))
+
+	err = f.generateKubeRoles(settings)
+	require.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(outDir, "bosh", "myrole-deployment.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), `image: "registry.example.com/org/repo-myrole-deployment@sha256:`+strings.Repeat("m", 64)+`"`)
+}
+
+func TestLoadChartMetadata(t *testing.T) {
+	t.Parallel()
+
+	outputDir, err := ioutil.TempDir("", "fissile-chart")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	f := NewFissileApplication("1.0", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+
+	chart, err := f.LoadChartMetadata(outputDir, kube.ChartMetadata{AppVersion: "2.0"})
+	require.NoError(t, err)
+	assert.Equal(t, kube.ChartMetadata{AppVersion: "2.0"}, chart, "Without a chart nothing is set")
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputDir, "Chart.yaml"), []byte(`apiVersion: v1
+name: mychart
+version: 1.2.3
+appVersion: "1.0"
+description: My chart
+`), 0644))
+
+	chart, err = f.LoadChartMetadata(outputDir, kube.ChartMetadata{AppVersion: "2.0"})
+	require.NoError(t, err)
+	assert.Equal(t, kube.ChartMetadata{Name: "mychart", Version: "1.2.3", AppVersion: "2.0", Description: "My chart"}, chart)
+
+	chart, err = f.LoadChartMetadata(outputDir, kube.ChartMetadata{Name: "other", Version: "2.0.0"})
+	require.NoError(t, err)
+	assert.Equal(t, kube.ChartMetadata{Name: "other", Version: "2.0.0", Description: "My chart"}, chart, "Flags override the existing chart")
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputDir, "Chart.yaml"), []byte("name: [\n"), 0644))
+	_, err = f.LoadChartMetadata(outputDir, kube.ChartMetadata{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Error parsing the existing chart")
+}
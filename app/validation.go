@@ -8,6 +8,27 @@ import (
 	"code.cloudfoundry.org/fissile/validation"
 )
 
+// The rules checked by the validation of the opinions and env files, as
+// reported and suppressed by their IDs
+var (
+	ruleUndefinedManifestProperty = validation.Rule{ID: "undefined-manifest-property", Severity: validation.SeverityError}
+	ruleUndefinedLightOpinion     = validation.Rule{ID: "undefined-light-opinion", Severity: validation.SeverityError}
+	ruleUndefinedDarkOpinion      = validation.Rule{ID: "undefined-dark-opinion", Severity: validation.SeverityError}
+	ruleUntemplatedDarkOpinion    = validation.Rule{ID: "untemplated-dark-opinion", Severity: validation.SeverityError}
+	ruleDarkOpinionInLight        = validation.Rule{ID: "dark-opinion-in-light", Severity: validation.SeverityError}
+	ruleManifestLightDuplicate    = validation.Rule{ID: "manifest-light-duplicate", Severity: validation.SeverityWarning}
+	ruleUndefinedEnvVariable      = validation.Rule{ID: "undefined-env-variable", Severity: validation.SeverityError}
+	ruleLightOpinionDefault       = validation.Rule{ID: "light-opinion-default", Severity: validation.SeverityWarning}
+)
+
+// opinionRules are the rules checked by the validation of the opinions
+var opinionRules = []validation.Rule{
+	ruleUndefinedManifestProperty, ruleUndefinedLightOpinion,
+	ruleUndefinedDarkOpinion, ruleUntemplatedDarkOpinion,
+	ruleDarkOpinionInLight, ruleManifestLightDuplicate,
+	ruleUndefinedEnvVariable, ruleLightOpinionDefault,
+}
+
 // validateManifestAndOpinions applies a series of checks to the role
 // manifest and opinions, testing for consistency against each other
 // and the loaded bosh releases. The result is a (possibly empty)
@@ -20,38 +41,103 @@ func (f *Fissile) validateManifestAndOpinions(roleManifest *model.RoleManifest,
 	lightOpinions := model.FlattenOpinions(opinions.Light, false)
 	manifestProperties := collectManifestProperties(roleManifest)
 
+	// Only warnings and infos can be suppressed
+	allErrs = append(allErrs, locate(validation.ValidateSuppressedRules(roleManifest.Validation.Suppressions,
+		"validation.suppressions", opinionRules).WithRule(validation.RuleSuppressions), roleManifest)...)
+
 	// All properties must be defined in a BOSH release
-	allErrs = append(allErrs, checkForUndefinedBOSHProperties("role-manifest",
-		manifestProperties, boshPropertyDefaultsAndJobs)...)
+	allErrs = append(allErrs, locate(checkForUndefinedBOSHProperties("role-manifest",
+		manifestProperties, boshPropertyDefaultsAndJobs).WithRule(ruleUndefinedManifestProperty),
+		manifestPropertyLocator(roleManifest))...)
 
 	// All light opinions must exists in a bosh release
-	allErrs = append(allErrs, checkForUndefinedBOSHProperties("light opinion",
-		lightOpinions, boshPropertyDefaultsAndJobs)...)
+	allErrs = append(allErrs, locate(checkForUndefinedBOSHProperties("light opinion",
+		lightOpinions, boshPropertyDefaultsAndJobs).WithRule(ruleUndefinedLightOpinion),
+		opinionLocator(validation.LocatorFunc(opinions.LocateLight)))...)
 
 	// All dark opinions must exists in a bosh release
-	allErrs = append(allErrs, checkForUndefinedBOSHProperties("dark opinion",
-		darkOpinions, boshPropertyDefaultsAndJobs)...)
+	allErrs = append(allErrs, locate(checkForUndefinedBOSHProperties("dark opinion",
+		darkOpinions, boshPropertyDefaultsAndJobs).WithRule(ruleUndefinedDarkOpinion),
+		opinionLocator(opinions.DarkSource))...)
 
 	// All dark opinions must be configured as templates
-	allErrs = append(allErrs, checkForUntemplatedDarkOpinions(darkOpinions,
-		manifestProperties)...)
+	allErrs = append(allErrs, locate(checkForUntemplatedDarkOpinions(darkOpinions,
+		manifestProperties).WithRule(ruleUntemplatedDarkOpinion), opinions.DarkSource)...)
 
 	// No dark opinions must have defaults in light opinions
-	allErrs = append(allErrs, checkForDarkInTheLight(darkOpinions, lightOpinions)...)
+	allErrs = append(allErrs, locate(checkForDarkInTheLight(darkOpinions, lightOpinions).WithRule(ruleDarkOpinionInLight),
+		validation.LocatorFunc(opinions.LocateLight))...)
 
 	// No duplicates must exist between role manifest and light
 	// opinions
-	allErrs = append(allErrs, checkForDuplicatesBetweenManifestAndLight(lightOpinions, roleManifest)...)
+	allErrs = append(allErrs, locate(checkForDuplicatesBetweenManifestAndLight(lightOpinions, roleManifest).WithRule(ruleManifestLightDuplicate),
+		roleManifest)...)
 
 	// All vars in env files must exist in the role manifest
-	allErrs = append(allErrs, f.checkEnvFileVariables(roleManifest, defaultsFromEnvFiles)...)
+	allErrs = append(allErrs, f.checkEnvFileVariables(roleManifest, defaultsFromEnvFiles).WithRule(ruleUndefinedEnvVariable)...)
 
 	// All light opinions should differ from their defaults in the
 	// BOSH releases
-	allErrs = append(allErrs, f.checkLightDefaults(lightOpinions,
-		boshPropertyDefaultsAndJobs)...)
+	allErrs = append(allErrs, locate(f.checkLightDefaults(lightOpinions,
+		boshPropertyDefaultsAndJobs).WithRule(ruleLightOpinionDefault), validation.LocatorFunc(opinions.LocateLight))...)
 
-	return allErrs
+	return allErrs.Suppress(roleManifest.Validation.Suppressions)
+}
+
+// locate sets the positions of the errors found by a check, as the fields
+// of the different checks refer to different files.
+func locate(errs validation.ErrorList, locator validation.Locator) validation.ErrorList {
+	errs.Locate(locator)
+	return errs
+}
+
+// opinionLocator locates the properties named in the errors of
+// checkForUndefinedBOSHProperties in the opinions files
+func opinionLocator(source validation.Locator) validation.Locator {
+	return validation.LocatorFunc(func(field string) *validation.Position {
+		return source.Locate("properties." + undefinedPropertyName(field))
+	})
+}
+
+// manifestPropertyLocator locates the properties named in the errors of
+// checkForUndefinedBOSHProperties in the global, or else the first
+// per-instance-group, templates of the role manifest
+func manifestPropertyLocator(roleManifest *model.RoleManifest) validation.Locator {
+	return validation.LocatorFunc(func(field string) *validation.Position {
+		property := "properties." + undefinedPropertyName(field)
+		template := fmt.Sprintf("configuration.templates[%s]", property)
+		if hasTemplate(roleManifest.Configuration, property) {
+			return roleManifest.Locate(template)
+		}
+		for _, instanceGroup := range roleManifest.InstanceGroups {
+			if hasTemplate(instanceGroup.Configuration, property) {
+				return roleManifest.Locate(fmt.Sprintf("instance_groups[%s].%s", instanceGroup.Name, template))
+			}
+		}
+		return nil
+	})
+}
+
+func hasTemplate(configuration *model.Configuration, property string) bool {
+	if configuration == nil {
+		return false
+	}
+	for _, templateDef := range configuration.Templates {
+		if templateDef.Key == property {
+			return true
+		}
+	}
+	return false
+}
+
+// undefinedPropertyName returns the name of the property in a field of
+// checkForUndefinedBOSHProperties, like `light opinion 'tor.hostname'`
+func undefinedPropertyName(field string) string {
+	start := strings.Index(field, "'")
+	if start < 0 || !strings.HasSuffix(field, "'") {
+		return field
+	}
+	return field[start+1 : len(field)-1]
 }
 
 // Check that the given 'properties' are all defined in a 'bosh'
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FixValidation rewrites the role manifest and opinion files in place to fix
+// the validation errors which have a single obvious fix, keeping comments and
+// the order of everything else. These are the sorting of variables and
+// templates, light opinions duplicated by global templates (in all the
+// layers setting them), and undefined dark opinions. The changes are shown
+// as a diff for human output. It returns the paths of the changed files, for
+// the other output formats to report.
+func (f *Fissile) FixValidation(err error, roleManifestPath string, lightManifestPaths []string, darkManifestPath string, outputFormat OutputFormat) ([]string, error) {
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		return nil, nil
+	}
+
+	editors := map[string]*validation.YAMLEditor{}
+	var paths []string
+	fix := func(path string, change func(*validation.YAMLEditor) error) error {
+		editor, ok := editors[path]
+		if !ok {
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			editor, err = validation.NewYAMLEditor(path, contents)
+			if err != nil {
+				return err
+			}
+			editors[path] = editor
+			paths = append(paths, path)
+		}
+		return change(editor)
+	}
+
+	sorted := map[string]bool{}
+	for _, item := range validationErr.Errors {
+		var err error
+		switch item.Rule {
+		case model.RuleVariableSorting.ID:
+			if !sorted[item.Rule] {
+				err = fix(roleManifestPath, func(editor *validation.YAMLEditor) error {
+					return editor.SortSequence("variables", "name")
+				})
+			}
+			sorted[item.Rule] = true
+		case model.RuleTemplateSorting.ID:
+			if !sorted[item.Rule] {
+				err = fix(roleManifestPath, func(editor *validation.YAMLEditor) error {
+					return editor.SortMapping("configuration.templates")
+				})
+			}
+			sorted[item.Rule] = true
+		case ruleManifestLightDuplicate.ID:
+			// Only global templates replace the light opinion everywhere
+			prefix := "configuration.templates["
+			if strings.HasPrefix(item.Field, prefix) {
+				property := strings.TrimSuffix(strings.TrimPrefix(item.Field, prefix), "]")
+				for _, lightManifestPath := range lightManifestPaths {
+					err = fix(lightManifestPath, func(editor *validation.YAMLEditor) error {
+						if !editor.Has(property) {
+							return nil
+						}
+						return editor.Remove(property)
+					})
+					if err != nil {
+						break
+					}
+				}
+			}
+		case ruleUndefinedDarkOpinion.ID:
+			err = fix(darkManifestPath, func(editor *validation.YAMLEditor) error {
+				return editor.Remove("properties." + undefinedPropertyName(item.Field))
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error fixing %s: %s", item.Field, err.Error())
+		}
+	}
+
+	var changed []string
+	for _, path := range paths {
+		original, err := ioutil.ReadFile(path)
+		if err != nil {
+			return changed, err
+		}
+		contents := editors[path].Contents()
+		if string(contents) == string(original) {
+			continue
+		}
+
+		if outputFormat == OutputFormatHuman {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(original)),
+				B:        difflib.SplitLines(string(contents)),
+				FromFile: path,
+				ToFile:   path,
+				Context:  3,
+			})
+			if err != nil {
+				return changed, fmt.Errorf("Error showing the changes of %s: %s", path, err.Error())
+			}
+			f.UI.Println(color.CyanString("Fixing %s", path))
+			f.UI.Printf("%s", diff)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return changed, err
+		}
+		if err := ioutil.WriteFile(path, contents, info.Mode()); err != nil {
+			return changed, fmt.Errorf("Error writing %s: %s", path, err.Error())
+		}
+		changed = append(changed, path)
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-validation-fix")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	roleManifestPath := filepath.Join(dir, "role-manifest.yml")
+	lightManifestPath := filepath.Join(dir, "opinions.yml")
+	darkManifestPath := filepath.Join(dir, "dark-opinions.yml")
+	require.NoError(t, ioutil.WriteFile(roleManifestPath, []byte(`variables:
+- name: PORT # The port
+- name: DOMAIN
+configuration:
+  templates:
+    properties.tor.port: ((PORT))
+    properties.tor.hostname: ((DOMAIN))
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(lightManifestPath, []byte(`properties:
+  tor:
+    hostname: example.com
+    client_keys: []
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(darkManifestPath, []byte(`# Secrets
+properties:
+  tor:
+    private_key: ~
+`), 0644))
+
+	err = &ValidationError{Errors: validation.ErrorList{
+		validation.Invalid("variables", "PORT", "Does not sort before 'DOMAIN'").WithRule(model.RuleVariableSorting),
+		validation.Forbidden("properties.tor.port", "Template key does not sort before 'properties.tor.hostname'").WithRule(model.RuleTemplateSorting),
+		validation.Forbidden("configuration.templates[properties.tor.hostname]", "Role-manifest overrides opinion, remove opinion").WithRule(ruleManifestLightDuplicate),
+		validation.Forbidden("instance-groups[main].configuration.templates[properties.tor.client_keys]", "Role-manifest duplicates opinion, remove from manifest").WithRule(ruleManifestLightDuplicate),
+		validation.NotFound("dark opinion 'tor.private_key'", "In any BOSH release").WithRule(ruleUndefinedDarkOpinion),
+	}}
+
+	out := &bytes.Buffer{}
+	f := NewFissileApplication("1.0", termui.New(&bytes.Buffer{}, out, nil))
+	fixed, err := f.FixValidation(err, roleManifestPath, []string{lightManifestPath}, darkManifestPath, OutputFormatHuman)
+	require.NoError(t, err)
+	assert.Equal(t, []string{roleManifestPath, lightManifestPath, darkManifestPath}, fixed)
+
+	contents, err := ioutil.ReadFile(roleManifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, `variables:
+- name: DOMAIN
+- name: PORT # The port
+configuration:
+  templates:
+    properties.tor.hostname: ((DOMAIN))
+    properties.tor.port: ((PORT))
+`, string(contents))
+
+	contents, err = ioutil.ReadFile(lightManifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, "properties:\n  tor:\n    client_keys: []\n", string(contents), "Only opinions duplicated by global templates are removed")
+
+	contents, err = ioutil.ReadFile(darkManifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# Secrets\nproperties: {}\n", string(contents))
+
+	assert.Contains(t, out.String(), "-    hostname: example.com\n")
+	assert.Contains(t, out.String(), "+- name: DOMAIN\n")
+
+	out.Reset()
+	fixed, err = f.FixValidation(nil, roleManifestPath, []string{lightManifestPath}, darkManifestPath, OutputFormatHuman)
+	assert.NoError(t, err)
+	assert.Empty(t, fixed)
+	assert.Empty(t, out.String())
+
+	// Only the files are reported for the other output formats
+	require.NoError(t, ioutil.WriteFile(roleManifestPath, []byte("variables:\n- name: PORT\n- name: DOMAIN\n"), 0644))
+	err = &ValidationError{Errors: validation.ErrorList{
+		validation.Invalid("variables", "PORT", "Does not sort before 'DOMAIN'").WithRule(model.RuleVariableSorting),
+	}}
+	fixed, err = f.FixValidation(err, roleManifestPath, []string{lightManifestPath}, darkManifestPath, OutputFormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{roleManifestPath}, fixed)
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v2"
+)
+
+// ValidationError is returned when the role manifest, opinions or env files
+// are invalid, as opposed to errors preventing their validation. It may hold
+// only warnings, which don't fail the validation.
+type ValidationError struct {
+	Context string // Prefixed to the message, if set
+	Errors  validation.ErrorList
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	if e.Context == "" {
+		return e.Errors.Errors()
+	}
+	return fmt.Sprintf("%s: %s", e.Context, e.Errors.Errors())
+}
+
+// validationReport is the machine-readable form of the validation errors
+type validationReport struct {
+	Valid  bool                    `json:"valid" yaml:"valid"`
+	Errors []validationReportError `json:"errors" yaml:"errors"`
+	Fixed  []string                `json:"fixed,omitempty" yaml:"fixed,omitempty"`
+}
+
+type validationReportError struct {
+	Rule     string                    `json:"rule,omitempty" yaml:"rule,omitempty"`
+	Severity validation.Severity       `json:"severity" yaml:"severity"`
+	Type     validation.ErrorType      `json:"type" yaml:"type"`
+	Field    string                    `json:"field" yaml:"field"`
+	BadValue interface{}               `json:"badValue,omitempty" yaml:"badValue,omitempty"`
+	Detail   string                    `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Message  string                    `json:"message" yaml:"message"`
+	Position *validationReportPosition `json:"position,omitempty" yaml:"position,omitempty"`
+}
+
+type validationReportPosition struct {
+	File   string `json:"file" yaml:"file"`
+	Line   int    `json:"line" yaml:"line"`
+	Column int    `json:"column" yaml:"column"`
+}
+
+// ReportValidation writes the validation errors in the given output format,
+// and returns the error for the exit code, which is nil if there are only
+// warnings. Human readable errors are left to the caller printing the
+// error, and errors other than validation errors are returned as they are.
+// The files changed by FixValidation are listed in the machine readable
+// reports, as only human output shows the changes.
+func (f *Fissile) ReportValidation(err error, fixedPaths []string, outputFormat OutputFormat) error {
+	switch outputFormat {
+	case OutputFormatHuman, OutputFormatJSON, OutputFormatYAML, OutputFormatSARIF:
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, yaml, or sarif", outputFormat)
+	}
+
+	var errs validation.ErrorList
+	if err != nil {
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		errs = validationErr.Errors
+	}
+	if !errs.HasErrors() {
+		err = nil
+	}
+
+	if outputFormat == OutputFormatHuman {
+		if err == nil {
+			for _, item := range errs {
+				f.UI.Println(color.YellowString("%s", item.Error()))
+			}
+		}
+		return err
+	}
+
+	var buf []byte
+	var marshalErr error
+	switch outputFormat {
+	case OutputFormatJSON:
+		buf, marshalErr = json.MarshalIndent(newValidationReport(errs, fixedPaths), "", "  ")
+	case OutputFormatYAML:
+		buf, marshalErr = yaml.Marshal(newValidationReport(errs, fixedPaths))
+	case OutputFormatSARIF:
+		buf, marshalErr = json.MarshalIndent(newSARIFReport(errs, fixedPaths, f.Version), "", "  ")
+	}
+	if marshalErr != nil {
+		return fmt.Errorf("Error writing the validation report: %s", marshalErr.Error())
+	}
+
+	f.UI.Printf("%s\n", buf)
+	return err
+}
+
+func newValidationReport(errs validation.ErrorList, fixedPaths []string) validationReport {
+	report := validationReport{
+		Valid:  !errs.HasErrors(),
+		Errors: []validationReportError{},
+		Fixed:  fixedPaths,
+	}
+	for _, item := range errs {
+		reportError := validationReportError{
+			Rule:     item.Rule,
+			Severity: severity(item),
+			Type:     item.Type,
+			Field:    item.Field,
+			Detail:   item.Detail,
+			Message:  item.ErrorBody(),
+		}
+		switch item.Type {
+		case validation.ErrorTypeRequired, validation.ErrorTypeForbidden, validation.ErrorTypeTooLong, validation.ErrorTypeInternal:
+			// Like the message, leave out values which are not given or not shown
+		default:
+			reportError.BadValue = reportValue(item.BadValue)
+		}
+		if item.Position != nil {
+			reportError.Position = &validationReportPosition{
+				File:   item.Position.File,
+				Line:   item.Position.Line,
+				Column: item.Position.Column,
+			}
+		}
+		report.Errors = append(report.Errors, reportError)
+	}
+	return report
+}
+
+// severity returns the severity of an error, which defaults to error
+func severity(item *validation.Error) validation.Severity {
+	if item.Severity == "" {
+		return validation.SeverityError
+	}
+	return item.Severity
+}
+
+// reportValue converts a bad value into plain data, the way it is shown in
+// the error messages
+func reportValue(value interface{}) interface{} {
+	buf, err := util.JSONMarshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	var result interface{}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return result
+}
+
+// The subset of SARIF 2.1.0 used to report validation errors, as read by
+// code scanning tools to annotate the lines of the files
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool      sarifTool       `json:"tool"`
+	Artifacts []sarifArtifact `json:"artifacts,omitempty"`
+	Results   []sarifResult   `json:"results"`
+}
+
+// sarifArtifact is a file of the run, listed for the files changed by the
+// fixes
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+	Roles    []string              `json:"roles"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+func newSARIFReport(errs validation.ErrorList, fixedPaths []string, version string) sarifReport {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "fissile",
+			Version:        version,
+			InformationURI: "https://github.com/cloudfoundry-incubator/fissile",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	for _, path := range fixedPaths {
+		run.Artifacts = append(run.Artifacts, sarifArtifact{
+			Location: sarifArtifactLocation{URI: sarifURI(path)},
+			Roles:    []string{"modified"},
+		})
+	}
+
+	rules := map[string]bool{}
+	for _, item := range errs {
+		level := "error"
+		switch severity(item) {
+		case validation.SeverityWarning:
+			level = "warning"
+		case validation.SeverityInfo:
+			level = "note"
+		}
+		result := sarifResult{
+			RuleID:  item.Rule,
+			Level:   level,
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", item.Field, item.ErrorBody())},
+		}
+		if item.Position != nil {
+			result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: sarifURI(item.Position.File)},
+				Region:           sarifRegion{StartLine: item.Position.Line, StartColumn: item.Position.Column},
+			}}}
+		}
+		if item.Rule != "" {
+			rules[item.Rule] = true
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	var ruleIDs []string
+	for rule := range rules {
+		ruleIDs = append(ruleIDs, rule)
+	}
+	sort.Strings(ruleIDs)
+	for _, rule := range ruleIDs {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule})
+	}
+
+	return sarifReport{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}
+}
+
+// sarifURI returns the path of a file relative to the working directory, as
+// code scanning tools expect paths relative to the checked out repository
+func sarifURI(path string) string {
+	if workDir, err := os.Getwd(); err == nil && filepath.IsAbs(path) {
+		if relative, err := filepath.Rel(workDir, path); err == nil {
+			path = relative
+		}
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validationReportTestErrors() validation.ErrorList {
+	located := validation.Invalid("instance_groups[api].run.memory", -1, "must be positive").WithRule(validation.Rule{ID: "memory"})
+	located.Position = &validation.Position{File: "role-manifest.yml", Line: 10, Column: 11}
+	return validation.ErrorList{
+		located,
+		validation.Required("variables", ""),
+	}
+}
+
+func TestReportValidationJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	f := NewFissileApplication("1.0", termui.New(&bytes.Buffer{}, out, nil))
+
+	err := &ValidationError{Errors: validationReportTestErrors()}
+	assert.Equal(t, err, f.ReportValidation(err, nil, OutputFormatJSON))
+
+	var report map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, false, report["valid"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"rule":     "memory",
+			"severity": "error",
+			"type":     "FieldValueInvalid",
+			"field":    "instance_groups[api].run.memory",
+			"badValue": -1.,
+			"detail":   "must be positive",
+			"message":  "Invalid value: -1: must be positive",
+			"position": map[string]interface{}{"file": "role-manifest.yml", "line": 10., "column": 11.},
+		},
+		map[string]interface{}{
+			"severity": "error",
+			"type":     "FieldValueRequired",
+			"field":    "variables",
+			"message":  "Required value",
+		},
+	}, report["errors"])
+}
+
+func TestReportValidationSARIF(t *testing.T) {
+	out := &bytes.Buffer{}
+	f := NewFissileApplication("1.0", termui.New(&bytes.Buffer{}, out, nil))
+
+	err := &ValidationError{Errors: validationReportTestErrors()}
+	assert.Equal(t, err, f.ReportValidation(err, nil, OutputFormatSARIF))
+
+	var report sarifReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Runs, 1)
+	assert.Equal(t, "1.0", report.Runs[0].Tool.Driver.Version)
+	assert.Equal(t, []sarifRule{{ID: "memory"}}, report.Runs[0].Tool.Driver.Rules)
+	require.Len(t, report.Runs[0].Results, 2)
+	assert.Equal(t, sarifResult{
+		RuleID:  "memory",
+		Level:   "error",
+		Message: sarifMessage{Text: "instance_groups[api].run.memory: Invalid value: -1: must be positive"},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: "role-manifest.yml"},
+			Region:           sarifRegion{StartLine: 10, StartColumn: 11},
+		}}},
+	}, report.Runs[0].Results[0])
+	assert.Empty(t, report.Runs[0].Results[1].Locations)
+}
+
+func TestReportValidationFailures(t *testing.T) {
+	out := &bytes.Buffer{}
+	f := NewFissileApplication("1.0", termui.New(&bytes.Buffer{}, out, nil))
+
+	t.Run("Valid", func(t *testing.T) {
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(nil, nil, OutputFormatYAML))
+		assert.Equal(t, "valid: true\nerrors: []\n\n", out.String())
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		err := &ValidationError{Errors: validation.ErrorList{
+			validation.Invalid("variables", "B", "Does not sort before 'A'").WithRule(model.RuleVariableSorting),
+		}}
+
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(err, nil, OutputFormatHuman))
+		assert.Contains(t, out.String(), `warning: variables: Invalid value: "B": Does not sort before 'A'`)
+
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(err, nil, OutputFormatSARIF))
+		var report sarifReport
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		require.Len(t, report.Runs, 1)
+		require.Len(t, report.Runs[0].Results, 1)
+		assert.Equal(t, "warning", report.Runs[0].Results[0].Level)
+	})
+
+	t.Run("Fixed", func(t *testing.T) {
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(nil, []string{"role-manifest.yml"}, OutputFormatYAML))
+		assert.Equal(t, "valid: true\nerrors: []\nfixed:\n- role-manifest.yml\n\n", out.String())
+
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(nil, []string{"role-manifest.yml"}, OutputFormatSARIF))
+		var report sarifReport
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		require.Len(t, report.Runs, 1)
+		assert.Equal(t, []sarifArtifact{{
+			Location: sarifArtifactLocation{URI: "role-manifest.yml"},
+			Roles:    []string{"modified"},
+		}}, report.Runs[0].Artifacts)
+
+		out.Reset()
+		assert.NoError(t, f.ReportValidation(nil, []string{"role-manifest.yml"}, OutputFormatHuman))
+		assert.Empty(t, out.String(), "The changes are shown as a diff")
+	})
+
+	t.Run("Internal", func(t *testing.T) {
+		out.Reset()
+		err := fmt.Errorf("Releases not loaded")
+		assert.Equal(t, err, f.ReportValidation(err, nil, OutputFormatJSON))
+		assert.Empty(t, out.String(), "Only validation errors are reported")
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		err := f.ReportValidation(nil, nil, OutputFormat("xml"))
+		assert.EqualError(t, err, "Invalid output format 'xml', expected one of human, json, yaml, or sarif")
+	})
+
+	t.Run("Human", func(t *testing.T) {
+		out.Reset()
+		err := &ValidationError{Context: "Error loading roles manifest", Errors: validationReportTestErrors()}
+		assert.Equal(t, err, f.ReportValidation(err, nil, OutputFormatHuman))
+		assert.Empty(t, out.String(), "The error is shown by the caller")
+		assert.EqualError(t, err, "Error loading roles manifest: role-manifest.yml:10:11: instance_groups[api].run.memory: Invalid value: -1: must be positive\nvariables: Required value")
+	})
+}
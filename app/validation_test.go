@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/validation"
 	"github.com/SUSE/termui"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,7 +37,7 @@ func TestValidation(t *testing.T) {
 	roleManifest := f.Manifest
 	require.NotNil(t, roleManifest, "error loading role manifest")
 
-	opinions, err := model.NewOpinions(lightManifestPath, darkManifestPath)
+	opinions, err := model.NewOpinions([]string{lightManifestPath}, darkManifestPath)
 	assert.NoError(t, err)
 
 	errs := f.validateManifestAndOpinions(roleManifest, opinions, nil)
@@ -71,6 +72,16 @@ func TestValidation(t *testing.T) {
 		assert.Contains(t, actual, expected)
 	}
 	assert.Len(t, errs, len(allExpected))
+
+	for _, err := range errs {
+		assert.NotEmpty(t, err.Rule, "Rule of %s", err.Field)
+	}
+
+	// The errors are located in the files they refer to
+	assert.Contains(t, actual, roleManifestPath+`:30:21: role-manifest 'fox'`)
+	assert.Contains(t, actual, lightManifestPath+`:3:5: light opinion 'tor.opinion'`)
+	assert.Contains(t, actual, darkManifestPath+`:4:5: properties.tor.dark-opinion`)
+	assert.Contains(t, actual, roleManifestPath+`:32:30: warning: configuration.templates[properties.tor.hostname]`)
 }
 
 func TestValidationOk(t *testing.T) {
@@ -97,7 +108,7 @@ func TestValidationOk(t *testing.T) {
 	roleManifest := f.Manifest
 	require.NotNil(t, roleManifest, "error loading role manifest")
 
-	opinions, err := model.NewOpinions(lightManifestPath, darkManifestPath)
+	opinions, err := model.NewOpinions([]string{lightManifestPath}, darkManifestPath)
 	assert.NoError(t, err)
 
 	errs := f.validateManifestAndOpinions(roleManifest, opinions, nil)
@@ -127,7 +138,7 @@ func TestValidationHash(t *testing.T) {
 	roleManifest := f.Manifest
 	require.NotNil(t, roleManifest, "error loading role manifest")
 
-	opinions, err := model.NewOpinions(emptyManifestPath, emptyManifestPath)
+	opinions, err := model.NewOpinions([]string{emptyManifestPath}, emptyManifestPath)
 	assert.NoError(t, err)
 
 	errs := f.validateManifestAndOpinions(roleManifest, opinions, nil)
@@ -185,6 +196,51 @@ func TestTemplateSorting(t *testing.T) {
 	assert.Contains(t, err.Error(), `properties.tor.hostname: Forbidden: Template key does not sort before 'properties.tor.hashed_control_password'`)
 }
 
+func TestManifestWarnings(t *testing.T) {
+	out := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, out, nil)
+
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/app/tor-validation-warnings.yml")
+	emptyManifestPath := filepath.Join(workDir, "../test-assets/misc/empty.yml")
+	f := NewFissileApplication(".", ui)
+
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{torReleasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "warning: properties.tor.hostname: Forbidden: Template key does not sort before 'properties.tor.hashed_control_password'")
+
+	out.Reset()
+	f.HideManifestWarnings = true
+	err = f.LoadManifest(
+		roleManifestPath,
+		[]string{torReleasePath},
+		[]string{""},
+		[]string{""},
+		filepath.Join(workDir, "../test-assets/bosh-cache"))
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+
+	// Errors of the opinions validation can't be suppressed either
+	f.Manifest.Validation.Suppressions = []validation.Suppression{
+		{Rule: ruleUndefinedDarkOpinion.ID, Reason: "The opinions are checked elsewhere"},
+		{Rule: ruleLightOpinionDefault.ID, Reason: "The defaults are set on purpose"},
+	}
+	opinions, err := model.NewOpinions([]string{emptyManifestPath}, emptyManifestPath)
+	require.NoError(t, err)
+
+	errs := f.validateManifestAndOpinions(f.Manifest, opinions, nil)
+	assert.Contains(t, errs.Errors(), "validation.suppressions[0].rule: Forbidden: Rule undefined-dark-opinion reports errors, only warnings and infos can be suppressed")
+	assert.NotContains(t, errs.Errors(), "validation.suppressions[1].rule")
+}
+
 func TestNonExistingVarsInEnvFile(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 
@@ -206,7 +262,7 @@ func TestNonExistingVarsInEnvFile(t *testing.T) {
 	assert.NoError(t, err)
 	require.NotNil(t, roleManifest)
 
-	opinions, err := model.NewOpinions(emptyManifestPath, emptyManifestPath)
+	opinions, err := model.NewOpinions([]string{emptyManifestPath}, emptyManifestPath)
 	assert.NoError(t, err)
 
 	errs := f.validateManifestAndOpinions(roleManifest, opinions, map[string]string{"FOOBAR": "pelerinul"})
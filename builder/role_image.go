@@ -13,6 +13,7 @@ import (
 
 	"code.cloudfoundry.org/fissile/docker"
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/oci"
 	"code.cloudfoundry.org/fissile/scripts/dockerfiles"
 	"code.cloudfoundry.org/fissile/util"
 	"github.com/SUSE/stampy"
@@ -27,6 +28,20 @@ const (
 	jobConfigSpecFilename = "config_spec.json"
 )
 
+// ImageFormat is the format images are written in when building them into an
+// output directory instead of with docker
+type ImageFormat string
+
+const (
+	// ImageFormatContext writes the docker build context of each image, to be
+	// built with `docker build` later
+	ImageFormatContext = ImageFormat("context")
+	// ImageFormatOCI writes the images into an OCI image layout
+	ImageFormatOCI = ImageFormat("oci")
+	// ImageFormatDockerArchive writes each image as a tarball for `docker load`
+	ImageFormatDockerArchive = ImageFormat("docker-archive")
+)
+
 var (
 	// newDockerImageBuilder is a stub to be replaced by the unit test
 	newDockerImageBuilder = func() (dockerImageBuilder, error) { return docker.NewImageManager() }
@@ -47,14 +62,14 @@ type RoleImageBuilder struct {
 	metricsPath          string
 	tagExtra             string
 	fissileVersion       string
-	lightOpinionsPath    string
+	lightOpinionsPaths   []string
 	darkOpinionsPath     string
 	ui                   *termui.UI
 	grapher              util.ModelGrapher
 }
 
 // NewRoleImageBuilder creates a new RoleImageBuilder
-func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath, lightOpinionsPath, darkOpinionsPath, metricsPath, tagExtra, fissileVersion string, ui *termui.UI, grapher util.ModelGrapher) (*RoleImageBuilder, error) {
+func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath string, lightOpinionsPaths []string, darkOpinionsPath, metricsPath, tagExtra, fissileVersion string, ui *termui.UI, grapher util.ModelGrapher) (*RoleImageBuilder, error) {
 	if err := os.MkdirAll(targetPath, 0755); err != nil {
 		return nil, err
 	}
@@ -66,7 +81,7 @@ func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath, lightOpin
 		metricsPath:          metricsPath,
 		fissileVersion:       fissileVersion,
 		tagExtra:             tagExtra,
-		lightOpinionsPath:    lightOpinionsPath,
+		lightOpinionsPaths:   lightOpinionsPaths,
 		darkOpinionsPath:     darkOpinionsPath,
 		ui:                   ui,
 		grapher:              grapher,
@@ -161,7 +176,7 @@ func (r *RoleImageBuilder) NewDockerPopulator(instanceGroup *model.InstanceGroup
 			})
 
 			// Write spec into <ROOT_DIR>/var/vcap/job-src/<JOB>/config_spec.json
-			configJSON, err := jobReference.WriteConfigs(instanceGroup, r.lightOpinionsPath, r.darkOpinionsPath)
+			configJSON, err := jobReference.WriteConfigs(instanceGroup, r.lightOpinionsPaths, r.darkOpinionsPath)
 			if err != nil {
 				return err
 			}
@@ -359,6 +374,8 @@ type roleBuildJob struct {
 	noBuild         bool
 	dockerManager   dockerImageBuilder
 	outputDirectory string
+	imageFormat     ImageFormat
+	layout          *oci.Layout
 	resultsCh       chan<- error
 	abort           <-chan struct{}
 	registry        string
@@ -376,7 +393,7 @@ func (j roleBuildJob) Run() {
 	}
 
 	j.resultsCh <- func() error {
-		opinions, err := model.NewOpinions(j.builder.lightOpinionsPath, j.builder.darkOpinionsPath)
+		opinions, err := model.NewOpinions(j.builder.lightOpinionsPaths, j.builder.darkOpinionsPath)
 		if err != nil {
 			return err
 		}
@@ -402,10 +419,18 @@ func (j roleBuildJob) Run() {
 		}
 
 		if !j.force {
-			if j.outputDirectory == "" {
-				if hasImage, err := j.dockerManager.HasImage(roleImageName); err != nil {
+			if j.outputDirectory == "" || j.imageFormat != ImageFormatContext {
+				hasImage, err := j.hasImage(roleImageName)
+				if err != nil {
 					return err
-				} else if hasImage {
+				}
+				if hasImage && j.imageFormat == ImageFormatDockerArchive {
+					// The archive is written from the image in the layout
+					if _, err := os.Stat(outputPath); err != nil {
+						hasImage = false
+					}
+				}
+				if hasImage {
 					j.ui.Printf("Skipping build of role image %s because it exists\n", color.YellowString(j.instanceGroup.Name))
 					return nil
 				}
@@ -453,6 +478,18 @@ func (j roleBuildJob) Run() {
 				log.WriteTo(j.ui)
 				return fmt.Errorf("Error building image: %s", err.Error())
 			}
+		} else if j.layout != nil {
+			j.ui.Printf("Building image of %s without docker...\n", color.YellowString(j.instanceGroup.Name))
+
+			if _, err := j.layout.Build(roleImageName, dockerPopulator); err != nil {
+				return fmt.Errorf("Error building image: %s", err.Error())
+			}
+
+			if j.imageFormat == ImageFormatDockerArchive {
+				if err := j.layout.WriteDockerArchive(roleImageName, outputPath); err != nil {
+					return fmt.Errorf("Failed to write image archive %s: %s", outputPath, err)
+				}
+			}
 		} else {
 			j.ui.Printf("Building tarball of %s...\n", color.YellowString(j.instanceGroup.Name))
 
@@ -476,15 +513,33 @@ func (j roleBuildJob) Run() {
 	}()
 }
 
-// BuildRoleImages triggers the building of the role docker images in parallel
-func (r *RoleImageBuilder) BuildRoleImages(instanceGroups model.InstanceGroups, registry, organization, repository, baseImageName, outputDirectory string, force, noBuild bool, workerCount int) error {
+// hasImage returns true if the role image was built already, either by docker
+// or into the image layout
+func (j roleBuildJob) hasImage(roleImageName string) (bool, error) {
+	if j.layout != nil {
+		return j.layout.HasImage(roleImageName)
+	}
+	return j.dockerManager.HasImage(roleImageName)
+}
+
+// BuildRoleImages triggers the building of the role docker images in parallel.
+// With an output directory, the images are written there in the given format
+// instead of being built by docker. All formats but ImageFormatContext build
+// the images into the given image layout, where the base image must exist.
+func (r *RoleImageBuilder) BuildRoleImages(instanceGroups model.InstanceGroups, registry, organization, repository, baseImageName, outputDirectory string, imageFormat ImageFormat, layout *oci.Layout, force, noBuild bool, workerCount int) error {
 	if workerCount < 1 {
 		return fmt.Errorf("Invalid worker count %d", workerCount)
 	}
 
-	dockerManager, err := newDockerImageBuilder()
-	if err != nil {
-		return fmt.Errorf("Error connecting to docker: %s", err.Error())
+	var dockerManager dockerImageBuilder
+	var err error
+	if outputDirectory == "" {
+		dockerManager, err = newDockerImageBuilder()
+		if err != nil {
+			return fmt.Errorf("Error connecting to docker: %s", err.Error())
+		}
+	} else if imageFormat != ImageFormatContext && layout == nil {
+		return fmt.Errorf("Building images in the %s format requires an image layout", imageFormat)
 	}
 
 	if outputDirectory != "" {
@@ -508,6 +563,8 @@ func (r *RoleImageBuilder) BuildRoleImages(instanceGroups model.InstanceGroups,
 			noBuild:         noBuild,
 			dockerManager:   dockerManager,
 			outputDirectory: outputDirectory,
+			imageFormat:     imageFormat,
+			layout:          layout,
 			resultsCh:       resultsCh,
 			abort:           abort,
 			registry:        registry,
@@ -534,18 +591,27 @@ func (r *RoleImageBuilder) BuildRoleImages(instanceGroups model.InstanceGroups,
 	return err
 }
 
-// GetRoleDevImageName generates a docker image name to be used as a dev role image
-func GetRoleDevImageName(registry, organization, repository string, instanceGroup *model.InstanceGroup, version string) string {
-	var imageName string
-	if registry != "" {
-		imageName = registry + "/"
-	}
-
+// GetRegistryImageName returns the name of an image built without registry
+// or organization, as pushed to the given registry and organization
+func GetRegistryImageName(registry, organization, imageName string) string {
 	if organization != "" {
-		imageName += util.SanitizeDockerName(organization) + "/"
+		imageName = util.SanitizeDockerName(organization) + "/" + imageName
+	}
+	if registry != "" {
+		imageName = registry + "/" + imageName
 	}
+	return imageName
+}
 
-	imageName += util.SanitizeDockerName(fmt.Sprintf("%s-%s", repository, instanceGroup.Name))
+// GetRoleImageRepository returns the name of the image repository of a role,
+// without any tag
+func GetRoleImageRepository(registry, organization, repository string, instanceGroup *model.InstanceGroup) string {
+	imageName := util.SanitizeDockerName(fmt.Sprintf("%s-%s", repository, instanceGroup.Name))
+	return GetRegistryImageName(registry, organization, imageName)
+}
 
+// GetRoleDevImageName generates a docker image name to be used as a dev role image
+func GetRoleDevImageName(registry, organization, repository string, instanceGroup *model.InstanceGroup, version string) string {
+	imageName := GetRoleImageRepository(registry, organization, repository, instanceGroup)
 	return fmt.Sprintf("%s:%s", imageName, util.SanitizeDockerName(version))
 }
@@ -15,8 +15,10 @@ import (
 	"testing"
 
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/oci"
 	"github.com/SUSE/termui"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateRoleImageDockerfile(t *testing.T) {
@@ -49,7 +51,7 @@ func TestGenerateRoleImageDockerfile(t *testing.T) {
 	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, []string{lightOpinionsPath}, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
 	assert.NoError(err)
 
 	var dockerfileContents bytes.Buffer
@@ -103,7 +105,7 @@ func TestGenerateRoleImageRunScript(t *testing.T) {
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
 
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, []string{lightOpinionsPath}, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
 	assert.NoError(err)
 
 	runScriptContents, err := roleImageBuilder.generateRunScript(roleManifest.InstanceGroups[0], "run.sh")
@@ -175,7 +177,7 @@ func TestGenerateRoleImageJobsConfig(t *testing.T) {
 	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, []string{lightOpinionsPath}, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
 	assert.NoError(err)
 
 	jobsConfigContents, err := roleImageBuilder.generateJobsConfig(roleManifest.InstanceGroups[0])
@@ -226,7 +228,7 @@ func TestGenerateRoleImageDockerfileDir(t *testing.T) {
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
 
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, []string{lightOpinionsPath}, darkOpinionsPath, "", "deadbeef", "6.28.30", ui, nil)
 	assert.NoError(err)
 
 	torPkg := getPackage(roleManifest.InstanceGroups, "myrole", "tor", "tor")
@@ -448,7 +450,7 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		compiledPackagesDir,
 		targetPath,
-		lightOpinionsPath,
+		[]string{lightOpinionsPath},
 		darkOpinionsPath,
 		"",
 		"deadbeef",
@@ -480,6 +482,8 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		"",
 		"",
+		ImageFormatContext,
+		nil,
 		false,
 		false,
 		2,
@@ -502,6 +506,8 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		"",
 		"",
+		ImageFormatContext,
+		nil,
 		false,
 		false,
 		0,
@@ -530,6 +536,8 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		"",
 		"",
+		ImageFormatContext,
+		nil,
 		false,
 		false,
 		1,
@@ -556,6 +564,8 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		"",
 		"",
+		ImageFormatContext,
+		nil,
 		false,
 		false,
 		len(roleManifest.InstanceGroups),
@@ -590,6 +600,8 @@ func TestBuildRoleImages(t *testing.T) {
 		"test-repository",
 		"",
 		"",
+		ImageFormatContext,
+		nil,
 		false,
 		false,
 		1,
@@ -606,6 +618,157 @@ func TestBuildRoleImages(t *testing.T) {
 	assert.Regexp(regexp.MustCompile(expected), string(contents))
 }
 
+// writeBaseImageArchive writes an image archive without any layers, as
+// `docker save` would
+func writeBaseImageArchive(t *testing.T, path string) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+	for _, entry := range []struct{ name, contents string }{
+		{"config.json", `{"architecture":"amd64","os":"linux","config":{"Cmd":["/bin/bash"]},"rootfs":{"type":"layers","diff_ids":[]}}`},
+		{"manifest.json", `[{"Config":"config.json","RepoTags":["base:latest"],"Layers":[]}]`},
+	} {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.contents)), Typeflag: tar.TypeReg}
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(entry.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+}
+
+func TestBuildRoleImagesWithoutDocker(t *testing.T) {
+	origNewDockerImageBuilder := newDockerImageBuilder
+	defer func() {
+		newDockerImageBuilder = origNewDockerImageBuilder
+	}()
+	newDockerImageBuilder = func() (dockerImageBuilder, error) {
+		return nil, fmt.Errorf("Docker must not be used")
+	}
+
+	assert := assert.New(t)
+
+	out := &bytes.Buffer{}
+	ui := termui.New(
+		&bytes.Buffer{},
+		out,
+		nil,
+	)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	compiledPackagesDir := filepath.Join(workDir, "../test-assets/tor-boshrelease-fake-compiled")
+	targetPath, err := ioutil.TempDir("", "fissile-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(targetPath)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml")
+	roleManifest, err := model.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleasePaths: []string{releasePath},
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache")})
+	require.NoError(t, err)
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+
+	roleImageBuilder, err := NewRoleImageBuilder(
+		"test-repository",
+		compiledPackagesDir,
+		targetPath,
+		[]string{filepath.Join(torOpinionsDir, "opinions.yml")},
+		filepath.Join(torOpinionsDir, "dark-opinions.yml"),
+		"",
+		"deadbeef",
+		"6.28.30",
+		ui,
+		nil,
+	)
+	require.NoError(t, err)
+
+	layout, err := oci.OpenLayout(filepath.Join(targetPath, "layout"))
+	require.NoError(t, err)
+	baseArchivePath := filepath.Join(targetPath, "base.tar")
+	writeBaseImageArchive(t, baseArchivePath)
+	_, err = layout.Import(baseArchivePath, "base:latest")
+	require.NoError(t, err)
+
+	// Images need a layout
+	outputDirectory := filepath.Join(targetPath, "output")
+	err = roleImageBuilder.BuildRoleImages(
+		roleManifest.InstanceGroups,
+		"",
+		"",
+		"test-repository",
+		"base:latest",
+		outputDirectory,
+		ImageFormatOCI,
+		nil,
+		false,
+		false,
+		1,
+	)
+	assert.Error(err)
+
+	err = roleImageBuilder.BuildRoleImages(
+		roleManifest.InstanceGroups,
+		"",
+		"",
+		"test-repository",
+		"base:latest",
+		outputDirectory,
+		ImageFormatDockerArchive,
+		layout,
+		false,
+		false,
+		2,
+	)
+	require.NoError(t, err)
+
+	archives, err := filepath.Glob(filepath.Join(outputDirectory, "*.tar"))
+	require.NoError(t, err)
+	assert.Len(archives, len(roleManifest.InstanceGroups))
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		archivePath := ""
+		for _, candidate := range archives {
+			if strings.HasPrefix(filepath.Base(candidate), "test-repository-"+instanceGroup.Name+":") {
+				archivePath = candidate
+			}
+		}
+		if !assert.NotEmpty(archivePath, "No archive for %s", instanceGroup.Name) {
+			continue
+		}
+
+		image, err := layout.Image(strings.TrimSuffix(filepath.Base(archivePath), ".tar"))
+		require.NoError(t, err)
+		assert.Equal(instanceGroup.Name, image.Config.Config.Labels["instance_group"])
+		assert.Equal([]string{"/usr/bin/dumb-init", "/opt/fissile/run.sh"}, image.Config.Config.Entrypoint)
+		assert.Nil(image.Config.Config.Cmd)
+		assert.Len(image.Manifest.Layers, 1)
+	}
+
+	// Existing images are skipped, unless their archive is missing
+	require.NoError(t, os.Remove(archives[0]))
+	out.Reset()
+	err = roleImageBuilder.BuildRoleImages(
+		roleManifest.InstanceGroups,
+		"",
+		"",
+		"test-repository",
+		"base:latest",
+		outputDirectory,
+		ImageFormatDockerArchive,
+		layout,
+		false,
+		false,
+		1,
+	)
+	require.NoError(t, err)
+	assert.Equal(len(roleManifest.InstanceGroups)-1, strings.Count(out.String(), "because it exists"))
+	assert.FileExists(archives[0])
+}
+
 func TestGetRoleDevImageName(t *testing.T) {
 	assert := assert.New(t)
 
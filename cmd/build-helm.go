@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"path/filepath"
+
 	"code.cloudfoundry.org/fissile/kube"
 	"code.cloudfoundry.org/fissile/model"
 	"github.com/spf13/cobra"
@@ -13,7 +15,16 @@ var (
 	flagBuildHelmUseMemoryLimits bool
 	flagBuildHelmUseCPULimits    bool
 	flagBuildHelmTagExtra        string
+	flagBuildHelmImageDigests    string
 	flagBuildHelmAuthType        string
+	flagBuildHelmChartName       string
+	flagBuildHelmChartVersion    string
+	flagBuildHelmAppVersion      string
+	flagBuildHelmDescription     string
+	flagBuildHelmNamePrefix      string
+	flagBuildHelmNameSuffix      string
+	flagBuildHelmLabels          []string
+	flagBuildHelmAnnotations     []string
 )
 
 // buildHelmCmd represents the helm command
@@ -28,8 +39,17 @@ var buildHelmCmd = &cobra.Command{
 		flagBuildHelmUseMemoryLimits = buildHelmViper.GetBool("use-memory-limits")
 		flagBuildHelmUseCPULimits = buildHelmViper.GetBool("use-cpu-limits")
 		flagBuildHelmTagExtra = buildHelmViper.GetString("tag-extra")
+		flagBuildHelmImageDigests = buildHelmViper.GetString("image-digests")
+		flagBuildHelmNamePrefix = buildHelmViper.GetString("name-prefix")
+		flagBuildHelmNameSuffix = buildHelmViper.GetString("name-suffix")
+		flagBuildHelmLabels = buildHelmViper.GetStringSlice("label")
+		flagBuildHelmAnnotations = buildHelmViper.GetStringSlice("annotation")
 		flagBuildOutputGraph = buildViper.GetString("output-graph")
 		flagBuildHelmAuthType = buildHelmViper.GetString("auth-type")
+		flagBuildHelmChartName = buildHelmViper.GetString("chart-name")
+		flagBuildHelmChartVersion = buildHelmViper.GetString("chart-version")
+		flagBuildHelmAppVersion = buildHelmViper.GetString("app-version")
+		flagBuildHelmDescription = buildHelmViper.GetString("description")
 
 		err := fissile.LoadManifest(
 			flagRoleManifest,
@@ -64,6 +84,46 @@ var buildHelmCmd = &cobra.Command{
 			CreateHelmChart: true,
 			TagExtra:        flagBuildHelmTagExtra,
 			AuthType:        flagBuildHelmAuthType,
+			Chart: kube.ChartMetadata{
+				Name:        flagBuildHelmChartName,
+				Version:     flagBuildHelmChartVersion,
+				AppVersion:  flagBuildHelmAppVersion,
+				Description: flagBuildHelmDescription,
+			},
+			NamePrefix: flagBuildHelmNamePrefix,
+			NameSuffix: flagBuildHelmNameSuffix,
+		}
+
+		settings.Labels, err = parseKeyValues("label", flagBuildHelmLabels)
+		if err != nil {
+			return err
+		}
+		settings.Annotations, err = parseKeyValues("annotation", flagBuildHelmAnnotations)
+		if err != nil {
+			return err
+		}
+
+		settings.Chart, err = fissile.LoadChartMetadata(flagBuildHelmOutputDir, settings.Chart)
+		if err != nil {
+			return err
+		}
+		if settings.Chart.Version == "" {
+			settings.Chart.Version = defaultChartVersion
+		}
+		if settings.Chart.Name == "" {
+			// Helm expects the chart directory to be named like the chart
+			outputDir, err := filepath.Abs(flagBuildHelmOutputDir)
+			if err != nil {
+				return err
+			}
+			settings.Chart.Name = filepath.Base(outputDir)
+		}
+
+		if flagBuildHelmImageDigests != "" {
+			settings.ImageDigests, err = fissile.LoadImageDigests(flagBuildHelmImageDigests, settings)
+			if err != nil {
+				return err
+			}
 		}
 
 		if flagBuildOutputGraph != "" {
@@ -79,6 +139,10 @@ var buildHelmCmd = &cobra.Command{
 		return fissile.GenerateKube(flagBuildHelmDefaultEnvFiles, settings)
 	},
 }
+
+// defaultChartVersion is the version of new Helm charts
+const defaultChartVersion = "0.1.0"
+
 var buildHelmViper = viper.New()
 
 func init() {
@@ -135,5 +199,68 @@ func init() {
 		"Sets the Kubernetes auth type",
 	)
 
+	buildHelmCmd.PersistentFlags().StringP(
+		"image-digests",
+		"",
+		"",
+		"Reference images by digest, read from this digest manifest as written by build images --push, or from the docker daemon if set to 'docker'",
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"chart-name",
+		"",
+		"",
+		"Name of the Helm chart; defaults to the name of an existing chart in the output directory, or of the output directory",
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"chart-version",
+		"",
+		"",
+		"Version of the Helm chart; defaults to the version of an existing chart in the output directory, or "+defaultChartVersion,
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"app-version",
+		"",
+		"",
+		"Version of the application in the Helm chart; defaults to the version of the release named like the chart, or of the first release",
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"description",
+		"",
+		"",
+		"Description of the Helm chart",
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"name-prefix",
+		"",
+		"",
+		"Prefix of the names of all generated resources",
+	)
+
+	buildHelmCmd.PersistentFlags().StringP(
+		"name-suffix",
+		"",
+		"",
+		"Suffix of the names of all generated resources",
+	)
+
+	buildHelmCmd.PersistentFlags().StringSliceP(
+		"label",
+		"",
+		nil,
+		"Label which will be set on all generated resources. Format: label=value",
+	)
+
+	buildHelmCmd.PersistentFlags().StringSliceP(
+		"annotation",
+		"",
+		nil,
+		"Annotation which will be set on all generated resources. Format: annotation=value",
+	)
+
 	buildHelmViper.BindPFlags(buildHelmCmd.PersistentFlags())
 }
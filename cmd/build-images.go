@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"code.cloudfoundry.org/fissile/builder"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -15,10 +16,14 @@ var (
 	flagPatchPropertiesDirective string
 	flagOutputDirectory          string
 
-	flagBuildImagesStemcell   string
-	flagBuildImagesStemcellID string
-	flagBuildImagesTagExtra   string
-	flagLabels                []string
+	flagBuildImagesStemcell        string
+	flagBuildImagesStemcellID      string
+	flagBuildImagesStemcellArchive string
+	flagBuildImagesImageFormat     string
+	flagBuildImagesTagExtra        string
+	flagBuildImagesPush            bool
+	flagBuildImagesDigestManifest  string
+	flagLabels                     []string
 )
 
 // buildImagesCmd represents the images command
@@ -43,6 +48,25 @@ the image.
 
 The ` + "`--patch-properties-release`" + ` flag is used to distinguish the patchProperties release/job spec
 from other specs.  At most one is allowed.
+
+With ` + "`--output-directory`" + `, no docker daemon is used. The ` + "`--image-format`" + ` flag
+selects what is written there:
+
+- ` + "`context`" + ` (the default): the docker build context of each image, as a tarball
+- ` + "`oci`" + `: the images themselves, in an OCI image layout
+- ` + "`docker-archive`" + `: the images themselves, as tarballs for ` + "`docker load`" + `
+
+The last two need the stemcell image, either from ` + "`--stemcell-archive`" + ` (written
+by ` + "`docker save`" + `, or an OCI image layout) or imported by an earlier run. Images
+already in the layout are skipped unless ` + "`--force`" + ` is given; build contexts are
+always written.
+
+With ` + "`--push`" + `, the role images and the packages layer image are pushed to
+` + "`--docker-registry`" + ` using the registry API, authenticated with ` + "`--docker-username`" + `
+and ` + "`--docker-password`" + `. Layers the registry has already are not uploaded again.
+This works for images built by docker and for the ` + "`oci`" + ` and ` + "`docker-archive`" + `
+formats. The digest of every pushed image is recorded in ` + "`--digest-manifest`" + `,
+` + "`<work-dir>/image-digests.yml`" + ` by default.
 	`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
@@ -53,7 +77,11 @@ from other specs.  At most one is allowed.
 		flagOutputDirectory = buildImagesViper.GetString("output-directory")
 		flagBuildImagesStemcell = buildImagesViper.GetString("stemcell")
 		flagBuildImagesStemcellID = buildImagesViper.GetString("stemcell-id")
+		flagBuildImagesStemcellArchive = buildImagesViper.GetString("stemcell-archive")
+		flagBuildImagesImageFormat = buildImagesViper.GetString("image-format")
 		flagBuildImagesTagExtra = buildImagesViper.GetString("tag-extra")
+		flagBuildImagesPush = buildImagesViper.GetBool("push")
+		flagBuildImagesDigestManifest = buildImagesViper.GetString("digest-manifest")
 		flagBuildOutputGraph = buildViper.GetString("output-graph")
 		flagLabels = buildImagesViper.GetStringSlice("add-label")
 
@@ -68,7 +96,13 @@ from other specs.  At most one is allowed.
 			return err
 		}
 
-		if flagOutputDirectory != "" && !flagBuildImagesForce {
+		if flagOutputDirectory == "" && flagBuildImagesImageFormat != string(builder.ImageFormatContext) {
+			return fmt.Errorf("--image-format %s requires --output-directory", flagBuildImagesImageFormat)
+		}
+
+		// Images in a layout are skipped when they exist, as without an output
+		// directory; build contexts are always written
+		if flagOutputDirectory != "" && flagBuildImagesImageFormat == string(builder.ImageFormatContext) && !flagBuildImagesForce {
 			fissile.UI.Printf("--force required when --output-directory is set\n")
 			flagBuildImagesForce = true
 		}
@@ -92,7 +126,16 @@ from other specs.  At most one is allowed.
 			labels[parts[0]] = parts[1]
 		}
 
-		return fissile.GenerateRoleImages(
+		if flagBuildImagesPush && flagBuildImagesNoBuild {
+			return fmt.Errorf("--push can not be used with --no-build")
+		}
+		if flagBuildImagesDigestManifest == "" {
+			flagBuildImagesDigestManifest = workPathImageDigests
+		}
+
+		instanceGroupNames := strings.FieldsFunc(flagBuildImagesRoles, func(r rune) bool { return r == ',' })
+
+		err = fissile.GenerateRoleImages(
 			workPathDockerDir,
 			flagDockerRegistry,
 			flagDockerOrganization,
@@ -103,14 +146,38 @@ from other specs.  At most one is allowed.
 			flagBuildImagesNoBuild,
 			flagBuildImagesForce,
 			flagBuildImagesTagExtra,
-			strings.FieldsFunc(flagBuildImagesRoles, func(r rune) bool { return r == ',' }),
+			instanceGroupNames,
 			flagWorkers,
 			workPathCompilationDir,
 			flagLightOpinions,
 			flagDarkOpinions,
 			flagOutputDirectory,
+			builder.ImageFormat(flagBuildImagesImageFormat),
+			flagBuildImagesStemcellArchive,
 			labels,
 		)
+		if err != nil || !flagBuildImagesPush {
+			return err
+		}
+
+		return fissile.PushRoleImages(
+			workPathDockerDir,
+			flagDockerRegistry,
+			flagDockerOrganization,
+			flagRepository,
+			flagDockerUsername,
+			flagDockerPassword,
+			flagBuildImagesStemcell,
+			flagBuildImagesStemcellID,
+			flagBuildImagesTagExtra,
+			instanceGroupNames,
+			workPathCompilationDir,
+			flagLightOpinions,
+			flagDarkOpinions,
+			flagOutputDirectory,
+			builder.ImageFormat(flagBuildImagesImageFormat),
+			flagBuildImagesDigestManifest,
+		)
 	},
 }
 var buildImagesViper = viper.New()
@@ -170,6 +237,20 @@ func init() {
 		"Docker image ID for the stemcell (intended for CI)",
 	)
 
+	buildImagesCmd.PersistentFlags().StringP(
+		"stemcell-archive",
+		"",
+		"",
+		"Image archive (from docker save) or OCI image layout of the stemcell, for building without docker",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"image-format",
+		"",
+		string(builder.ImageFormatContext),
+		"Format of the images written to the output directory: context, oci, or docker-archive",
+	)
+
 	buildImagesCmd.PersistentFlags().StringP(
 		"tag-extra",
 		"",
@@ -177,6 +258,20 @@ func init() {
 		"Additional information to use in computing the image tags",
 	)
 
+	buildImagesCmd.PersistentFlags().BoolP(
+		"push",
+		"",
+		false,
+		"Push the images to the docker registry after building them",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"digest-manifest",
+		"",
+		"",
+		"File recording the digests of pushed images; defaults to <work-dir>/image-digests.yml",
+	)
+
 	buildImagesCmd.PersistentFlags().StringSliceP(
 		"add-label",
 		"",
@@ -13,6 +13,13 @@ var (
 	flagBuildKubeUseMemoryLimits bool
 	flagBuildKubeUseCPULimits    bool
 	flagBuildKubeTagExtra        string
+	flagBuildKubeImageDigests    string
+	flagBuildKubeVersion         string
+	flagBuildKubeNetworkPolicies bool
+	flagBuildKubeNamePrefix      string
+	flagBuildKubeNameSuffix      string
+	flagBuildKubeLabels          []string
+	flagBuildKubeAnnotations     []string
 )
 
 // buildKubeCmd represents the kube command
@@ -27,6 +34,13 @@ var buildKubeCmd = &cobra.Command{
 		flagBuildKubeUseMemoryLimits = buildKubeViper.GetBool("use-memory-limits")
 		flagBuildKubeUseCPULimits = buildKubeViper.GetBool("use-cpu-limits")
 		flagBuildKubeTagExtra = buildKubeViper.GetString("tag-extra")
+		flagBuildKubeImageDigests = buildKubeViper.GetString("image-digests")
+		flagBuildKubeVersion = buildKubeViper.GetString("kube-version")
+		flagBuildKubeNetworkPolicies = buildKubeViper.GetBool("network-policies")
+		flagBuildKubeNamePrefix = buildKubeViper.GetString("name-prefix")
+		flagBuildKubeNameSuffix = buildKubeViper.GetString("name-suffix")
+		flagBuildKubeLabels = buildKubeViper.GetStringSlice("label")
+		flagBuildKubeAnnotations = buildKubeViper.GetStringSlice("annotation")
 		flagBuildOutputGraph = buildViper.GetString("output-graph")
 
 		err := fissile.LoadManifest(
@@ -61,6 +75,32 @@ var buildKubeCmd = &cobra.Command{
 			Opinions:        opinions,
 			CreateHelmChart: false,
 			TagExtra:        flagBuildKubeTagExtra,
+			NetworkPolicies: flagBuildKubeNetworkPolicies,
+			NamePrefix:      flagBuildKubeNamePrefix,
+			NameSuffix:      flagBuildKubeNameSuffix,
+		}
+
+		settings.Labels, err = parseKeyValues("label", flagBuildKubeLabels)
+		if err != nil {
+			return err
+		}
+		settings.Annotations, err = parseKeyValues("annotation", flagBuildKubeAnnotations)
+		if err != nil {
+			return err
+		}
+
+		if flagBuildKubeVersion != "" {
+			settings.KubeVersion, err = kube.ParseClusterVersion(flagBuildKubeVersion)
+			if err != nil {
+				return err
+			}
+		}
+
+		if flagBuildKubeImageDigests != "" {
+			settings.ImageDigests, err = fissile.LoadImageDigests(flagBuildKubeImageDigests, settings)
+			if err != nil {
+				return err
+			}
 		}
 
 		if flagBuildOutputGraph != "" {
@@ -118,5 +158,54 @@ func init() {
 		"Additional information to use in computing the image tags",
 	)
 
+	buildKubeCmd.PersistentFlags().StringP(
+		"image-digests",
+		"",
+		"",
+		"Reference images by digest, read from this digest manifest as written by build images --push, or from the docker daemon if set to 'docker'",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"kube-version",
+		"",
+		"",
+		"Kubernetes version (major.minor) selecting the API versions of the generated configurations; the oldest supported ones are used if not set",
+	)
+
+	buildKubeCmd.PersistentFlags().BoolP(
+		"network-policies",
+		"",
+		false,
+		"Include network policies only allowing ingress from instance groups consuming links, and to public ports",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"name-prefix",
+		"",
+		"",
+		"Prefix of the names of all generated resources",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"name-suffix",
+		"",
+		"",
+		"Suffix of the names of all generated resources",
+	)
+
+	buildKubeCmd.PersistentFlags().StringSliceP(
+		"label",
+		"",
+		nil,
+		"Label which will be set on all generated resources. Format: label=value",
+	)
+
+	buildKubeCmd.PersistentFlags().StringSliceP(
+		"annotation",
+		"",
+		nil,
+		"Annotation which will be set on all generated resources. Format: annotation=value",
+	)
+
 	buildKubeViper.BindPFlags(buildKubeCmd.PersistentFlags())
 }
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagBuildKustomizeOutputDir       string
+	flagBuildKustomizeDefaultEnvFiles []string
+	flagBuildKustomizeUseMemoryLimits bool
+	flagBuildKustomizeUseCPULimits    bool
+	flagBuildKustomizeTagExtra        string
+	flagBuildKustomizeImageDigests    string
+	flagBuildKustomizeVersion         string
+	flagBuildKustomizeNetworkPolicies bool
+	flagBuildKustomizeOverlays        []string
+	flagBuildKustomizeNamePrefix      string
+	flagBuildKustomizeNameSuffix      string
+	flagBuildKustomizeLabels          []string
+	flagBuildKustomizeAnnotations     []string
+)
+
+// buildKustomizeCmd represents the kustomize command
+var buildKustomizeCmd = &cobra.Command{
+	Use:   "kustomize",
+	Short: "Creates a kustomize base and overlays.",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		flagBuildKustomizeOutputDir = buildKustomizeViper.GetString("output-dir")
+		flagBuildKustomizeDefaultEnvFiles = splitNonEmpty(buildKustomizeViper.GetString("defaults-file"), ",")
+		flagBuildKustomizeUseMemoryLimits = buildKustomizeViper.GetBool("use-memory-limits")
+		flagBuildKustomizeUseCPULimits = buildKustomizeViper.GetBool("use-cpu-limits")
+		flagBuildKustomizeTagExtra = buildKustomizeViper.GetString("tag-extra")
+		flagBuildKustomizeImageDigests = buildKustomizeViper.GetString("image-digests")
+		flagBuildKustomizeVersion = buildKustomizeViper.GetString("kube-version")
+		flagBuildKustomizeNetworkPolicies = buildKustomizeViper.GetBool("network-policies")
+		flagBuildKustomizeOverlays = splitNonEmpty(buildKustomizeViper.GetString("overlays"), ",")
+		flagBuildKustomizeNamePrefix = buildKustomizeViper.GetString("name-prefix")
+		flagBuildKustomizeNameSuffix = buildKustomizeViper.GetString("name-suffix")
+		flagBuildKustomizeLabels = buildKustomizeViper.GetStringSlice("label")
+		flagBuildKustomizeAnnotations = buildKustomizeViper.GetStringSlice("annotation")
+		flagBuildOutputGraph = buildViper.GetString("output-graph")
+
+		err := fissile.LoadManifest(
+			flagRoleManifest,
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		opinions, err := model.NewOpinions(
+			flagLightOpinions,
+			flagDarkOpinions,
+		)
+		if err != nil {
+			return err
+		}
+
+		settings := kube.ExportSettings{
+			OutputDir:       flagBuildKustomizeOutputDir,
+			Registry:        flagDockerRegistry,
+			Username:        flagDockerUsername,
+			Password:        flagDockerPassword,
+			Organization:    flagDockerOrganization,
+			Repository:      flagRepository,
+			UseMemoryLimits: flagBuildKustomizeUseMemoryLimits,
+			UseCPULimits:    flagBuildKustomizeUseCPULimits,
+			FissileVersion:  fissile.Version,
+			Opinions:        opinions,
+			TagExtra:        flagBuildKustomizeTagExtra,
+			NetworkPolicies: flagBuildKustomizeNetworkPolicies,
+			NamePrefix:      flagBuildKustomizeNamePrefix,
+			NameSuffix:      flagBuildKustomizeNameSuffix,
+		}
+
+		settings.Labels, err = parseKeyValues("label", flagBuildKustomizeLabels)
+		if err != nil {
+			return err
+		}
+		settings.Annotations, err = parseKeyValues("annotation", flagBuildKustomizeAnnotations)
+		if err != nil {
+			return err
+		}
+
+		if flagBuildKustomizeVersion != "" {
+			settings.KubeVersion, err = kube.ParseClusterVersion(flagBuildKustomizeVersion)
+			if err != nil {
+				return err
+			}
+		}
+
+		if flagBuildKustomizeImageDigests != "" {
+			settings.ImageDigests, err = fissile.LoadImageDigests(flagBuildKustomizeImageDigests, settings)
+			if err != nil {
+				return err
+			}
+		}
+
+		if flagBuildOutputGraph != "" {
+			err = fissile.GraphBegin(flagBuildOutputGraph)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				fissile.GraphEnd()
+			}()
+		}
+
+		return fissile.GenerateKustomize(flagBuildKustomizeDefaultEnvFiles, flagBuildKustomizeOverlays, settings)
+	},
+}
+var buildKustomizeViper = viper.New()
+
+func init() {
+	initViper(buildKustomizeViper)
+
+	buildCmd.AddCommand(buildKustomizeCmd)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"output-dir",
+		"",
+		".",
+		"The kustomize base and overlays will be written to this directory",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"defaults-file",
+		"D",
+		"",
+		"Env files that contain defaults for the config vars of the kustomize base",
+	)
+
+	buildKustomizeCmd.PersistentFlags().BoolP(
+		"use-memory-limits",
+		"",
+		true,
+		"Include memory limits when generating kube configurations",
+	)
+
+	buildKustomizeCmd.PersistentFlags().BoolP(
+		"use-cpu-limits",
+		"",
+		true,
+		"Include cpu limits when generating kube configurations",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"tag-extra",
+		"",
+		"",
+		"Additional information to use in computing the image tags",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"image-digests",
+		"",
+		"",
+		"Reference images by digest, read from this digest manifest as written by build images --push, or from the docker daemon if set to 'docker'",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"kube-version",
+		"",
+		"",
+		"Kubernetes version (major.minor) selecting the API versions of the generated configurations; the oldest supported ones are used if not set",
+	)
+
+	buildKustomizeCmd.PersistentFlags().BoolP(
+		"network-policies",
+		"",
+		false,
+		"Include network policies only allowing ingress from instance groups consuming links, and to public ports",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"overlays",
+		"",
+		"",
+		"Env files that contain the config vars of kustomize overlays, each written to overlays/<file name>",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"name-prefix",
+		"",
+		"",
+		"Prefix of the names of all generated resources",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringP(
+		"name-suffix",
+		"",
+		"",
+		"Suffix of the names of all generated resources",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringSliceP(
+		"label",
+		"",
+		nil,
+		"Label which will be set on all generated resources. Format: label=value",
+	)
+
+	buildKustomizeCmd.PersistentFlags().StringSliceP(
+		"annotation",
+		"",
+		nil,
+		"Annotation which will be set on all generated resources. Format: annotation=value",
+	)
+
+	buildKustomizeViper.BindPFlags(buildKustomizeCmd.PersistentFlags())
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"code.cloudfoundry.org/fissile/app"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -29,16 +30,34 @@ Compiled packages are stored in ` + "`<work-dir>/compilation`" + `. Fissile uses
 package's fingerprint as part of the directory structure. This means that if the
 same package (with the same version) is used by multiple releases, it will only be
 compiled once.
+
+The output of every compilation is kept next to the compiled package, along with
+its exit code, duration and stemcell; use ` + "`fissile show compilation-log`" + ` to
+read it back.
+
+With ` + "`--rootless`" + ` neither docker nor root permissions are needed: each package
+is compiled in its own user and mount namespace, chrooted into the stemcell root
+filesystem given by ` + "`--stemcell-rootfs`" + `. The ` + "`--stemcell`" + ` image name is
+still used to key the compiled packages. Packages needing other users than root
+for compilation are not supported this way.
+
+With ` + "`--dry-run`" + ` nothing is compiled; instead, the packages are listed in the
+order they would be compiled, along with their fingerprints, dependencies, and
+whether they would be compiled, downloaded from the package cache, or reused
+from the work dir.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		flagBuildPackagesRoles := buildPackagesViper.GetString("roles")
 		flagBuildPackagesOnlyReleases := buildPackagesViper.GetString("only-releases")
 		flagBuildPackagesWithoutDocker := buildPackagesViper.GetBool("without-docker")
+		flagBuildPackagesRootless := buildPackagesViper.GetBool("rootless")
+		flagBuildPackagesStemcellRootfs := buildPackagesViper.GetString("stemcell-rootfs")
 		flagBuildPackagesDockerNetworkMode := buildPackagesViper.GetString("docker-network-mode")
 		flagBuildPackagesStemcell := buildPackagesViper.GetString("stemcell")
 		flagBuildOutputGraph = buildViper.GetString("output-graph")
 		flagBuildCompilationCacheConfig := buildPackagesViper.GetString("compilation-cache-config")
+		flagBuildPackagesDryRun := buildPackagesViper.GetBool("dry-run")
 
 		err := fissile.LoadManifest(
 			flagRoleManifest,
@@ -77,8 +96,12 @@ compiled once.
 			flagWorkers,
 			flagBuildPackagesDockerNetworkMode,
 			flagBuildPackagesWithoutDocker,
+			flagBuildPackagesRootless,
+			flagBuildPackagesStemcellRootfs,
 			flagVerbose,
 			flagBuildCompilationCacheConfig,
+			flagBuildPackagesDryRun,
+			app.OutputFormat(flagOutputFormat),
 		)
 	},
 }
@@ -112,6 +135,20 @@ func init() {
 		"Build without docker; this may adversely affect your system.  Only supported on Linux, and requires CAP_SYS_ADMIN.",
 	)
 
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"rootless",
+		"",
+		false,
+		"Build without docker and without root, in a user namespace chrooted into --stemcell-rootfs.  Only supported on Linux, and requires unprivileged user namespaces.",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringP(
+		"stemcell-rootfs",
+		"",
+		"",
+		"The root filesystem of the stemcell for --rootless: a directory, a tarball of one (e.g. from docker export), or an image archive from docker save",
+	)
+
 	buildPackagesCmd.PersistentFlags().StringP(
 		"docker-network-mode",
 		"",
@@ -133,5 +170,12 @@ func init() {
 		"Points to a file containing configuration for a compiled package cache or contains the configuration as valid yaml",
 	)
 
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"dry-run",
+		"",
+		false,
+		"Only show which packages would be compiled, taken from the package cache, or reused from the work dir; honors --output.",
+	)
+
 	buildPackagesViper.BindPFlags(buildPackagesCmd.PersistentFlags())
 }
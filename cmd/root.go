@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/fissile/app"
 	"github.com/spf13/cobra"
@@ -29,7 +30,9 @@ var (
 	flagDockerPassword     string
 	flagRepository         string
 	flagWorkers            int
-	flagLightOpinions      string
+	flagDownloadWorkers    int
+	flagDownloadRetries    int
+	flagLightOpinions      []string
 	flagDarkOpinions       string
 	flagOutputFormat       string
 	flagMetrics            string
@@ -40,6 +43,7 @@ var (
 	workPathConfigDir      string
 	workPathBaseDockerfile string
 	workPathDockerDir      string
+	workPathImageDigests   string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -65,6 +69,28 @@ agent.
 	},
 }
 
+// exitError is returned by commands exiting with a specific code. Errors
+// already reported by the command have no message.
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+
+// ExitCode returns the exit code for an error returned by Execute
+func ExitCode(err error) int {
+	if e, ok := err.(*exitError); ok {
+		return e.code
+	}
+	return 1
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(f *app.Fissile, v string) error {
@@ -118,7 +144,7 @@ func init() {
 		"cache-dir",
 		"c",
 		filepath.Join(os.Getenv("HOME"), ".bosh", "cache"),
-		"Local BOSH cache directory.",
+		"Local BOSH cache directory; releases downloaded for the role manifest are cached below it.",
 	)
 
 	RootCmd.PersistentFlags().StringP(
@@ -170,11 +196,25 @@ func init() {
 		"Number of workers to use; zero means determine based on CPU count.",
 	)
 
+	RootCmd.PersistentFlags().IntP(
+		"download-workers",
+		"",
+		4,
+		"Maximum number of releases referenced by the role manifest to download at the same time; zero means no limit.",
+	)
+
+	RootCmd.PersistentFlags().IntP(
+		"download-retries",
+		"",
+		3,
+		"Number of times a failed release download is retried, with exponential backoff.",
+	)
+
 	RootCmd.PersistentFlags().StringP(
 		"light-opinions",
 		"l",
 		"",
-		"Path to a BOSH deployment manifest file that contains properties to be used as defaults.",
+		"Paths to BOSH deployment manifest files that contain properties to be used as defaults, separated by commas. Later files are deep-merged over earlier ones.",
 	)
 
 	RootCmd.PersistentFlags().StringP(
@@ -188,14 +228,14 @@ func init() {
 		"metrics",
 		"M",
 		"",
-		"Path to a CSV file to store timing metrics into.",
+		"Path to a CSV file to store timing metrics into. Compilation times recorded there are used to schedule the slowest packages first.",
 	)
 
 	RootCmd.PersistentFlags().StringP(
 		"output",
 		"o",
 		app.OutputFormatHuman,
-		"Choose output format, one of human, json, or yaml (currently only for 'show properties')",
+		"Choose output format, one of human, json, or yaml (currently only for 'show properties', 'show compilation-log', 'build packages --dry-run' and 'validate', which also supports sarif)",
 	)
 
 	RootCmd.PersistentFlags().BoolP(
@@ -245,14 +285,15 @@ func extendPathsFromWorkDirectory() {
 	workPathConfigDir = filepath.Join(workDir, "config")
 	workPathBaseDockerfile = filepath.Join(workDir, "base_dockerfile")
 	workPathDockerDir = filepath.Join(workDir, "dockerfiles")
+	workPathImageDigests = filepath.Join(workDir, "image-digests.yml")
 
 	// Set defaults for empty flags
 	if flagRoleManifest == "" {
 		flagRoleManifest = filepath.Join(workDir, "role-manifest.yml")
 	}
 
-	if flagLightOpinions == "" {
-		flagLightOpinions = filepath.Join(workDir, "opinions.yml")
+	if len(flagLightOpinions) == 0 {
+		flagLightOpinions = []string{filepath.Join(workDir, "opinions.yml")}
 	}
 
 	if flagDarkOpinions == "" {
@@ -275,7 +316,9 @@ func validateBasicFlags() error {
 	flagDockerUsername = viper.GetString("docker-username")
 	flagDockerPassword = viper.GetString("docker-password")
 	flagWorkers = viper.GetInt("workers")
-	flagLightOpinions = viper.GetString("light-opinions")
+	flagDownloadWorkers = viper.GetInt("download-workers")
+	flagDownloadRetries = viper.GetInt("download-retries")
+	flagLightOpinions = splitNonEmpty(viper.GetString("light-opinions"), ",")
 	flagDarkOpinions = viper.GetString("dark-opinions")
 	flagOutputFormat = viper.GetString("output")
 	flagMetrics = viper.GetString("metrics")
@@ -291,7 +334,6 @@ func validateBasicFlags() error {
 		&flagRoleManifest,
 		&flagCacheDir,
 		&flagWorkDir,
-		&flagLightOpinions,
 		&flagDarkOpinions,
 		&flagMetrics,
 		&workPathCompilationDir,
@@ -306,6 +348,16 @@ func validateBasicFlags() error {
 		return err
 	}
 
+	if flagLightOpinions, err = absolutePathsForArray(flagLightOpinions); err != nil {
+		return err
+	}
+
+	fissile.ReleaseDownloads.Workers = flagDownloadWorkers
+	fissile.ReleaseDownloads.Retries = flagDownloadRetries
+	fissile.ReleaseDownloads.RetryBackoff = time.Second
+
+	fissile.HideManifestWarnings = app.OutputFormat(flagOutputFormat) != app.OutputFormatHuman
+
 	return nil
 }
 
@@ -382,3 +434,17 @@ func splitNonEmpty(value string, separator string) []string {
 	}
 	return r
 }
+
+// parseKeyValues parses the values of a flag given as key=value pairs, like
+// labels and annotations
+func parseKeyValues(flag string, values []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid %s format '%s'. Use: --%s \"foo=bar\"", flag, value, flag)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// showCompilationLogCmd represents the compilation-log command
+var showCompilationLogCmd = &cobra.Command{
+	Use:   "compilation-log <package>",
+	Short: "Displays the output of the last compilation of a package.",
+	Long: `
+Every package compiled by ` + "`fissile build packages`" + ` leaves its output in the
+work dir, next to the compiled package, together with the exit code, duration and
+stemcell of the compilation. This command shows them, whether the compilation
+succeeded or not.
+
+Use ` + "`<release>/<package>`" + ` when several releases carry a package of the
+same name. If the package was compiled on several stemcells, the most recent
+compilation is shown, unless ` + "`--stemcell`" + ` is given.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || args[0] == "" {
+			return fmt.Errorf("Expected exactly one package name")
+		}
+
+		flagShowCompilationLogStemcell := showCompilationLogViper.GetString("stemcell")
+
+		err := fissile.LoadManifest(
+			flagRoleManifest,
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowCompilationLog(
+			workPathCompilationDir,
+			flagShowCompilationLogStemcell,
+			args[0],
+			app.OutputFormat(flagOutputFormat),
+		)
+	},
+}
+
+var showCompilationLogViper = viper.New()
+
+func init() {
+	initViper(showCompilationLogViper)
+
+	showCmd.AddCommand(showCompilationLogCmd)
+
+	showCompilationLogCmd.PersistentFlags().StringP(
+		"stemcell",
+		"s",
+		"",
+		"Only show compilations on the given stemcell",
+	)
+
+	showCompilationLogViper.BindPFlags(showCompilationLogCmd.PersistentFlags())
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"code.cloudfoundry.org/fissile/app"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // showPropertiesCmd represents the properties command
@@ -12,10 +13,17 @@ var showPropertiesCmd = &cobra.Command{
 	Long: `
 Displays a report of all properties of all the jobs in the referenced releases.
 The report lists the properties per job per release, with their default value.
+
+With ` + "`--opinions`" + ` the report lists the light opinions instead, as merged from
+all the light opinion files, with the file each value came from.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Show property information
 
+		if showPropertiesViper.GetBool("opinions") {
+			return fissile.ListOpinions(flagLightOpinions, flagDarkOpinions, app.OutputFormat(flagOutputFormat))
+		}
+
 		err := fissile.LoadManifest(
 			flagRoleManifest,
 			flagRelease,
@@ -31,6 +39,19 @@ The report lists the properties per job per release, with their default value.
 	},
 }
 
+var showPropertiesViper = viper.New()
+
 func init() {
+	initViper(showPropertiesViper)
+
 	showCmd.AddCommand(showPropertiesCmd)
+
+	showPropertiesCmd.PersistentFlags().BoolP(
+		"opinions",
+		"",
+		false,
+		"If the flag is set, show the merged light opinions and the file each value came from",
+	)
+
+	showPropertiesViper.BindPFlags(showPropertiesCmd.PersistentFlags())
 }
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"code.cloudfoundry.org/fissile/app"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // validateCmd represents the release command
@@ -10,26 +12,79 @@ var validateCmd = &cobra.Command{
 	Short: "Validates all the configuration going into fissile.",
 	Long: `
 Displays a report of all validation checks.
+
+With ` + "`--output json`" + `, ` + "`yaml`" + ` or ` + "`sarif`" + ` the report lists each error with the
+ID of the check which found it, and its position in the role manifest, opinions
+or env files. The exit code is 1 if the inputs are invalid, and 2 if they could
+not be validated.
+
+Checks reporting warnings don't fail the validation, unless ` + "`--strict`" + ` is
+given. The role manifest can suppress checks for some of its fields in its
+` + "`validation.suppressions`" + `.
+
+With ` + "`--fix`" + ` the problems with a single obvious fix are fixed by rewriting the
+role manifest and opinion files in place, keeping their comments and order:
+unsorted variables and templates, light opinions duplicated by global templates,
+and undefined dark opinions. The changes are shown as a diff, and the remaining
+problems are reported. The json, yaml and sarif reports list the changed files
+instead.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flagBuildHelmDefaultEnvFiles = splitNonEmpty(buildHelmViper.GetString("defaults-file"), ",")
-
-		err := fissile.LoadManifest(
-			flagRoleManifest,
-			flagRelease,
-			flagReleaseName,
-			flagReleaseVersion,
-			flagCacheDir,
-		)
-		if err != nil {
-			return err
+		flagValidateDefaultEnvFiles := splitNonEmpty(validateViper.GetString("defaults-file"), ",")
+		outputFormat := app.OutputFormat(flagOutputFormat)
+		flagValidateStrict := validateViper.GetBool("strict")
+
+		// The warnings are part of the report
+		fissile.HideManifestWarnings = true
+
+		validate := func() error {
+			err := fissile.LoadManifest(
+				flagRoleManifest,
+				flagRelease,
+				flagReleaseName,
+				flagReleaseVersion,
+				flagCacheDir,
+			)
+			if err != nil {
+				return err
+			}
+			return fissile.Validate(flagLightOpinions, flagDarkOpinions, flagValidateDefaultEnvFiles, outputFormat, flagValidateStrict)
+		}
+
+		err := validate()
+		var fixedPaths []string
+		if validateViper.GetBool("fix") {
+			var fixErr error
+			fixedPaths, fixErr = fissile.FixValidation(err, flagRoleManifest, flagLightOpinions, flagDarkOpinions, outputFormat)
+			if fixErr != nil {
+				return &exitError{err: fixErr, code: 2}
+			}
+			if len(fixedPaths) > 0 {
+				// Report what is left
+				err = validate()
+			}
 		}
 
-		return fissile.Validate(flagLightOpinions, flagDarkOpinions, flagBuildHelmDefaultEnvFiles)
+		err = fissile.ReportValidation(err, fixedPaths, outputFormat)
+		switch err.(type) {
+		case nil:
+			return nil
+		case *app.ValidationError:
+			if outputFormat != app.OutputFormatHuman {
+				// Already reported
+				return &exitError{code: 1}
+			}
+			return err
+		default:
+			return &exitError{err: err, code: 2}
+		}
 	},
 }
 
+var validateViper = viper.New()
+
 func init() {
+	initViper(validateViper)
 
 	validateCmd.PersistentFlags().StringP(
 		"defaults-file",
@@ -38,5 +93,21 @@ func init() {
 		"Env files that contain defaults for the configuration variables",
 	)
 
+	validateCmd.PersistentFlags().BoolP(
+		"strict",
+		"",
+		false,
+		"Fail the validation on warnings",
+	)
+
+	validateCmd.PersistentFlags().BoolP(
+		"fix",
+		"",
+		false,
+		"Fix the problems with a single obvious fix, rewriting the files in place",
+	)
+
+	validateViper.BindPFlags(validateCmd.PersistentFlags())
+
 	RootCmd.AddCommand(validateCmd)
 }
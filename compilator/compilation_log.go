@@ -0,0 +1,174 @@
+package compilator
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	compilationLogOutputFile = "compilation.log"
+	compilationLogInfoFile   = "compilation.yml"
+)
+
+// CompilationLog describes the last compilation of a package. It is kept in
+// the work dir next to the compiled package, together with the output of the
+// compilation (see CompilationLogOutputPath).
+type CompilationLog struct {
+	Name        string    `json:"name" yaml:"name"`
+	Release     string    `json:"release" yaml:"release"`
+	Fingerprint string    `json:"fingerprint" yaml:"fingerprint"`
+	Stemcell    string    `json:"stemcell" yaml:"stemcell"`
+	Started     time.Time `json:"started" yaml:"started"`
+	// Duration is the time spent compiling, in seconds
+	Duration float64 `json:"duration" yaml:"duration"`
+	// ExitCode is the exit code of the compilation script, or -1 if the
+	// script could not be run at all
+	ExitCode int    `json:"exit_code" yaml:"exit_code"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// CompilationLogOutputPath returns the path of the file holding the output of
+// the last compilation of the package with the given fingerprint
+func CompilationLogOutputPath(workDir, fingerprint string) string {
+	return filepath.Join(workDir, fingerprint, compilationLogOutputFile)
+}
+
+// ReadCompilationLog returns the description of the last compilation of the
+// package with the given fingerprint, or nil if it was never compiled in the
+// given work dir
+func ReadCompilationLog(workDir, fingerprint string) (*CompilationLog, error) {
+	infoPath := filepath.Join(workDir, fingerprint, compilationLogInfoFile)
+
+	contents, err := ioutil.ReadFile(infoPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var compilationLog CompilationLog
+	if err := yaml.Unmarshal(contents, &compilationLog); err != nil {
+		return nil, fmt.Errorf("Error reading compilation log %s: %s", infoPath, err.Error())
+	}
+
+	return &compilationLog, nil
+}
+
+// compilationLogWriter records the output of a package compilation in the
+// work dir
+type compilationLogWriter struct {
+	log          CompilationLog
+	infoPath     string
+	file         *os.File
+	stdoutWriter *docker.FormattingWriter
+	stderrWriter *docker.FormattingWriter
+}
+
+// newCompilationLogWriter starts recording the compilation of a package,
+// replacing whatever an earlier compilation left behind
+func (c *Compilator) newCompilationLogWriter(pkg *model.Package) (*compilationLogWriter, error) {
+	logDir := filepath.Join(c.hostWorkDir, pkg.Fingerprint)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+
+	infoPath := filepath.Join(logDir, compilationLogInfoFile)
+	if err := os.RemoveAll(infoPath); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(CompilationLogOutputPath(c.hostWorkDir, pkg.Fingerprint))
+	if err != nil {
+		return nil, err
+	}
+
+	// Both streams go to the same file; write whole lines only so they
+	// don't get mixed up
+	fileWriter := util.NewSyncedWriter(file)
+
+	var releaseName string
+	if pkg.Release != nil {
+		releaseName = pkg.Release.Name
+	}
+
+	return &compilationLogWriter{
+		log: CompilationLog{
+			Name:        pkg.Name,
+			Release:     releaseName,
+			Fingerprint: pkg.Fingerprint,
+			Stemcell:    c.stemcellImageName,
+			Started:     time.Now().UTC(),
+		},
+		infoPath:     infoPath,
+		file:         file,
+		stdoutWriter: docker.NewFormattingWriter(fileWriter, nil),
+		stderrWriter: docker.NewFormattingWriter(fileWriter, nil),
+	}, nil
+}
+
+// stdout returns a writer sending the compilation output both to the log
+// file and the given writer
+func (w *compilationLogWriter) stdout(writer *docker.FormattingWriter) io.WriteCloser {
+	return &teeWriteCloser{
+		Writer:  io.MultiWriter(w.stdoutWriter, writer),
+		closers: []io.Closer{w.stdoutWriter, writer},
+	}
+}
+
+// stderr returns a writer sending the compilation errors both to the log
+// file and the given writer
+func (w *compilationLogWriter) stderr(writer *docker.FormattingWriter) io.WriteCloser {
+	return &teeWriteCloser{
+		Writer:  io.MultiWriter(w.stderrWriter, writer),
+		closers: []io.Closer{w.stderrWriter, writer},
+	}
+}
+
+// finish records the outcome of the compilation
+func (w *compilationLogWriter) finish(exitCode int, compileErr error) error {
+	w.log.Duration = time.Since(w.log.Started).Seconds()
+	w.log.ExitCode = exitCode
+	if compileErr != nil {
+		w.log.Error = compileErr.Error()
+	}
+
+	w.stdoutWriter.Close()
+	w.stderrWriter.Close()
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	contents, err := yaml.Marshal(w.log)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(w.infoPath, contents, 0644)
+}
+
+// teeWriteCloser is an io.MultiWriter that also closes all its writers, so
+// FormattingWriters get to flush their last line
+type teeWriteCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// Close implements io.Closer for teeWriteCloser
+func (t *teeWriteCloser) Close() error {
+	var firstErr error
+	for _, closer := range t.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,83 @@
+package compilator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompilationLog(t *testing.T) {
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	c, err := NewDockerCompilator(nil, compilationWorkDir, "", "stemcell", "", "", "", false, ui, nil, nil)
+	require.NoError(t, err)
+
+	pkg := &model.Package{
+		Name:        "ruby-2.5",
+		Fingerprint: "abc",
+		Release:     &model.Release{Name: "test-release"},
+	}
+
+	compilationLog, err := ReadCompilationLog(compilationWorkDir, pkg.Fingerprint)
+	assert.NoError(err)
+	assert.Nil(compilationLog, "packages which were never compiled have no log")
+
+	logWriter, err := c.newCompilationLogWriter(pkg)
+	require.NoError(t, err)
+
+	uiOutput := util.NewSyncedWriter(ioutil.Discard)
+	stdout := logWriter.stdout(docker.NewFormattingWriter(uiOutput, nil))
+	stderr := logWriter.stderr(docker.NewFormattingWriter(uiOutput, nil))
+	fmt.Fprint(stdout, "configure\nma")
+	fmt.Fprint(stderr, "warning: deprecated\n")
+	fmt.Fprint(stdout, "ke\nmake install")
+	assert.NoError(stdout.Close())
+	assert.NoError(stderr.Close())
+	assert.NoError(logWriter.finish(2, fmt.Errorf("exited with code 2")))
+
+	compilationLog, err = ReadCompilationLog(compilationWorkDir, pkg.Fingerprint)
+	if assert.NoError(err) && assert.NotNil(compilationLog) {
+		assert.Equal("ruby-2.5", compilationLog.Name)
+		assert.Equal("test-release", compilationLog.Release)
+		assert.Equal("abc", compilationLog.Fingerprint)
+		assert.Equal("stemcell", compilationLog.Stemcell)
+		assert.Equal(2, compilationLog.ExitCode)
+		assert.Equal("exited with code 2", compilationLog.Error)
+		assert.False(compilationLog.Started.IsZero())
+	}
+
+	output, err := ioutil.ReadFile(CompilationLogOutputPath(compilationWorkDir, pkg.Fingerprint))
+	assert.NoError(err)
+	assert.Equal("configure\nwarning: deprecated\nmake\nmake install\n", string(output))
+
+	// A new compilation replaces the log of the previous one
+	logWriter, err = c.newCompilationLogWriter(pkg)
+	require.NoError(t, err)
+
+	compilationLog, err = ReadCompilationLog(compilationWorkDir, pkg.Fingerprint)
+	assert.NoError(err)
+	assert.Nil(compilationLog, "the outcome of a running compilation is unknown")
+
+	assert.NoError(logWriter.finish(0, nil))
+
+	compilationLog, err = ReadCompilationLog(compilationWorkDir, pkg.Fingerprint)
+	if assert.NoError(err) && assert.NotNil(compilationLog) {
+		assert.Equal(0, compilationLog.ExitCode)
+		assert.Empty(compilationLog.Error)
+	}
+
+	output, err = ioutil.ReadFile(CompilationLogOutputPath(compilationWorkDir, pkg.Fingerprint))
+	assert.NoError(err)
+	assert.Empty(output)
+}
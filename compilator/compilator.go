@@ -9,7 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/fissile/docker"
@@ -66,6 +66,51 @@ type Compilator struct {
 	keepContainer      bool
 	ui                 *termui.UI
 	grapher            util.ModelGrapher
+
+	// stemcellRootfs is the stemcell root filesystem used by rootless
+	// compilation; it is unpacked into rootfsDir on first use
+	stemcellRootfs string
+	rootfsOnce     sync.Once
+	rootfsDir      string
+	rootfsErr      error
+}
+
+// NewRootlessCompilator will create an instance of the Compilator compiling
+// in user and mount namespaces, chrooted into the stemcell root filesystem.
+// This needs neither root nor docker (Linux only). The stemcell root
+// filesystem is either a directory, a tarball of one, or an image archive
+// from `docker save`.
+func NewRootlessCompilator(
+	hostWorkDir string,
+	metricsPath string,
+	stemcellImageName string,
+	stemcellRootfs string,
+	baseType string,
+	fissileVersion string,
+	ui *termui.UI,
+	grapher util.ModelGrapher,
+	packageStorage *PackageStorage,
+) (*Compilator, error) {
+
+	if stemcellRootfs == "" {
+		return nil, fmt.Errorf("Rootless compilation needs the stemcell root filesystem")
+	}
+
+	compilator := &Compilator{
+		hostWorkDir:        hostWorkDir,
+		metricsPath:        metricsPath,
+		stemcellImageName:  stemcellImageName,
+		stemcellRootfs:     stemcellRootfs,
+		baseType:           baseType,
+		fissileVersion:     fissileVersion,
+		compilePackage:     (*Compilator).compilePackageRootless,
+		ui:                 ui,
+		grapher:            grapher,
+		packageStorage:     packageStorage,
+		signalDependencies: make(map[string]chan struct{}),
+	}
+
+	return compilator, nil
 }
 
 type compileJob struct {
@@ -183,6 +228,12 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanc
 	}
 	sort.Sort(packages)
 
+	durations, err := c.compileDurations()
+	if err != nil {
+		// Not knowing the history only makes the schedule worse
+		c.ui.Println(color.YellowString("Ignoring compilation history: %s", err.Error()))
+	}
+
 	// Setup the queuing system ...
 	doneCh := make(chan compileResult)
 	killCh := make(chan struct{})
@@ -190,7 +241,7 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanc
 	workerLib.MaxJobs = workerCount
 
 	worker := workerLib.NewWorker()
-	buckets := createDepBuckets(packages)
+	buckets := createDepBuckets(packages, durations)
 
 	// ... load it with the jobs to run ...
 	for _, pkg := range buckets {
@@ -392,34 +443,32 @@ func (j compileJob) Run() {
 	}
 }
 
-func createDepBuckets(packages []*model.Package) []*model.Package {
+// createDepBuckets orders the packages for compilation. Every package is
+// queued only after all of its dependencies, and among the packages ready to
+// be queued the one heading the longest remaining chain of compilation time
+// goes first. This keeps slow packages (and the packages waiting on them)
+// from being started last, when the other workers have already run out of
+// things to do. Compilation times come from durations, keyed by
+// compileDurationKey; unknown packages are assumed to take the average time.
+func createDepBuckets(packages []*model.Package, durations map[string]time.Duration) []*model.Package {
 	var buckets []*model.Package
 
-	// ruby takes forever and has no deps,
-	// so optimize by moving ruby packages to the front
-	var rubies []*model.Package
-
-	// topological sort, ensuring that each package X is queued
-	// only after all of its dependencies.
-
 	// helper data structures:
 	// 1. map: package fingerprint -> #(unqueued deps)
 	// 2. map: package fingerprint -> list of using packages (inverted dependencies)
+	// 3. map: package fingerprint -> position in the input, to break ties
 	//
 	// The counters in the 1st map are initialized with the number
 	// of actual dependencies, and then counted down as
 	// these dependencies are queued up.
 	//
-	// When the counter for a package P reaches 0 then P can be
-	// queued, and in turn bumps the counters of all packages
-	// using it.
-	//
-	// The counters additionally serve as flags for when a package
-	// is queued/processed, saving us a separate boolean
-	// flag. This is done by dropping the respective depCount to -1 (**).
+	// When the counter for a package P reaches 0 then P is ready
+	// to be queued, and once queued in turn bumps the counters of
+	// all packages using it.
 
 	revDeps := make(map[string][]*model.Package)
 	depCount := make(map[string]int)
+	position := make(map[string]int)
 
 	// Initialize the depCount first. In the next loop we can use
 	// the presence of a package P in depCount as the indicator
@@ -427,8 +476,9 @@ func createDepBuckets(packages []*model.Package) []*model.Package {
 	// with 'isPackageCompiledHarness' and incurring a dependency
 	// on a Compilator structure.
 
-	for _, pkg := range packages {
+	for index, pkg := range packages {
 		depCount[pkg.Fingerprint] = 0
+		position[pkg.Fingerprint] = index
 	}
 
 	// Finalize the depCount and initialize the map of reverse
@@ -458,51 +508,72 @@ func createDepBuckets(packages []*model.Package) []*model.Package {
 		}
 	}
 
-	// Iterate until we have handled all packages.  We expect each
-	// iteration to handle at least one package, because the input
-	// is a DAG, i.e. has no cycles. Therefore each iteration will
-	// have at least one package with no dependencies, and being
-	// handled.
+	// The priority of a package P is the compilation time of the
+	// longest chain starting at P, i.e. the time of P itself plus
+	// the highest priority of all packages using it. The input is
+	// a DAG, so the recursion terminates.
 
-	keepRunning := true
-	for keepRunning {
-		keepRunning = false
+	defaultDuration := averageCompileDuration(packages, durations)
+	priority := make(map[string]time.Duration)
 
-		for _, pkg := range packages {
+	var prioritize func(pkg *model.Package) time.Duration
+	prioritize = func(pkg *model.Package) time.Duration {
+		if value, ok := priority[pkg.Fingerprint]; ok {
+			return value
+		}
 
-			// The package either still has dependencies waiting (depCount > 0),
-			// or is enqueued and processed ((**) depCount == -1 < 0)
-			if depCount[pkg.Fingerprint] != 0 {
-				continue
+		var longestUse time.Duration
+		for _, usr := range revDeps[pkg.Fingerprint] {
+			if value := prioritize(usr); value > longestUse {
+				longestUse = value
 			}
+		}
 
-			// depCount == 0, time to
-			// - queue the package
-			// - notify the outer loop to keep running, and
-			// - force the following iterations to ignore
-			//   the package (See (**)).
-			depCount[pkg.Fingerprint]--
-			keepRunning = true
-
-			// notify the users of the queued that another
-			// of their dependencies is handled
-			for _, usr := range revDeps[pkg.Fingerprint] {
-				depCount[usr.Fingerprint]--
-			}
+		duration, ok := durations[compileDurationKey(pkg)]
+		if !ok {
+			duration = defaultDuration
+		}
+		priority[pkg.Fingerprint] = duration + longestUse
 
-			// rubies are special, see notes at top of function
-			if strings.HasPrefix(pkg.Name, "ruby-2.") {
-				rubies = append(rubies, pkg)
-				continue
-			}
+		return priority[pkg.Fingerprint]
+	}
 
-			// queue regular
-			buckets = append(buckets, pkg)
+	var ready []*model.Package
+	for _, pkg := range packages {
+		prioritize(pkg)
+		if depCount[pkg.Fingerprint] == 0 {
+			ready = append(ready, pkg)
 		}
 	}
 
-	// prepend rubies to get them out of the way first
-	buckets = append(rubies, buckets...)
+	// Queue the ready package with the highest priority until we
+	// have handled all packages.  We expect each iteration to make
+	// at least one more package ready, unless none are left,
+	// because the input is a DAG, i.e. has no cycles.
+
+	for len(ready) > 0 {
+		next := 0
+		for index, pkg := range ready {
+			if priority[pkg.Fingerprint] > priority[ready[next].Fingerprint] ||
+				(priority[pkg.Fingerprint] == priority[ready[next].Fingerprint] &&
+					position[pkg.Fingerprint] < position[ready[next].Fingerprint]) {
+				next = index
+			}
+		}
+
+		pkg := ready[next]
+		ready = append(ready[:next], ready[next+1:]...)
+		buckets = append(buckets, pkg)
+
+		// notify the users of the queued that another
+		// of their dependencies is handled
+		for _, usr := range revDeps[pkg.Fingerprint] {
+			depCount[usr.Fingerprint]--
+			if depCount[usr.Fingerprint] == 0 {
+				ready = append(ready, usr)
+			}
+		}
+	}
 
 	return buckets
 }
@@ -534,6 +605,12 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 	// Run compilation in container
 	containerName := c.getPackageContainerName(pkg)
 
+	// Keep the output in the work dir, whatever the outcome
+	compilationLog, err := c.newCompilationLogWriter(pkg)
+	if err != nil {
+		return err
+	}
+
 	// in-memory buffer of the log
 	log := new(bytes.Buffer)
 	logWriter := util.NewSyncedWriter(log)
@@ -569,9 +646,12 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 		NetworkMode:   c.dockerNetworkMode,
 		Volumes:       map[string]map[string]string{sourceMountName: nil},
 		KeepContainer: c.keepContainer,
-		StdoutWriter:  stdoutWriter,
-		StderrWriter:  stderrWriter,
+		StdoutWriter:  compilationLog.stdout(stdoutWriter),
+		StderrWriter:  compilationLog.stderr(stderrWriter),
 	})
+	if logErr := compilationLog.finish(exitCode, err); logErr != nil {
+		c.ui.Println(color.YellowString("Error saving compilation log for package %s: %s", pkg.Name, logErr.Error()))
+	}
 
 	if container != nil && (!c.keepContainer || err == nil || exitCode == 0) {
 		// Attention. While the assignments to 'err' in the
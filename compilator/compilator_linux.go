@@ -11,6 +11,7 @@ import (
 	"code.cloudfoundry.org/fissile/docker"
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/scripts/compilation"
+	"code.cloudfoundry.org/fissile/util"
 	"github.com/fatih/color"
 )
 
@@ -37,6 +38,12 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 		return fmt.Errorf("failed to extract package: %s", err)
 	}
 
+	// Keep the output in the work dir, whatever the outcome
+	compilationLog, err := c.newCompilationLogWriter(pkg)
+	if err != nil {
+		return fmt.Errorf("failed to create compilation log: %s", err)
+	}
+
 	// in-memory buffer of the log
 	log := new(bytes.Buffer)
 
@@ -62,20 +69,34 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 		Args:   []string{"bash", hostScriptPath, pkg.Name, pkg.Version, c.hostWorkDir},
 		Env:    append(os.Environ(), "HOST_USERID=1000", "HOST_USERGID=1000"),
 		Dir:    c.hostWorkDir,
-		Stdout: stdoutWriter,
-		Stderr: stderrWriter,
+		Stdout: compilationLog.stdout(stdoutWriter),
+		Stderr: compilationLog.stderr(stderrWriter),
 		SysProcAttr: &syscall.SysProcAttr{
 			Cloneflags: syscall.CLONE_NEWNS,
 		},
 	}
 	err = cmd.Run()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	exitCode := 0
 	if err != nil {
-		log.WriteTo(c.ui)
+		exitCode = -1
 		if exitError, ok := err.(*exec.ExitError); ok {
-			if waitStatus, ok := exitError.Sys().(*syscall.WaitStatus); ok {
-				return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, waitStatus.ExitStatus())
+			if waitStatus, ok := exitError.Sys().(syscall.WaitStatus); ok {
+				exitCode = waitStatus.ExitStatus()
 			}
 		}
+	}
+	if logErr := compilationLog.finish(exitCode, err); logErr != nil {
+		c.ui.Println(color.YellowString("Error saving compilation log for package %s: %s", pkg.Name, logErr.Error()))
+	}
+
+	if err != nil {
+		log.WriteTo(c.ui)
+		if exitCode != -1 {
+			return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, exitCode)
+		}
 		return fmt.Errorf("Error compiling package %s: %s", pkg.Name, err)
 	}
 
@@ -83,3 +104,132 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 		pkg.GetPackageCompiledTempDir(c.hostWorkDir),
 		pkg.GetPackageCompiledDir(c.hostWorkDir))
 }
+
+func (c *Compilator) compilePackageRootless(pkg *model.Package) (err error) {
+	rootDir, err := c.stemcellRootDir()
+	if err != nil {
+		return err
+	}
+
+	// Prepare input dir (package plus deps)
+	if err := c.createCompilationDirStructure(pkg); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+
+	if err := c.copyDependencies(pkg); err != nil {
+		return fmt.Errorf("failed to copy dependencies: %s", err)
+	}
+
+	// Generate the compilation scripts; the compilation script runs
+	// chrooted, the rootless script sets that up
+	sourcesDir := pkg.GetTargetPackageSourcesDir(c.hostWorkDir)
+	if err := compilation.SaveScript(c.baseType, compilation.CompilationScript, filepath.Join(sourcesDir, "compile.sh")); err != nil {
+		return fmt.Errorf("failed to copy compilation script: %s", err)
+	}
+	rootlessScriptPath := filepath.Join(c.hostWorkDir, pkg.Fingerprint, "rootless.sh")
+	if err := compilation.SaveScript(c.baseType, compilation.RootlessScript, rootlessScriptPath); err != nil {
+		return fmt.Errorf("failed to copy rootless compilation script: %s", err)
+	}
+
+	// Extract package
+	extractDir := c.getSourcePackageDir(pkg)
+	if _, err := pkg.Extract(extractDir); err != nil {
+		return fmt.Errorf("failed to extract package: %s", err)
+	}
+
+	compiledTempDir := pkg.GetPackageCompiledTempDir(c.hostWorkDir)
+	if err := os.RemoveAll(compiledTempDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(compiledTempDir, 0755); err != nil {
+		return err
+	}
+
+	scratchDir := filepath.Join(c.hostWorkDir, pkg.Fingerprint, "scratch")
+	if err := os.RemoveAll(scratchDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratchDir)
+
+	// Keep the output in the work dir, whatever the outcome
+	compilationLog, err := c.newCompilationLogWriter(pkg)
+	if err != nil {
+		return fmt.Errorf("failed to create compilation log: %s", err)
+	}
+
+	// in-memory buffer of the log
+	log := new(bytes.Buffer)
+	logWriter := util.NewSyncedWriter(log)
+
+	stdoutWriter := docker.NewFormattingWriter(
+		logWriter,
+		func(line string) string {
+			return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.WhiteString("%s", line))
+		},
+	)
+	stderrWriter := docker.NewFormattingWriter(
+		logWriter,
+		func(line string) string {
+			return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.RedString("%s", line))
+		},
+	)
+
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		return fmt.Errorf("Failed to find bash: %s", err)
+	}
+
+	// Inside the user namespace we are root, i.e. the owner of the stemcell
+	// root filesystem and the work dir. No other user exists in there.
+	cmd := &exec.Cmd{
+		Path: bashPath,
+		Args: []string{"bash", rootlessScriptPath, rootDir, sourcesDir, compiledTempDir, scratchDir, pkg.Name, pkg.Version},
+		Env: []string{
+			"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+			"HOME=/root",
+			"HOST_USERID=0",
+			"HOST_USERGID=0",
+		},
+		Dir:    c.hostWorkDir,
+		Stdout: compilationLog.stdout(stdoutWriter),
+		Stderr: compilationLog.stderr(stderrWriter),
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+			UidMappings: []syscall.SysProcIDMap{
+				{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+			},
+			GidMappings: []syscall.SysProcIDMap{
+				{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+			},
+			GidMappingsEnableSetgroups: false,
+		},
+	}
+	err = cmd.Run()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if waitStatus, ok := exitError.Sys().(syscall.WaitStatus); ok {
+				exitCode = waitStatus.ExitStatus()
+			}
+		}
+	}
+	if logErr := compilationLog.finish(exitCode, err); logErr != nil {
+		c.ui.Println(color.YellowString("Error saving compilation log for package %s: %s", pkg.Name, logErr.Error()))
+	}
+
+	if err != nil {
+		log.WriteTo(c.ui)
+		if exitCode != -1 {
+			return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, exitCode)
+		}
+		return fmt.Errorf("Error compiling package %s: %s", pkg.Name, err)
+	}
+
+	return os.Rename(
+		compiledTempDir,
+		pkg.GetPackageCompiledDir(c.hostWorkDir))
+}
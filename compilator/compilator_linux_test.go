@@ -62,3 +62,38 @@ func TestCompilePackageInMountNS(t *testing.T) {
 	err = c.Compile(2, []*model.Release{release}, nil, false)
 	assert.NoError(err, stderr.String())
 }
+
+func TestCompilePackageRootless(t *testing.T) {
+	assert := assert.New(t)
+
+	// A stemcell root filesystem, e.g. from `docker export`
+	stemcellRootfs := os.Getenv("FISSILE_TEST_STEMCELL_ROOTFS")
+	if stemcellRootfs == "" {
+		t.Skip("rootless compilation requires FISSILE_TEST_STEMCELL_ROOTFS")
+	}
+
+	stderr := &LockedBuffer{}
+	ui := termui.New(&bytes.Buffer{}, stderr, nil)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/no-license")
+	releasePathBoshCache := filepath.Join(workDir, "../test-assets/bosh-cache")
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	if !assert.NoError(err) {
+		return
+	}
+
+	tempDir, err := ioutil.TempDir("", "fissile-test-compile-rootless")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	c, err := NewRootlessCompilator(tempDir, "", "repo", stemcellRootfs, "linux", "0", ui, nil, nil)
+	assert.NoError(err)
+
+	err = c.Compile(2, []*model.Release{release}, nil, false)
+	assert.NoError(err, stderr.String())
+}
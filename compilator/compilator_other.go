@@ -11,3 +11,7 @@ import (
 func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 	return fmt.Errorf("Compilation without docker is not supported outside Linux")
 }
+
+func (c *Compilator) compilePackageRootless(pkg *model.Package) (err error) {
+	return fmt.Errorf("Rootless compilation is not supported outside Linux")
+}
@@ -17,6 +17,8 @@ import (
 	"code.cloudfoundry.org/fissile/util"
 	"github.com/SUSE/termui"
 	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/graymeta/stow"
+	"github.com/graymeta/stow/local"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -87,7 +89,8 @@ func TestCompilationBasic(t *testing.T) {
 		close(waitCh)
 	}()
 
-	for _, expectedName := range []string{"ruby-2.5", "go-1.4", "consul"} {
+	// Without history, go-1.4 heads the longest chain (go-1.4, consul)
+	for _, expectedName := range []string{"go-1.4", "consul", "ruby-2.5"} {
 		select {
 		case pkgName := <-compileChan:
 			assert.Equal(pkgName, expectedName)
@@ -102,12 +105,6 @@ func TestCompilationBasic(t *testing.T) {
 	}
 
 	expected := []string{
-		",compile-packages::test-release/ruby-2.5,start",
-		",compile-packages::wait::test-release/ruby-2.5,start",
-		",compile-packages::wait::test-release/ruby-2.5,done",
-		",compile-packages::run::test-release/ruby-2.5,start",
-		",compile-packages::run::test-release/ruby-2.5,done",
-		",compile-packages::test-release/ruby-2.5,done",
 		",compile-packages::test-release/go-1.4,start",
 		",compile-packages::wait::test-release/go-1.4,start",
 		",compile-packages::wait::test-release/go-1.4,done",
@@ -120,6 +117,12 @@ func TestCompilationBasic(t *testing.T) {
 		",compile-packages::run::test-release/consul,start",
 		",compile-packages::run::test-release/consul,done",
 		",compile-packages::test-release/consul,done",
+		",compile-packages::test-release/ruby-2.5,start",
+		",compile-packages::wait::test-release/ruby-2.5,start",
+		",compile-packages::wait::test-release/ruby-2.5,done",
+		",compile-packages::run::test-release/ruby-2.5,start",
+		",compile-packages::run::test-release/ruby-2.5,done",
+		",compile-packages::test-release/ruby-2.5,done",
 	}
 
 	contents, err := ioutil.ReadFile(metrics)
@@ -668,14 +671,48 @@ func TestCreateDepBuckets(t *testing.T) {
 		},
 	}
 
-	buckets := createDepBuckets(packages)
+	// Without history, ties are broken by the input order
+	buckets := createDepBuckets(packages, nil)
 	assert.Equal(t, len(buckets), 4)
-	assert.Equal(t, buckets[0].Name, "ruby-2.5") // Ruby should be first
+	assert.Equal(t, buckets[0].Name, "go-1.4")
+	assert.Equal(t, buckets[1].Name, "ruby-2.5")
+	assert.Equal(t, buckets[2].Name, "consul")
+	assert.Equal(t, buckets[3].Name, "cloud_controller_go")
+
+	// A slow ruby goes first
+	buckets = createDepBuckets(packages, map[string]time.Duration{
+		"consul":              time.Minute,
+		"go-1.4":              time.Minute,
+		"ruby-2.5":            10 * time.Minute,
+		"cloud_controller_go": time.Minute,
+	})
+	assert.Equal(t, len(buckets), 4)
+	assert.Equal(t, buckets[0].Name, "ruby-2.5")
 	assert.Equal(t, buckets[1].Name, "go-1.4")
 	assert.Equal(t, buckets[2].Name, "consul")
 	assert.Equal(t, buckets[3].Name, "cloud_controller_go")
 }
 
+func TestCreateDepBucketsUnknownDurations(t *testing.T) {
+	t.Parallel()
+
+	packages := []*model.Package{
+		{Name: "fast", Fingerprint: "FA"},
+		{Name: "new", Fingerprint: "NE"},
+		{Name: "slow", Fingerprint: "SL"},
+	}
+
+	// Packages without history are assumed to take the average time
+	buckets := createDepBuckets(packages, map[string]time.Duration{
+		"fast": time.Second,
+		"slow": 5 * time.Minute,
+	})
+	assert.Equal(t, len(buckets), 3)
+	assert.Equal(t, buckets[0].Name, "slow")
+	assert.Equal(t, buckets[1].Name, "new")
+	assert.Equal(t, buckets[2].Name, "fast")
+}
+
 func TestCreateDepBucketsOnChain(t *testing.T) {
 	t.Parallel()
 
@@ -703,7 +740,7 @@ func TestCreateDepBucketsOnChain(t *testing.T) {
 		},
 	}
 
-	buckets := createDepBuckets(packages)
+	buckets := createDepBuckets(packages, nil)
 	assert.Equal(t, len(buckets), 3)
 	assert.Equal(t, buckets[0].Name, "A")
 	assert.Equal(t, buckets[1].Name, "C")
@@ -791,3 +828,52 @@ func genTestCase(args ...string) []*model.Release {
 
 	return []*model.Release{&release}
 }
+
+func TestPlan(t *testing.T) {
+	saveIsPackageCompiled := isPackageCompiledHarness
+	defer func() {
+		isPackageCompiledHarness = saveIsPackageCompiled
+	}()
+
+	isPackageCompiledHarness = func(c *Compilator, pkg *model.Package) (bool, error) {
+		return pkg.Name == "libyaml", nil
+	}
+
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	containerDir, err := util.TempDir("", "fissile-stow-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(containerDir)
+
+	configMap := stow.ConfigMap{local.ConfigKeyPath: containerDir}
+	p, err := NewPackageStorage(local.Kind, true, configMap, compilationWorkDir, "cache", "stemcell")
+	require.NoError(t, err)
+
+	c, err := NewDockerCompilator(nil, compilationWorkDir, "", "stemcell", "", "", "", false, ui, nil, p)
+	require.NoError(t, err)
+
+	releases := genTestCase("consul>go-1.4", "go-1.4", "ruby-2.5>libyaml", "libyaml")
+
+	// Pretend go was compiled before and uploaded to the package cache
+	goPackage, err := releases[0].LookupPackage("go-1.4")
+	require.NoError(t, err)
+	_, err = p.container.Put(p.uploadedPackageFilePath(goPackage), strings.NewReader("go"), 2, nil)
+	require.NoError(t, err)
+
+	plan, err := c.Plan(releases, nil)
+	require.NoError(t, err)
+
+	assert.Equal([]PlannedPackage{
+		{Name: "libyaml", Release: "test-release", Fingerprint: "libyaml", Dependencies: []string{}, Source: PackageSourceWorkDir},
+		{Name: "go-1.4", Release: "test-release", Fingerprint: "go-1.4", Dependencies: []string{}, Source: PackageSourceCache},
+		{Name: "consul", Release: "test-release", Fingerprint: "consul", Dependencies: []string{"go-1.4"}, Source: PackageSourceCompile},
+		{Name: "ruby-2.5", Release: "test-release", Fingerprint: "ruby-2.5", Dependencies: []string{"libyaml"}, Source: PackageSourceCompile},
+	}, plan)
+
+	// Planning must not keep the packages from being compiled afterwards
+	assert.Empty(c.signalDependencies)
+}
@@ -0,0 +1,122 @@
+package compilator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+const (
+	// compileRunSeriesPrefix is the metrics series recording the time spent
+	// compiling a single package, see compileJob.Run
+	compileRunSeriesPrefix = "compile-packages::run::"
+
+	// stampyTimeFormat is the format stampy writes timestamps in
+	stampyTimeFormat = "2006-01-02 15:04:05"
+
+	// minCompileDuration is the smallest compilation time assumed for a
+	// package; stampy only records whole seconds
+	minCompileDuration = time.Second
+)
+
+// compileDurationKey returns the key identifying a package in the durations
+// loaded by loadCompileDurations
+func compileDurationKey(pkg *model.Package) string {
+	if pkg.Release == nil {
+		return pkg.Name
+	}
+	return fmt.Sprintf("%s/%s", pkg.Release.Name, pkg.Name)
+}
+
+// compileDurations returns the compilation times recorded by earlier runs in
+// the metrics file, if there is one
+func (c *Compilator) compileDurations() (map[string]time.Duration, error) {
+	if c.metricsPath == "" {
+		return map[string]time.Duration{}, nil
+	}
+	return loadCompileDurations(c.metricsPath)
+}
+
+// loadCompileDurations reads the metrics file written by stampy and returns
+// the latest compilation time of every package found in it, keyed by
+// compileDurationKey. A missing file has no history.
+func loadCompileDurations(metricsPath string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+
+	file, err := os.Open(metricsPath)
+	if os.IsNotExist(err) {
+		return durations, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	starts := map[string]time.Time{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error reading metrics file %s: %s", metricsPath, err.Error())
+		}
+
+		if len(record) != 4 || !strings.HasPrefix(record[2], compileRunSeriesPrefix) {
+			continue
+		}
+
+		stamp, err := time.Parse(stampyTimeFormat, record[0])
+		if err != nil {
+			return nil, fmt.Errorf("Error reading metrics file %s: %s", metricsPath, err.Error())
+		}
+
+		key := strings.TrimPrefix(record[2], compileRunSeriesPrefix)
+
+		switch record[3] {
+		case "start":
+			starts[key] = stamp
+		case "done":
+			start, ok := starts[key]
+			if !ok {
+				continue
+			}
+			delete(starts, key)
+
+			duration := stamp.Sub(start)
+			if duration < minCompileDuration {
+				duration = minCompileDuration
+			}
+			durations[key] = duration
+		}
+	}
+
+	return durations, nil
+}
+
+// averageCompileDuration returns the mean of the known compilation times of
+// the given packages, to be used for packages without any history
+func averageCompileDuration(packages []*model.Package, durations map[string]time.Duration) time.Duration {
+	var total time.Duration
+	known := 0
+
+	for _, pkg := range packages {
+		if duration, ok := durations[compileDurationKey(pkg)]; ok {
+			total += duration
+			known++
+		}
+	}
+
+	if known == 0 {
+		return minCompileDuration
+	}
+
+	return total / time.Duration(known)
+}
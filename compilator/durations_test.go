@@ -0,0 +1,87 @@
+package compilator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCompileDurations(t *testing.T) {
+	assert := assert.New(t)
+
+	file, err := ioutil.TempFile("", "metrics")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`2018-01-01 10:00:00,fissile,compile-packages::run::test-release/go-1.4,start
+2018-01-01 10:00:00,fissile,compile-packages::test-release/go-1.4,start
+2018-01-01 10:02:00,fissile,compile-packages::run::test-release/go-1.4,done
+2018-01-01 10:02:00,fissile,compile-packages::run::test-release/ruby-2.5,start
+2018-01-01 10:02:00,fissile,compile-packages::run::test-release/consul,start
+2018-01-01 10:02:00,fissile,compile-packages::run::test-release/consul,done
+2018-01-02 10:00:00,fissile,compile-packages::run::test-release/go-1.4,start
+2018-01-02 10:01:30,fissile,compile-packages::run::test-release/go-1.4,done
+`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	durations, err := loadCompileDurations(file.Name())
+	assert.NoError(err)
+	assert.Equal(map[string]time.Duration{
+		// The latest run wins
+		"test-release/go-1.4": 90 * time.Second,
+		// Runs shorter than stampy's resolution still count
+		"test-release/consul": time.Second,
+	}, durations)
+}
+
+func TestLoadCompileDurationsMissingFile(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	durations, err := loadCompileDurations(filepath.Join(tempDir, "metrics.csv"))
+	assert.NoError(err)
+	assert.Empty(durations)
+}
+
+func TestLoadCompileDurationsBadTime(t *testing.T) {
+	assert := assert.New(t)
+
+	file, err := ioutil.TempFile("", "metrics")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString("yesterday,fissile,compile-packages::run::test-release/go-1.4,start\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = loadCompileDurations(file.Name())
+	assert.Error(err)
+}
+
+func TestAverageCompileDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	release := &model.Release{Name: "test-release"}
+	packages := []*model.Package{
+		{Name: "go-1.4", Release: release},
+		{Name: "ruby-2.5", Release: release},
+		{Name: "consul", Release: release},
+	}
+
+	assert.Equal(time.Second, averageCompileDuration(packages, nil))
+	assert.Equal(2*time.Minute, averageCompileDuration(packages, map[string]time.Duration{
+		"test-release/go-1.4":   time.Minute,
+		"test-release/ruby-2.5": 3 * time.Minute,
+		"other-release/consul":  time.Hour,
+	}))
+}
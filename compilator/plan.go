@@ -0,0 +1,91 @@
+package compilator
+
+import (
+	"sort"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// PackageSource tells where Compile gets a package from
+type PackageSource string
+
+// Known package sources
+const (
+	PackageSourceWorkDir PackageSource = "work-dir" // already compiled in the work dir
+	PackageSourceCache   PackageSource = "cache"    // downloaded from the package cache
+	PackageSourceCompile PackageSource = "compile"  // compiled from source
+)
+
+// PlannedPackage describes a package as it would be handled by Compile
+type PlannedPackage struct {
+	Name         string        `json:"name" yaml:"name"`
+	Release      string        `json:"release" yaml:"release"`
+	Fingerprint  string        `json:"fingerprint" yaml:"fingerprint"`
+	Dependencies []string      `json:"dependencies" yaml:"dependencies"`
+	Source       PackageSource `json:"source" yaml:"source"`
+}
+
+// Plan returns the packages Compile would handle for the given releases and
+// instance groups, without compiling or downloading anything. Packages found
+// in the work dir come first, followed by the remaining packages in the order
+// they would be queued for compilation.
+func (c *Compilator) Plan(releases []*model.Release, instanceGroups model.InstanceGroups) ([]PlannedPackage, error) {
+	// gatherPackages registers every package it returns; reset that so a
+	// later Compile still sees all of them
+	defer func() {
+		c.signalDependencies = make(map[string]chan struct{})
+	}()
+
+	plan := []PlannedPackage{}
+	var packages model.Packages
+
+	for _, pkg := range c.gatherPackages(releases, instanceGroups) {
+		compiled, err := isPackageCompiledHarness(c, pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		if compiled {
+			plan = append(plan, newPlannedPackage(pkg, PackageSourceWorkDir))
+		} else {
+			packages = append(packages, pkg)
+		}
+	}
+
+	sort.Sort(packages)
+
+	// Compile ignores unreadable history as well
+	durations, _ := c.compileDurations()
+
+	for _, pkg := range createDepBuckets(packages, durations) {
+		source := PackageSourceCompile
+		if c.packageStorage != nil {
+			exists, err := c.packageStorage.Exists(pkg)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				source = PackageSourceCache
+			}
+		}
+
+		plan = append(plan, newPlannedPackage(pkg, source))
+	}
+
+	return plan, nil
+}
+
+func newPlannedPackage(pkg *model.Package, source PackageSource) PlannedPackage {
+	dependencies := make([]string, 0, len(pkg.Dependencies))
+	for _, dep := range pkg.Dependencies {
+		dependencies = append(dependencies, dep.Name)
+	}
+
+	return PlannedPackage{
+		Name:         pkg.Name,
+		Release:      pkg.Release.Name,
+		Fingerprint:  pkg.Fingerprint,
+		Dependencies: dependencies,
+		Source:       source,
+	}
+}
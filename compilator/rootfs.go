@@ -0,0 +1,391 @@
+package compilator
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// rootfsCompleteMarker is created once a root filesystem is fully
+	// unpacked, so interrupted runs are detected
+	rootfsCompleteMarker = ".fissile-rootfs-complete"
+
+	// Whiteout files in image layers mark deleted files and directories
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// rootfsMountPoints are the directories of the stemcell root filesystem the
+// rootless compilation script mounts over
+var rootfsMountPoints = []string{"fissile-in", "fissile-out", "var/vcap", "tmp", "dev", "proc", "etc"}
+
+// stemcellRootDir returns the stemcell root filesystem for rootless
+// compilation, unpacking it on first use
+func (c *Compilator) stemcellRootDir() (string, error) {
+	c.rootfsOnce.Do(func() {
+		c.ui.Printf("unpacking stemcell root filesystem %s\n", c.stemcellRootfs)
+
+		c.rootfsDir, c.rootfsErr = unpackRootfs(c.stemcellRootfs, filepath.Join(c.hostWorkDir, "rootfs"))
+		if c.rootfsErr != nil {
+			return
+		}
+
+		for _, mountPoint := range rootfsMountPoints {
+			path := filepath.Join(c.rootfsDir, mountPoint)
+			if err := checkNoSymlinks(c.rootfsDir, path); err != nil {
+				c.rootfsErr = err
+				return
+			}
+			if err := os.MkdirAll(path, 0755); err != nil {
+				c.rootfsErr = fmt.Errorf("Error preparing stemcell root filesystem %s: %s", c.rootfsDir, err.Error())
+				return
+			}
+		}
+	})
+
+	return c.rootfsDir, c.rootfsErr
+}
+
+// unpackRootfs makes the root filesystem in source available below cacheDir.
+// The source is one of
+//   - a directory, which is copied
+//   - a tarball of a root filesystem, e.g. from `docker export`
+//   - an image archive from `docker save`, whose layers are applied in order
+//
+// Tarballs may be gzipped. The root filesystem is kept in a directory named
+// after a digest of the source, so that it is unpacked only once, and a
+// changed source is unpacked again. The source itself is never changed.
+func unpackRootfs(source, cacheDir string) (string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", fmt.Errorf("Error reading stemcell root filesystem %s: %s", source, err.Error())
+	}
+
+	digest, err := rootfsDigest(source, info)
+	if err != nil {
+		return "", fmt.Errorf("Error reading stemcell root filesystem %s: %s", source, err.Error())
+	}
+	target := filepath.Join(cacheDir, digest)
+
+	if _, err := os.Stat(filepath.Join(target, rootfsCompleteMarker)); err == nil {
+		return target, nil
+	}
+
+	// Anything without the marker is a leftover of an interrupted run
+	if err := os.RemoveAll(target); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	tempDir, err := ioutil.TempDir(filepath.Dir(target), filepath.Base(target)+".unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	archiveDir := filepath.Join(tempDir, "archive")
+	if info.IsDir() {
+		if err := copyRootfs(source, archiveDir); err != nil {
+			return "", fmt.Errorf("Error copying stemcell root filesystem %s: %s", source, err.Error())
+		}
+	} else if err := extractTarFile(source, archiveDir); err != nil {
+		return "", fmt.Errorf("Error unpacking stemcell root filesystem %s: %s", source, err.Error())
+	}
+
+	var layers []string
+	if !info.IsDir() {
+		layers, err = imageArchiveLayers(archiveDir)
+		if err != nil {
+			return "", fmt.Errorf("Error reading stemcell image %s: %s", source, err.Error())
+		}
+	}
+
+	// A plain root filesystem is used as unpacked
+	rootDir := archiveDir
+	if layers != nil {
+		rootDir = filepath.Join(tempDir, "rootfs")
+		for _, layer := range layers {
+			if err := extractTarFile(filepath.Join(archiveDir, layer), rootDir); err != nil {
+				return "", fmt.Errorf("Error unpacking layer %s of stemcell image %s: %s", layer, source, err.Error())
+			}
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(rootDir, rootfsCompleteMarker), nil, 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(rootDir, target); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// rootfsDigest identifies a root filesystem source by the contents of a
+// tarball, or by the names, modes, sizes and modification times of the files
+// in a directory
+func rootfsDigest(source string, info os.FileInfo) (string, error) {
+	hash := sha256.New()
+
+	if !info.IsDir() {
+		file, err := os.Open(source)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%d\n", relPath, info.Mode(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyRootfs copies a root filesystem directory to target. Like unpacking a
+// tarball, it runs without privileges: ownership is not preserved and device
+// nodes are skipped.
+func copyRootfs(source, target string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(target, relPath)
+		mode := info.Mode().Perm()
+
+		switch {
+		case info.IsDir():
+			// Keep directories writable so the rest of the copy fits in
+			if err := os.MkdirAll(targetPath, mode|0700); err != nil {
+				return err
+			}
+			return os.Chmod(targetPath, mode|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			linkname, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkname, targetPath)
+		case info.Mode().IsRegular():
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			out, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, in)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		default:
+			return nil
+		}
+	})
+}
+
+// imageArchiveLayers returns the layers of an image archive written by
+// `docker save`, bottom layer first, or nil if the directory does not hold
+// an image archive
+func imageArchiveLayers(archiveDir string) ([]string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(archiveDir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var manifest []struct {
+		Layers []string
+	}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest) != 1 {
+		return nil, fmt.Errorf("Expected exactly one image in the archive, found %d", len(manifest))
+	}
+
+	return manifest[0].Layers, nil
+}
+
+// extractTarFile unpacks a (possibly gzipped) tarball into target, applying
+// whiteouts. It runs without privileges: ownership is not preserved and
+// device nodes are skipped.
+func extractTarFile(tarPath, target string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var stream io.Reader = reader
+
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		stream = gzipReader
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := extractTarEntry(tarReader, header, target); err != nil {
+			return fmt.Errorf("%s: %s", header.Name, err.Error())
+		}
+	}
+}
+
+func extractTarEntry(tarReader *tar.Reader, header *tar.Header, target string) error {
+	relPath := filepath.Clean(string(filepath.Separator) + header.Name)
+	if relPath == string(filepath.Separator) {
+		return nil
+	}
+	path := filepath.Join(target, relPath)
+	dir, base := filepath.Split(path)
+
+	// Never follow symlinks from the tarball out of the target
+	if err := checkNoSymlinks(target, dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Whiteouts remove what lower layers put in place
+	if base == whiteoutOpaque {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if strings.HasPrefix(base, whiteoutPrefix) {
+		return os.RemoveAll(filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+	}
+
+	// Files from upper layers replace whatever is there, except directories
+	// which are merged
+	if info, err := os.Lstat(path); err == nil && !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// Keep directories writable so the rest of the tarball fits in
+		if err := os.MkdirAll(path, mode|0700); err != nil {
+			return err
+		}
+		return os.Chmod(path, mode|0700)
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, tarReader)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, path)
+	case tar.TypeLink:
+		// Hard links must not reach out of the target through symlinks either;
+		// a link to a symlink links the symlink itself
+		linkTarget := filepath.Join(target, filepath.Clean(string(filepath.Separator)+header.Linkname))
+		if err := checkNoSymlinks(target, filepath.Dir(linkTarget)); err != nil {
+			return err
+		}
+		return os.Link(linkTarget, path)
+	default:
+		// Device nodes and fifos need privileges; the compilation
+		// gets /dev from the host instead
+		return nil
+	}
+}
+
+// checkNoSymlinks returns an error if any existing component of dir below
+// root is a symlink
+func checkNoSymlinks(root, dir string) error {
+	relDir, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+
+	path := root
+	for _, component := range strings.Split(relDir, string(filepath.Separator)) {
+		if component == "." || component == "" {
+			continue
+		}
+		path = filepath.Join(path, component)
+
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Refusing to write below symlink %s", path)
+		}
+	}
+
+	return nil
+}
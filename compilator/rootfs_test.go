@@ -0,0 +1,247 @@
+package compilator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func writeTestTarball(t *testing.T, path string, gzipped bool, entries ...tarEntry) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Mode:     0644,
+			Size:     int64(len(entry.content)),
+			Linkname: entry.linkname,
+		}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0555
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+
+	contents := buf.Bytes()
+	if gzipped {
+		var gzipBuf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&gzipBuf)
+		_, err := gzipWriter.Write(contents)
+		require.NoError(t, err)
+		require.NoError(t, gzipWriter.Close())
+		contents = gzipBuf.Bytes()
+	}
+
+	if path != "" {
+		require.NoError(t, ioutil.WriteFile(path, contents, 0644))
+	}
+	return contents
+}
+
+func TestUnpackRootfsTarball(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	tarballPath := filepath.Join(tempDir, "rootfs.tgz")
+	writeTestTarball(t, tarballPath, true,
+		tarEntry{name: "./bin/", typeflag: tar.TypeDir},
+		tarEntry{name: "./bin/bash", typeflag: tar.TypeReg, content: "bash"},
+		tarEntry{name: "./bin/sh", typeflag: tar.TypeSymlink, linkname: "bash"},
+		tarEntry{name: "./bin/rbash", typeflag: tar.TypeLink, linkname: "./bin/bash"},
+		tarEntry{name: "./dev/null", typeflag: tar.TypeChar},
+	)
+
+	cacheDir := filepath.Join(tempDir, "rootfs")
+	rootDir, err := unpackRootfs(tarballPath, cacheDir)
+	require.NoError(t, err)
+	assert.Equal(cacheDir, filepath.Dir(rootDir))
+
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "bin", "rbash"))
+	assert.NoError(err)
+	assert.Equal("bash", string(content))
+
+	link, err := os.Readlink(filepath.Join(rootDir, "bin", "sh"))
+	assert.NoError(err)
+	assert.Equal("bash", link)
+
+	info, err := os.Stat(filepath.Join(rootDir, "bin"))
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0755), info.Mode().Perm(), "directories should stay writable")
+	}
+
+	_, err = os.Lstat(filepath.Join(rootDir, "dev", "null"))
+	assert.True(os.IsNotExist(err), "device nodes should be skipped")
+
+	// The unpacked root filesystem is reused for the same source only
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, "reused"), nil, 0644))
+	reusedDir, err := unpackRootfs(tarballPath, cacheDir)
+	assert.NoError(err)
+	assert.Equal(rootDir, reusedDir)
+	assert.FileExists(filepath.Join(reusedDir, "reused"))
+
+	writeTestTarball(t, tarballPath, false)
+	otherDir, err := unpackRootfs(tarballPath, cacheDir)
+	assert.NoError(err)
+	assert.NotEqual(rootDir, otherDir)
+	_, err = os.Stat(filepath.Join(otherDir, "bin", "bash"))
+	assert.True(os.IsNotExist(err), "a changed stemcell should not reuse the old root filesystem")
+
+	require.NoError(t, os.Remove(tarballPath))
+	_, err = unpackRootfs(tarballPath, cacheDir)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Error reading stemcell root filesystem")
+	}
+}
+
+func TestUnpackRootfsImageArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	lower := writeTestTarball(t, "", false,
+		tarEntry{name: "etc/", typeflag: tar.TypeDir},
+		tarEntry{name: "etc/hostname", typeflag: tar.TypeReg, content: "lower"},
+		tarEntry{name: "etc/motd", typeflag: tar.TypeReg, content: "hello"},
+		tarEntry{name: "opt/old/file", typeflag: tar.TypeReg, content: "old"},
+	)
+	upper := writeTestTarball(t, "", false,
+		tarEntry{name: "etc/hostname", typeflag: tar.TypeReg, content: "upper"},
+		tarEntry{name: "etc/.wh.motd", typeflag: tar.TypeReg},
+		tarEntry{name: "opt/.wh..wh..opq", typeflag: tar.TypeReg},
+		tarEntry{name: "opt/new", typeflag: tar.TypeReg, content: "new"},
+	)
+
+	archivePath := filepath.Join(tempDir, "stemcell.tar")
+	writeTestTarball(t, archivePath, false,
+		tarEntry{name: "manifest.json", typeflag: tar.TypeReg, content: `[{"Config":"config.json","RepoTags":["stemcell:latest"],"Layers":["lower/layer.tar","upper/layer.tar"]}]`},
+		tarEntry{name: "lower/layer.tar", typeflag: tar.TypeReg, content: string(lower)},
+		tarEntry{name: "upper/layer.tar", typeflag: tar.TypeReg, content: string(upper)},
+	)
+
+	rootDir, err := unpackRootfs(archivePath, filepath.Join(tempDir, "rootfs"))
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "etc", "hostname"))
+	assert.NoError(err)
+	assert.Equal("upper", string(content))
+
+	_, err = os.Stat(filepath.Join(rootDir, "etc", "motd"))
+	assert.True(os.IsNotExist(err), "whiteouts should remove files")
+
+	entries, err := ioutil.ReadDir(filepath.Join(rootDir, "opt"))
+	if assert.NoError(err) && assert.Len(entries, 1) {
+		assert.Equal("new", entries[0].Name(), "opaque whiteouts should clear directories")
+	}
+
+	_, err = os.Stat(filepath.Join(rootDir, "manifest.json"))
+	assert.True(os.IsNotExist(err), "the archive itself should not end up in the root filesystem")
+}
+
+func TestUnpackRootfsSymlinkEscape(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	outside := filepath.Join(tempDir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0755))
+
+	tarballPath := filepath.Join(tempDir, "rootfs.tar")
+	writeTestTarball(t, tarballPath, false,
+		tarEntry{name: "escape", typeflag: tar.TypeSymlink, linkname: outside},
+		tarEntry{name: "escape/file", typeflag: tar.TypeReg, content: "gotcha"},
+	)
+
+	cacheDir := filepath.Join(tempDir, "rootfs")
+	_, err = unpackRootfs(tarballPath, cacheDir)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Refusing to write below symlink")
+	}
+
+	_, err = os.Stat(filepath.Join(outside, "file"))
+	assert.True(os.IsNotExist(err), "nothing should be written outside the root filesystem")
+	entries, err := ioutil.ReadDir(cacheDir)
+	if assert.NoError(err) {
+		assert.Empty(entries, "failed unpacking should leave nothing behind")
+	}
+}
+
+func TestUnpackRootfsHardLinkEscape(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	outside := filepath.Join(tempDir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+
+	tarballPath := filepath.Join(tempDir, "rootfs.tar")
+	writeTestTarball(t, tarballPath, false,
+		tarEntry{name: "escape", typeflag: tar.TypeSymlink, linkname: outside},
+		tarEntry{name: "secret", typeflag: tar.TypeLink, linkname: "escape/secret"},
+	)
+
+	_, err = unpackRootfs(tarballPath, filepath.Join(tempDir, "rootfs"))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Refusing to write below symlink")
+	}
+}
+
+func TestUnpackRootfsDirectory(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	source := filepath.Join(tempDir, "source")
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "bin"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(source, "bin", "bash"), []byte("bash"), 0755))
+	require.NoError(t, os.Symlink("bash", filepath.Join(source, "bin", "sh")))
+
+	rootDir, err := unpackRootfs(source, filepath.Join(tempDir, "rootfs"))
+	require.NoError(t, err)
+	assert.NotEqual(source, rootDir)
+
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "bin", "bash"))
+	assert.NoError(err)
+	assert.Equal("bash", string(content))
+
+	link, err := os.Readlink(filepath.Join(rootDir, "bin", "sh"))
+	assert.NoError(err)
+	assert.Equal("bash", link)
+
+	entries, err := ioutil.ReadDir(source)
+	if assert.NoError(err) && assert.Len(entries, 1) {
+		assert.Equal("bin", entries[0].Name(), "the source directory should be left alone")
+	}
+}
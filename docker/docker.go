@@ -41,6 +41,7 @@ type dockerClient interface {
 	CommitContainer(dockerclient.CommitContainerOptions) (*dockerclient.Image, error)
 	CreateContainer(dockerclient.CreateContainerOptions) (*dockerclient.Container, error)
 	CreateVolume(dockerclient.CreateVolumeOptions) (*dockerclient.Volume, error)
+	ExportImage(dockerclient.ExportImageOptions) error
 	ImageHistory(string) ([]dockerclient.ImageHistory, error)
 	InspectImage(string) (*dockerclient.Image, error)
 	ListImages(dockerclient.ListImagesOptions) ([]dockerclient.APIImages, error)
@@ -403,6 +404,15 @@ func (d *ImageManager) HasImage(imageName string) (bool, error) {
 	return false, err
 }
 
+// SaveImage writes the image to writer as an image archive, as `docker save`
+// does
+func (d *ImageManager) SaveImage(imageName string, writer io.Writer) error {
+	return d.client.ExportImage(dockerclient.ExportImageOptions{
+		Name:         imageName,
+		OutputStream: writer,
+	})
+}
+
 // RemoveContainer will remove a container from Docker
 func (d *ImageManager) RemoveContainer(containerID string) error {
 	return d.client.RemoveContainer(dockerclient.RemoveContainerOptions{
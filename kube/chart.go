@@ -0,0 +1,161 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// ChartMetadata describes the Helm chart written to Chart.yaml
+type ChartMetadata struct {
+	Name        string
+	Version     string
+	AppVersion  string // Defaults to the version of the releases
+	Description string
+}
+
+// MakeChart returns the contents of Chart.yaml. The app version defaults to
+// the version of the release named like the chart, or else of the first
+// release of the role manifest.
+func MakeChart(settings ExportSettings) (helm.Node, error) {
+	if settings.Chart.Name == "" {
+		return nil, fmt.Errorf("The Helm chart needs a name")
+	}
+	if settings.Chart.Version == "" {
+		return nil, fmt.Errorf("The Helm chart %s needs a version", settings.Chart.Name)
+	}
+
+	appVersion := settings.Chart.AppVersion
+	if appVersion == "" && settings.RoleManifest != nil {
+		for _, release := range settings.RoleManifest.LoadedReleases {
+			if release.Name == settings.Chart.Name {
+				appVersion = release.Version
+				break
+			}
+		}
+		if appVersion == "" && len(settings.RoleManifest.LoadedReleases) > 0 {
+			appVersion = settings.RoleManifest.LoadedReleases[0].Version
+		}
+	}
+
+	chart := helm.NewMapping(
+		"apiVersion", "v1",
+		"name", settings.Chart.Name,
+		"version", settings.Chart.Version)
+	if appVersion != "" {
+		chart.Add("appVersion", appVersion)
+	}
+	if settings.Chart.Description != "" {
+		chart.Add("description", settings.Chart.Description)
+	}
+
+	return chart, nil
+}
+
+// MakeHelpers returns the contents of templates/_helpers.tpl, defining the
+// names and labels used by the generated templates for reuse by NOTES.txt
+// and by charts depending on this one
+func MakeHelpers(settings ExportSettings) string {
+	prefix := settings.Chart.Name
+	helpers := &bytes.Buffer{}
+
+	define := func(name, comment, body string) {
+		fmt.Fprintf(helpers, "{{/*\n%s\n*/}}\n", comment)
+		fmt.Fprintf(helpers, "{{- define %q -}}\n%s\n{{- end -}}\n\n", prefix+"."+name, body)
+	}
+
+	define("name", "The name of the chart, unless overridden by nameOverride.",
+		`{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" -}}`)
+	define("chart", "The name and version of the chart, as used by the helm.sh/chart label.",
+		`{{- printf "%s-%s" .Chart.Name (.Chart.Version | replace "+" "_") -}}`)
+	define("labels", "The labels of all the resources of the chart.",
+		`app.kubernetes.io/instance: {{ .Release.Name | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service | quote }}
+app.kubernetes.io/name: {{ include "`+prefix+`.name" . | quote }}
+app.kubernetes.io/version: {{ default .Chart.Version .Chart.AppVersion | quote }}
+helm.sh/chart: {{ include "`+prefix+`.chart" . | quote }}`)
+	define("generatedSecretsName", "The name of the secret holding the generated secrets of the current revision.",
+		makeResourceName(generatedSecretsName, settings))
+
+	return helpers.String()
+}
+
+// MakeNotes returns the contents of templates/NOTES.txt, which helm shows
+// after installing or upgrading the chart. It lists the public services,
+// and how to fetch the generated secrets that were not set by the user.
+func MakeNotes(settings ExportSettings) (string, error) {
+	if settings.RoleManifest == nil {
+		return "", fmt.Errorf("The Helm chart notes need the role manifest")
+	}
+
+	notes := &bytes.Buffer{}
+	notes.WriteString("{{ .Chart.Name }} {{ .Chart.AppVersion }} is deployed as release {{ .Release.Name }} " +
+		"in namespace {{ .Release.Namespace }}.\n")
+
+	var services []string
+	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+		if instanceGroup.IsColocated() || instanceGroup.Type != model.RoleTypeBosh {
+			continue
+		}
+		for _, job := range instanceGroup.JobReferences {
+			public, ingress := 0, 0
+			for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+				if port.Public {
+					public++
+					if port.Ingress != nil {
+						ingress++
+					}
+				}
+			}
+			if public == 0 {
+				continue
+			}
+
+			// Same name as in newService
+			serviceName := job.ContainerProperties.BoshContainerization.ServiceName
+			if serviceName == "" {
+				serviceName = util.ConvertNameToKey(instanceGroup.Name + "-" + job.Name)
+			}
+			line := fmt.Sprintf("  kubectl get service --namespace {{ .Release.Namespace }} %s\n",
+				makeResourceName(serviceName+"-public", settings))
+			if ingress == public {
+				// The service is replaced by the ingress when enabled
+				line = "{{- if not .Values.ingress.enabled }}\n" + line + "{{- end }}\n"
+			}
+			services = append(services, line)
+		}
+	}
+	if len(services) > 0 {
+		notes.WriteString("\nThe addresses of the public services are shown by:\n")
+		for _, service := range services {
+			notes.WriteString(service)
+		}
+	}
+
+	var secrets []*model.VariableDefinition
+	for _, cv := range model.MakeMapOfVariables(settings.RoleManifest) {
+		if cv.CVOptions.Secret && cv.Type != "" && !cv.CVOptions.Internal && independentSecret(cv.Name) {
+			secrets = append(secrets, cv)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	if len(secrets) > 0 {
+		notes.WriteString("\nThe generated secrets can be read with:\n")
+		for _, cv := range secrets {
+			line := fmt.Sprintf("  %s: kubectl get secret --namespace {{ .Release.Namespace }} "+
+				"{{ include %q . }} --output jsonpath='{.data.%s}' | base64 --decode\n",
+				cv.Name, settings.Chart.Name+".generatedSecretsName", util.ConvertNameToKey(cv.Name))
+			if !cv.CVOptions.Immutable {
+				// Secrets set in the values are not generated
+				line = fmt.Sprintf("{{- if not .Values.secrets.%s }}\n%s{{- end }}\n", cv.Name, line)
+			}
+			notes.WriteString(line)
+		}
+	}
+
+	return notes.String(), nil
+}
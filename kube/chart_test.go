@@ -0,0 +1,227 @@
+package kube
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/Masterminds/sprig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chartTestRoleManifest() *model.RoleManifest {
+	return &model.RoleManifest{
+		LoadedReleases: []*model.Release{
+			&model.Release{Name: "first", Version: "1.0"},
+			&model.Release{Name: "mychart", Version: "2.0"},
+		},
+		InstanceGroups: model.InstanceGroups{
+			&model.InstanceGroup{
+				Name: "router",
+				Type: model.RoleTypeBosh,
+				JobReferences: model.JobReferences{
+					&model.JobReference{
+						Name: "gorouter",
+						ContainerProperties: model.JobContainerProperties{
+							BoshContainerization: model.JobBoshContainerization{
+								Ports: []model.JobExposedPort{
+									{Name: "http", Public: true},
+								},
+							},
+						},
+					},
+					&model.JobReference{
+						Name: "api",
+						ContainerProperties: model.JobContainerProperties{
+							BoshContainerization: model.JobBoshContainerization{
+								ServiceName: "api",
+								Ports: []model.JobExposedPort{
+									{Name: "https", Public: true, Ingress: &model.JobExposedPortIngress{Hosts: []string{"api.example.com"}}},
+								},
+							},
+						},
+					},
+					&model.JobReference{
+						Name: "internal",
+						ContainerProperties: model.JobContainerProperties{
+							BoshContainerization: model.JobBoshContainerization{
+								Ports: []model.JobExposedPort{{Name: "private"}},
+							},
+						},
+					},
+				},
+			},
+		},
+		Variables: model.Variables{
+			&model.VariableDefinition{
+				Name:      "ADMIN_PASSWORD",
+				Type:      "password",
+				CVOptions: model.CVOptions{Secret: true},
+			},
+			&model.VariableDefinition{
+				Name:      "CA_CERT",
+				Type:      "certificate",
+				CVOptions: model.CVOptions{Secret: true, Immutable: true},
+			},
+			&model.VariableDefinition{
+				Name:      "CA_CERT_KEY",
+				Type:      "certificate",
+				CVOptions: model.CVOptions{Secret: true, Immutable: true},
+			},
+			&model.VariableDefinition{
+				Name:      "INTERNAL_PASSWORD",
+				Type:      "password",
+				CVOptions: model.CVOptions{Secret: true, Internal: true},
+			},
+			&model.VariableDefinition{
+				Name:      "USER_PASSWORD",
+				CVOptions: model.CVOptions{Secret: true},
+			},
+		},
+	}
+}
+
+func TestMakeChart(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{
+			RoleManifest: chartTestRoleManifest(),
+			Chart:        ChartMetadata{Name: "other", Version: "0.1.0"},
+		}
+		chart, err := MakeChart(settings)
+		require.NoError(t, err)
+		actual, err := RoundtripKube(chart)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: v1
+			name: other
+			version: 0.1.0
+			appVersion: "1.0"
+		`, actual)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{
+			RoleManifest: chartTestRoleManifest(),
+			Chart:        ChartMetadata{Name: "mychart", Version: "0.1.0", Description: "My chart"},
+		}
+		chart, err := MakeChart(settings)
+		require.NoError(t, err)
+		actual, err := RoundtripKube(chart)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: v1
+			name: mychart
+			version: 0.1.0
+			appVersion: "2.0"
+			description: My chart
+		`, actual)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+		_, err := MakeChart(ExportSettings{Chart: ChartMetadata{Name: "mychart"}})
+		assert.EqualError(t, err, "The Helm chart mychart needs a version")
+	})
+}
+
+// renderChartTemplate renders a template of a chart, together with its
+// helpers, the way helm would
+func renderChartTemplate(helpers, text string, values map[string]interface{}) (string, error) {
+	tmpl := template.New("").Option("missingkey=zero")
+	functions := sprig.TxtFuncMap()
+	functions["include"] = func(name string, data interface{}) (string, error) {
+		var buffer bytes.Buffer
+		err := tmpl.ExecuteTemplate(&buffer, name, data)
+		return buffer.String(), err
+	}
+	tmpl.Funcs(functions)
+
+	_, err := tmpl.New("_helpers.tpl").Parse(helpers)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmpl.New("main").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buffer, "main", map[string]interface{}{
+		"Values":  values,
+		"Chart":   map[string]interface{}{"Name": "mychart", "Version": "1.2.3+build", "AppVersion": "2.0"},
+		"Release": map[string]interface{}{"Name": "myrelease", "Namespace": "ns", "Service": "Helm"},
+	})
+	return buffer.String(), err
+}
+
+func TestMakeHelpers(t *testing.T) {
+	t.Parallel()
+
+	helpers := MakeHelpers(ExportSettings{Chart: ChartMetadata{Name: "mychart"}})
+
+	actual, err := renderChartTemplate(helpers, `{{ include "mychart.labels" . }}`, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, `app.kubernetes.io/instance: "myrelease"
+app.kubernetes.io/managed-by: "Helm"
+app.kubernetes.io/name: "mychart"
+app.kubernetes.io/version: "2.0"
+helm.sh/chart: "mychart-1.2.3_build"`, actual)
+
+	actual, err = renderChartTemplate(helpers, `{{ include "mychart.generatedSecretsName" . }}`, map[string]interface{}{
+		"kube": map[string]interface{}{"secrets_generation_counter": 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "secrets-1.2.3+build-3", actual)
+}
+
+func TestMakeNotes(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{
+		RoleManifest: chartTestRoleManifest(),
+		Chart:        ChartMetadata{Name: "mychart"},
+	}
+	notes, err := MakeNotes(settings)
+	require.NoError(t, err)
+
+	values := func(ingress bool, adminPassword interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"kube":    map[string]interface{}{"secrets_generation_counter": 1},
+			"ingress": map[string]interface{}{"enabled": ingress},
+			"secrets": map[string]interface{}{"ADMIN_PASSWORD": adminPassword},
+		}
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		actual, err := renderChartTemplate(MakeHelpers(settings), notes, values(false, nil))
+		require.NoError(t, err)
+		assert.Equal(t, `mychart 2.0 is deployed as release myrelease in namespace ns.
+
+The addresses of the public services are shown by:
+  kubectl get service --namespace ns router-gorouter-public
+  kubectl get service --namespace ns api-public
+
+The generated secrets can be read with:
+  ADMIN_PASSWORD: kubectl get secret --namespace ns secrets-1.2.3+build-1 --output jsonpath='{.data.admin-password}' | base64 --decode
+  CA_CERT: kubectl get secret --namespace ns secrets-1.2.3+build-1 --output jsonpath='{.data.ca-cert}' | base64 --decode
+`, actual)
+	})
+
+	t.Run("Overridden", func(t *testing.T) {
+		t.Parallel()
+		actual, err := renderChartTemplate(MakeHelpers(settings), notes, values(true, "secret"))
+		require.NoError(t, err)
+		assert.Contains(t, actual, "router-gorouter-public")
+		assert.NotContains(t, actual, "api-public", "The ingress replaces the service")
+		assert.NotContains(t, actual, "ADMIN_PASSWORD", "The user set the secret")
+		assert.Contains(t, actual, "CA_CERT")
+	})
+}
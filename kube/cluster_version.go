@@ -0,0 +1,145 @@
+package kube
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+)
+
+// ClusterVersion is the Kubernetes version targeted by generated configs
+type ClusterVersion struct {
+	Major int
+	Minor int
+}
+
+// ParseClusterVersion parses a Kubernetes version like "1.16", "v1.16" or
+// "1.16.2"; the patch level is ignored
+func ParseClusterVersion(version string) (*ClusterVersion, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("Invalid Kubernetes version '%s', expected major.minor", version)
+	}
+
+	var numbers []int
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("Invalid Kubernetes version '%s', expected major.minor", version)
+		}
+		numbers = append(numbers, number)
+	}
+
+	return &ClusterVersion{Major: numbers[0], Minor: numbers[1]}, nil
+}
+
+// String returns the version as major.minor
+func (v ClusterVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// atLeast checks if the version is the given one or newer. Without a version,
+// the oldest supported cluster is assumed.
+func (v *ClusterVersion) atLeast(major, minor int) bool {
+	if v == nil {
+		return false
+	}
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// kubeAPIVersion is the API version serving a kind starting with a given
+// Kubernetes version
+type kubeAPIVersion struct {
+	major      int
+	minor      int
+	apiVersion string
+}
+
+// kubeAPIVersions lists the API versions of the kinds which moved between API
+// groups or versions, oldest first. The first entry is used for clusters of
+// unknown version.
+var kubeAPIVersions = map[string][]kubeAPIVersion{
+	"Deployment": {
+		{0, 0, "extensions/v1beta1"},
+		{1, 9, "apps/v1"},
+	},
+	"StatefulSet": {
+		{0, 0, "apps/v1beta1"},
+		{1, 9, "apps/v1"},
+	},
+	"Role": {
+		{0, 0, "rbac.authorization.k8s.io/v1beta1"},
+		{1, 8, "rbac.authorization.k8s.io/v1"},
+	},
+	"RoleBinding": {
+		{0, 0, "rbac.authorization.k8s.io/v1beta1"},
+		{1, 8, "rbac.authorization.k8s.io/v1"},
+	},
+	"PodSecurityPolicy": {
+		{0, 0, "extensions/v1beta1"},
+		{1, 10, "policy/v1beta1"},
+	},
+	"PodDisruptionBudget": {
+		{0, 0, "policy/v1beta1"},
+		{1, 21, "policy/v1"},
+	},
+	"Ingress": {
+		{0, 0, "extensions/v1beta1"},
+		{1, 14, "networking.k8s.io/v1beta1"},
+		{1, 19, "networking.k8s.io/v1"},
+	},
+	"HorizontalPodAutoscaler": {
+		{0, 0, "autoscaling/v2beta1"},
+		{1, 12, "autoscaling/v2beta2"},
+		{1, 23, "autoscaling/v2"},
+	},
+}
+
+// getAPIVersion returns the API version to use for a kind. Helm charts pick
+// it at install time, based on the version of the cluster.
+func getAPIVersion(kind string, settings ExportSettings) string {
+	return selectAPIVersion(kind, settings, func(apiVersion string) string {
+		return apiVersion
+	})
+}
+
+// getAPIGroup returns the API group to use for a kind, like getAPIVersion
+func getAPIGroup(kind string, settings ExportSettings) string {
+	return selectAPIVersion(kind, settings, func(apiVersion string) string {
+		return strings.Split(apiVersion, "/")[0]
+	})
+}
+
+func selectAPIVersion(kind string, settings ExportSettings, format func(string) string) string {
+	versions, ok := kubeAPIVersions[kind]
+	if !ok {
+		panic(fmt.Sprintf("No API versions known for kind %s", kind))
+	}
+
+	if settings.CreateHelmChart {
+		var result string
+		for i := len(versions) - 1; i > 0; i-- {
+			result += fmt.Sprintf("{{ if %s }}%s{{ else }}",
+				minKubeVersion(versions[i].major, versions[i].minor), format(versions[i].apiVersion))
+		}
+		return result + format(versions[0].apiVersion) + strings.Repeat("{{ end }}", len(versions)-1)
+	}
+
+	for i := len(versions) - 1; i > 0; i-- {
+		if settings.KubeVersion.atLeast(versions[i].major, versions[i].minor) {
+			return format(versions[i].apiVersion)
+		}
+	}
+	return format(versions[0].apiVersion)
+}
+
+// withMinKubeVersion determines if a field needing at least the given
+// Kubernetes version should be added. Helm charts always add it, guarded by
+// the returned block.
+func withMinKubeVersion(major, minor int, settings ExportSettings) (bool, helm.NodeModifier) {
+	if settings.CreateHelmChart {
+		return true, helm.Block("if " + minKubeVersion(major, minor))
+	}
+	return settings.KubeVersion.atLeast(major, minor), nil
+}
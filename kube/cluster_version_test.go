@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClusterVersion(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	for version, expected := range map[string]*ClusterVersion{
+		"1.16":    {1, 16},
+		"v1.9":    {1, 9},
+		"1.21.3":  {1, 21},
+		"v2.0.0":  {2, 0},
+		"1":       nil,
+		"1.x":     nil,
+		"1.2.3.4": nil,
+		"":        nil,
+		"1.-1":    nil,
+	} {
+		actual, err := ParseClusterVersion(version)
+		if expected == nil {
+			assert.Error(err, version)
+			continue
+		}
+		if assert.NoError(err, version) {
+			assert.Equal(expected, actual, version)
+		}
+	}
+
+	assert.Equal("1.21", ClusterVersion{1, 21}.String())
+}
+
+func TestGetAPIVersionKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	for _, testcase := range []struct {
+		version  *ClusterVersion
+		kind     string
+		expected string
+	}{
+		{nil, "Deployment", "extensions/v1beta1"},
+		{&ClusterVersion{1, 8}, "Deployment", "extensions/v1beta1"},
+		{&ClusterVersion{1, 9}, "Deployment", "apps/v1"},
+		{&ClusterVersion{2, 0}, "Deployment", "apps/v1"},
+		{nil, "StatefulSet", "apps/v1beta1"},
+		{&ClusterVersion{1, 16}, "StatefulSet", "apps/v1"},
+		{&ClusterVersion{1, 7}, "Role", "rbac.authorization.k8s.io/v1beta1"},
+		{&ClusterVersion{1, 8}, "RoleBinding", "rbac.authorization.k8s.io/v1"},
+		{&ClusterVersion{1, 20}, "PodDisruptionBudget", "policy/v1beta1"},
+		{&ClusterVersion{1, 21}, "PodDisruptionBudget", "policy/v1"},
+	} {
+		settings := ExportSettings{KubeVersion: testcase.version}
+		assert.Equal(testcase.expected, getAPIVersion(testcase.kind, settings), "%s on %v", testcase.kind, testcase.version)
+	}
+
+	assert.Equal("extensions", getAPIGroup("PodSecurityPolicy", ExportSettings{}))
+	assert.Equal("policy", getAPIGroup("PodSecurityPolicy", ExportSettings{KubeVersion: &ClusterVersion{1, 10}}))
+	assert.Panics(func() { getAPIVersion("Unknown", ExportSettings{}) })
+}
+
+func TestGetAPIVersionHelm(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{CreateHelmChart: true}
+	node := helm.NewMapping(
+		"deployment", getAPIVersion("Deployment", settings),
+		"psp", getAPIGroup("PodSecurityPolicy", settings))
+
+	for _, testcase := range []struct {
+		minor    string
+		expected string
+	}{
+		{"8", `{ deployment: extensions/v1beta1, psp: extensions }`},
+		{"9", `{ deployment: apps/v1, psp: extensions }`},
+		{"10+", `{ deployment: apps/v1, psp: policy }`},
+	} {
+		actual, err := RoundtripNode(node, map[string]interface{}{
+			"Capabilities.KubeVersion.Major": "1",
+			"Capabilities.KubeVersion.Minor": testcase.minor,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), testcase.expected, actual)
+	}
+}
+
+func TestWithMinKubeVersion(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	add, guard := withMinKubeVersion(1, 8, ExportSettings{})
+	assert.False(add)
+	assert.Nil(guard)
+
+	add, guard = withMinKubeVersion(1, 8, ExportSettings{KubeVersion: &ClusterVersion{1, 8}})
+	assert.True(add)
+	assert.Nil(guard)
+
+	add, guard = withMinKubeVersion(1, 8, ExportSettings{CreateHelmChart: true})
+	assert.True(add)
+	assert.NotNil(guard)
+}
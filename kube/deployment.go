@@ -21,11 +21,12 @@ func NewDeployment(instanceGroup *model.InstanceGroup, settings ExportSettings,
 		return nil, nil, err
 	}
 	spec := helm.NewMapping()
-	spec.Add("selector", newSelector(instanceGroup.Name))
+	spec.Add("selector", newSelector(instanceGroup.Name, settings))
 	spec.Add("template", podTemplate)
 
-	deployment := newKubeConfig(settings, "extensions/v1beta1", "Deployment", instanceGroup.Name, helm.Comment(instanceGroup.GetLongDescription()))
+	deployment := newKubeConfig(settings, getAPIVersion("Deployment", settings), "Deployment", instanceGroup.Name, helm.Comment(instanceGroup.GetLongDescription()))
 	deployment.Add("spec", spec)
+	addFlightStageAnnotations(instanceGroup, deployment, settings)
 	err = replicaCheck(instanceGroup, deployment, svc, settings)
 	if err != nil {
 		return nil, nil, err
@@ -72,13 +73,8 @@ func addAffinityRules(instanceGroup *model.InstanceGroup, spec *helm.Mapping, se
 	}
 
 	meta := spec.Get("template", "metadata").(*helm.Mapping)
-	if meta.Get("annotations") == nil {
-		meta.Add("annotations", helm.NewMapping())
-		meta.Sort()
-	}
-	annotations := meta.Get("annotations").(*helm.Mapping)
-
-	annotations.Sort()
+	getAnnotations(meta).Sort()
+	meta.Sort()
 
 	return nil
 }
@@ -157,7 +153,12 @@ func replicaCheck(instanceGroup *model.InstanceGroup, controller *helm.Mapping,
 	} else {
 		count = "{{ " + count + " }}"
 	}
-	spec.Add("replicas", count)
+	if instanceGroup.Run.Autoscaling != nil {
+		// The horizontal pod autoscaler manages the replicas when enabled
+		spec.Add("replicas", count, helm.Block(fmt.Sprintf("if not .Values.sizing.%s.autoscaling.enabled", roleName)))
+	} else {
+		spec.Add("replicas", count)
+	}
 	spec.Sort()
 
 	if instanceGroup.Run.Scaling.Min == 0 {
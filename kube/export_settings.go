@@ -21,4 +21,29 @@ type ExportSettings struct {
 	Opinions        *model.Opinions
 	CreateHelmChart bool
 	AuthType        string
+	// KubeVersion selects the API versions and fields of kube configs; when
+	// unset, the oldest supported cluster is assumed. Helm charts select them
+	// from .Capabilities at install time instead.
+	KubeVersion *ClusterVersion
+	// ImageDigests maps role image names, including Registry, Organization
+	// and tag, to the digests of their manifests. When set, images are
+	// referenced by digest instead of by tag.
+	ImageDigests map[string]string
+	// NetworkPolicies adds network policies to kube configs. Helm charts
+	// always contain them, enabled by a values.yaml switch.
+	NetworkPolicies bool
+	// Kustomize reads the config vars of kube configs from the config map
+	// and secret of a kustomize base, instead of using the defaults.
+	Kustomize bool
+	// Chart describes the Helm chart, written to Chart.yaml
+	Chart ChartMetadata
+	// NamePrefix and NameSuffix are added to the names of all generated
+	// resources, and to the labels selecting their pods. They may contain
+	// templates in Helm charts, like "{{ .Release.Name }}-".
+	NamePrefix string
+	NameSuffix string
+	// Labels and Annotations are added to all generated resources and pod
+	// templates. Helm charts also add the ones from values.yaml.
+	Labels      map[string]string
+	Annotations map[string]string
 }
@@ -0,0 +1,136 @@
+package kube
+
+import (
+	"fmt"
+	"strconv"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+const (
+	// kappChangeGroup and kappChangeRule are the annotations used by kapp
+	// to order the changes to resources, waiting for the earlier ones
+	kappChangeGroup = "kapp.k14s.io/change-group"
+	kappChangeRule  = "kapp.k14s.io/change-rule"
+
+	// preFlightDependencyWeight is the helm hook weight of the resources
+	// needed by the pre-flight tasks, which are created before them
+	preFlightDependencyWeight = -10
+)
+
+// addFlightStageAnnotations orders the workload of an instance group by its
+// flight stage. Helm charts run pre-flight and post-flight tasks as hooks,
+// weighted by their order in the role manifest, and delete them once they
+// succeed. Kube configs get kapp change groups and rules, waiting for the
+// workloads of the previous stage.
+func addFlightStageAnnotations(instanceGroup *model.InstanceGroup, config *helm.Mapping, settings ExportSettings) {
+	annotations := helm.NewMapping()
+	stage := instanceGroup.Run.FlightStage
+
+	if settings.CreateHelmChart {
+		if isFlightStageHook(instanceGroup, settings) {
+			hook := "post-install,post-upgrade"
+			if stage == model.FlightStagePreFlight {
+				hook = "pre-install,pre-upgrade"
+			}
+			annotations.Add("helm.sh/hook", hook)
+			annotations.Add("helm.sh/hook-weight", strconv.Itoa(getFlightStageIndex(instanceGroup, settings)))
+			// Hooks are not part of the release, so nothing else removes them
+			annotations.Add("helm.sh/hook-delete-policy", "before-hook-creation,hook-succeeded")
+		}
+	} else {
+		switch stage {
+		case model.FlightStagePreFlight:
+			annotations.Add(kappChangeGroup, getKappChangeGroup(model.FlightStagePreFlight))
+		case model.FlightStageFlight:
+			if hasFlightStage(model.FlightStagePostFlight, settings) {
+				annotations.Add(kappChangeGroup, getKappChangeGroup(model.FlightStageFlight))
+			}
+			if hasFlightStage(model.FlightStagePreFlight, settings) {
+				annotations.Add(kappChangeRule, "upsert after upserting "+getKappChangeGroup(model.FlightStagePreFlight))
+			}
+		case model.FlightStagePostFlight:
+			annotations.Add(kappChangeGroup, getKappChangeGroup(model.FlightStagePostFlight))
+			annotations.Add(kappChangeRule, "upsert after upserting "+getKappChangeGroup(model.FlightStageFlight))
+		}
+	}
+
+	if len(annotations.Names()) > 0 {
+		getAnnotations(config.Get("metadata").(*helm.Mapping)).Merge(annotations)
+	}
+}
+
+// isFlightStageHook checks if the instance group is run as a helm hook
+func isFlightStageHook(instanceGroup *model.InstanceGroup, settings ExportSettings) bool {
+	if !settings.CreateHelmChart || instanceGroup.Type != model.RoleTypeBoshTask || instanceGroup.Run == nil {
+		return false
+	}
+	stage := instanceGroup.Run.FlightStage
+	return stage == model.FlightStagePreFlight || stage == model.FlightStagePostFlight
+}
+
+// addPreFlightDependencyAnnotations makes a resource needed by the pre-flight
+// tasks, like the secrets and service accounts, a helm hook created before
+// them; otherwise helm would only install it after running them. Charts
+// without pre-flight tasks keep it a regular resource.
+func addPreFlightDependencyAnnotations(config *helm.Mapping, settings ExportSettings) {
+	if !settings.CreateHelmChart || !hasPreFlightHooks(settings) {
+		return
+	}
+	annotations := helm.NewMapping()
+	annotations.Add("helm.sh/hook", "pre-install,pre-upgrade")
+	annotations.Add("helm.sh/hook-weight", strconv.Itoa(preFlightDependencyWeight))
+	// Keep it after the hooks ran, as the other resources use it too
+	annotations.Add("helm.sh/hook-delete-policy", "before-hook-creation")
+	getAnnotations(config.Get("metadata").(*helm.Mapping)).Merge(annotations)
+}
+
+// hasPreFlightHooks checks if any of the instance groups is a pre-flight task
+// run as a helm hook
+func hasPreFlightHooks(settings ExportSettings) bool {
+	if settings.RoleManifest == nil {
+		return false
+	}
+	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+		if isFlightStageHook(instanceGroup, settings) && instanceGroup.Run.FlightStage == model.FlightStagePreFlight {
+			return true
+		}
+	}
+	return false
+}
+
+func getKappChangeGroup(stage model.FlightStage) string {
+	return fmt.Sprintf("fissile.cloudfoundry.org/%s", stage)
+}
+
+// getFlightStageIndex returns the position of an instance group among those
+// of the same type and flight stage in the role manifest
+func getFlightStageIndex(instanceGroup *model.InstanceGroup, settings ExportSettings) int {
+	if settings.RoleManifest == nil {
+		return 0
+	}
+	index := 0
+	for _, other := range settings.RoleManifest.InstanceGroups {
+		if other.Name == instanceGroup.Name {
+			break
+		}
+		if other.Type == instanceGroup.Type && other.Run.FlightStage == instanceGroup.Run.FlightStage {
+			index++
+		}
+	}
+	return index
+}
+
+// hasFlightStage checks if any of the instance groups is in the given stage
+func hasFlightStage(stage model.FlightStage, settings ExportSettings) bool {
+	if settings.RoleManifest == nil {
+		return false
+	}
+	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+		if !instanceGroup.IsColocated() && instanceGroup.Run.FlightStage == stage {
+			return true
+		}
+	}
+	return false
+}
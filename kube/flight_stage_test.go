@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFlightStageAnnotations(t *testing.T) {
+	t.Parallel()
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	manifest, err := model.LoadRoleManifest(
+		filepath.Join(workDir, "../test-assets/role-manifests/kube/jobs.yml"),
+		model.LoadRoleManifestOptions{
+			ReleasePaths: []string{filepath.Join(workDir, "../test-assets/tor-boshrelease")},
+			BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+			ValidationOptions: model.RoleManifestValidationOptions{
+				AllowMissingScripts: true,
+			}})
+	require.NoError(t, err)
+
+	annotations := func(name string, settings ExportSettings) map[string]string {
+		instanceGroup := manifest.LookupInstanceGroup(name)
+		require.NotNil(t, instanceGroup, "Failed to find instance group %s", name)
+
+		config := newKubeConfig(settings, "v1", "Pod", name)
+		addFlightStageAnnotations(instanceGroup, config, settings)
+
+		result := make(map[string]string)
+		if node := config.Get("metadata", "annotations"); node != nil {
+			for _, key := range node.(*helm.Mapping).Names() {
+				if strings.HasPrefix(key, "{{") {
+					// Common annotations from the values
+					continue
+				}
+				result[key] = node.Get(key).String()
+			}
+		}
+		return result
+	}
+
+	t.Run("Helm", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{CreateHelmChart: true, RoleManifest: manifest}
+		assert.Equal(t, map[string]string{
+			"helm.sh/hook":               "pre-install,pre-upgrade",
+			"helm.sh/hook-weight":        "0",
+			"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+		}, annotations("pre-role", settings))
+		assert.Equal(t, map[string]string{
+			"helm.sh/hook":               "pre-install,pre-upgrade",
+			"helm.sh/hook-weight":        "1",
+			"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+		}, annotations("migrate-role", settings))
+		assert.Equal(t, map[string]string{
+			"helm.sh/hook":               "post-install,post-upgrade",
+			"helm.sh/hook-weight":        "0",
+			"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+		}, annotations("post-role", settings))
+		assert.Empty(t, annotations("main-role", settings))
+	})
+
+	t.Run("Kube", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: manifest}
+		assert.Equal(t, map[string]string{
+			"kapp.k14s.io/change-group": "fissile.cloudfoundry.org/pre-flight",
+		}, annotations("migrate-role", settings))
+		assert.Equal(t, map[string]string{
+			"kapp.k14s.io/change-group": "fissile.cloudfoundry.org/flight",
+			"kapp.k14s.io/change-rule":  "upsert after upserting fissile.cloudfoundry.org/pre-flight",
+		}, annotations("main-role", settings))
+		assert.Equal(t, map[string]string{
+			"kapp.k14s.io/change-group": "fissile.cloudfoundry.org/post-flight",
+			"kapp.k14s.io/change-rule":  "upsert after upserting fissile.cloudfoundry.org/flight",
+		}, annotations("post-role", settings))
+	})
+}
+
+func TestAddPreFlightDependencyAnnotations(t *testing.T) {
+	t.Parallel()
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	manifest, err := model.LoadRoleManifest(
+		filepath.Join(workDir, "../test-assets/role-manifests/kube/jobs.yml"),
+		model.LoadRoleManifestOptions{
+			ReleasePaths: []string{filepath.Join(workDir, "../test-assets/tor-boshrelease")},
+			BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+			ValidationOptions: model.RoleManifestValidationOptions{
+				AllowMissingScripts: true,
+			}})
+	require.NoError(t, err)
+
+	annotations := func(settings ExportSettings) interface{} {
+		secret, err := MakeRegistryCredentials(settings)
+		require.NoError(t, err)
+		node := secret.Get("metadata", "annotations")
+		if node == nil {
+			return nil
+		}
+		result := make(map[string]string)
+		for _, key := range node.(*helm.Mapping).Names() {
+			if !strings.HasPrefix(key, "{{") {
+				result[key] = node.Get(key).String()
+			}
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]string{
+		"helm.sh/hook":               "pre-install,pre-upgrade",
+		"helm.sh/hook-weight":        "-10",
+		"helm.sh/hook-delete-policy": "before-hook-creation",
+	}, annotations(ExportSettings{CreateHelmChart: true, RoleManifest: manifest}))
+
+	assert.Nil(t, annotations(ExportSettings{RoleManifest: manifest}), "Kube configs have no hooks")
+
+	withoutPreFlight := *manifest
+	withoutPreFlight.InstanceGroups = nil
+	for _, instanceGroup := range manifest.InstanceGroups {
+		if instanceGroup.Run.FlightStage != model.FlightStagePreFlight {
+			withoutPreFlight.InstanceGroups = append(withoutPreFlight.InstanceGroups, instanceGroup)
+		}
+	}
+	assert.NotContains(t, annotations(ExportSettings{CreateHelmChart: true, RoleManifest: &withoutPreFlight}),
+		"helm.sh/hook", "Without pre-flight tasks the resources are not hooks")
+}
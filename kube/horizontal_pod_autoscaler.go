@@ -0,0 +1,127 @@
+package kube
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// NewHorizontalPodAutoscaler creates a HorizontalPodAutoscaler scaling the
+// given controller of an instance group between the minimum and maximum
+// instance counts of the group. Nothing is returned for groups without
+// autoscaling. Helm charts only enable it if requested in values.yaml, and
+// the group has any instances.
+func NewHorizontalPodAutoscaler(instanceGroup *model.InstanceGroup, controller helm.Node, settings ExportSettings) (helm.Node, error) {
+	if instanceGroup.Run == nil || instanceGroup.Run.Scaling == nil {
+		return nil, fmt.Errorf("Instance group %s has no scaling information", instanceGroup.Name)
+	}
+	autoscaling := instanceGroup.Run.Autoscaling
+	if autoscaling == nil {
+		return nil, nil
+	}
+
+	roleName := makeVarName(instanceGroup.Name)
+	scaling := instanceGroup.Run.Scaling
+	minReplicas := helm.NewNode(atLeastOne(scaling.Min))
+	if settings.CreateHelmChart && scaling.HA != scaling.Min {
+		// Like the replicas, HA only applies if the count is left at the default
+		minReplicas = helm.NewNode(fmt.Sprintf("{{ if and .Values.config.HA (eq (int .Values.sizing.%s.count) %d) -}} %d {{- else -}} %d {{- end }}",
+			roleName, scaling.Min, atLeastOne(scaling.HA), atLeastOne(scaling.Min)))
+	}
+
+	spec := helm.NewMapping()
+	spec.Add("scaleTargetRef", helm.NewMapping(
+		"apiVersion", controller.Get("apiVersion").String(),
+		"kind", controller.Get("kind").String(),
+		"name", controller.Get("metadata", "name").String()))
+	spec.Add("minReplicas", minReplicas)
+	spec.Add("maxReplicas", scaling.Max)
+	spec.Add("metrics", getAutoscalingMetrics(autoscaling, settings))
+
+	var block helm.NodeModifier
+	if settings.CreateHelmChart {
+		condition := fmt.Sprintf(".Values.sizing.%s.autoscaling.enabled", roleName)
+		if scaling.Min == 0 {
+			// There is no controller to scale without instances
+			condition = fmt.Sprintf("and %s (gt (int .Values.sizing.%s.count) 0)", condition, roleName)
+		}
+		block = helm.Block("if " + condition)
+	}
+
+	hpa := newKubeConfig(settings, getAPIVersion("HorizontalPodAutoscaler", settings), "HorizontalPodAutoscaler", instanceGroup.Name, block)
+	hpa.Add("spec", spec)
+
+	return hpa, nil
+}
+
+// getAutoscalingMetrics returns the metric targets of an autoscaler. The
+// autoscaling/v2beta1 API describes them differently than later versions, so
+// helm charts contain both.
+func getAutoscalingMetrics(autoscaling *model.RoleRunAutoscaling, settings ExportSettings) *helm.List {
+	metrics := helm.NewList()
+
+	var current, legacy helm.NodeModifier
+	if settings.CreateHelmChart {
+		current = helm.Block("if " + minKubeVersion(1, 12))
+		legacy = helm.Block(fmt.Sprintf("if not (%s)", minKubeVersion(1, 12)))
+	}
+	addCurrent := settings.CreateHelmChart || settings.KubeVersion.atLeast(1, 12)
+	addLegacy := settings.CreateHelmChart || !settings.KubeVersion.atLeast(1, 12)
+
+	for _, resource := range []struct {
+		name        string
+		utilization *int
+	}{
+		{"cpu", autoscaling.CPUUtilization},
+		{"memory", autoscaling.MemoryUtilization},
+	} {
+		if resource.utilization == nil {
+			continue
+		}
+		if addCurrent {
+			metrics.Add(helm.NewNode(helm.NewMapping(
+				"type", "Resource",
+				"resource", helm.NewMapping(
+					"name", resource.name,
+					"target", helm.NewMapping(
+						"type", "Utilization",
+						"averageUtilization", *resource.utilization))), current))
+		}
+		if addLegacy {
+			metrics.Add(helm.NewNode(helm.NewMapping(
+				"type", "Resource",
+				"resource", helm.NewMapping(
+					"name", resource.name,
+					"targetAverageUtilization", *resource.utilization)), legacy))
+		}
+	}
+
+	for _, metric := range autoscaling.Metrics {
+		if addCurrent {
+			metrics.Add(helm.NewNode(helm.NewMapping(
+				"type", "Pods",
+				"pods", helm.NewMapping(
+					"metric", helm.NewMapping("name", metric.Name),
+					"target", helm.NewMapping(
+						"type", "AverageValue",
+						"averageValue", metric.AverageValue))), current))
+		}
+		if addLegacy {
+			metrics.Add(helm.NewNode(helm.NewMapping(
+				"type", "Pods",
+				"pods", helm.NewMapping(
+					"metricName", metric.Name,
+					"targetAverageValue", metric.AverageValue)), legacy))
+		}
+	}
+
+	return metrics
+}
+
+func atLeastOne(count int) int {
+	if count < 1 {
+		return 1
+	}
+	return count
+}
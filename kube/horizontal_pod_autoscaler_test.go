@@ -0,0 +1,256 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hpaTestInstanceGroup(scaling model.RoleRunScaling) *model.InstanceGroup {
+	cpu := 80
+	return &model.InstanceGroup{
+		Name: "some-group",
+		Type: model.RoleTypeBosh,
+		Run: &model.RoleRun{
+			Scaling: &scaling,
+			Autoscaling: &model.RoleRunAutoscaling{
+				CPUUtilization: &cpu,
+				Metrics: []model.RoleRunCustomMetric{
+					{Name: "requests_per_second", AverageValue: "100"},
+				},
+			},
+		},
+	}
+}
+
+func hpaTestController(settings ExportSettings) helm.Node {
+	return newKubeConfig(settings, "apps/v1", "StatefulSet", "some-group")
+}
+
+func TestNewHorizontalPodAutoscalerKube(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NoAutoscaling", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 3, HA: 1})
+		hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(ExportSettings{}), ExportSettings{})
+		assert.NoError(t, err)
+		assert.Nil(t, hpa)
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{}
+		instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 0, Max: 5, HA: 0})
+		hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(settings), settings)
+		require.NoError(t, err)
+		require.NotNil(t, hpa)
+
+		actual, err := RoundtripKube(hpa)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: autoscaling/v2beta1
+			kind: HorizontalPodAutoscaler
+			metadata:
+				name: some-group
+				labels:
+					app.kubernetes.io/component: some-group
+			spec:
+				scaleTargetRef:
+					apiVersion: apps/v1
+					kind: StatefulSet
+					name: some-group
+				minReplicas: 1
+				maxReplicas: 5
+				metrics:
+				-	type: Resource
+					resource:
+						name: cpu
+						targetAverageUtilization: 80
+				-	type: Pods
+					pods:
+						metricName: requests_per_second
+						targetAverageValue: "100"
+		`, actual)
+	})
+
+	t.Run("Current", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{KubeVersion: &ClusterVersion{1, 23}}
+		instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 2, Max: 5, HA: 2})
+		hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(settings), settings)
+		require.NoError(t, err)
+		require.NotNil(t, hpa)
+
+		actual, err := RoundtripKube(hpa)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			apiVersion: autoscaling/v2
+			spec:
+				minReplicas: 2
+				maxReplicas: 5
+				metrics:
+				-	type: Resource
+					resource:
+						name: cpu
+						target:
+							type: Utilization
+							averageUtilization: 80
+				-	type: Pods
+					pods:
+						metric:
+							name: requests_per_second
+						target:
+							type: AverageValue
+							averageValue: "100"
+		`, actual)
+	})
+}
+
+func TestNewHorizontalPodAutoscalerHelm(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{CreateHelmChart: true}
+	instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 5, HA: 3})
+	hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(settings), settings)
+	require.NoError(t, err)
+	require.NotNil(t, hpa)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(hpa, map[string]interface{}{
+			"Values.sizing.some_group.autoscaling.enabled": false,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(hpa, map[string]interface{}{
+			"Values.sizing.some_group.autoscaling.enabled": true,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			apiVersion: autoscaling/v2beta1
+			spec:
+				minReplicas: 1
+				maxReplicas: 5
+				metrics:
+				-	type: Resource
+					resource:
+						name: cpu
+						targetAverageUtilization: 80
+				-	type: Pods
+					pods:
+						metricName: requests_per_second
+						targetAverageValue: "100"
+		`, actual)
+	})
+
+	t.Run("Current", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(hpa, map[string]interface{}{
+			"Values.sizing.some_group.count":               1,
+			"Values.sizing.some_group.autoscaling.enabled": true,
+			"Values.config.HA":                             true,
+			"Capabilities.KubeVersion.Minor":               "12",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			apiVersion: autoscaling/v2beta2
+			spec:
+				minReplicas: 3
+				maxReplicas: 5
+				metrics:
+				-	type: Resource
+					resource:
+						name: cpu
+						target:
+							type: Utilization
+							averageUtilization: 80
+				-	type: Pods
+					pods:
+						metric:
+							name: requests_per_second
+						target:
+							type: AverageValue
+							averageValue: "100"
+		`, actual)
+	})
+}
+
+func TestNewHorizontalPodAutoscalerHelmCount(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{CreateHelmChart: true}
+
+	t.Run("ExplicitCountUnderHA", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 5, HA: 3})
+		hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(settings), settings)
+		require.NoError(t, err)
+
+		actual, err := RoundtripNode(hpa, map[string]interface{}{
+			"Values.sizing.some_group.count":               2,
+			"Values.sizing.some_group.autoscaling.enabled": true,
+			"Values.config.HA":                             true,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			spec:
+				minReplicas: 1
+		`, actual)
+	})
+
+	t.Run("NoInstances", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 0, Max: 5, HA: 0})
+		hpa, err := NewHorizontalPodAutoscaler(instanceGroup, hpaTestController(settings), settings)
+		require.NoError(t, err)
+
+		for _, count := range []int{0, 1} {
+			actual, err := RoundtripNode(hpa, map[string]interface{}{
+				"Values.sizing.some_group.count":               count,
+				"Values.sizing.some_group.autoscaling.enabled": true,
+			})
+			require.NoError(t, err)
+			if count == 0 {
+				assert.Nil(t, actual, "no autoscaler without instances")
+			} else {
+				assert.NotNil(t, actual, "autoscaler with instances")
+			}
+		}
+	})
+}
+
+func TestReplicaCheckAutoscaling(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{CreateHelmChart: true}
+	instanceGroup := hpaTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 5, HA: 1})
+	controller := newKubeConfig(settings, "apps/v1", "StatefulSet", "some-group")
+	controller.Add("spec", helm.NewMapping("template", helm.NewMapping(
+		"metadata", helm.NewMapping(),
+		"spec", helm.NewMapping())))
+	require.NoError(t, replicaCheck(instanceGroup, controller, nil, settings))
+
+	for _, enabled := range []bool{false, true} {
+		actual, err := RoundtripNode(controller, map[string]interface{}{
+			"Values.sizing.some_group.count":               2,
+			"Values.sizing.some_group.autoscaling.enabled": enabled,
+			"Values.sizing.some_group.affinity":            map[string]interface{}{},
+		})
+		require.NoError(t, err)
+		spec := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		if enabled {
+			assert.NotContains(t, spec, "replicas", "autoscaling enabled")
+		} else {
+			assert.Equal(t, 2, spec["replicas"], "autoscaling disabled")
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// NewIngress creates an Ingress routing the hosts and paths of the public
+// ports with an ingress section to the private services of the instance
+// group. Nothing is returned if there are no such ports. Helm charts only
+// enable it if requested in values.yaml.
+func NewIngress(instanceGroup *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
+	var hosts []string
+	paths := make(map[string]*helm.List)
+	tlsHosts := make(map[string]*helm.List)
+	var tlsSecrets []string
+
+	for _, job := range instanceGroup.JobReferences {
+		serviceName := job.ContainerProperties.BoshContainerization.ServiceName
+		if serviceName == "" {
+			serviceName = util.ConvertNameToKey(instanceGroup.Name + "-" + job.Name)
+		}
+
+		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+			if port.Ingress == nil {
+				continue
+			}
+			for _, host := range port.Ingress.Hosts {
+				if _, ok := paths[host]; !ok {
+					hosts = append(hosts, host)
+					paths[host] = helm.NewList()
+				}
+				for _, path := range getIngressPaths(makeResourceName(serviceName, settings), port, settings) {
+					paths[host].Add(path)
+				}
+
+				if port.Ingress.TLSSecret != "" {
+					if _, ok := tlsHosts[port.Ingress.TLSSecret]; !ok {
+						tlsSecrets = append(tlsSecrets, port.Ingress.TLSSecret)
+						tlsHosts[port.Ingress.TLSSecret] = helm.NewList()
+					}
+					tlsHosts[port.Ingress.TLSSecret].Add(host)
+				}
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+
+	spec := helm.NewMapping()
+	if settings.CreateHelmChart {
+		// ingressClassName is new in kube 1.18; older versions use an annotation
+		spec.Add("ingressClassName", "{{ .Values.ingress.class }}",
+			helm.Block(fmt.Sprintf("if and .Values.ingress.class (%s)", minKubeVersion(1, 18))))
+	}
+
+	rules := helm.NewList()
+	for _, host := range hosts {
+		rules.Add(helm.NewMapping(
+			"host", host,
+			"http", helm.NewMapping("paths", paths[host])))
+	}
+	spec.Add("rules", rules)
+
+	if len(tlsSecrets) > 0 {
+		tls := helm.NewList()
+		for _, secret := range tlsSecrets {
+			tls.Add(helm.NewMapping("hosts", tlsHosts[secret], "secretName", secret))
+		}
+		var block helm.NodeModifier
+		if settings.CreateHelmChart {
+			block = helm.Block("if .Values.ingress.tls")
+		}
+		spec.Add("tls", tls, block)
+	}
+
+	var block helm.NodeModifier
+	if settings.CreateHelmChart {
+		block = helm.Block("if .Values.ingress.enabled")
+	}
+
+	ingress := newKubeConfig(settings, getAPIVersion("Ingress", settings), "Ingress", instanceGroup.Name, block)
+	if settings.CreateHelmChart {
+		annotations := getAnnotations(ingress.Get("metadata").(*helm.Mapping))
+		annotations.Add("{{ $ingressAnnotation }}", "{{ $value | quote }}",
+			helm.Block("range $ingressAnnotation, $value := .Values.ingress.annotations"))
+		if len(settings.Annotations) == 0 {
+			annotations.Set(helm.Block("if or .Values.kube.annotations .Values.ingress.annotations"))
+		}
+	}
+	ingress.Add("spec", spec)
+
+	return ingress, nil
+}
+
+// getIngressPaths returns the paths of an ingress rule routed to a port of
+// a service. The networking.k8s.io/v1 API describes them differently than
+// earlier versions, so helm charts contain both.
+func getIngressPaths(serviceName string, port model.JobExposedPort, settings ExportSettings) []helm.Node {
+	pathNames := port.Ingress.Paths
+	if len(pathNames) == 0 {
+		pathNames = []string{"/"}
+	}
+
+	var current, legacy helm.NodeModifier
+	if settings.CreateHelmChart {
+		current = helm.Block("if " + minKubeVersion(1, 19))
+		legacy = helm.Block(fmt.Sprintf("if not (%s)", minKubeVersion(1, 19)))
+	}
+	addCurrent := settings.CreateHelmChart || settings.KubeVersion.atLeast(1, 19)
+	addLegacy := settings.CreateHelmChart || !settings.KubeVersion.atLeast(1, 19)
+
+	var paths []helm.Node
+	for _, pathName := range pathNames {
+		if addCurrent {
+			paths = append(paths, helm.NewNode(helm.NewMapping(
+				"path", pathName,
+				"pathType", "Prefix",
+				"backend", helm.NewMapping(
+					"service", helm.NewMapping(
+						"name", serviceName,
+						"port", helm.NewMapping("name", port.Name)))), current))
+		}
+		if addLegacy {
+			paths = append(paths, helm.NewNode(helm.NewMapping(
+				"path", pathName,
+				"backend", helm.NewMapping(
+					"serviceName", serviceName,
+					"servicePort", port.Name)), legacy))
+		}
+	}
+	return paths
+}
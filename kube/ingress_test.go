@@ -0,0 +1,256 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIngressKube(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	instanceGroup := deploymentTestLoad(assert, "myrole", "ingress.yml")
+	require.NotNil(t, instanceGroup)
+
+	t.Run("Legacy", func(t *testing.T) {
+		t.Parallel()
+		ingress, err := NewIngress(instanceGroup, ExportSettings{})
+		require.NoError(t, err)
+		require.NotNil(t, ingress)
+
+		actual, err := RoundtripKube(ingress)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert, `---
+			apiVersion: extensions/v1beta1
+			kind: Ingress
+			metadata:
+				name: myrole
+				labels:
+					app.kubernetes.io/component: myrole
+			spec:
+				rules:
+				-	host: app.example.com
+					http:
+						paths:
+						-	path: /api
+							backend:
+								serviceName: myrole-tor
+								servicePort: http
+						-	path: /
+							backend:
+								serviceName: ui
+								servicePort: ui
+				-	host: www.example.com
+					http:
+						paths:
+						-	path: /api
+							backend:
+								serviceName: myrole-tor
+								servicePort: http
+				tls:
+				-	hosts: [app.example.com, www.example.com]
+					secretName: app-tls
+		`, actual)
+	})
+
+	t.Run("Current", func(t *testing.T) {
+		t.Parallel()
+		ingress, err := NewIngress(instanceGroup, ExportSettings{KubeVersion: &ClusterVersion{1, 19}})
+		require.NoError(t, err)
+		require.NotNil(t, ingress)
+
+		actual, err := RoundtripKube(ingress)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			apiVersion: networking.k8s.io/v1
+			spec:
+				rules:
+				-	host: app.example.com
+					http:
+						paths:
+						-	path: /api
+							pathType: Prefix
+							backend:
+								service:
+									name: myrole-tor
+									port:
+										name: http
+						-	path: /
+							pathType: Prefix
+							backend:
+								service:
+									name: ui
+									port:
+										name: ui
+				-	host: www.example.com
+					http:
+						paths:
+						-	path: /api
+							pathType: Prefix
+							backend:
+								service:
+									name: myrole-tor
+									port:
+										name: http
+		`, actual)
+	})
+
+	t.Run("NoIngress", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := deploymentTestLoad(assert, "myrole", "exposed-ports.yml")
+		require.NotNil(t, instanceGroup)
+		ingress, err := NewIngress(instanceGroup, ExportSettings{})
+		assert.NoError(err)
+		assert.Nil(ingress)
+	})
+}
+
+func TestNewIngressHelm(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	instanceGroup := deploymentTestLoad(assert, "myrole", "ingress.yml")
+	require.NotNil(t, instanceGroup)
+
+	ingress, err := NewIngress(instanceGroup, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+	require.NotNil(t, ingress)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(ingress, map[string]interface{}{
+			"Values.ingress.enabled": false,
+		})
+		require.NoError(t, err)
+		assert.Nil(actual)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(ingress, map[string]interface{}{
+			"Values.ingress.enabled":         true,
+			"Values.ingress.class":           "nginx",
+			"Values.ingress.annotations":     map[string]interface{}{"a": "b"},
+			"Values.ingress.tls":             false,
+			"Capabilities.KubeVersion.Minor": "19",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			apiVersion: networking.k8s.io/v1
+			metadata:
+				annotations:
+					a: b
+			spec:
+				ingressClassName: nginx
+				rules:
+				-	host: app.example.com
+					http:
+						paths:
+						-	path: /api
+							pathType: Prefix
+							backend:
+								service:
+									name: myrole-tor
+									port:
+										name: http
+						-	path: /
+							pathType: Prefix
+							backend:
+								service:
+									name: ui
+									port:
+										name: ui
+				-	host: www.example.com
+					http:
+						paths:
+						-	path: /api
+							pathType: Prefix
+							backend:
+								service:
+									name: myrole-tor
+									port:
+										name: http
+		`, actual)
+		spec := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		assert.NotContains(spec, "tls")
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(ingress, map[string]interface{}{
+			"Values.ingress.enabled": true,
+			"Values.ingress.class":   "nginx",
+			"Values.ingress.tls":     true,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			apiVersion: extensions/v1beta1
+			spec:
+				rules:
+				-	host: app.example.com
+					http:
+						paths:
+						-	path: /api
+							backend:
+								serviceName: myrole-tor
+								servicePort: http
+						-	path: /
+							backend:
+								serviceName: ui
+								servicePort: ui
+				-	host: www.example.com
+					http:
+						paths:
+						-	path: /api
+							backend:
+								serviceName: myrole-tor
+								servicePort: http
+				tls:
+				-	secretName: app-tls
+		`, actual)
+		spec := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		assert.NotContains(spec, "ingressClassName")
+	})
+}
+
+func TestNewServiceIngressPorts(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	instanceGroup := deploymentTestLoad(assert, "myrole", "ingress.yml")
+	require.NotNil(t, instanceGroup)
+	settings := ExportSettings{CreateHelmChart: true}
+
+	for _, enabled := range []bool{false, true} {
+		config := map[string]interface{}{
+			"Values.ingress.enabled":       enabled,
+			"Values.services.loadbalanced": true,
+		}
+
+		// Some of the public ports are routed through the ingress
+		service, err := newService(instanceGroup, instanceGroup.JobReferences[0], newServiceTypePublic, settings)
+		require.NoError(t, err)
+		actual, err := RoundtripNode(service, config)
+		require.NoError(t, err)
+		ports := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})["ports"].([]interface{})
+		if enabled {
+			assert.Len(ports, 1, "ingress enabled")
+		} else {
+			assert.Len(ports, 2, "ingress disabled")
+		}
+
+		// All of the public ports are routed through the ingress
+		service, err = newService(instanceGroup, instanceGroup.JobReferences[1], newServiceTypePublic, settings)
+		require.NoError(t, err)
+		actual, err = RoundtripNode(service, config)
+		require.NoError(t, err)
+		if enabled {
+			assert.Nil(actual, "ingress enabled")
+		} else {
+			assert.NotNil(actual, "ingress disabled")
+		}
+	}
+}
@@ -25,13 +25,16 @@ func NewJob(instanceGroup *model.InstanceGroup, settings ExportSettings, grapher
 		return nil, fmt.Errorf("Instance group %s has unexpected flight stage %s", instanceGroup.Name, instanceGroup.Run.FlightStage)
 	}
 
+	// Jobs can't be changed, so each revision gets new ones; hooks are
+	// replaced by helm instead
 	name := instanceGroup.Name
-	if settings.CreateHelmChart {
+	if settings.CreateHelmChart && !isFlightStageHook(instanceGroup, settings) {
 		name += "-{{ .Release.Revision }}"
 	}
 
 	job := newKubeConfig(settings, "batch/v1", "Job", name, helm.Comment(instanceGroup.GetLongDescription()))
 	job.Add("spec", helm.NewMapping("template", podTemplate))
+	addFlightStageAnnotations(instanceGroup, job, settings)
 
 	return job.Sort(), nil
 }
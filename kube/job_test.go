@@ -160,15 +160,19 @@ func TestJobHelm(t *testing.T) {
 		apiVersion: batch/v1
 		kind: "Job"
 		metadata:
-			name: "pre-role-42"
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
+			name: "pre-role"
 			labels:
-				app.kubernetes.io/component: pre-role-42
+				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
 				app.kubernetes.io/managed-by: Tiller
 				app.kubernetes.io/name: MyChart
 				app.kubernetes.io/version: 1.22.333.4444
 				helm.sh/chart: MyChart-42.1_foo
-				skiff-role-name: pre-role-42
+				skiff-role-name: pre-role
 		spec:
 			template:
 				metadata:
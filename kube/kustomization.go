@@ -0,0 +1,97 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+const kustomizeAPIVersion = "kustomize.config.k8s.io/v1beta1"
+
+// MakeKustomization creates the kustomization of a kustomize base, listing
+// the given resources. The config vars are put into a config map and a
+// secret generated by kustomize, with the values from the defaults.
+func MakeKustomization(resources []string, variables model.CVMap, settings ExportSettings) (helm.Node, error) {
+	configLiterals, secretLiterals := getKustomizeLiterals(variables, func(cv *model.VariableDefinition) (bool, string) {
+		ok, value := cv.Value(settings.Defaults)
+		if !ok && cv.CVOptions.Secret {
+			// Pods require all the keys of the secret, as in kube configs
+			return true, ""
+		}
+		return ok, value
+	})
+
+	kustomization := helm.NewMapping("apiVersion", kustomizeAPIVersion, "kind", "Kustomization")
+	kustomization.Add("resources", helm.NewNode(resources))
+	kustomization.Add("configMapGenerator", helm.NewList(helm.NewMapping(
+		"name", makeResourceName(configMapName, settings),
+		"literals", helm.NewNode(configLiterals))))
+	kustomization.Add("secretGenerator", helm.NewList(helm.NewMapping(
+		"name", makeResourceName(userSecretsName, settings),
+		"literals", helm.NewNode(secretLiterals))))
+
+	return kustomization, nil
+}
+
+// MakeKustomizeOverlay creates the kustomization of an overlay of the given
+// kustomize base, merging the config vars set in the defaults into the
+// generated config map and secret.
+func MakeKustomizeOverlay(base string, variables model.CVMap, defaults map[string]string, settings ExportSettings) (helm.Node, error) {
+	for name := range defaults {
+		if _, ok := variables[name]; !ok {
+			return nil, fmt.Errorf("Overlay default %s is not a variable of the role manifest", name)
+		}
+	}
+
+	configLiterals, secretLiterals := getKustomizeLiterals(variables, func(cv *model.VariableDefinition) (bool, string) {
+		if _, ok := defaults[cv.Name]; !ok {
+			return false, ""
+		}
+		return cv.Value(defaults)
+	})
+
+	kustomization := helm.NewMapping("apiVersion", kustomizeAPIVersion, "kind", "Kustomization")
+	kustomization.Add("resources", helm.NewList(base))
+	if len(configLiterals) > 0 {
+		kustomization.Add("configMapGenerator", helm.NewList(helm.NewMapping(
+			"name", makeResourceName(configMapName, settings),
+			"behavior", "merge",
+			"literals", helm.NewNode(configLiterals))))
+	}
+	if len(secretLiterals) > 0 {
+		kustomization.Add("secretGenerator", helm.NewList(helm.NewMapping(
+			"name", makeResourceName(userSecretsName, settings),
+			"behavior", "merge",
+			"literals", helm.NewNode(secretLiterals))))
+	}
+
+	return kustomization, nil
+}
+
+// getKustomizeLiterals returns the sorted key=value literals of the config
+// map and the secret of a kustomization, for the config vars with a value.
+// Config map keys are the variable names; secret keys match the ones used by
+// pods and the secret of kube configs.
+func getKustomizeLiterals(variables model.CVMap, value func(*model.VariableDefinition) (bool, string)) ([]string, []string) {
+	var configLiterals, secretLiterals []string
+	for name, cv := range variables {
+		if isComputedVariable(name) {
+			continue
+		}
+		ok, stringifiedValue := value(cv)
+		if !ok {
+			continue
+		}
+		if cv.CVOptions.Secret {
+			secretLiterals = append(secretLiterals, fmt.Sprintf("%s=%s", util.ConvertNameToKey(name), stringifiedValue))
+		} else {
+			configLiterals = append(configLiterals, fmt.Sprintf("%s=%s", name, stringifiedValue))
+		}
+	}
+	sort.Strings(configLiterals)
+	sort.Strings(secretLiterals)
+	return configLiterals, secretLiterals
+}
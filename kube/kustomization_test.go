@@ -0,0 +1,98 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kustomizeTestCVMap() model.CVMap {
+	return model.CVMap{
+		"DOMAIN": &model.VariableDefinition{
+			Name:      "DOMAIN",
+			CVOptions: model.CVOptions{Default: "example.com"},
+		},
+		"STRUCTURED": &model.VariableDefinition{
+			Name:      "STRUCTURED",
+			CVOptions: model.CVOptions{Default: []string{"a", "b"}},
+		},
+		"UNSET": &model.VariableDefinition{
+			Name: "UNSET",
+		},
+		"ADMIN_PASSWORD": &model.VariableDefinition{
+			Name:      "ADMIN_PASSWORD",
+			CVOptions: model.CVOptions{Secret: true},
+		},
+		"KUBE_SECRETS_GENERATION_COUNTER": &model.VariableDefinition{
+			Name:      "KUBE_SECRETS_GENERATION_COUNTER",
+			CVOptions: model.CVOptions{Default: "1"},
+		},
+	}
+}
+
+func TestMakeKustomization(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{
+		Defaults: map[string]string{"DOMAIN": "base.example.com"},
+	}
+	kustomization, err := MakeKustomization([]string{"auth/account.yaml", "bosh/role.yaml"}, kustomizeTestCVMap(), settings)
+	require.NoError(t, err)
+
+	actual, err := RoundtripKube(kustomization)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert.New(t), `---
+		apiVersion: kustomize.config.k8s.io/v1beta1
+		kind: Kustomization
+		resources:
+		-	auth/account.yaml
+		-	bosh/role.yaml
+		configMapGenerator:
+		-	name: config
+			literals:
+			-	DOMAIN=base.example.com
+			-	STRUCTURED=["a","b"]
+		secretGenerator:
+		-	name: secrets
+			literals:
+			-	admin-password=
+	`, actual)
+}
+
+func TestMakeKustomizeOverlay(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Merge", func(t *testing.T) {
+		t.Parallel()
+		overlay, err := MakeKustomizeOverlay("../../base", kustomizeTestCVMap(), map[string]string{
+			"ADMIN_PASSWORD": "changeme",
+		}, ExportSettings{})
+		require.NoError(t, err)
+
+		actual, err := RoundtripKube(overlay)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: kustomize.config.k8s.io/v1beta1
+			kind: Kustomization
+			resources:
+			-	../../base
+			secretGenerator:
+			-	name: secrets
+				behavior: merge
+				literals:
+				-	admin-password=changeme
+		`, actual)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		t.Parallel()
+		_, err := MakeKustomizeOverlay("../../base", kustomizeTestCVMap(), map[string]string{
+			"DOMAIN":  "overlay.example.com",
+			"UNKNOWN": "value",
+		}, ExportSettings{})
+		assert.EqualError(t, err, "Overlay default UNKNOWN is not a variable of the role manifest")
+	})
+}
@@ -0,0 +1,105 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// NewNetworkPolicy creates a NetworkPolicy for the pods of the given instance
+// group, only allowing ingress from the instance groups consuming its links
+// (or those of its colocated containers), and from anywhere to its public
+// ports. Helm charts only enable it if requested in values.yaml.
+func NewNetworkPolicy(instanceGroup *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
+	if !settings.CreateHelmChart && !settings.NetworkPolicies {
+		return nil, nil
+	}
+	if settings.RoleManifest == nil {
+		return nil, fmt.Errorf("Network policy for instance group %s needs the role manifest", instanceGroup.Name)
+	}
+
+	providers := append(model.InstanceGroups{instanceGroup}, instanceGroup.GetColocatedRoles()...)
+
+	consumers := make(map[string]bool)
+	var publicPorts []helm.Node
+	for _, provider := range providers {
+		for _, name := range settings.RoleManifest.LinkConsumers(provider.Name) {
+			consumer := settings.RoleManifest.LookupInstanceGroup(name)
+			if consumer == nil || !consumer.IsColocated() {
+				consumers[name] = true
+				continue
+			}
+			// Colocated containers run in the pods of the instance groups using them
+			for _, host := range settings.RoleManifest.InstanceGroups {
+				for _, colocated := range host.ColocatedContainers() {
+					if colocated == name {
+						consumers[host.Name] = true
+					}
+				}
+			}
+		}
+
+		for _, job := range provider.JobReferences {
+			for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+				if port.Public {
+					publicPorts = append(publicPorts, getNetworkPolicyPorts(provider, port, settings)...)
+				}
+			}
+		}
+	}
+
+	var names []string
+	for name := range consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ingress := helm.NewList()
+	if len(names) > 0 {
+		from := helm.NewList()
+		for _, name := range names {
+			from.Add(helm.NewMapping("podSelector", helm.NewMapping(
+				"matchLabels", helm.NewMapping(RoleNameLabel, makeResourceName(name, settings)))))
+		}
+		ingress.Add(helm.NewMapping("from", from))
+	}
+	if len(publicPorts) > 0 {
+		ingress.Add(helm.NewMapping("ports", helm.NewNode(publicPorts)))
+	}
+
+	spec := helm.NewMapping()
+	spec.Add("podSelector", helm.NewMapping("matchLabels", helm.NewMapping(RoleNameLabel, makeResourceName(instanceGroup.Name, settings))))
+	spec.Add("policyTypes", helm.NewList("Ingress"))
+	spec.Add("ingress", ingress)
+
+	var block helm.NodeModifier
+	if settings.CreateHelmChart {
+		block = helm.Block("if .Values.kube.network_policies")
+	}
+
+	policy := newKubeConfig(settings, "networking.k8s.io/v1", "NetworkPolicy", instanceGroup.Name, block)
+	policy.Add("spec", spec)
+
+	return policy, nil
+}
+
+// getNetworkPolicyPorts returns the container ports of an exposed port, in
+// the form used by network policies
+func getNetworkPolicyPorts(instanceGroup *model.InstanceGroup, port model.JobExposedPort, settings ExportSettings) []helm.Node {
+	if settings.CreateHelmChart && port.CountIsConfigurable {
+		sizing := fmt.Sprintf(".Values.sizing.%s.ports.%s", makeVarName(instanceGroup.Name), makeVarName(port.Name))
+		policyPort := helm.NewMapping(
+			"port", fmt.Sprintf("{{ add %d $port }}", port.InternalPort),
+			"protocol", port.Protocol)
+		policyPort.Set(helm.Block(fmt.Sprintf("range $port := until (int %s.count)", sizing)))
+		return []helm.Node{policyPort}
+	}
+
+	var ports []helm.Node
+	for portNumber := port.InternalPort; portNumber < port.InternalPort+port.Count; portNumber++ {
+		ports = append(ports, helm.NewMapping("port", portNumber, "protocol", port.Protocol))
+	}
+	return ports
+}
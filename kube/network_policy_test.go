@@ -0,0 +1,134 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func networkPolicyTestLoad(t *testing.T) *model.RoleManifest {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	manifest, err := model.LoadRoleManifest(
+		filepath.Join(workDir, "../test-assets/role-manifests/kube/network-policy.yml"),
+		model.LoadRoleManifestOptions{
+			ReleasePaths: []string{
+				filepath.Join(workDir, "../test-assets/ntp-release"),
+			},
+			BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+			ValidationOptions: model.RoleManifestValidationOptions{
+				AllowMissingScripts: true,
+			}})
+	require.NoError(t, err)
+	return manifest
+}
+
+func TestNewNetworkPolicyKube(t *testing.T) {
+	t.Parallel()
+
+	manifest := networkPolicyTestLoad(t)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: manifest}
+		policy, err := NewNetworkPolicy(manifest.LookupInstanceGroup("server"), settings)
+		assert.NoError(t, err)
+		assert.Nil(t, policy)
+	})
+
+	t.Run("Provider", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: manifest, NetworkPolicies: true}
+		policy, err := NewNetworkPolicy(manifest.LookupInstanceGroup("server"), settings)
+		require.NoError(t, err)
+		require.NotNil(t, policy)
+
+		actual, err := RoundtripKube(policy)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: networking.k8s.io/v1
+			kind: NetworkPolicy
+			metadata:
+				name: server
+				labels:
+					app.kubernetes.io/component: server
+			spec:
+				podSelector:
+					matchLabels:
+						app.kubernetes.io/component: server
+				policyTypes:
+				-	Ingress
+				ingress:
+				-	from:
+					-	podSelector:
+							matchLabels:
+								app.kubernetes.io/component: client
+					-	podSelector:
+							matchLabels:
+								app.kubernetes.io/component: server
+				-	ports:
+					-	port: 123
+						protocol: UDP
+		`, actual)
+	})
+
+	t.Run("Unconsumed", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: manifest, NetworkPolicies: true}
+		policy, err := NewNetworkPolicy(manifest.LookupInstanceGroup("client"), settings)
+		require.NoError(t, err)
+		require.NotNil(t, policy)
+
+		actual, err := RoundtripKube(policy)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			spec:
+				podSelector:
+					matchLabels:
+						app.kubernetes.io/component: client
+				ingress: []
+		`, actual)
+	})
+}
+
+func TestNewNetworkPolicyHelm(t *testing.T) {
+	t.Parallel()
+
+	manifest := networkPolicyTestLoad(t)
+	settings := ExportSettings{RoleManifest: manifest, CreateHelmChart: true}
+	policy, err := NewNetworkPolicy(manifest.LookupInstanceGroup("server"), settings)
+	require.NoError(t, err)
+	require.NotNil(t, policy)
+
+	actual, err := RoundtripNode(policy, map[string]interface{}{
+		"Values.kube.network_policies": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, actual)
+
+	actual, err = RoundtripNode(policy, map[string]interface{}{
+		"Values.kube.network_policies": true,
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert.New(t), `---
+		kind: NetworkPolicy
+		spec:
+			ingress:
+			-	from:
+				-	podSelector:
+						matchLabels:
+							app.kubernetes.io/component: client
+				-	podSelector:
+						matchLabels:
+							app.kubernetes.io/component: server
+			-	ports:
+				-	port: 123
+					protocol: UDP
+	`, actual)
+}
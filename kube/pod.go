@@ -36,17 +36,17 @@ func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher
 		containers.Add(containerMapping)
 	}
 
-	imagePullSecrets := helm.NewMapping("name", "registry-credentials")
+	imagePullSecrets := helm.NewMapping("name", makeResourceName("registry-credentials", settings))
 
 	spec := helm.NewMapping()
 	spec.Add("containers", containers)
 	spec.Add("imagePullSecrets", helm.NewList(imagePullSecrets))
 	spec.Add("dnsPolicy", "ClusterFirst")
-	spec.Add("volumes", getNonClaimVolumes(role, settings.CreateHelmChart))
+	spec.Add("volumes", getNonClaimVolumes(role, settings))
 	spec.Add("restartPolicy", "Always")
 	if role.Run.ServiceAccount != "default" {
 		// This role requires a custom service account
-		spec.Add("serviceAccountName", role.Run.ServiceAccount, authModeRBAC(settings))
+		spec.Add("serviceAccountName", makeResourceName(role.Run.ServiceAccount, settings), authModeRBAC(settings))
 	}
 
 	// BOSH can potentially have an infinite termination grace period; we don't
@@ -60,7 +60,11 @@ func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher
 	pod := newKubeConfig(settings, "v1", "Pod", role.Name)
 	meta := pod.Get("metadata").(*helm.Mapping)
 	if settings.CreateHelmChart {
-		meta.Add("annotations", helm.NewMapping("checksum/config", `{{ include (print $.Template.BasePath "/secrets.yaml") . | sha256sum }}`))
+		getAnnotations(meta).Add("checksum/config", `{{ include (print $.Template.BasePath "/secrets.yaml") . | sha256sum }}`)
+	} else {
+		// The selectors of the controllers still use the legacy role name
+		// label, which newKubeConfig only adds to helm charts
+		meta.Get("labels").(*helm.Mapping).Add("skiff-role-name", makeResourceName(role.Name, settings))
 	}
 	podTemplate.Add("metadata", meta)
 	podTemplate.Add("spec", spec)
@@ -87,6 +91,7 @@ func NewPod(role *model.InstanceGroup, settings ExportSettings, grapher util.Mod
 
 	pod := newKubeConfig(settings, "v1", "Pod", role.Name, helm.Comment(role.GetLongDescription()))
 	pod.Add("spec", podTemplate.Get("spec"))
+	addFlightStageAnnotations(role, pod, settings)
 
 	return pod.Sort(), nil
 }
@@ -190,6 +195,20 @@ func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, gra
 
 // getContainerImageName returns the name of the docker image to use for a role
 func getContainerImageName(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (string, error) {
+	if settings.ImageDigests != nil {
+		imageName, err := getContainerImageDigestName(role, settings, grapher)
+		if err != nil {
+			return "", err
+		}
+		if settings.CreateHelmChart {
+			registry := "{{ .Values.kube.registry.hostname }}"
+			org := "{{ .Values.kube.organization }}"
+			image := fmt.Sprintf("{{ .Values.kube.images.%s }}", makeVarName(role.Name))
+			return builder.GetRegistryImageName(registry, org, image), nil
+		}
+		return builder.GetRegistryImageName(settings.Registry, settings.Organization, imageName), nil
+	}
+
 	devVersion, err := role.GetRoleDevVersion(settings.Opinions, settings.TagExtra, settings.FissileVersion, grapher)
 	if err != nil {
 		return "", err
@@ -207,6 +226,24 @@ func getContainerImageName(role *model.InstanceGroup, settings ExportSettings, g
 	return imageName, nil
 }
 
+// getContainerImageDigestName returns the name of the docker image of a role,
+// without registry and organization, referenced by the digest found in the
+// settings
+func getContainerImageDigestName(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (string, error) {
+	devVersion, err := role.GetRoleDevVersion(settings.Opinions, settings.TagExtra, settings.FissileVersion, grapher)
+	if err != nil {
+		return "", err
+	}
+
+	taggedName := builder.GetRoleDevImageName(settings.Registry, settings.Organization, settings.Repository, role, devVersion)
+	digest, ok := settings.ImageDigests[taggedName]
+	if !ok {
+		return "", fmt.Errorf("No digest found for image %s", taggedName)
+	}
+
+	return fmt.Sprintf("%s@%s", builder.GetRoleImageRepository("", "", settings.Repository, role), digest), nil
+}
+
 // getContainerPorts returns a list of ports for a role
 func getContainerPorts(role *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
 	var ports []helm.Node
@@ -280,14 +317,15 @@ func getVolumeMounts(role *model.InstanceGroup, createHelmChart bool) helm.Node
 }
 
 const userSecretsName = "secrets"
+const configMapName = "config"
 const generatedSecretsName = "secrets-{{ .Chart.Version }}-{{ .Values.kube.secrets_generation_counter }}"
 
-func makeSecretVar(name string, generated bool, modifiers ...helm.NodeModifier) helm.Node {
+func makeSecretVar(name string, generated bool, settings ExportSettings, modifiers ...helm.NodeModifier) helm.Node {
 	secretKeyRef := helm.NewMapping("key", util.ConvertNameToKey(name))
 	if generated {
-		secretKeyRef.Add("name", generatedSecretsName)
+		secretKeyRef.Add("name", makeResourceName(generatedSecretsName, settings))
 	} else {
-		secretKeyRef.Add("name", userSecretsName)
+		secretKeyRef.Add("name", makeResourceName(userSecretsName, settings))
 	}
 
 	envVar := helm.NewMapping("name", name, "valueFrom", helm.NewMapping("secretKeyRef", secretKeyRef))
@@ -296,17 +334,17 @@ func makeSecretVar(name string, generated bool, modifiers ...helm.NodeModifier)
 }
 
 // getNonClaimVolumes returns the list of pod volumes that are _not_ bound with volume claims
-func getNonClaimVolumes(role *model.InstanceGroup, createHelmChart bool) helm.Node {
+func getNonClaimVolumes(role *model.InstanceGroup, settings ExportSettings) helm.Node {
 	var mounts []helm.Node
 	for _, volume := range role.Run.Volumes {
 		switch volume.Type {
 		case model.VolumeTypeHost:
 			hostPathInfo := helm.NewMapping("path", volume.Path)
-			if createHelmChart {
-				hostPathInfo.Add("type", "Directory", helm.Block(fmt.Sprintf("if (%s)", minKubeVersion(1, 8))))
+			if add, guard := withMinKubeVersion(1, 8, settings); add {
+				hostPathInfo.Add("type", "Directory", guard)
 			}
 			volumeEntry := helm.NewMapping("name", volume.Tag, "hostPath", hostPathInfo)
-			if createHelmChart {
+			if settings.CreateHelmChart {
 				volumeEntry.Set(helm.Block("if .Values.kube.hostpath_available"))
 			}
 			mounts = append(mounts, volumeEntry)
@@ -332,10 +370,22 @@ func getEnvVars(role *model.InstanceGroup, settings ExportSettings) (helm.Node,
 	return getEnvVarsFromConfigs(configs, settings)
 }
 
-func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) (helm.Node, error) {
-	sizingCountRegexp := regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_COUNT$")
-	sizingPortsRegexp := regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_PORTS_([A-Z][A-Z_]*)_(MIN|MAX)$")
+var (
+	sizingCountRegexp = regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_COUNT$")
+	sizingPortsRegexp = regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_PORTS_([A-Z][A-Z_]*)_(MIN|MAX)$")
+)
+
+// isComputedVariable checks if the value of a config var is computed by
+// fissile, instead of being taken from the defaults or helm values
+func isComputedVariable(name string) bool {
+	switch name {
+	case "HELM_IS_INSTALL", "KUBERNETES_STORAGE_CLASS_PERSISTENT", "KUBE_SECRETS_GENERATION_COUNTER", "KUBE_SECRETS_GENERATION_NAME":
+		return true
+	}
+	return sizingCountRegexp.MatchString(name) || sizingPortsRegexp.MatchString(name)
+}
 
+func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) (helm.Node, error) {
 	var env []helm.Node
 	for _, config := range configs {
 		// KUBE_SIZING_role_COUNT
@@ -434,31 +484,39 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) (he
 			if settings.CreateHelmChart {
 				value = generatedSecretsName
 			}
+			value = makeResourceName(value, settings)
 			env = append(env, helm.NewMapping("name", config.Name, "value", value))
 			continue
 		}
 
 		if config.CVOptions.Secret {
 			if !settings.CreateHelmChart {
-				env = append(env, makeSecretVar(config.Name, false))
+				env = append(env, makeSecretVar(config.Name, false, settings))
 			} else {
 				if config.CVOptions.Immutable && config.Type != "" {
 					// Users cannot override immutable secrets that are generated
-					env = append(env, makeSecretVar(config.Name, true))
+					env = append(env, makeSecretVar(config.Name, true, settings))
 				} else if config.Type == "" && independentSecret(config.Name) {
-					env = append(env, makeSecretVar(config.Name, false))
+					env = append(env, makeSecretVar(config.Name, false, settings))
 				} else {
 					// Generated secrets can be overridden by the user (unless immutable)
 					block := helm.Block(fmt.Sprintf("if not .Values.secrets.%s", config.Name))
-					env = append(env, makeSecretVar(config.Name, true, block))
+					env = append(env, makeSecretVar(config.Name, true, settings, block))
 
 					block = helm.Block(fmt.Sprintf("if .Values.secrets.%s", config.Name))
-					env = append(env, makeSecretVar(config.Name, false, block))
+					env = append(env, makeSecretVar(config.Name, false, settings, block))
 				}
 			}
 			continue
 		}
 
+		if settings.Kustomize {
+			// Overlays may set config vars that don't have a default value
+			configMapKeyRef := helm.NewMapping("name", makeResourceName(configMapName, settings), "key", config.Name, "optional", true)
+			env = append(env, helm.NewMapping("name", config.Name, "valueFrom", helm.NewMapping("configMapKeyRef", configMapKeyRef)))
+			continue
+		}
+
 		var stringifiedValue string
 		if settings.CreateHelmChart && config.CVOptions.Type == model.CVTypeUser {
 			required := `""`
@@ -487,6 +545,15 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) (he
 
 	env = append(env, envVar)
 
+	// The images name the providers of BOSH links by their instance groups
+	// and services; run.sh adds the name prefix and suffix for configgin
+	if settings.NamePrefix != "" {
+		env = append(env, helm.NewMapping("name", "KUBE_NAME_PREFIX", "value", settings.NamePrefix))
+	}
+	if settings.NameSuffix != "" {
+		env = append(env, helm.NewMapping("name", "KUBE_NAME_SUFFIX", "value", settings.NameSuffix))
+	}
+
 	sort.Slice(env[:], func(i, j int) bool {
 		return env[i].Get("name").String() < env[j].Get("name").String()
 	})
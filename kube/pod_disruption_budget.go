@@ -0,0 +1,70 @@
+package kube
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// NewPodDisruptionBudget creates a PodDisruptionBudget for the given instance
+// group, limiting the pods evicted at the same time (e.g. by node drains). A
+// group with a quorum (one that must have an odd instance count) keeps a
+// majority of its pods, others lose at most one pod at a time. Nothing is
+// returned for groups tagged to opt out, or that can't have more than one
+// instance.
+func NewPodDisruptionBudget(instanceGroup *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
+	if instanceGroup.Run == nil || instanceGroup.Run.Scaling == nil {
+		return nil, fmt.Errorf("Instance group %s has no scaling information", instanceGroup.Name)
+	}
+	if instanceGroup.HasTag(model.RoleTagNoDisruptionBudget) {
+		return nil, nil
+	}
+
+	scaling := instanceGroup.Run.Scaling
+	if scaling.Max < 2 || (!settings.CreateHelmChart && scaling.Min < 2) {
+		return nil, nil
+	}
+
+	spec := helm.NewMapping("selector", newSelector(instanceGroup.Name, settings))
+
+	var block helm.NodeModifier
+	if settings.CreateHelmChart {
+		count := fmt.Sprintf(".Values.sizing.%s.count", makeVarName(instanceGroup.Name))
+
+		// Like the replicas, the HA count applies if the count wasn't changed.
+		// There is no disruption budget for a single instance.
+		if scaling.HA != scaling.Min {
+			block = helm.Block(fmt.Sprintf("if or (gt (int %s) 1) (and .Values.config.HA (eq (int %s) %d))",
+				count, count, scaling.Min))
+		} else {
+			block = helm.Block(fmt.Sprintf("if gt (int %s) 1", count))
+		}
+
+		if scaling.MustBeOdd {
+			maxUnavailable := fmt.Sprintf("{{ div (sub (int %s) 1) 2 }}", count)
+			if scaling.HA != scaling.Min {
+				maxUnavailable = fmt.Sprintf("{{ if and .Values.config.HA (eq (int %s) %d) -}} %d {{- else -}} %s {{- end }}",
+					count, scaling.Min, quorumMaxUnavailable(scaling.HA), maxUnavailable)
+			}
+			spec.Add("maxUnavailable", maxUnavailable)
+		} else {
+			spec.Add("maxUnavailable", 1)
+		}
+	} else if scaling.MustBeOdd {
+		spec.Add("maxUnavailable", quorumMaxUnavailable(scaling.Min))
+	} else {
+		spec.Add("maxUnavailable", 1)
+	}
+
+	pdb := newKubeConfig(settings, getAPIVersion("PodDisruptionBudget", settings), "PodDisruptionBudget", instanceGroup.Name, block)
+	pdb.Add("spec", spec.Sort())
+
+	return pdb, nil
+}
+
+// quorumMaxUnavailable returns how many of the given number of instances can
+// be unavailable while keeping a majority
+func quorumMaxUnavailable(count int) int {
+	return (count - 1) / 2
+}
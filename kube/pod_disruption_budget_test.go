@@ -0,0 +1,143 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pdbTestInstanceGroup(scaling model.RoleRunScaling, tags ...model.RoleTag) *model.InstanceGroup {
+	return &model.InstanceGroup{
+		Name: "some-group",
+		Type: model.RoleTypeBosh,
+		Tags: tags,
+		Run:  &model.RoleRun{Scaling: &scaling},
+	}
+}
+
+func TestNewPodDisruptionBudgetKube(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Quorum", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 3, Max: 5, HA: 3, MustBeOdd: true})
+		pdb, err := NewPodDisruptionBudget(instanceGroup, ExportSettings{})
+		require.NoError(t, err)
+		require.NotNil(t, pdb)
+
+		actual, err := RoundtripKube(pdb)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: policy/v1beta1
+			kind: PodDisruptionBudget
+			metadata:
+				name: some-group
+				labels:
+					app.kubernetes.io/component: some-group
+			spec:
+				maxUnavailable: 1
+				selector:
+					matchLabels:
+						skiff-role-name: some-group
+		`, actual)
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 4, Max: 8, HA: 4})
+		pdb, err := NewPodDisruptionBudget(instanceGroup, ExportSettings{KubeVersion: &ClusterVersion{1, 21}})
+		require.NoError(t, err)
+		require.NotNil(t, pdb)
+		assert.Equal(t, "policy/v1", pdb.Get("apiVersion").String())
+		assert.Equal(t, "1", pdb.Get("spec", "maxUnavailable").String())
+	})
+
+	t.Run("SingleInstance", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 3, HA: 3, MustBeOdd: true})
+		pdb, err := NewPodDisruptionBudget(instanceGroup, ExportSettings{})
+		assert.NoError(t, err)
+		assert.Nil(t, pdb)
+	})
+
+	t.Run("OptOut", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 3, Max: 3, HA: 3}, model.RoleTagNoDisruptionBudget)
+		pdb, err := NewPodDisruptionBudget(instanceGroup, ExportSettings{})
+		assert.NoError(t, err)
+		assert.Nil(t, pdb)
+	})
+}
+
+func TestNewPodDisruptionBudgetHelm(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{CreateHelmChart: true}
+
+	t.Run("Quorum", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 7, HA: 3, MustBeOdd: true})
+		pdb, err := NewPodDisruptionBudget(instanceGroup, settings)
+		require.NoError(t, err)
+		require.NotNil(t, pdb)
+
+		for _, testcase := range []struct {
+			count    int
+			ha       bool
+			expected string
+		}{
+			{1, false, ""},
+			{1, true, "1"},
+			{3, false, "1"},
+			{5, true, "2"},
+			{7, false, "3"},
+		} {
+			actual, err := RoundtripNode(pdb, map[string]interface{}{
+				"Values.sizing.some_group.count": testcase.count,
+				"Values.config.HA":               testcase.ha,
+			})
+			require.NoError(t, err)
+			if testcase.expected == "" {
+				assert.Nil(t, actual, "count %d", testcase.count)
+				continue
+			}
+			testhelpers.IsYAMLSubsetString(assert.New(t), `---
+				kind: PodDisruptionBudget
+				metadata:
+					name: some-group
+				spec:
+					maxUnavailable: `+testcase.expected+`
+					selector:
+						matchLabels:
+							skiff-role-name: some-group
+			`, actual)
+		}
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := pdbTestInstanceGroup(model.RoleRunScaling{Min: 1, Max: 3, HA: 1})
+		pdb, err := NewPodDisruptionBudget(instanceGroup, settings)
+		require.NoError(t, err)
+		require.NotNil(t, pdb)
+
+		actual, err := RoundtripNode(pdb, map[string]interface{}{
+			"Values.sizing.some_group.count": 1,
+			"Values.config.HA":               true,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, actual)
+
+		actual, err = RoundtripNode(pdb, map[string]interface{}{
+			"Values.sizing.some_group.count": 2,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			spec:
+				maxUnavailable: 1
+		`, actual)
+	})
+}
@@ -102,7 +102,7 @@ func TestPodGetNonClaimVolumes(t *testing.T) {
 		return
 	}
 
-	mounts := getNonClaimVolumes(role, true)
+	mounts := getNonClaimVolumes(role, ExportSettings{CreateHelmChart: true})
 	assert.NotNil(mounts)
 
 	actual, err := RoundtripNode(mounts, map[string]interface{}{
@@ -713,6 +713,51 @@ func TestPodGetEnvVarsFromConfigGenerationNameHelm(t *testing.T) {
 	`, actual)
 }
 
+func TestPodGetEnvVarsFromConfigNameAffixesHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ev, err := getEnvVarsFromConfigs(model.Variables{
+		&model.VariableDefinition{
+			Name: "KUBE_SECRETS_GENERATION_NAME",
+		},
+	}, ExportSettings{
+		CreateHelmChart: true,
+		NamePrefix:      "{{ .Release.Name }}-",
+		NameSuffix:      "-blue",
+		RoleManifest: &model.RoleManifest{
+			InstanceGroups: []*model.InstanceGroup{
+				&model.InstanceGroup{
+					Name: "foo",
+				},
+			},
+		},
+	})
+
+	config := map[string]interface{}{
+		"Chart.Version":                          "CV",
+		"Release.Name":                           "copy",
+		"Values.kube.secrets_generation_counter": "SGC",
+	}
+
+	actual, err := RoundtripNode(ev, config)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		-	name: "KUBERNETES_NAMESPACE"
+			valueFrom:
+				fieldRef:
+					fieldPath: "metadata.namespace"
+		-	name: "KUBE_NAME_PREFIX"
+			value: "copy-"
+		-	name: "KUBE_NAME_SUFFIX"
+			value: "-blue"
+		-	name: "KUBE_SECRETS_GENERATION_NAME"
+			value: "copy-secrets-CV-SGC-blue"
+	`, actual)
+}
+
 func TestPodGetEnvVarsFromConfigSecretsKube(t *testing.T) {
 	assert := assert.New(t)
 
@@ -949,6 +994,34 @@ func TestPodGetEnvVarsFromConfigNonSecretKube(t *testing.T) {
 						fieldPath: "metadata.namespace"
 		`, actual)
 	})
+
+	t.Run("Kustomize", func(t *testing.T) {
+		t.Parallel()
+		settings := settings
+		settings.Kustomize = true
+		ev, err := getEnvVarsFromConfigs(model.Variables{
+			&model.VariableDefinition{
+				Name: "SOMETHING",
+			},
+		}, settings)
+
+		actual, err := RoundtripNode(ev, nil)
+		if !assert.NoError(err) {
+			return
+		}
+		testhelpers.IsYAMLEqualString(assert, `---
+			-	name: "KUBERNETES_NAMESPACE"
+				valueFrom:
+					fieldRef:
+						fieldPath: "metadata.namespace"
+			-	name: "SOMETHING"
+				valueFrom:
+					configMapKeyRef:
+						name: "config"
+						key: "SOMETHING"
+						optional: true
+		`, actual)
+	})
 }
 
 func TestPodGetEnvVarsFromConfigNonSecretHelmUserOptional(t *testing.T) {
@@ -1770,6 +1843,10 @@ func TestPodPreFlightHelm(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "pre-role"
 			labels:
 				app.kubernetes.io/component: pre-role
@@ -1879,6 +1956,10 @@ func TestPodPostFlightHelm(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: post-install,post-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "post-role"
 			labels:
 				app.kubernetes.io/component: post-role
@@ -1998,6 +2079,10 @@ func TestPodMemoryHelmDisabled(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "pre-role"
 			labels:
 				app.kubernetes.io/component: pre-role
@@ -2080,6 +2165,10 @@ func TestPodMemoryHelmActive(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "pre-role"
 			labels:
 				app.kubernetes.io/component: pre-role
@@ -2201,6 +2290,10 @@ func TestPodCPUHelmDisabled(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "pre-role"
 			labels:
 				app.kubernetes.io/component: pre-role
@@ -2283,6 +2376,10 @@ func TestPodCPUHelmActive(t *testing.T) {
 		apiVersion: "v1"
 		kind: "Pod"
 		metadata:
+			annotations:
+				helm.sh/hook: pre-install,pre-upgrade
+				helm.sh/hook-weight: "0"
+				helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
 			name: "pre-role"
 			labels:
 				app.kubernetes.io/component: pre-role
@@ -2617,6 +2714,59 @@ func TestPodGetContainerImageNameHelm(t *testing.T) {
 	`, actual)
 }
 
+func TestPodGetContainerImageNameDigest(t *testing.T) {
+	t.Parallel()
+	role := podTemplateTestLoadRole(assert.New(t))
+	if role == nil {
+		return
+	}
+
+	digest := "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	settings := ExportSettings{
+		Repository:   "theRepo",
+		Opinions:     model.NewEmptyOpinions(),
+		Organization: "O",
+		Registry:     "R",
+		ImageDigests: map[string]string{
+			"R/O/theRepo-myrole:d0aca33ba5bc55dce697d9d57b46e1b23688659c": digest,
+		},
+	}
+	grapher := FakeGrapher{}
+
+	t.Run("Kube", func(t *testing.T) {
+		t.Parallel()
+		name, err := getContainerImageName(role, settings, grapher)
+		assert.NoError(t, err)
+		assert.Equal(t, "R/O/theRepo-myrole@"+digest, name)
+	})
+
+	t.Run("Helm", func(t *testing.T) {
+		t.Parallel()
+		settings := settings
+		settings.CreateHelmChart = true
+		name, err := getContainerImageName(role, settings, grapher)
+		require.NoError(t, err)
+
+		actual, err := RoundtripNode(helm.NewNode(name), map[string]interface{}{
+			"Values.kube.registry.hostname": "R",
+			"Values.kube.organization":      "O",
+			"Values.kube.images.myrole":     "theRepo-myrole@" + digest,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), "R/O/theRepo-myrole@"+digest, actual)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+		settings := settings
+		settings.ImageDigests = map[string]string{}
+		_, err := getContainerImageName(role, settings, grapher)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "No digest found for image R/O/theRepo-myrole:")
+		}
+	})
+}
+
 func TestPodGetContainerPortsKube(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -2722,7 +2872,7 @@ func TestPodMakeSecretVarPlain(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	sv := makeSecretVar("foo", false)
+	sv := makeSecretVar("foo", false, ExportSettings{})
 
 	actual, err := RoundtripNode(sv, nil)
 	if !assert.NoError(err) {
@@ -2741,7 +2891,7 @@ func TestPodMakeSecretVarGenerated(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	sv := makeSecretVar("foo", true)
+	sv := makeSecretVar("foo", true, ExportSettings{})
 
 	config := map[string]interface{}{
 		"Chart.Version":                          "CV",
@@ -2780,7 +2930,7 @@ func TestPodVolumeTypeEmptyDir(t *testing.T) {
 	assert.NotNil(roleManifest)
 
 	// Check non-claim volumes
-	mounts := getNonClaimVolumes(roleManifest.LookupInstanceGroup("main-role"), true)
+	mounts := getNonClaimVolumes(roleManifest.LookupInstanceGroup("main-role"), ExportSettings{CreateHelmChart: true})
 	assert.NotNil(mounts)
 	actual, err := RoundtripNode(mounts, nil)
 	if !assert.NoError(err) {
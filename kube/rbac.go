@@ -15,19 +15,24 @@ func NewRBACAccount(name string, account model.AuthAccount, settings ExportSetti
 
 	// If we want to modify the default account, there's no need to create it
 	// first -- it already exists
+	accountName := name
 	if name != "default" {
-		resources = append(resources, newKubeConfig(settings, "v1", "ServiceAccount", name, block))
+		serviceAccount := newKubeConfig(settings, "v1", "ServiceAccount", name, block)
+		addPreFlightDependencyAnnotations(serviceAccount, settings)
+		resources = append(resources, serviceAccount)
+		accountName = makeResourceName(name, settings)
 	}
 
 	for _, role := range account.Roles {
-		binding := newKubeConfig(settings, "rbac.authorization.k8s.io/v1beta1", "RoleBinding", fmt.Sprintf("%s-%s-binding", name, role), block)
+		binding := newKubeConfig(settings, getAPIVersion("RoleBinding", settings), "RoleBinding", fmt.Sprintf("%s-%s-binding", name, role), block)
+		addPreFlightDependencyAnnotations(binding, settings)
 		subjects := helm.NewList(helm.NewMapping(
 			"kind", "ServiceAccount",
-			"name", name))
+			"name", accountName))
 		binding.Add("subjects", subjects)
 		binding.Add("roleRef", helm.NewMapping(
 			"kind", "Role",
-			"name", role,
+			"name", makeResourceName(role, settings),
 			"apiGroup", "rbac.authorization.k8s.io"))
 		resources = append(resources, binding)
 	}
@@ -41,14 +46,15 @@ func NewRBACAccount(name string, account model.AuthAccount, settings ExportSetti
 	binding := newKubeConfig(settings, "rbac.authorization.k8s.io/v1", "ClusterRoleBinding",
 		authCRBindingName(name, settings),
 		authPSPCondition(account.PodSecurityPolicy, settings))
+	addPreFlightDependencyAnnotations(binding, settings)
 	subjects := helm.NewList(helm.NewMapping(
 		"kind", "ServiceAccount",
-		"name", name,
+		"name", accountName,
 		"namespace", namespace))
 	binding.Add("subjects", subjects)
 	binding.Add("roleRef", helm.NewMapping(
 		"kind", "ClusterRole",
-		"name", authPSPRoleName(account.PodSecurityPolicy, settings),
+		"name", makeResourceName(authPSPRoleName(account.PodSecurityPolicy, settings), settings),
 		"apiGroup", "rbac.authorization.k8s.io"))
 	resources = append(resources, binding)
 
@@ -78,7 +84,8 @@ func NewRBACRole(name string, authRole model.AuthRole, settings ExportSettings)
 		rules.Add(rule.Sort())
 	}
 
-	role := newKubeConfig(settings, "rbac.authorization.k8s.io/v1beta1", "Role", name, authModeRBAC(settings))
+	role := newKubeConfig(settings, getAPIVersion("Role", settings), "Role", name, authModeRBAC(settings))
+	addPreFlightDependencyAnnotations(role, settings)
 	role.Add("rules", rules)
 
 	return role.Sort(), nil
@@ -122,6 +129,7 @@ func NewRBACClusterRolePSP(psp string, settings ExportSettings) (helm.Node, erro
 	name := authPSPRoleName(psp, settings)
 
 	clusterRole := newKubeConfig(settings, "rbac.authorization.k8s.io/v1", "ClusterRole", name, authPSPCondition(psp, settings))
+	addPreFlightDependencyAnnotations(clusterRole, settings)
 
 	if settings.CreateHelmChart {
 		psp = fmt.Sprintf("{{ .Values.kube.psp.%s | quote }}", psp)
@@ -129,7 +137,7 @@ func NewRBACClusterRolePSP(psp string, settings ExportSettings) (helm.Node, erro
 
 	rules := helm.NewList()
 	rule := helm.NewMapping()
-	rule.Add("apiGroups", helm.NewList("extensions"))
+	rule.Add("apiGroups", helm.NewList(getAPIGroup("PodSecurityPolicy", settings)))
 	rule.Add("resources", helm.NewList("podsecuritypolicies"))
 	rule.Add("verbs", helm.NewList("use"))
 	rule.Add("resourceNames", helm.NewList(psp))
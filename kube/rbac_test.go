@@ -159,7 +159,7 @@ func TestNewRBACAccountHelm(t *testing.T) {
 		}
 
 		testhelpers.IsYAMLEqualString(assert, `---
-			apiVersion: "rbac.authorization.k8s.io/v1beta1"
+			apiVersion: "rbac.authorization.k8s.io/v1"
 			kind: "RoleBinding"
 			metadata:
 				name: "the-name-a-role-binding"
@@ -359,7 +359,7 @@ func TestNewRBACRoleHelm(t *testing.T) {
 		}
 
 		testhelpers.IsYAMLEqualString(assert, `---
-			apiVersion: "rbac.authorization.k8s.io/v1beta1"
+			apiVersion: "rbac.authorization.k8s.io/v1"
 			kind: "Role"
 			metadata:
 				name: "the-name"
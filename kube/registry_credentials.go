@@ -31,6 +31,7 @@ func MakeRegistryCredentials(settings ExportSettings) (helm.Node, error) {
 	data := helm.NewMapping(".dockercfg", value)
 
 	secret := newKubeConfig(settings, "v1", "Secret", "registry-credentials")
+	addPreFlightDependencyAnnotations(secret, settings)
 	secret.Add("data", data)
 	secret.Add("type", "kubernetes.io/dockercfg")
 
@@ -58,6 +58,7 @@ func MakeSecrets(secrets model.CVMap, settings ExportSettings) (helm.Node, error
 	data.Merge(generated.Sort())
 
 	secret := newKubeConfig(settings, "v1", "Secret", userSecretsName)
+	addPreFlightDependencyAnnotations(secret, settings)
 	secret.Add("data", data)
 
 	return secret.Sort(), nil
@@ -160,7 +160,7 @@ func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (h
 
 	spec := helm.NewMapping()
 
-	selector := helm.NewMapping(RoleNameLabel, role.Name)
+	selector := helm.NewMapping(RoleNameLabel, makeResourceName(role.Name, settings))
 	if role.HasTag(model.RoleTagActivePassive) {
 		selector.Add("skiff-role-active", "true")
 	}
@@ -178,6 +178,7 @@ func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (h
 // newService creates a new k8s service (ClusterIP or LoadBalanced) for a job
 func newService(role *model.InstanceGroup, job *model.JobReference, serviceType newServiceType, settings ExportSettings) (helm.Node, error) {
 	var ports []helm.Node
+	var ingressPorts []helm.Node
 
 	for _, port := range job.ContainerProperties.BoshContainerization.Ports {
 		if serviceType == newServiceTypePublic && !port.Public {
@@ -185,7 +186,23 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 			continue
 		}
 
-		ports = append(ports, createPorts(settings, serviceType, role.Name, port)...)
+		newPorts := createPorts(settings, serviceType, role.Name, port)
+		if serviceType == newServiceTypePublic && settings.CreateHelmChart && port.Ingress != nil {
+			// Ports routed through an enabled ingress don't need a public service
+			ingressPorts = append(ingressPorts, newPorts...)
+		}
+		ports = append(ports, newPorts...)
+	}
+
+	var block helm.NodeModifier
+	if len(ingressPorts) > 0 {
+		if len(ingressPorts) == len(ports) {
+			block = helm.Block("if not .Values.ingress.enabled")
+		} else {
+			for _, port := range ingressPorts {
+				port.Set(helm.Block("if not .Values.ingress.enabled"))
+			}
+		}
 	}
 	if len(ports) == 0 {
 		// Kubernetes refuses to create services with no ports, so we should
@@ -195,7 +212,7 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 
 	spec := helm.NewMapping()
 
-	selector := helm.NewMapping(RoleNameLabel, role.Name)
+	selector := helm.NewMapping(RoleNameLabel, makeResourceName(role.Name, settings))
 	if role.HasTag(model.RoleTagActivePassive) {
 		selector.Add("skiff-role-active", "true")
 	}
@@ -230,7 +247,7 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 		panic(fmt.Sprintf("Unexpected service type %d", serviceType))
 	}
 
-	service := newKubeConfig(settings, "v1", "Service", serviceName)
+	service := newKubeConfig(settings, "v1", "Service", serviceName, block)
 	service.Add("spec", spec.Sort())
 
 	return service, nil
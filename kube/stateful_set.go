@@ -29,14 +29,13 @@ func NewStatefulSet(role *model.InstanceGroup, settings ExportSettings, grapher
 	claims := getVolumeClaims(role, settings.CreateHelmChart)
 
 	spec := helm.NewMapping()
-	spec.Add("serviceName", fmt.Sprintf("%s-set", role.Name))
-	spec.Add("selector", newSelector(role.Name))
+	spec.Add("serviceName", makeResourceName(role.Name+"-set", settings))
+	spec.Add("selector", newSelector(role.Name, settings))
 	spec.Add("template", podTemplate)
-	// "updateStrategy" is new in kube 1.7, so we don't add anything to non-helm configs
-	// The default behaviour is "OnDelete"
-	if settings.CreateHelmChart {
+	// "updateStrategy" is new in kube 1.7; the default behaviour before was "OnDelete"
+	if add, guard := withMinKubeVersion(1, 7, settings); add {
 		strategy := helm.NewMapping("type", "RollingUpdate")
-		spec.Add("updateStrategy", strategy, helm.Block("if "+minKubeVersion(1, 7)))
+		spec.Add("updateStrategy", strategy, guard)
 	}
 	if len(claims) > 0 {
 		spec.Add("volumeClaimTemplates", helm.NewNode(claims))
@@ -47,8 +46,9 @@ func NewStatefulSet(role *model.InstanceGroup, settings ExportSettings, grapher
 	}
 	spec.Add("podManagementPolicy", podManagementPolicy)
 
-	statefulSet := newKubeConfig(settings, "apps/v1beta1", "StatefulSet", role.Name, helm.Comment(role.GetLongDescription()))
+	statefulSet := newKubeConfig(settings, getAPIVersion("StatefulSet", settings), "StatefulSet", role.Name, helm.Comment(role.GetLongDescription()))
 	statefulSet.Add("spec", spec)
+	addFlightStageAnnotations(role, statefulSet, settings)
 	err = replicaCheck(role, statefulSet, svcList, settings)
 	if err != nil {
 		return nil, nil, err
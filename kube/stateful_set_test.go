@@ -416,6 +416,46 @@ func TestStatefulSetStartupPolicy(t *testing.T) {
 	}
 }
 
+func TestStatefulSetKubeVersion(t *testing.T) {
+	t.Parallel()
+	_, role := statefulSetTestLoadManifest(assert.New(t), "volumes.yml")
+	require.NotNil(t, role)
+
+	t.Run("Unset", func(t *testing.T) {
+		t.Parallel()
+		statefulset, _, err := NewStatefulSet(role, ExportSettings{
+			Opinions: model.NewEmptyOpinions(),
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "apps/v1beta1", statefulset.Get("apiVersion").String())
+		assert.Nil(t, statefulset.Get("spec", "updateStrategy"))
+	})
+
+	t.Run("Current", func(t *testing.T) {
+		t.Parallel()
+		statefulset, _, err := NewStatefulSet(role, ExportSettings{
+			Opinions:    model.NewEmptyOpinions(),
+			KubeVersion: &ClusterVersion{Major: 1, Minor: 16},
+		}, nil)
+		require.NoError(t, err)
+		actual, err := RoundtripKube(statefulset)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			apiVersion: apps/v1
+			spec:
+				selector:
+					matchLabels:
+						skiff-role-name: myrole
+				template:
+					metadata:
+						labels:
+							skiff-role-name: myrole
+				updateStrategy:
+					type: RollingUpdate
+		`, actual)
+	})
+}
+
 func TestStatefulSetVolumesKube(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -2,6 +2,8 @@ package kube
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/helm"
@@ -21,16 +23,40 @@ func newTypeMeta(apiVersion, kind string, modifiers ...helm.NodeModifier) *helm.
 	return mapping
 }
 
-func newSelector(name string) *helm.Mapping {
+func newSelector(name string, settings ExportSettings) *helm.Mapping {
 	meta := helm.NewMapping()
 	// meta.Add("matchLabels", helm.NewMapping(RoleNameLabel, name))
 	// XXX We need to match on legacy RoleNameLabel to maintain upgradability of stateful sets
-	meta.Add("matchLabels", helm.NewMapping("skiff-role-name", name))
+	meta.Add("matchLabels", helm.NewMapping("skiff-role-name", makeResourceName(name, settings)))
 	return meta
 }
 
+// makeResourceName returns the name of a generated resource, with the name
+// prefix and suffix from the settings. All references to generated resources
+// must use it, as well as the labels selecting their pods.
+func makeResourceName(name string, settings ExportSettings) string {
+	return settings.NamePrefix + name + settings.NameSuffix
+}
+
+// nameAffixRegexp matches the name prefixes and suffixes which keep the
+// names of the resources, services and labels valid
+var nameAffixRegexp = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// CheckNameAffixes returns an error if the name prefix or suffix of the
+// settings can't be part of the names of kube resources. Templates in Helm
+// charts are only known once they are rendered, and are not checked.
+func (settings ExportSettings) CheckNameAffixes() error {
+	for _, affix := range []string{settings.NamePrefix, settings.NameSuffix} {
+		if !strings.Contains(affix, "{{") && !nameAffixRegexp.MatchString(affix) {
+			return fmt.Errorf("Invalid name prefix or suffix '%s': only lower case letters, digits and '-' can be used", affix)
+		}
+	}
+	return nil
+}
+
 // newKubeConfig sets up generic a Kube config structure with minimal metadata
 func newKubeConfig(settings ExportSettings, apiVersion, kind, name string, modifiers ...helm.NodeModifier) *helm.Mapping {
+	name = makeResourceName(name, settings)
 	labels := helm.NewMapping(RoleNameLabel, name) // "app.kubernetes.io/component"
 	if settings.CreateHelmChart {
 		// XXX skiff-role-name is the legacy RoleNameLabel and will be removed in a future release
@@ -43,12 +69,58 @@ func newKubeConfig(settings ExportSettings, apiVersion, kind, name string, modif
 		labels.Add("helm.sh/chart", `{{ printf "%s-%s" .Chart.Name (.Chart.Version | replace "+" "_") | quote }}`)
 	}
 
+	for _, key := range sortedKeys(settings.Labels) {
+		labels.Add(key, settings.Labels[key])
+	}
+	if settings.CreateHelmChart {
+		labels.Add("{{ $label }}", "{{ $value | quote }}", helm.Block("range $label, $value := .Values.kube.labels"))
+	}
+
+	meta := helm.NewMapping("name", name, "labels", labels)
+
+	annotations := helm.NewMapping()
+	for _, key := range sortedKeys(settings.Annotations) {
+		annotations.Add(key, settings.Annotations[key])
+	}
+	if settings.CreateHelmChart {
+		annotations.Add("{{ $annotation }}", "{{ $value | quote }}", helm.Block("range $annotation, $value := .Values.kube.annotations"))
+		if len(settings.Annotations) == 0 {
+			// Don't leave an empty annotations key when there are no common annotations
+			annotations.Set(helm.Block("if .Values.kube.annotations"))
+		}
+	}
+	if len(annotations.Names()) > 0 {
+		meta.Add("annotations", annotations)
+	}
+
 	config := newTypeMeta(apiVersion, kind, modifiers...)
-	config.Add("metadata", helm.NewMapping("name", name, "labels", labels))
+	config.Add("metadata", meta)
 
 	return config
 }
 
+// getAnnotations returns the annotations of the given metadata, adding them
+// if necessary. The annotations are always emitted once more are added to
+// the common ones.
+func getAnnotations(meta *helm.Mapping) *helm.Mapping {
+	annotations, ok := meta.Get("annotations").(*helm.Mapping)
+	if !ok {
+		annotations = helm.NewMapping()
+		meta.Add("annotations", annotations)
+	}
+	annotations.Set(helm.Block(""))
+	return annotations
+}
+
+func sortedKeys(mapping map[string]string) []string {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func makeVarName(name string) string {
 	return strings.Replace(name, "-", "_", -1)
 }
@@ -79,6 +151,9 @@ func MakeBasicValues() *helm.Mapping {
 			"storage_class", helm.NewMapping("persistent", "persistent", "shared", "shared"),
 			"psp", psp,
 			"hostpath_available", helm.NewNode(false, helm.Comment("Whether HostPath volume mounts are available")),
+			"network_policies", helm.NewNode(false, helm.Comment("Whether to only allow ingress from linked instance groups and to public ports")),
+			"labels", helm.NewNode(helm.NewMapping(), helm.Comment("Labels added to all resources; they must not override the labels set by the chart")),
+			"annotations", helm.NewNode(helm.NewMapping(), helm.Comment("Annotations added to all resources")),
 			"registry", helm.NewMapping(
 				"hostname", "docker.io",
 				"username", "",
@@ -99,5 +174,11 @@ func MakeBasicValues() *helm.Mapping {
 		"sizing", helm.NewMapping(),
 		"secrets", helm.NewMapping(),
 		"services", helm.NewMapping(
-			"loadbalanced", false))
+			"loadbalanced", false),
+		"ingress", helm.NewNode(helm.NewMapping(
+			"enabled", helm.NewNode(false, helm.Comment("Route public ports with ingress hosts through ingresses instead of public services")),
+			"class", helm.NewNode(nil, helm.Comment("Ingress class (Kubernetes 1.18 and later); use the kubernetes.io/ingress.class annotation before")),
+			"annotations", helm.NewNode(helm.NewMapping(), helm.Comment("Annotations added to all ingresses")),
+			"tls", helm.NewNode(true, helm.Comment("Whether to terminate TLS with the secrets named in the role manifest")),
+		), helm.Comment("Ingress configuration")))
 }
@@ -7,6 +7,7 @@ import (
 	"code.cloudfoundry.org/fissile/helm"
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewTypeMeta(t *testing.T) {
@@ -29,7 +30,7 @@ func TestNewSelector(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	selector := newSelector("thename")
+	selector := newSelector("thename", ExportSettings{NamePrefix: "pre-"})
 
 	actual, err := RoundtripKube(selector)
 	if !assert.NoError(err) {
@@ -37,7 +38,7 @@ func TestNewSelector(t *testing.T) {
 	}
 	testhelpers.IsYAMLEqualString(assert, `---
 		matchLabels:
-			skiff-role-name: "thename"
+			skiff-role-name: "pre-thename"
 	`, actual)
 }
 
@@ -61,6 +62,70 @@ func TestNewKubeConfig(t *testing.T) {
 	`, actual)
 }
 
+func TestNewKubeConfigCommonMetadata(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{
+		NamePrefix:  "pre-",
+		NameSuffix:  "-suf",
+		Labels:      map[string]string{"team": "blue", "env": "prod"},
+		Annotations: map[string]string{"owner": "ops@example.com"},
+	}
+
+	t.Run("Kube", func(t *testing.T) {
+		t.Parallel()
+		kubeConfig := newKubeConfig(settings, "v1", "thekind", "thename")
+		actual, err := RoundtripKube(kubeConfig)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			apiVersion: v1
+			kind: thekind
+			metadata:
+				name: pre-thename-suf
+				labels:
+					app.kubernetes.io/component: pre-thename-suf
+					env: prod
+					team: blue
+				annotations:
+					owner: ops@example.com
+		`, actual)
+	})
+
+	t.Run("Helm", func(t *testing.T) {
+		t.Parallel()
+		settings := settings
+		settings.CreateHelmChart = true
+		kubeConfig := newKubeConfig(settings, "v1", "thekind", "thename")
+		actual, err := RoundtripNode(kubeConfig, map[string]interface{}{
+			"Values.kube.labels":      map[string]interface{}{"tier": "backend"},
+			"Values.kube.annotations": map[string]interface{}{"note": "hello"},
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			metadata:
+				name: pre-thename-suf
+				labels:
+					app.kubernetes.io/component: pre-thename-suf
+					env: prod
+					skiff-role-name: pre-thename-suf
+					team: blue
+					tier: backend
+				annotations:
+					note: hello
+					owner: ops@example.com
+		`, actual)
+	})
+
+	t.Run("HelmWithoutAnnotations", func(t *testing.T) {
+		t.Parallel()
+		kubeConfig := newKubeConfig(ExportSettings{CreateHelmChart: true}, "v1", "thekind", "thename")
+		actual, err := RoundtripNode(kubeConfig, nil)
+		require.NoError(t, err)
+		metadata := actual.(map[interface{}]interface{})["metadata"].(map[interface{}]interface{})
+		assert.NotContains(t, metadata, "annotations")
+	})
+}
+
 func TestMakeVarName(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -120,3 +185,16 @@ func TestMinKubeVersion(t *testing.T) {
 		testhelpers.IsYAMLEqualString(assert, testcase.Result, actual)
 	}
 }
+
+func TestCheckNameAffixes(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, ExportSettings{}.CheckNameAffixes())
+	assert.NoError(t, ExportSettings{NamePrefix: "copy-2-", NameSuffix: "-blue"}.CheckNameAffixes())
+	assert.NoError(t, ExportSettings{NamePrefix: "{{ .Release.Name }}-"}.CheckNameAffixes(), "Templates are not checked")
+
+	err := ExportSettings{NamePrefix: "Copy_"}.CheckNameAffixes()
+	assert.EqualError(t, err, "Invalid name prefix or suffix 'Copy_': only lower case letters, digits and '-' can be used")
+	err = ExportSettings{NameSuffix: ".blue"}.CheckNameAffixes()
+	assert.EqualError(t, err, "Invalid name prefix or suffix '.blue': only lower case letters, digits and '-' can be used")
+}
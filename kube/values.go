@@ -175,6 +175,13 @@ func MakeValues(settings ExportSettings) (helm.Node, error) {
 
 		entry.Add("affinity", helm.NewMapping(), helm.Comment("Node affinity rules can be specified here"))
 
+		if instanceGroup.Run.Autoscaling != nil {
+			entry.Add("autoscaling", helm.NewMapping("enabled", false), helm.Comment(fmt.Sprintf(
+				"Scale the %s instance group between %d and %d instances based on its load,\n"+
+					"instead of using the count. This requires a metrics server in the cluster.",
+				instanceGroup.Name, instanceGroup.Run.Scaling.Min, instanceGroup.Run.Scaling.Max)))
+		}
+
 		sizing.Add(makeVarName(instanceGroup.Name), entry.Sort(), helm.Comment(instanceGroup.GetLongDescription()))
 	}
 	values.Add("sizing", sizing.Sort())
@@ -196,5 +203,23 @@ func MakeValues(settings ExportSettings) (helm.Node, error) {
 		values.Get("kube").(*helm.Mapping).Add("auth", settings.AuthType)
 	}
 
+	if settings.ImageDigests != nil {
+		images := helm.NewMapping()
+		for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+			if instanceGroup.Run.FlightStage == model.FlightStageManual {
+				continue
+			}
+			imageName, err := getContainerImageDigestName(instanceGroup, settings, nil)
+			if err != nil {
+				return nil, err
+			}
+			images.Add(makeVarName(instanceGroup.Name), imageName)
+		}
+		values.Get("kube").(*helm.Mapping).Add("images", images.Sort(), helm.Comment(strings.Join(strings.Fields(`
+			The images of the instance groups, referenced by digest. They are
+			pulled from the registry hostname and organization above.
+		`), " ")))
+	}
+
 	return values, nil
 }
@@ -0,0 +1,231 @@
+package kube
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+const valuesSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// MakeValuesSchema returns the JSON schema of the values of the Helm chart,
+// written to values.schema.json. It lets helm reject values the templates
+// would fail on, like missing required variables or instance counts outside
+// the scaling bounds, before rendering them. Values not generated from the
+// role manifest are not constrained.
+func MakeValuesSchema(settings ExportSettings) (map[string]interface{}, error) {
+	env := newObjectSchema()
+	secrets := newObjectSchema()
+
+	for name, cv := range model.MakeMapOfVariables(settings.RoleManifest) {
+		// Same selection as in MakeValues
+		if strings.HasPrefix(name, "KUBE_SIZING_") || cv.CVOptions.Type == model.CVTypeEnv {
+			continue
+		}
+		if cv.CVOptions.Immutable && cv.Type != "" {
+			continue
+		}
+
+		description := cv.CVOptions.Description
+		if cv.CVOptions.Secret && cv.Type != "" {
+			description += "\nThis value uses a generated default."
+		}
+		if cv.CVOptions.Immutable {
+			description += "\nThis value is immutable and must not be changed once set."
+		}
+
+		// Generated secrets don't need a value from the user
+		required := cv.CVOptions.Required && (!cv.CVOptions.Secret || cv.Type == "")
+
+		schema := map[string]interface{}{
+			"type": getVariableSchemaTypes(cv.CVOptions.Default, required),
+		}
+		if description = strings.TrimSpace(description); description != "" {
+			schema["description"] = description
+		}
+		if cv.CVOptions.Example != "" {
+			schema["examples"] = []string{cv.CVOptions.Example}
+		}
+
+		if cv.CVOptions.Secret {
+			secrets.addProperty(name, schema, required)
+		} else {
+			env.addProperty(name, schema, required)
+		}
+	}
+
+	sizing := newObjectSchema()
+	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+		if instanceGroup.Run.FlightStage == model.FlightStageManual {
+			continue
+		}
+		sizing.addProperty(makeVarName(instanceGroup.Name), getSizingSchema(instanceGroup, settings), true)
+	}
+
+	values := newObjectSchema()
+	values["$schema"] = valuesSchemaVersion
+	values.addProperty("env", env, true)
+	values.addProperty("secrets", secrets, true)
+	values.addProperty("sizing", sizing, true)
+
+	return map[string]interface{}(values), nil
+}
+
+// getSizingSchema returns the schema of the sizing values of an instance
+// group, matching the guards of replicaCheck
+func getSizingSchema(instanceGroup *model.InstanceGroup, settings ExportSettings) objectSchema {
+	scaling := instanceGroup.Run.Scaling
+	count := map[string]interface{}{
+		"type":    "integer",
+		"minimum": scaling.Min,
+		"maximum": scaling.Max,
+	}
+	if scaling.MustBeOdd {
+		count["not"] = map[string]interface{}{"multipleOf": 2}
+	}
+
+	entry := newObjectSchema()
+	entry.addProperty("count", count, true)
+
+	if !instanceGroup.IsPrivileged() {
+		entry.addProperty("capabilities", map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		}, false)
+	}
+
+	if settings.UseMemoryLimits {
+		memory := newObjectSchema()
+		memory["description"] = "Unit [MiB]"
+		for _, name := range []string{"request", "limit"} {
+			memory.addProperty(name, map[string]interface{}{
+				"type":    []string{"integer", "null"},
+				"minimum": 0,
+			}, false)
+		}
+		entry.addProperty("memory", memory, false)
+	}
+	if settings.UseCPULimits {
+		cpu := newObjectSchema()
+		cpu["description"] = "Unit [millicore]"
+		for _, name := range []string{"request", "limit"} {
+			cpu.addProperty(name, map[string]interface{}{
+				"type":    []string{"number", "null"},
+				"minimum": 0,
+			}, false)
+		}
+		entry.addProperty("cpu", cpu, false)
+	}
+
+	diskSizes := newObjectSchema()
+	for _, volume := range instanceGroup.Run.Volumes {
+		switch volume.Type {
+		case model.VolumeTypePersistent, model.VolumeTypeShared:
+			diskSizes.addProperty(makeVarName(volume.Tag), map[string]interface{}{
+				"type":    "integer",
+				"minimum": 1,
+			}, true)
+		}
+	}
+	if len(diskSizes.properties()) > 0 {
+		entry.addProperty("disk_sizes", diskSizes, false)
+	}
+
+	ports := newObjectSchema()
+	for _, job := range instanceGroup.JobReferences {
+		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+			config := newObjectSchema()
+			if port.PortIsConfigurable {
+				config.addProperty("port", map[string]interface{}{
+					"type":    "integer",
+					"minimum": 1,
+					"maximum": 65535,
+				}, true)
+			}
+			if port.CountIsConfigurable {
+				count := map[string]interface{}{
+					"type":    "integer",
+					"minimum": 1,
+				}
+				if port.Max > 0 {
+					count["maximum"] = port.Max
+				}
+				config.addProperty("count", count, true)
+			}
+			if len(config.properties()) > 0 {
+				ports.addProperty(makeVarName(port.Name), config, false)
+			}
+		}
+	}
+	if len(ports.properties()) > 0 {
+		entry.addProperty("ports", ports, false)
+	}
+
+	entry.addProperty("affinity", map[string]interface{}{"type": "object"}, false)
+
+	if instanceGroup.Run.Autoscaling != nil {
+		autoscaling := newObjectSchema()
+		autoscaling.addProperty("enabled", map[string]interface{}{"type": "boolean"}, false)
+		entry.addProperty("autoscaling", autoscaling, false)
+	}
+
+	return entry
+}
+
+// getVariableSchemaTypes returns the JSON types accepted for a variable,
+// based on its default value. MakeValues writes defaults as strings, and the
+// templates quote scalars and encode structured values as JSON, so strings
+// are always accepted. Only variables which are not required may be null.
+func getVariableSchemaTypes(value interface{}, required bool) []string {
+	var types []string
+	if value == nil {
+		types = []string{"string", "number", "boolean", "object", "array"}
+	} else {
+		switch reflect.TypeOf(value).Kind() {
+		case reflect.Bool:
+			types = []string{"boolean", "string"}
+		case reflect.Int, reflect.Int64, reflect.Uint64:
+			types = []string{"integer", "string"}
+		case reflect.Float32, reflect.Float64:
+			types = []string{"number", "string"}
+		case reflect.Map:
+			types = []string{"object", "string"}
+		case reflect.Slice:
+			types = []string{"array", "string"}
+		default:
+			types = []string{"string", "number", "boolean"}
+		}
+	}
+	if !required {
+		types = append(types, "null")
+	}
+	return types
+}
+
+// objectSchema is the JSON schema of an object
+type objectSchema map[string]interface{}
+
+func newObjectSchema() objectSchema {
+	return objectSchema{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+func (schema objectSchema) properties() map[string]interface{} {
+	return schema["properties"].(map[string]interface{})
+}
+
+// addProperty adds the schema of a property, keeping the list of required
+// properties sorted
+func (schema objectSchema) addProperty(name string, property interface{}, required bool) {
+	schema.properties()[name] = property
+	if required {
+		names, _ := schema["required"].([]string)
+		names = append(names, name)
+		sort.Strings(names)
+		schema["required"] = names
+	}
+}
@@ -0,0 +1,346 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeValuesSchema(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{
+		UseMemoryLimits: true,
+		RoleManifest: &model.RoleManifest{
+			Variables: model.Variables{
+				&model.VariableDefinition{
+					Name: "DOMAIN",
+					CVOptions: model.CVOptions{
+						Description: "The domain",
+						Required:    true,
+					},
+				},
+				&model.VariableDefinition{
+					Name:      "WORKERS",
+					CVOptions: model.CVOptions{Default: 4},
+				},
+				&model.VariableDefinition{
+					Name:      "ADMIN_PASSWORD",
+					CVOptions: model.CVOptions{Secret: true, Required: true},
+				},
+				&model.VariableDefinition{
+					Name:      "GENERATED_PASSWORD",
+					Type:      "password",
+					CVOptions: model.CVOptions{Secret: true, Required: true},
+				},
+			},
+			InstanceGroups: model.InstanceGroups{
+				&model.InstanceGroup{
+					Name: "some-group",
+					Run: &model.RoleRun{
+						Scaling: &model.RoleRunScaling{Min: 1, Max: 3, MustBeOdd: true},
+					},
+				},
+				&model.InstanceGroup{
+					Name: "manual-group",
+					Run: &model.RoleRun{
+						FlightStage: model.FlightStageManual,
+						Scaling:     &model.RoleRunScaling{},
+					},
+				},
+			},
+			Configuration: &model.Configuration{},
+		},
+	}
+
+	schema, err := MakeValuesSchema(settings)
+	require.NoError(t, err)
+
+	// Compare the JSON encoding, as written to values.schema.json
+	encoded, err := json.Marshal(schema)
+	require.NoError(t, err)
+	var actual map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &actual))
+
+	get := func(path ...string) interface{} {
+		var value interface{} = actual
+		for _, key := range path {
+			mapping, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = mapping[key]
+		}
+		return value
+	}
+
+	assert.Equal(t, valuesSchemaVersion, actual["$schema"])
+
+	t.Run("Env", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []interface{}{"DOMAIN"}, get("properties", "env", "required"))
+		assert.Equal(t, map[string]interface{}{
+			"type":        []interface{}{"string", "number", "boolean", "object", "array"},
+			"description": "The domain",
+		}, get("properties", "env", "properties", "DOMAIN"))
+		assert.Equal(t, []interface{}{"integer", "string", "null"}, get("properties", "env", "properties", "WORKERS", "type"))
+		assert.Nil(t, get("properties", "env", "properties", "IP_ADDRESS"), "environment variables are not values")
+	})
+
+	t.Run("Secrets", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []interface{}{"ADMIN_PASSWORD"}, get("properties", "secrets", "required"))
+		assert.Equal(t, "This value uses a generated default.",
+			get("properties", "secrets", "properties", "GENERATED_PASSWORD", "description"))
+	})
+
+	t.Run("Sizing", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []interface{}{"some_group"}, get("properties", "sizing", "required"))
+		assert.Equal(t, map[string]interface{}{
+			"type":    "integer",
+			"minimum": 1.,
+			"maximum": 3.,
+			"not":     map[string]interface{}{"multipleOf": 2.},
+		}, get("properties", "sizing", "properties", "some_group", "properties", "count"))
+		assert.NotNil(t, get("properties", "sizing", "properties", "some_group", "properties", "memory"))
+		assert.Nil(t, get("properties", "sizing", "properties", "some_group", "properties", "cpu"))
+	})
+}
+
+func TestMakeValuesSchemaPorts(t *testing.T) {
+	t.Parallel()
+
+	instanceGroup := &model.InstanceGroup{
+		Name: "some-group",
+		Run: &model.RoleRun{
+			Scaling: &model.RoleRunScaling{Min: 1, Max: 1},
+		},
+		JobReferences: model.JobReferences{
+			&model.JobReference{
+				ContainerProperties: model.JobContainerProperties{
+					BoshContainerization: model.JobBoshContainerization{
+						Ports: []model.JobExposedPort{
+							{Name: "http", PortIsConfigurable: true},
+							{Name: "tcp-route", CountIsConfigurable: true, Max: 10},
+							{Name: "fixed"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ports := getSizingSchema(instanceGroup, ExportSettings{})["properties"].(map[string]interface{})["ports"].(objectSchema)
+	assert.Equal(t, map[string]interface{}{
+		"http": objectSchema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"port": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 65535},
+			},
+			"required": []string{"port"},
+		},
+		"tcp_route": objectSchema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"count": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 10},
+			},
+			"required": []string{"count"},
+		},
+	}, ports.properties())
+}
+
+func TestMakeValuesSchemaMatchesValues(t *testing.T) {
+	t.Parallel()
+
+	variable := func(name string, options model.CVOptions) *model.VariableDefinition {
+		return &model.VariableDefinition{Name: name, CVOptions: options}
+	}
+	settings := ExportSettings{
+		UseMemoryLimits: true,
+		UseCPULimits:    true,
+		RoleManifest: &model.RoleManifest{
+			Variables: model.Variables{
+				variable("DOMAIN", model.CVOptions{Required: true}),
+				variable("ADMIN_PASSWORD", model.CVOptions{Secret: true, Required: true}),
+				variable("OPTIONAL", model.CVOptions{}),
+				variable("NAME", model.CVOptions{Default: "fissile", Required: true}),
+				variable("WORKERS", model.CVOptions{Default: 4}),
+				variable("RATIO", model.CVOptions{Default: 0.5}),
+				variable("DEBUG", model.CVOptions{Default: false}),
+				variable("LABELS", model.CVOptions{Default: map[interface{}]interface{}{"tier": "web"}}),
+				variable("ZONES", model.CVOptions{Default: []interface{}{"a", "b"}}),
+				&model.VariableDefinition{
+					Name:      "GENERATED_PASSWORD",
+					Type:      "password",
+					CVOptions: model.CVOptions{Secret: true, Required: true},
+				},
+			},
+			InstanceGroups: model.InstanceGroups{
+				&model.InstanceGroup{
+					Name: "some-group",
+					Run: &model.RoleRun{
+						Scaling:     &model.RoleRunScaling{Min: 1, Max: 3, HA: 3, MustBeOdd: true},
+						Memory:      &model.RoleRunMemory{},
+						CPU:         &model.RoleRunCPU{},
+						Autoscaling: &model.RoleRunAutoscaling{},
+					},
+				},
+				&model.InstanceGroup{
+					Name: "optional-group",
+					Run: &model.RoleRun{
+						Scaling: &model.RoleRunScaling{Min: 0, Max: 2},
+						Memory:  &model.RoleRunMemory{},
+						CPU:     &model.RoleRunCPU{},
+					},
+				},
+			},
+			Configuration: &model.Configuration{},
+		},
+	}
+
+	values, err := MakeValues(settings)
+	require.NoError(t, err)
+	actual, err := RoundtripKube(values)
+	require.NoError(t, err)
+
+	schema, err := MakeValuesSchema(settings)
+	require.NoError(t, err)
+
+	// Only the required variables without a default are left for the user
+	assert.Equal(t, []string{
+		"env.DOMAIN: null is not one of [string number boolean object array]",
+		"secrets.ADMIN_PASSWORD: null is not one of [string number boolean object array]",
+	}, validateValuesSchema(toJSONValue(t, schema), toJSONValue(t, actual), ""))
+}
+
+// toJSONValue converts a value to the types decoded from JSON
+func toJSONValue(t *testing.T, value interface{}) interface{} {
+	var convert func(value interface{}) interface{}
+	convert = func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case map[interface{}]interface{}:
+			result := make(map[string]interface{})
+			for key, item := range value {
+				result[fmt.Sprintf("%v", key)] = convert(item)
+			}
+			return result
+		case []interface{}:
+			result := make([]interface{}, len(value))
+			for i, item := range value {
+				result[i] = convert(item)
+			}
+			return result
+		}
+		return value
+	}
+
+	encoded, err := json.Marshal(convert(value))
+	require.NoError(t, err)
+	var result interface{}
+	require.NoError(t, json.Unmarshal(encoded, &result))
+	return result
+}
+
+// validateValuesSchema checks a value against the parts of JSON schema used by
+// MakeValuesSchema, returning the violations sorted by path
+func validateValuesSchema(schema, value interface{}, path string) []string {
+	rules, _ := schema.(map[string]interface{})
+	var violations []string
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf("%s: %s", strings.TrimPrefix(path, "."), fmt.Sprintf(format, args...)))
+	}
+
+	if types, ok := rules["type"]; ok {
+		var allowed []string
+		switch types := types.(type) {
+		case string:
+			allowed = []string{types}
+		case []interface{}:
+			for _, name := range types {
+				allowed = append(allowed, name.(string))
+			}
+		}
+		if !jsonTypeMatches(value, allowed) {
+			fail("%v is not one of %v", jsonTypeName(value), allowed)
+			return violations
+		}
+	}
+
+	if number, ok := value.(float64); ok {
+		if minimum, ok := rules["minimum"].(float64); ok && number < minimum {
+			fail("%v is less than %v", number, minimum)
+		}
+		if maximum, ok := rules["maximum"].(float64); ok && number > maximum {
+			fail("%v is greater than %v", number, maximum)
+		}
+		if divisor, ok := rules["multipleOf"].(float64); ok && math.Mod(number, divisor) != 0 {
+			fail("%v is not a multiple of %v", number, divisor)
+		}
+	}
+	if not, ok := rules["not"]; ok && len(validateValuesSchema(not, value, path)) == 0 {
+		fail("%v matches a forbidden schema", value)
+	}
+
+	if object, ok := value.(map[string]interface{}); ok {
+		if required, ok := rules["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					fail("missing %s", name)
+				}
+			}
+		}
+		properties, _ := rules["properties"].(map[string]interface{})
+		for name, property := range properties {
+			if item, ok := object[name]; ok {
+				violations = append(violations, validateValuesSchema(property, item, path+"."+name)...)
+			}
+		}
+	}
+	if list, ok := value.([]interface{}); ok {
+		if items, ok := rules["items"]; ok {
+			for i, item := range list {
+				violations = append(violations, validateValuesSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func jsonTypeMatches(value interface{}, allowed []string) bool {
+	name := jsonTypeName(value)
+	for _, candidate := range allowed {
+		if candidate == name {
+			return true
+		}
+		if candidate == "integer" && name == "number" && value.(float64) == math.Trunc(value.(float64)) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"github.com/stretchr/testify/assert"
@@ -158,4 +159,83 @@ func TestMakeValues(t *testing.T) {
 
 		assert.Equal(t, auth.String(), authString)
 	})
+	t.Run("ImageDigests", func(t *testing.T) {
+		t.Parallel()
+		instanceGroup := &model.InstanceGroup{
+			Name: "arole",
+			Run: &model.RoleRun{
+				Scaling: &model.RoleRunScaling{},
+			},
+		}
+		settings := ExportSettings{
+			OutputDir:    outDir,
+			Registry:     "R",
+			Organization: "O",
+			Repository:   "theRepo",
+			Opinions:     model.NewEmptyOpinions(),
+			RoleManifest: &model.RoleManifest{
+				InstanceGroups: model.InstanceGroups{instanceGroup},
+				Configuration:  &model.Configuration{},
+			},
+		}
+		devVersion, err := instanceGroup.GetRoleDevVersion(settings.Opinions, "", "", nil)
+		require.NoError(t, err)
+		settings.ImageDigests = map[string]string{
+			builder.GetRoleDevImageName("R", "O", "theRepo", instanceGroup, devVersion): "sha256:abcd",
+		}
+
+		node, err := MakeValues(settings)
+		require.NoError(t, err)
+
+		actual, err := RoundtripKube(node)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			kube:
+				images:
+					arole: theRepo-arole@sha256:abcd
+		`, actual)
+
+		settings.ImageDigests = map[string]string{}
+		_, err = MakeValues(settings)
+		assert.Error(t, err)
+	})
+
+	t.Run("Autoscaling", func(t *testing.T) {
+		t.Parallel()
+		cpu := 80
+		settings := ExportSettings{
+			OutputDir: outDir,
+			RoleManifest: &model.RoleManifest{
+				InstanceGroups: model.InstanceGroups{
+					&model.InstanceGroup{
+						Name: "arole",
+						Run: &model.RoleRun{
+							Scaling:     &model.RoleRunScaling{Min: 1, Max: 4},
+							Autoscaling: &model.RoleRunAutoscaling{CPUUtilization: &cpu},
+						},
+					},
+					&model.InstanceGroup{
+						Name: "brole",
+						Run: &model.RoleRun{
+							Scaling: &model.RoleRunScaling{Min: 1, Max: 4},
+						},
+					},
+				},
+				Configuration: &model.Configuration{},
+			},
+		}
+
+		node, err := MakeValues(settings)
+		require.NoError(t, err)
+
+		actual, err := RoundtripKube(node)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			sizing:
+				arole:
+					autoscaling:
+						enabled: false
+		`, actual)
+		assert.Nil(t, node.Get("sizing", "brole", "autoscaling"))
+	})
 }
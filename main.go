@@ -42,7 +42,9 @@ func main() {
 	f := app.NewFissileApplication(version, ui)
 
 	if err := cmd.Execute(f, version); err != nil {
-		ui.Println(color.RedString("%v", err))
-		sigint.DefaultHandler.Exit(1)
+		if err.Error() != "" {
+			ui.Println(color.RedString("%v", err))
+		}
+		sigint.DefaultHandler.Exit(cmd.ExitCode(err))
 	}
 }
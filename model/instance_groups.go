@@ -64,9 +64,10 @@ type RoleTag string
 
 // The list of acceptable tags
 const (
-	RoleTagStopOnFailure     = RoleTag("stop-on-failure")
-	RoleTagSequentialStartup = RoleTag("sequential-startup")
-	RoleTagActivePassive     = RoleTag("active-passive")
+	RoleTagStopOnFailure      = RoleTag("stop-on-failure")
+	RoleTagSequentialStartup  = RoleTag("sequential-startup")
+	RoleTagActivePassive      = RoleTag("active-passive")
+	RoleTagNoDisruptionBudget = RoleTag("no-disruption-budget")
 )
 
 // Validate implements several checks for the instance group and its job references. It's run after the
@@ -79,7 +80,7 @@ func (g *InstanceGroup) Validate(mappedReleases releaseByName) validation.ErrorL
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].run.active-passive-probe", g.Name),
 				g.Run.ActivePassiveProbe,
-				"Active/passive probes are only valid on instance groups with active-passive tag"))
+				"Active/passive probes are only valid on instance groups with active-passive tag").WithRule(ruleActivePassiveProbe))
 		}
 	}
 
@@ -90,7 +91,7 @@ func (g *InstanceGroup) Validate(mappedReleases releaseByName) validation.ErrorL
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].jobs[%s]", g.Name, jobReference.Name),
 				jobReference.ReleaseName,
-				"Referenced release is not loaded"))
+				"Referenced release is not loaded").WithRule(ruleJobReferences))
 			continue
 		}
 
@@ -98,7 +99,7 @@ func (g *InstanceGroup) Validate(mappedReleases releaseByName) validation.ErrorL
 		if err != nil {
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].jobs[%s]", g.Name, jobReference.Name),
-				jobReference.ReleaseName, err.Error()))
+				jobReference.ReleaseName, err.Error()).WithRule(ruleJobReferences))
 			continue
 		}
 		jobReference.Job = job
@@ -123,13 +124,13 @@ func (g *InstanceGroup) Validate(mappedReleases releaseByName) validation.ErrorL
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].colocated_containers[%d]", g.Name, idx),
 				roleName,
-				"There is no such instance group defined"))
+				"There is no such instance group defined").WithRule(ruleColocatedContainers))
 
 		} else if lookupRole.Type != RoleTypeColocatedContainer {
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].colocated_containers[%d]", g.Name, idx),
 				roleName,
-				"The instance group is not of required type colocated-container"))
+				"The instance group is not of required type colocated-container").WithRule(ruleColocatedContainers))
 		}
 	}
 
@@ -193,6 +194,12 @@ func (g *InstanceGroup) calculateRoleRun() validation.ErrorList {
 		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), jobReferences.firstHealthCheck(), "Cannot specify Run.HealthCheck properties on more than one job of the same instance group"))
 	}
 
+	if ok := jobReferences.atMostOnce(autoscalingPresent); ok {
+		g.Run.Autoscaling = jobReferences.firstAutoscaling()
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), jobReferences.firstAutoscaling(), "Cannot specify Run.Autoscaling properties on more than one job of the same instance group"))
+	}
+
 	return allErrs
 }
 
@@ -31,19 +31,28 @@ type JobBoshContainerization struct {
 
 // JobExposedPort describes a port to be available to other jobs, or the outside world
 type JobExposedPort struct {
-	Name                string `yaml:"name"`
-	Protocol            string `yaml:"protocol"`
-	External            string `yaml:"external"`
-	Internal            string `yaml:"internal"`
-	Public              bool   `yaml:"public"`
-	Count               int    `yaml:"count"`
-	Max                 int    `yaml:"max"`
-	PortIsConfigurable  bool   `yaml:"port-configurable"`
-	CountIsConfigurable bool   `yaml:"count-configurable"`
+	Name                string                 `yaml:"name"`
+	Protocol            string                 `yaml:"protocol"`
+	External            string                 `yaml:"external"`
+	Internal            string                 `yaml:"internal"`
+	Public              bool                   `yaml:"public"`
+	Count               int                    `yaml:"count"`
+	Max                 int                    `yaml:"max"`
+	PortIsConfigurable  bool                   `yaml:"port-configurable"`
+	CountIsConfigurable bool                   `yaml:"count-configurable"`
+	Ingress             *JobExposedPortIngress `yaml:"ingress,omitempty"`
 	InternalPort        int
 	ExternalPort        int
 }
 
+// JobExposedPortIngress describes how to route HTTP(S) traffic for a public
+// port through a Kubernetes ingress
+type JobExposedPortIngress struct {
+	Hosts     []string `yaml:"hosts"`                // Host names routed to the port
+	Paths     []string `yaml:"paths,omitempty"`      // URL path prefixes routed to the port, defaults to "/"
+	TLSSecret string   `yaml:"tls-secret,omitempty"` // Name of the TLS secret with the certificate for the hosts
+}
+
 func runPropertyPresent(j JobReference) bool {
 	if j.ContainerProperties.BoshContainerization.Run == nil {
 		return false
@@ -72,6 +81,13 @@ func affinityPresent(j JobReference) bool {
 	return true
 }
 
+func autoscalingPresent(j JobReference) bool {
+	if j.ContainerProperties.BoshContainerization.Run.Autoscaling == nil {
+		return false
+	}
+	return true
+}
+
 // JobReferences is a collection of pointers to job references
 type JobReferences []*JobReference
 
@@ -171,8 +187,17 @@ func (jobs JobReferences) firstAffinity() *RoleRunAffinity {
 	return nil
 }
 
+func (jobs JobReferences) firstAutoscaling() *RoleRunAutoscaling {
+	for _, j := range jobs {
+		if j.ContainerProperties.BoshContainerization.Run.Autoscaling != nil {
+			return j.ContainerProperties.BoshContainerization.Run.Autoscaling
+		}
+	}
+	return nil
+}
+
 // WriteConfigs merges the job's spec with the opinions and returns the result as JSON.
-func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsPath, darkOpinionsPath string) ([]byte, error) {
+func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsPaths []string, darkOpinionsPath string) ([]byte, error) {
 	var config struct {
 		Job struct {
 			Name string `json:"name"`
@@ -198,7 +223,7 @@ func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsP
 		config.Consumes[consumer.Name] = consumer.jobLinkInfo
 	}
 
-	opinions, err := NewOpinions(lightOpinionsPath, darkOpinionsPath)
+	opinions, err := NewOpinions(lightOpinionsPaths, darkOpinionsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +69,7 @@ func TestWriteConfigs(t *testing.T) {
 	assert.NoError(err)
 	assert.NoError(tempFile.Close())
 
-	json, err := role.JobReferences[0].WriteConfigs(role, tempFile.Name(), tempFile.Name())
+	json, err := role.JobReferences[0].WriteConfigs(role, []string{tempFile.Name()}, tempFile.Name())
 	assert.NoError(err)
 
 	// `service_name` is empty because we never resolved links
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"reflect"
 
+	"code.cloudfoundry.org/fissile/validation"
 	"gopkg.in/yaml.v2"
 )
 
@@ -12,6 +13,15 @@ import (
 type Opinions struct {
 	Light map[string]interface{}
 	Dark  map[string]interface{}
+
+	// The light opinion files, in the order they were merged
+	LightFiles []string
+
+	// The sources locate the opinions in their files, if loaded from them
+	LightSources []*validation.YAMLSource
+	DarkSource   *validation.YAMLSource
+
+	lightLayers []map[string]string
 }
 
 // NewEmptyOpinions returns an empty opinions object, used for testing and
@@ -30,21 +40,37 @@ func NewEmptyOpinions() *Opinions {
 	return result
 }
 
-// NewOpinions returns the json opinions for the light and dark opinion files
-func NewOpinions(lightFile, darkFile string) (*Opinions, error) {
-	result := &Opinions{}
-
-	manifestContents, err := ioutil.ReadFile(lightFile)
-	if err != nil {
-		return nil, err
+// NewOpinions returns the json opinions for the light and dark opinion files.
+// The light opinion files are layers, like base, product and environment
+// opinions, which are deep-merged in order: mappings are merged key by key,
+// and other values of later files replace those of earlier ones.
+func NewOpinions(lightFiles []string, darkFile string) (*Opinions, error) {
+	result := &Opinions{
+		Light:      map[string]interface{}{},
+		LightFiles: lightFiles,
 	}
 
-	err = yaml.Unmarshal([]byte(manifestContents), &result.Light)
-	if err != nil {
-		return nil, err
+	for _, lightFile := range lightFiles {
+		manifestContents, err := ioutil.ReadFile(lightFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var layer map[string]interface{}
+		err = yaml.Unmarshal([]byte(manifestContents), &layer)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range layer {
+			result.Light[key] = mergeOpinion(result.Light[key], value)
+		}
+
+		source, _ := validation.NewYAMLSource(lightFile, manifestContents)
+		result.LightSources = append(result.LightSources, source)
+		result.lightLayers = append(result.lightLayers, FlattenOpinions(layer, false))
 	}
 
-	manifestContents, err = ioutil.ReadFile(darkFile)
+	manifestContents, err := ioutil.ReadFile(darkFile)
 	if err != nil {
 		return nil, err
 	}
@@ -53,10 +79,67 @@ func NewOpinions(lightFile, darkFile string) (*Opinions, error) {
 	if err != nil {
 		return nil, err
 	}
+	result.DarkSource, _ = validation.NewYAMLSource(darkFile, manifestContents)
 
 	return result, nil
 }
 
+// mergeOpinion deep-merges the value of a later light opinion layer into the
+// value of the earlier ones. Empty values don't replace anything.
+func mergeOpinion(base, layer interface{}) interface{} {
+	if layer == nil {
+		return base
+	}
+	baseMap, ok := base.(map[interface{}]interface{})
+	if !ok {
+		return layer
+	}
+	layerMap, ok := layer.(map[interface{}]interface{})
+	if !ok {
+		return layer
+	}
+
+	result := make(map[interface{}]interface{}, len(baseMap))
+	for key, value := range baseMap {
+		result[key] = value
+	}
+	for key, value := range layerMap {
+		result[key] = mergeOpinion(result[key], value)
+	}
+	return result
+}
+
+// LightLayer returns the light opinion file the merged value of the
+// (flattened) property came from, or an empty string if it is not set.
+func (o *Opinions) LightLayer(property string) string {
+	for i := len(o.lightLayers) - 1; i >= 0; i-- {
+		if _, ok := o.lightLayers[i][property]; ok {
+			return o.LightFiles[i]
+		}
+	}
+	return ""
+}
+
+// LocateLight returns the position of a light opinion in the last layer
+// setting it, or else the closest position of its parents in any layer.
+func (o *Opinions) LocateLight(field string) *validation.Position {
+	var closest *validation.Position
+	closestMissing := 0
+	for i := len(o.LightSources) - 1; i >= 0; i-- {
+		position, missing := o.LightSources[i].Lookup(field)
+		if position == nil {
+			continue
+		}
+		if missing == 0 {
+			return position
+		}
+		if closest == nil || missing < closestMissing {
+			closest, closestMissing = position, missing
+		}
+	}
+	return closest
+}
+
 // FlattenOpinions converts the incoming nested map of opinions into a
 // flat map of properties to values (strings). When 'total' is set (to
 // true) array values are recursed into and flattened as well.
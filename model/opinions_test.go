@@ -17,7 +17,7 @@ func TestOpinionsLoad(t *testing.T) {
 	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
 	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
 
-	confOpinions, err := NewOpinions(opinionsFile, opinionsFileDark)
+	confOpinions, err := NewOpinions([]string{opinionsFile}, opinionsFileDark)
 	assert.Nil(err)
 	assert.NotNil(confOpinions)
 }
@@ -32,7 +32,7 @@ func TestGetOpinionForKey(t *testing.T) {
 	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
 	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
 
-	confOpinions, err := NewOpinions(opinionsFile, opinionsFileDark)
+	confOpinions, err := NewOpinions([]string{opinionsFile}, opinionsFileDark)
 	assert.Nil(err)
 	assert.NotNil(confOpinions)
 
@@ -52,7 +52,7 @@ func TestGetOpinionWithDarkKey(t *testing.T) {
 	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
 	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
 
-	confOpinions, err := NewOpinions(opinionsFile, opinionsFileDark)
+	confOpinions, err := NewOpinions([]string{opinionsFile}, opinionsFileDark)
 	assert.Nil(err)
 	assert.NotNil(confOpinions)
 
@@ -70,7 +70,7 @@ func TestGetOpinionForKeyInvalid(t *testing.T) {
 	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
 	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
 
-	confOpinions, err := NewOpinions(opinionsFile, opinionsFileDark)
+	confOpinions, err := NewOpinions([]string{opinionsFile}, opinionsFileDark)
 	assert.Nil(err)
 	assert.NotNil(confOpinions)
 
@@ -88,7 +88,7 @@ func TestOpinionsFlattenOpinions(t *testing.T) {
 
 	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
 	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
-	confOpinions, err := NewOpinions(opinionsFile, opinionsFileDark)
+	confOpinions, err := NewOpinions([]string{opinionsFile}, opinionsFileDark)
 	assert.Nil(err)
 	assert.NotNil(confOpinions)
 
@@ -105,3 +105,37 @@ func TestOpinionsFlattenOpinions(t *testing.T) {
 		assert.Contains(light, property)
 	}
 }
+
+func TestOpinionsLayers(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.Nil(err)
+
+	opinionsFile := filepath.Join(workDir, "../test-assets/test-opinions/opinions.yml")
+	overlayFile := filepath.Join(workDir, "../test-assets/test-opinions/overlay-opinions.yml")
+	opinionsFileDark := filepath.Join(workDir, "../test-assets/test-opinions/dark-opinions.yml")
+	confOpinions, err := NewOpinions([]string{opinionsFile, overlayFile}, opinionsFileDark)
+	if !assert.NoError(err) {
+		return
+	}
+
+	light := FlattenOpinions(confOpinions.Light, false)
+	assert.Len(light, 6)
+	assert.Equal("tor.example.com", light["properties.tor.hostname"])
+	assert.Equal("some key", light["properties.tor.client_keys.web"])
+	assert.Equal("31", light["properties.tor.int_opinion"])
+
+	assert.Equal(overlayFile, confOpinions.LightLayer("properties.tor.hostname"))
+	assert.Equal(opinionsFile, confOpinions.LightLayer("properties.tor.int_opinion"))
+	assert.Empty(confOpinions.LightLayer("properties.tor.missing"))
+
+	position := confOpinions.LocateLight("properties.tor.hostname")
+	if assert.NotNil(position) {
+		assert.Equal(overlayFile+":3:5", position.String())
+	}
+	position = confOpinions.LocateLight("properties.tor.opinion")
+	if assert.NotNil(position) {
+		assert.Equal(opinionsFile+":3:5", position.String())
+	}
+}
@@ -1,22 +1,74 @@
 package model
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"code.cloudfoundry.org/fissile/util"
 	"gopkg.in/yaml.v2"
 )
 
-// ReleaseRef represents a reference to a BOSH release from a manifest
+// ReleaseRef represents a reference to a BOSH release from a manifest.
+// Final releases are referenced by URL; dev releases are referenced by a
+// local path, with an optional dev version.
 type ReleaseRef struct {
 	Name    string `yaml:"name"`
 	URL     string `yaml:"url"`
 	SHA1    string `yaml:"sha1"`
 	Version string `yaml:"version"`
+	Path    string `yaml:"path"`
+}
+
+// IsDevRelease returns true if the reference points at a local dev release
+// instead of a downloadable final release
+func (r *ReleaseRef) IsDevRelease() bool {
+	return r.URL == "" && r.Path != ""
+}
+
+// ValidateSHA1 validates that the checksum of a downloaded release tarball is
+// the same as the one declared in the role manifest. The declared checksum is
+// a plain SHA1, or a SHA256 when prefixed with "sha256:".
+func (r *ReleaseRef) ValidateSHA1(tarballPath string) error {
+	if r.SHA1 == "" {
+		return nil
+	}
+
+	algorithm := "sha1"
+	expected := r.SHA1
+	var h hash.Hash = sha1.New()
+	if strings.HasPrefix(expected, "sha256:") {
+		algorithm = "sha256"
+		expected = strings.TrimPrefix(expected, "sha256:")
+		h = sha256.New()
+	}
+
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return fmt.Errorf("Error opening the release tarball %s for %s calculation", tarballPath, algorithm)
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return fmt.Errorf("Error reading release tarball %s for %s calculation", tarballPath, algorithm)
+	}
+
+	computed := fmt.Sprintf("%x", h.Sum(nil))
+
+	if computed != strings.ToLower(expected) {
+		return fmt.Errorf("Computed %s (%s) is different than manifest %s (%s) for release %s downloaded from %s", algorithm, computed, algorithm, expected, r.Name, r.URL)
+	}
+
+	return nil
 }
 
 // Release represents a BOSH release
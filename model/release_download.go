@@ -0,0 +1,193 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mholt/archiver"
+	"github.com/vbauerster/mpb"
+	"github.com/vbauerster/mpb/decor"
+)
+
+// ReleaseDownloadOptions controls how final releases referenced by the role
+// manifest are downloaded
+type ReleaseDownloadOptions struct {
+	// CacheDir is the root of a release cache that can be shared between
+	// projects. When empty, releases are kept in a .final_releases directory
+	// next to the role manifest.
+	CacheDir string
+	// Workers is the maximum number of concurrent downloads; zero means no
+	// limit
+	Workers int
+	// Retries is the number of times a failed download is attempted again
+	Retries int
+	// RetryBackoff is the delay before the first retry of a download; it
+	// doubles for every further attempt
+	RetryBackoff time.Duration
+}
+
+// releaseDownloader fetches final releases into a content-addressed cache:
+// each release is unpacked into a directory named after the checksum of its
+// tarball, so identical releases referenced by different role manifests are
+// only downloaded once.
+type releaseDownloader struct {
+	cacheDir string
+	options  ReleaseDownloadOptions
+}
+
+func newReleaseDownloader(manifestFilePath string, options ReleaseDownloadOptions) *releaseDownloader {
+	cacheDir := options.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(filepath.Dir(manifestFilePath), ".final_releases")
+	}
+
+	return &releaseDownloader{
+		cacheDir: cacheDir,
+		options:  options,
+	}
+}
+
+// unpackedPath returns the cache directory holding the unpacked release.
+// Releases are keyed by their declared checksum; releases without one can't
+// be addressed by content and are keyed by name and version instead.
+func (d *releaseDownloader) unpackedPath(releaseRef *ReleaseRef) string {
+	switch {
+	case strings.HasPrefix(releaseRef.SHA1, "sha256:"):
+		return filepath.Join(d.cacheDir, "sha256", strings.ToLower(strings.TrimPrefix(releaseRef.SHA1, "sha256:")))
+	case releaseRef.SHA1 != "":
+		return filepath.Join(d.cacheDir, "sha1", strings.ToLower(releaseRef.SHA1))
+	default:
+		return filepath.Join(d.cacheDir, "unverified", fmt.Sprintf("%s-%s", releaseRef.Name, releaseRef.Version))
+	}
+}
+
+// downloadAll makes sure all given releases are available in the cache,
+// downloading at most options.Workers of them at the same time
+func (d *releaseDownloader) downloadAll(releaseRefs []*ReleaseRef) error {
+	var allErrs error
+	var errsMutex sync.Mutex
+	var wg sync.WaitGroup
+	progress := mpb.New(mpb.WithWaitGroup(&wg))
+
+	workers := d.options.Workers
+	if workers < 1 {
+		workers = len(releaseRefs)
+	}
+	slots := make(chan struct{}, workers)
+
+	for _, releaseRef := range releaseRefs {
+		wg.Add(1)
+
+		go func(releaseRef *ReleaseRef) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := d.download(releaseRef, progress); err != nil {
+				errsMutex.Lock()
+				allErrs = multierror.Append(allErrs, err)
+				errsMutex.Unlock()
+			}
+		}(releaseRef)
+	}
+
+	wg.Wait()
+
+	return allErrs
+}
+
+// download fetches, verifies and unpacks a single release, unless it is
+// already in the cache
+func (d *releaseDownloader) download(releaseRef *ReleaseRef, progress *mpb.Progress) error {
+	if releaseRef.URL == "" {
+		return fmt.Errorf("Release %s must have either a url or a path", releaseRef.Name)
+	}
+	if _, err := url.ParseRequestURI(releaseRef.URL); err != nil {
+		return fmt.Errorf("Invalid URL %s for release %s: %s", releaseRef.URL, releaseRef.Name, err.Error())
+	}
+
+	unpackedPath := d.unpackedPath(releaseRef)
+	if _, err := os.Stat(filepath.Join(unpackedPath, "release.MF")); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Anything at the final location without a manifest is a leftover
+	if err := os.RemoveAll(unpackedPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(unpackedPath), 0700); err != nil {
+		return err
+	}
+
+	// Show download progress
+	addBar := func() *mpb.Bar {
+		return progress.AddBar(
+			100,
+			mpb.BarRemoveOnComplete(),
+			mpb.PrependDecorators(
+				decor.Name(releaseRef.Name, decor.WCSyncSpaceR),
+				decor.Percentage(decor.WCSyncWidth),
+			))
+	}
+	bar := addBar()
+	lastPercentage := 0
+
+	// A partial tarball left behind by an earlier run is resumed
+	tarballPath := unpackedPath + ".tgz"
+	err := util.DownloadFile(tarballPath, releaseRef.URL, util.DownloadOptions{
+		Retries:      d.options.Retries,
+		RetryBackoff: d.options.RetryBackoff,
+	}, func(percentage int) {
+		if percentage < lastPercentage {
+			// The server ignored the Range request and sends everything again
+			progress.Abort(bar, true)
+			bar = addBar()
+			lastPercentage = 0
+		}
+		bar.IncrBy(percentage - lastPercentage)
+		lastPercentage = percentage
+	})
+	if err != nil {
+		progress.Abort(bar, true)
+		return err
+	}
+	defer os.Remove(tarballPath)
+
+	// make sure we never cache a truncated or tampered tarball
+	if err := releaseRef.ValidateSHA1(tarballPath); err != nil {
+		return err
+	}
+
+	// Unpack next to the final location and move the result into place, so
+	// that an interrupted run never leaves a partial release in the cache
+	tempPath, err := ioutil.TempDir(filepath.Dir(unpackedPath), filepath.Base(unpackedPath)+".unpack-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempPath)
+
+	if err := archiver.TarGz.Open(tarballPath, tempPath); err != nil {
+		return fmt.Errorf("Error unpacking release %s: %s", releaseRef.Name, err.Error())
+	}
+
+	if err := os.Rename(tempPath, unpackedPath); err != nil {
+		// Another fissile process sharing the cache may have won the race
+		if _, statErr := os.Stat(filepath.Join(unpackedPath, "release.MF")); statErr == nil {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
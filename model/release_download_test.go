@@ -0,0 +1,186 @@
+package model
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReleaseTarball returns a gzipped tarball with a minimal release.MF
+func fakeReleaseTarball(t *testing.T, name string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	content := []byte(fmt.Sprintf("name: %s\nversion: \"1\"\n", name))
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name: "./release.MF",
+		Mode: 0644,
+		Size: int64(len(content)),
+	}))
+	_, err := tarWriter.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	return buf.Bytes()
+}
+
+func TestReleaseDownloaderCache(t *testing.T) {
+	assert := assert.New(t)
+
+	tarball := fakeReleaseTarball(t, "foo")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "foo.tgz", time.Time{}, bytes.NewReader(tarball))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	releaseRef := &ReleaseRef{
+		Name:    "foo",
+		Version: "1",
+		URL:     server.URL + "/foo.tgz",
+		SHA1:    fmt.Sprintf("%x", sha1.Sum(tarball)),
+	}
+
+	// Two role manifests in different projects share the same cache
+	for _, manifest := range []string{"/project-a/role-manifest.yml", "/project-b/role-manifest.yml"} {
+		downloader := newReleaseDownloader(manifest, ReleaseDownloadOptions{CacheDir: cacheDir})
+		assert.NoError(downloader.downloadAll([]*ReleaseRef{releaseRef}))
+
+		unpackedPath := downloader.unpackedPath(releaseRef)
+		assert.Equal(filepath.Join(cacheDir, "sha1", releaseRef.SHA1), unpackedPath)
+		assert.FileExists(filepath.Join(unpackedPath, "release.MF"))
+		_, err = os.Stat(unpackedPath + ".tgz")
+		assert.True(os.IsNotExist(err), "tarball should be removed after unpacking")
+	}
+	assert.Equal(1, requests, "cached releases should not be downloaded again")
+
+	entries, err := ioutil.ReadDir(filepath.Join(cacheDir, "sha1"))
+	assert.NoError(err)
+	assert.Len(entries, 1, "no temporary directories should be left behind")
+}
+
+func TestReleaseDownloaderUnpackedPath(t *testing.T) {
+	assert := assert.New(t)
+
+	downloader := newReleaseDownloader("/project/role-manifest.yml", ReleaseDownloadOptions{})
+
+	assert.Equal("/project/.final_releases/sha1/abc",
+		downloader.unpackedPath(&ReleaseRef{Name: "foo", Version: "1", SHA1: "ABC"}))
+	assert.Equal("/project/.final_releases/sha256/def",
+		downloader.unpackedPath(&ReleaseRef{Name: "foo", Version: "1", SHA1: "sha256:def"}))
+	assert.Equal("/project/.final_releases/unverified/foo-1",
+		downloader.unpackedPath(&ReleaseRef{Name: "foo", Version: "1"}))
+}
+
+func TestReleaseDownloaderWorkers(t *testing.T) {
+	assert := assert.New(t)
+
+	var mutex sync.Mutex
+	inFlight := 0
+	maxInFlight := 0
+	tarballs := map[string][]byte{}
+	releaseRefs := []*ReleaseRef{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		tarball := tarballs[r.URL.Path]
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		http.ServeContent(w, r, "release.tgz", time.Time{}, bytes.NewReader(tarball))
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("release-%d", i)
+		tarball := fakeReleaseTarball(t, name)
+		tarballs["/"+name+".tgz"] = tarball
+		releaseRefs = append(releaseRefs, &ReleaseRef{
+			Name:    name,
+			Version: "1",
+			URL:     server.URL + "/" + name + ".tgz",
+			SHA1:    fmt.Sprintf("%x", sha1.Sum(tarball)),
+		})
+	}
+
+	cacheDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	downloader := newReleaseDownloader("/project/role-manifest.yml", ReleaseDownloadOptions{
+		CacheDir: cacheDir,
+		Workers:  2,
+	})
+	assert.NoError(downloader.downloadAll(releaseRefs))
+	assert.True(maxInFlight <= 2, "expected at most 2 concurrent downloads, got %d", maxInFlight)
+
+	for _, releaseRef := range releaseRefs {
+		assert.FileExists(filepath.Join(downloader.unpackedPath(releaseRef), "release.MF"))
+	}
+}
+
+func TestReleaseDownloaderRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	tarball := fakeReleaseTarball(t, "foo")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Drop the connection half way through the tarball
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(tarball)))
+			w.Write(tarball[:len(tarball)/2])
+			return
+		}
+		http.ServeContent(w, r, "foo.tgz", time.Time{}, bytes.NewReader(tarball))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	releaseRef := &ReleaseRef{
+		Name:    "foo",
+		Version: "1",
+		URL:     server.URL + "/foo.tgz",
+		SHA1:    fmt.Sprintf("%x", sha1.Sum(tarball)),
+	}
+
+	downloader := newReleaseDownloader("/project/role-manifest.yml", ReleaseDownloadOptions{
+		CacheDir:     cacheDir,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	})
+	assert.NoError(downloader.downloadAll([]*ReleaseRef{releaseRef}))
+	assert.Equal(2, requests)
+	assert.FileExists(filepath.Join(downloader.unpackedPath(releaseRef), "release.MF"))
+}
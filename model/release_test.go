@@ -399,3 +399,35 @@ func TestReleaseMarshal(t *testing.T) {
 		testhelpers.IsYAMLSubset(assert, expected, actual)
 	}
 }
+
+func TestReleaseRefValidateSHA1(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	tarballPath := filepath.Join(tempDir, "release.tgz")
+	assert.NoError(ioutil.WriteFile(tarballPath, []byte("release contents"), 0644))
+
+	releaseRef := &ReleaseRef{Name: "tor", SHA1: "63be689044b0038582e7ce09b70b4c13bf8bb2dd"}
+	assert.NoError(releaseRef.ValidateSHA1(tarballPath))
+
+	releaseRef.SHA1 = "sha256:2225ba0ddddc17ea832336525669c34be0bc44f34fc5c1faafbc9984f5882b9f"
+	assert.NoError(releaseRef.ValidateSHA1(tarballPath))
+
+	releaseRef.SHA1 = "0000000000000000000000000000000000000000"
+	err = releaseRef.ValidateSHA1(tarballPath)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Computed sha1 (63be689044b0038582e7ce09b70b4c13bf8bb2dd) is different than manifest sha1")
+	}
+
+	releaseRef.SHA1 = "sha256:0000"
+	err = releaseRef.ValidateSHA1(tarballPath)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Computed sha256")
+	}
+
+	releaseRef.SHA1 = ""
+	assert.NoError(releaseRef.ValidateSHA1(tarballPath))
+}
@@ -10,20 +10,21 @@ import (
 
 // RoleRun describes how a role should behave at runtime
 type RoleRun struct {
-	Scaling            *RoleRunScaling  `yaml:"scaling"`
-	Capabilities       []string         `yaml:"capabilities"`
-	PersistentVolumes  []*RoleRunVolume `yaml:"persistent-volumes"` // Backwards compat only
-	SharedVolumes      []*RoleRunVolume `yaml:"shared-volumes"`     // Backwards compat only
-	Volumes            []*RoleRunVolume `yaml:"volumes"`
-	MemRequest         *int64           `yaml:"memory"`
-	Memory             *RoleRunMemory   `yaml:"mem"`
-	VirtualCPUs        *float64         `yaml:"virtual-cpus"`
-	CPU                *RoleRunCPU      `yaml:"cpu"`
-	FlightStage        FlightStage      `yaml:"flight-stage"`
-	HealthCheck        *HealthCheck     `yaml:"healthcheck,omitempty"`
-	ActivePassiveProbe string           `yaml:"active-passive-probe,omitempty"`
-	ServiceAccount     string           `yaml:"service-account,omitempty"`
-	Affinity           *RoleRunAffinity `yaml:"affinity,omitempty"`
+	Scaling            *RoleRunScaling     `yaml:"scaling"`
+	Capabilities       []string            `yaml:"capabilities"`
+	PersistentVolumes  []*RoleRunVolume    `yaml:"persistent-volumes"` // Backwards compat only
+	SharedVolumes      []*RoleRunVolume    `yaml:"shared-volumes"`     // Backwards compat only
+	Volumes            []*RoleRunVolume    `yaml:"volumes"`
+	MemRequest         *int64              `yaml:"memory"`
+	Memory             *RoleRunMemory      `yaml:"mem"`
+	VirtualCPUs        *float64            `yaml:"virtual-cpus"`
+	CPU                *RoleRunCPU         `yaml:"cpu"`
+	FlightStage        FlightStage         `yaml:"flight-stage"`
+	HealthCheck        *HealthCheck        `yaml:"healthcheck,omitempty"`
+	ActivePassiveProbe string              `yaml:"active-passive-probe,omitempty"`
+	ServiceAccount     string              `yaml:"service-account,omitempty"`
+	Affinity           *RoleRunAffinity    `yaml:"affinity,omitempty"`
+	Autoscaling        *RoleRunAutoscaling `yaml:"autoscaling,omitempty"`
 }
 
 // RoleRunAffinity describes how a role should behave with regard to node / pod selection
@@ -33,6 +34,21 @@ type RoleRunAffinity struct {
 	NodeAffinity    interface{} `yaml:"nodeAffinity,omitempty"`
 }
 
+// RoleRunAutoscaling describes the targets for scaling a role automatically
+// between its minimum and maximum instance counts
+type RoleRunAutoscaling struct {
+	CPUUtilization    *int                  `yaml:"cpu-utilization,omitempty"`    // Target average CPU usage, in percent of the request
+	MemoryUtilization *int                  `yaml:"memory-utilization,omitempty"` // Target average memory usage, in percent of the request
+	Metrics           []RoleRunCustomMetric `yaml:"metrics,omitempty"`            // Targets for custom metrics
+}
+
+// RoleRunCustomMetric is a target for a custom metric describing the pods of
+// a role
+type RoleRunCustomMetric struct {
+	Name         string `yaml:"name"`          // Name of the metric
+	AverageValue string `yaml:"average-value"` // Target average value per pod, as a Kubernetes quantity
+}
+
 // RoleRunMemory describes how a role should behave with regard to memory usage.
 type RoleRunMemory struct {
 	Request *int64 `yaml:"request"`
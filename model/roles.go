@@ -3,17 +3,13 @@ package model
 import (
 	"fmt"
 	"io/ioutil"
-	"net/url"
-	"os"
 	"path/filepath"
-	"sync"
+	"regexp"
+	"sort"
 
 	"code.cloudfoundry.org/fissile/util"
 	"code.cloudfoundry.org/fissile/validation"
 	"github.com/hashicorp/go-multierror"
-	"github.com/mholt/archiver"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
 	"gopkg.in/yaml.v2"
 )
 
@@ -22,14 +18,25 @@ type RoleManifest struct {
 	InstanceGroups InstanceGroups `yaml:"instance_groups"`
 	Configuration  *Configuration `yaml:"configuration"`
 	Variables      Variables
-	Releases       []*ReleaseRef `yaml:"releases"`
+	Releases       []*ReleaseRef          `yaml:"releases"`
+	Validation     RoleManifestValidation `yaml:"validation"`
 
-	LoadedReleases   []*Release
+	LoadedReleases []*Release
+	// Warnings holds the problems found which don't fail the validation
+	Warnings         validation.ErrorList `yaml:"-"`
 	manifestFilePath string
+	source           *validation.YAMLSource
 
 	validationOptions RoleManifestValidationOptions
 }
 
+// RoleManifestValidation configures the validation of the role manifest
+type RoleManifestValidation struct {
+	// Suppressions silence rules for fields of the role manifest, or of
+	// the opinions
+	Suppressions []validation.Suppression `yaml:"suppressions"`
+}
+
 // RoleManifestValidationOptions allows tests to skip some parts of validation
 type RoleManifestValidationOptions struct {
 	AllowMissingScripts bool
@@ -43,6 +50,7 @@ type LoadRoleManifestOptions struct {
 	ReleaseNames      []string
 	ReleaseVersions   []string
 	BOSHCacheDir      string
+	ReleaseDownloads  ReleaseDownloadOptions
 	Grapher           util.ModelGrapher
 	ValidationOptions RoleManifestValidationOptions
 }
@@ -59,6 +67,11 @@ func LoadRoleManifest(manifestFilePath string, options LoadRoleManifestOptions)
 	if err := yaml.Unmarshal(manifestContents, &roleManifest); err != nil {
 		return nil, err
 	}
+	// The positions only locate validation errors, so manifests with YAML
+	// not accepted by the stricter parser are still loaded without them
+	if source, err := validation.NewYAMLSource(manifestFilePath, manifestContents); err == nil {
+		roleManifest.source = source
+	}
 
 	releases, err := LoadReleases(
 		options.ReleasePaths,
@@ -69,7 +82,7 @@ func LoadRoleManifest(manifestFilePath string, options LoadRoleManifestOptions)
 		return nil, err
 	}
 
-	embeddedReleases, err := roleManifest.loadReleaseReferences()
+	embeddedReleases, err := roleManifest.loadReleaseReferences(options.BOSHCacheDir, options.ReleaseDownloads)
 	if err != nil {
 		return nil, err
 	}
@@ -105,7 +118,7 @@ func LoadRoleManifest(manifestFilePath string, options LoadRoleManifestOptions)
 	return &roleManifest, nil
 }
 
-//LoadReleases loads information about BOSH releases
+// LoadReleases loads information about BOSH releases
 func LoadReleases(releasePaths, releaseNames, releaseVersions []string, cacheDir string) ([]*Release, error) {
 	releases := make([]*Release, len(releasePaths))
 	for idx, releasePath := range releasePaths {
@@ -155,92 +168,47 @@ func isFinalReleasePath(releasePath string) (bool, error) {
 
 // loadReleaseReferences downloads/builds and loads releases referenced in the
 // manifest
-func (m *RoleManifest) loadReleaseReferences() ([]*Release, error) {
+func (m *RoleManifest) loadReleaseReferences(boshCacheDir string, downloadOptions ReleaseDownloadOptions) ([]*Release, error) {
 	releases := []*Release{}
+	downloader := newReleaseDownloader(m.manifestFilePath, downloadOptions)
 
-	var allErrs error
-	var wg sync.WaitGroup
-	progress := mpb.New(mpb.WithWaitGroup(&wg))
+	if errs := validateReleaseReferences(m.Releases).WithRule(ruleReleases); len(errs) > 0 {
+		return nil, errs
+	}
 
-	// go through each referenced release
+	// local dev releases are loaded in place; everything else is a final
+	// release that we need to download
+	var allErrs error
+	finalReleaseRefs := []*ReleaseRef{}
 	for _, releaseRef := range m.Releases {
-		wg.Add(1)
-
-		go func(releaseRef *ReleaseRef) {
-			defer wg.Done()
-			_, err := url.ParseRequestURI(releaseRef.URL)
-			if err != nil {
-				// this is a local release that we need to build/load
-				// TODO: support this
-				allErrs = multierror.Append(allErrs, fmt.Errorf("Dev release %s is not supported as manifest references", releaseRef.Name))
-				return
-			}
-			// this is a final release that we need to download
-			manifestDir := filepath.Dir(m.manifestFilePath)
-			finalReleasesWorkDir := filepath.Join(manifestDir, ".final_releases")
-			finalReleaseTarballPath := filepath.Join(
-				finalReleasesWorkDir,
-				fmt.Sprintf("%s-%s-%s.tgz", releaseRef.Name, releaseRef.Version, releaseRef.SHA1))
-			finalReleaseUnpackedPath := filepath.Join(
-				finalReleasesWorkDir,
-				fmt.Sprintf("%s-%s-%s", releaseRef.Name, releaseRef.Version, releaseRef.SHA1))
-
-			if _, err := os.Stat(filepath.Join(finalReleaseUnpackedPath, "release.MF")); err != nil && os.IsNotExist(err) {
-				err = os.MkdirAll(finalReleaseUnpackedPath, 0700)
-				if err != nil {
-					allErrs = multierror.Append(allErrs, err)
-					return
-				}
-
-				// Show download progress
-				bar := progress.AddBar(
-					100,
-					mpb.BarRemoveOnComplete(),
-					mpb.PrependDecorators(
-						decor.Name(releaseRef.Name, decor.WCSyncSpaceR),
-						decor.Percentage(decor.WCSyncWidth),
-					))
-				lastPercentage := 0
-
-				// download the release in a directory next to the role manifest
-				err = util.DownloadFile(finalReleaseTarballPath, releaseRef.URL, func(percentage int) {
-					bar.IncrBy(percentage - lastPercentage)
-					lastPercentage = percentage
-				})
-				if err != nil {
-					allErrs = multierror.Append(allErrs, err)
-					return
-				}
-				defer func() {
-					os.Remove(finalReleaseTarballPath)
-				}()
-
-				// unpack
-				err = archiver.TarGz.Open(finalReleaseTarballPath, finalReleaseUnpackedPath)
-				if err != nil {
-					allErrs = multierror.Append(allErrs, err)
-					return
-				}
-			}
-		}(releaseRef)
+		if !releaseRef.IsDevRelease() {
+			finalReleaseRefs = append(finalReleaseRefs, releaseRef)
+		}
 	}
 
-	wg.Wait()
+	if err := downloader.downloadAll(finalReleaseRefs); err != nil {
+		return nil, multierror.Append(allErrs, err)
+	}
 
 	// Now that all releases have been downloaded and unpacked,
 	// add them to the collection
 	for _, releaseRef := range m.Releases {
-		manifestDir := filepath.Dir(m.manifestFilePath)
-		finalReleasesWorkDir := filepath.Join(manifestDir, ".final_releases")
-		finalReleaseUnpackedPath := filepath.Join(
-			finalReleasesWorkDir,
-			fmt.Sprintf("%s-%s-%s", releaseRef.Name, releaseRef.Version, releaseRef.SHA1))
+		var release *Release
+		var err error
 
 		// create a release object and add it to the collection
-		release, err := NewFinalRelease(finalReleaseUnpackedPath)
+		if releaseRef.IsDevRelease() {
+			release, err = NewDevRelease(m.devReleasePath(releaseRef), releaseRef.Name, releaseRef.Version, boshCacheDir)
+			if err != nil {
+				err = fmt.Errorf("Error loading dev release %s referenced in the role manifest: %s", releaseRef.Name, err.Error())
+			}
+		} else {
+			release, err = NewFinalRelease(downloader.unpackedPath(releaseRef))
+		}
 
 		if err != nil {
 			allErrs = multierror.Append(allErrs, err)
+			continue
 		}
 		releases = append(releases, release)
 	}
@@ -248,16 +216,29 @@ func (m *RoleManifest) loadReleaseReferences() ([]*Release, error) {
 	return releases, allErrs
 }
 
+// devReleasePath returns the location of a referenced dev release; relative
+// paths are resolved against the directory of the role manifest
+func (m *RoleManifest) devReleasePath(releaseRef *ReleaseRef) string {
+	if filepath.IsAbs(releaseRef.Path) {
+		return releaseRef.Path
+	}
+	return filepath.Join(filepath.Dir(m.manifestFilePath), releaseRef.Path)
+}
+
 // resolveRoleManifest takes a role manifest as loaded from disk, and validates
 // it to ensure it has no errors, and that the various ancillary structures are
 // correctly populated.
 func (m *RoleManifest) resolveRoleManifest(grapher util.ModelGrapher) error {
 	allErrs := validation.ErrorList{}
 
+	allErrs = append(allErrs, validateSuppressions(m).WithRule(ruleSuppressions)...)
+
 	// If template keys are not strings, we need to stop early to avoid panics
-	allErrs = append(allErrs, validateTemplateKeysAndValues(m)...)
-	if len(allErrs) != 0 {
-		return fmt.Errorf(allErrs.Errors())
+	allErrs = append(allErrs, validateTemplateKeysAndValues(m).WithRule(ruleTemplateKeys)...)
+	allErrs = allErrs.Suppress(m.Validation.Suppressions)
+	if allErrs.HasErrors() {
+		allErrs.Locate(m)
+		return allErrs
 	}
 
 	mappedReleases, err := m.mappedReleases()
@@ -294,11 +275,11 @@ func (m *RoleManifest) resolveRoleManifest(grapher util.ModelGrapher) error {
 		default:
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].type", instanceGroup.Name),
-				instanceGroup.Type, "Expected one of bosh, bosh-task, or colocated-container"))
+				instanceGroup.Type, "Expected one of bosh, bosh-task, or colocated-container").WithRule(ruleInstanceGroupType))
 		}
 
-		allErrs = append(allErrs, instanceGroup.calculateRoleRun()...)
-		allErrs = append(allErrs, validateRoleTags(instanceGroup)...)
+		allErrs = append(allErrs, instanceGroup.calculateRoleRun().WithRule(ruleInstanceGroupRun)...)
+		allErrs = append(allErrs, validateRoleTags(instanceGroup).WithRule(ruleInstanceGroupTags)...)
 		allErrs = append(allErrs, validateRoleRun(instanceGroup, m, declaredConfigs)...)
 
 		// Count how many instance groups use a particular
@@ -317,8 +298,10 @@ func (m *RoleManifest) resolveRoleManifest(grapher util.ModelGrapher) error {
 		}
 	}
 
-	if len(allErrs) != 0 {
-		return fmt.Errorf(allErrs.Errors())
+	allErrs = allErrs.Suppress(m.Validation.Suppressions)
+	if allErrs.HasErrors() {
+		allErrs.Locate(m)
+		return allErrs
 	}
 
 	for _, instanceGroup := range m.InstanceGroups {
@@ -338,29 +321,63 @@ func (m *RoleManifest) resolveRoleManifest(grapher util.ModelGrapher) error {
 
 	// Skip further validation if we fail to resolve any jobs
 	// This lets us assume valid jobs in the validation routines
-	if len(allErrs) == 0 {
-		allErrs = append(allErrs, m.resolveLinks()...)
-		allErrs = append(allErrs, validateVariableType(m.Variables)...)
-		allErrs = append(allErrs, validateVariableSorting(m.Variables)...)
-		allErrs = append(allErrs, validateVariablePreviousNames(m.Variables)...)
-		allErrs = append(allErrs, validateVariableUsage(m)...)
-		allErrs = append(allErrs, validateTemplateUsage(m, declaredConfigs)...)
-		allErrs = append(allErrs, validateServiceAccounts(m)...)
-		allErrs = append(allErrs, validateUnusedColocatedContainerRoles(m)...)
-		allErrs = append(allErrs, validateColocatedContainerPortCollisions(m)...)
-		allErrs = append(allErrs, validateColocatedContainerVolumeShares(m)...)
-		allErrs = append(allErrs, validateVariableDescriptions(m)...)
-		allErrs = append(allErrs, validateSortedTemplates(m)...)
-		allErrs = append(allErrs, validateScripts(m)...)
-	}
-
-	if len(allErrs) != 0 {
-		return fmt.Errorf(allErrs.Errors())
-	}
+	allErrs = allErrs.Suppress(m.Validation.Suppressions)
+	if !allErrs.HasErrors() {
+		allErrs = append(allErrs, m.resolveLinks().WithRule(ruleLinks)...)
+		allErrs = append(allErrs, validateVariableType(m.Variables).WithRule(ruleVariableType)...)
+		allErrs = append(allErrs, validateVariableSorting(m.Variables).WithRule(RuleVariableSorting)...)
+		allErrs = append(allErrs, validateVariablePreviousNames(m.Variables).WithRule(ruleVariablePreviousNames)...)
+		allErrs = append(allErrs, validateVariableUsage(m).WithRule(ruleVariableUsage)...)
+		allErrs = append(allErrs, validateTemplateUsage(m, declaredConfigs).WithRule(ruleTemplateUsage)...)
+		allErrs = append(allErrs, validateServiceAccounts(m).WithRule(ruleServiceAccounts)...)
+		allErrs = append(allErrs, validateUnusedColocatedContainerRoles(m).WithRule(ruleColocatedContainerUsage)...)
+		allErrs = append(allErrs, validateColocatedContainerPortCollisions(m).WithRule(ruleColocatedContainerPorts)...)
+		allErrs = append(allErrs, validateColocatedContainerVolumeShares(m).WithRule(ruleColocatedContainerVolumes)...)
+		allErrs = append(allErrs, validateVariableDescriptions(m).WithRule(ruleVariableDescriptions)...)
+		allErrs = append(allErrs, validateSortedTemplates(m).WithRule(RuleTemplateSorting)...)
+		allErrs = append(allErrs, validateScripts(m).WithRule(ruleScripts)...)
+	}
+
+	allErrs = allErrs.Suppress(m.Validation.Suppressions)
+	allErrs.Locate(m)
+	if allErrs.HasErrors() {
+		return allErrs
+	}
+	m.Warnings = allErrs
 
 	return m.resolvePodSecurityPolicies()
 }
 
+// instanceGroupFieldRegexp matches the fields of instance groups
+var instanceGroupFieldRegexp = regexp.MustCompile(`^instance[-_]groups?\[([^\]]*)\](\..*)$`)
+
+// Locate returns the position of a field of the role manifest in its file,
+// or nil if the role manifest was not loaded from a file. Fields of instance
+// groups not found in the instance group itself are looked up in the
+// containerization properties of its jobs, where the run properties and
+// colocated containers are given.
+func (m *RoleManifest) Locate(field string) *validation.Position {
+	if m.source == nil {
+		return nil
+	}
+
+	position, missing := m.source.Lookup(field)
+	if match := instanceGroupFieldRegexp.FindStringSubmatch(field); match != nil && missing > 0 {
+		if instanceGroup := m.LookupInstanceGroup(match[1]); instanceGroup != nil {
+			for _, jobReference := range instanceGroup.JobReferences {
+				jobField := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization%s",
+					instanceGroup.Name, jobReference.Name, match[2])
+				jobPosition, jobMissing := m.source.Lookup(jobField)
+				if jobPosition != nil && jobMissing < missing {
+					position, missing = jobPosition, jobMissing
+				}
+			}
+		}
+	}
+
+	return position
+}
+
 // resolvePodSecurityPolicies moves the PSP information found in
 // RoleManifest.InstanceGroup.JobReferences[].ContainerProperties.BoshContainerization.PodSecurityPolicy to
 // RoleManifest.Configuration.Authorization.Accounts[].PodSecurityPolicy
@@ -575,6 +592,28 @@ func (m *RoleManifest) resolveLinks() validation.ErrorList {
 	return errors
 }
 
+// LinkConsumers returns the sorted names of the instance groups with jobs
+// consuming links provided by the named instance group
+func (m *RoleManifest) LinkConsumers(providerName string) []string {
+	consumers := make(map[string]bool)
+	for _, instanceGroup := range m.InstanceGroups {
+		for _, jobReference := range instanceGroup.JobReferences {
+			for _, consumer := range jobReference.ResolvedConsumers {
+				if consumer.RoleName == providerName {
+					consumers[instanceGroup.Name] = true
+				}
+			}
+		}
+	}
+
+	var result []string
+	for name := range consumers {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
 // SelectInstanceGroups will find only the given instance groups in the role manifest
 func (m *RoleManifest) SelectInstanceGroups(roleNames []string) (InstanceGroups, error) {
 	if len(roleNames) == 0 {
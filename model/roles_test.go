@@ -3,11 +3,14 @@ package model
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"code.cloudfoundry.org/fissile/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
@@ -240,7 +243,7 @@ func TestNonBoshRolesAreNotAllowed(t *testing.T) {
 	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
 		ReleasePaths: []string{torReleasePath},
 		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache")})
-	assert.EqualError(t, err, "instance_groups[dockerrole].type: Invalid value: \"docker\": Expected one of bosh, bosh-task, or colocated-container")
+	assert.EqualError(t, err, roleManifestPath+":24:3: instance_groups[dockerrole].type: Invalid value: \"docker\": Expected one of bosh, bosh-task, or colocated-container")
 	assert.Nil(t, roleManifest)
 }
 
@@ -293,7 +296,7 @@ func TestLoadRoleManifestVariablesNotUsed(t *testing.T) {
 			AllowMissingScripts: true,
 		}})
 	assert.EqualError(t, err,
-		`variables: Not found: "No templates using 'SOME_VAR'"`)
+		roleManifestPath+`:11:1: variables: Not found: "No templates using 'SOME_VAR'"`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -310,7 +313,7 @@ func TestLoadRoleManifestVariablesNotDeclared(t *testing.T) {
 			AllowMissingScripts: true,
 		}})
 	assert.EqualError(t, err,
-		`variables: Not found: "No declaration of 'HOME'"`)
+		roleManifestPath+`:17:1: variables: Not found: "No declaration of 'HOME'"`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -382,7 +385,7 @@ func TestLoadRoleManifestBadCVType(t *testing.T) {
 		}})
 
 	require.EqualError(t, err,
-		`variables[BAR].options.type: Invalid value: "bogus": Expected one of user, or environment`)
+		roleManifestPath+`:40:5: variables[BAR].options.type: Invalid value: "bogus": Expected one of user, or environment`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -399,7 +402,7 @@ func TestLoadRoleManifestBadCVTypeConflictInternal(t *testing.T) {
 			AllowMissingScripts: true,
 		}})
 	assert.EqualError(t, err,
-		`variables[BAR].options.type: Invalid value: "environment": type conflicts with flag "internal"`)
+		roleManifestPath+`:18:5: variables[BAR].options.type: Invalid value: "environment": type conflicts with flag "internal"`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -412,8 +415,44 @@ func TestLoadRoleManifestMissingRBACAccount(t *testing.T) {
 	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
 		ReleasePaths: []string{torReleasePath},
 		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache")})
-	assert.EqualError(t, err, `instance_groups[myrole].run.service-account: Not found: "missing-account"`)
+	assert.EqualError(t, err, roleManifestPath+`:10:11: instance_groups[myrole].run.service-account: Not found: "missing-account"`)
 	assert.Nil(t, roleManifest)
+
+	// The errors are returned as they are, for reports
+	if assert.IsType(t, validation.ErrorList{}, err) {
+		errs := err.(validation.ErrorList)
+		assert.Equal(t, "service-accounts", errs[0].Rule)
+		assert.Equal(t, &validation.Position{File: roleManifestPath, Line: 10, Column: 11}, errs[0].Position)
+	}
+}
+
+func TestLoadRoleManifestValidationSeverities(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/model/validation-warnings.yml")
+	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
+		ReleasePaths: []string{torReleasePath},
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+		ValidationOptions: RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err, "Warnings don't fail the validation")
+	require.NotNil(t, roleManifest)
+
+	// The variable sorting warning is suppressed
+	assert.EqualError(t, roleManifest.Warnings,
+		"warning: properties.tor.private_key: Forbidden: Template key does not sort before 'properties.tor.hostname'")
+
+	roleManifest.Validation.Suppressions = []validation.Suppression{
+		{Rule: "template-sorting"},
+		{Rule: "instance-group-type", Reason: "The type is set later"},
+		{Rule: "undefined-dark-opinion", Reason: "Checked by the opinions validation"},
+	}
+	assert.EqualError(t, validateSuppressions(roleManifest),
+		"validation.suppressions[0].reason: Required value: Suppressions need a reason\n"+
+			"validation.suppressions[1].rule: Forbidden: Rule instance-group-type reports errors, only warnings and infos can be suppressed")
 }
 
 func TestLoadRoleManifestMissingRBACRole(t *testing.T) {
@@ -428,7 +467,7 @@ func TestLoadRoleManifestMissingRBACRole(t *testing.T) {
 		ValidationOptions: RoleManifestValidationOptions{
 			AllowMissingScripts: true,
 		}})
-	assert.EqualError(t, err, `configuration.auth.accounts[test-account].roles: Not found: "missing-role"`)
+	assert.EqualError(t, err, roleManifestPath+`:6:9: configuration.auth.accounts[test-account].roles: Not found: "missing-role"`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -553,7 +592,7 @@ func TestLoadRoleManifestRunGeneral(t *testing.T) {
 	tests := []testCase{
 		{
 			"rbac-illegal-psp.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.pod-security-policy: Invalid value: "bogus": Expected one of: nonprivileged, privileged`,
+				`11:9: instance_groups[myrole].jobs[tor].properties.bosh_containerization.pod-security-policy: Invalid value: "bogus": Expected one of: nonprivileged, privileged`,
 			},
 		},
 		{
@@ -561,61 +600,82 @@ func TestLoadRoleManifestRunGeneral(t *testing.T) {
 		},
 		{
 			"bosh-run-missing.yml", []string{
-				"instance_groups[myrole]: Required value: `properties.bosh_containerization.run` required for at least one Job",
+				"3:3: instance_groups[myrole]: Required value: `properties.bosh_containerization.run` required for at least one Job",
 			},
 		},
 		{
 			"bosh-run-bad-proto.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].protocol: Unsupported value: "AA": supported values: TCP, UDP`,
+				`11:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].protocol: Unsupported value: "AA": supported values: TCP, UDP`,
 			},
 		},
 		{
 			"bosh-run-bad-port-names.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[a--b].name: Invalid value: "a--b": port names must be lowercase words separated by hyphens`,
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[abcd-efgh-ijkl-x].name: Invalid value: "abcd-efgh-ijkl-x": port name must be no more than 15 characters`,
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[abcdefghij].name: Invalid value: "abcdefghij": user configurable port name must be no more than 9 characters`,
+				`10:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[a--b].name: Invalid value: "a--b": port names must be lowercase words separated by hyphens`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[abcd-efgh-ijkl-x].name: Invalid value: "abcd-efgh-ijkl-x": port name must be no more than 15 characters`,
+				`16:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[abcdefghij].name: Invalid value: "abcdefghij": user configurable port name must be no more than 9 characters`,
 			},
 		},
 		{
 			"bosh-run-bad-port-count.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].count: Invalid value: 2: count doesn't match port range 80-82`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].count: Invalid value: 2: count doesn't match port range 80-82`,
 			},
 		},
 		{
 			"bosh-run-bad-ports.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "-1": invalid syntax`,
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].external: Invalid value: 0: must be between 1 and 65535, inclusive`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "-1": invalid syntax`,
+				`12:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].external: Invalid value: 0: must be between 1 and 65535, inclusive`,
 			},
 		},
 		{
 			"bosh-run-missing-portrange.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "": invalid syntax`,
+				`12:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "": invalid syntax`,
 			},
 		},
 		{
 			"bosh-run-reverse-portrange.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "5678-123": last port can't be lower than first port`,
+				`12:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "5678-123": last port can't be lower than first port`,
 			},
 		},
 		{
 			"bosh-run-bad-parse.yml", []string{
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "qq": invalid syntax`,
-				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].external: Invalid value: "aa": invalid syntax`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "qq": invalid syntax`,
+				`12:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].external: Invalid value: "aa": invalid syntax`,
 			},
 		},
 		{
 			"bosh-run-bad-memory.yml", []string{
-				`instance_groups[myrole].run.memory: Invalid value: -10: must be greater than or equal to 0`,
+				`10:11: instance_groups[myrole].run.memory: Invalid value: -10: must be greater than or equal to 0`,
 			},
 		},
 		{
 			"bosh-run-bad-cpu.yml", []string{
-				`instance_groups[myrole].run.virtual-cpus: Invalid value: -2: must be greater than or equal to 0`,
+				`11:11: instance_groups[myrole].run.virtual-cpus: Invalid value: -2: must be greater than or equal to 0`,
+			},
+		},
+		{
+			"bosh-run-bad-ingress.yml", []string{
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].ingress: Invalid value: "UDP": ingress is only supported for TCP ports`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].ingress: Invalid value: false: ingress is only supported for public ports`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].ingress: Invalid value: 2: ingress is only supported for single ports`,
+				`13:11: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].ingress.hosts: Required value`,
+				`14:21: instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].ingress.paths[0]: Invalid value: "api": must be an absolute path`,
+			},
+		},
+		{
+			"bosh-run-bad-autoscaling.yml", []string{
+				`13:11: instance_groups[myrole].run.autoscaling: Invalid value: 3: Autoscaling needs scaling.max to be greater than scaling.min`,
+				`14:13: instance_groups[myrole].run.autoscaling.cpu-utilization: Invalid value: 0: must be a positive percentage`,
+				`9:9: instance_groups[myrole].run.cpu.request: Required value: Autoscaling by CPU utilization needs a CPU request`,
+				`9:9: instance_groups[myrole].run.mem.request: Required value: Autoscaling by memory utilization needs a memory request`,
+				`17:15: instance_groups[myrole].run.autoscaling.metrics[0].average-value: Required value`,
 			},
 		},
 		{
 			"bosh-run-ok.yml", []string{},
 		},
+		{
+			"bosh-run-autoscaling-ok.yml", []string{},
+		},
 	}
 
 	for _, tc := range tests {
@@ -631,7 +691,12 @@ func TestLoadRoleManifestRunGeneral(t *testing.T) {
 					}})
 
 				if len(tc.message) > 0 {
-					assert.EqualError(t, err, strings.Join(tc.message, "\n"))
+					// The messages start with the position in the role manifest
+					var messages []string
+					for _, message := range tc.message {
+						messages = append(messages, roleManifestPath+":"+message)
+					}
+					assert.EqualError(t, err, strings.Join(messages, "\n"))
 					assert.Nil(t, roleManifest)
 				} else {
 					assert.NoError(t, err)
@@ -1059,6 +1124,10 @@ func TestRoleResolveLinksMultipleProvider(t *testing.T) {
 			},
 		}, consumes["actual-consumer-name"], "resolved to incorrect provider for alias")
 	}
+
+	assert.Equal([]string{"role-1", "role-2", "role-3"}, roleManifest.LinkConsumers("role-1"))
+	assert.Equal([]string{"role-2", "role-3"}, roleManifest.LinkConsumers("role-2"))
+	assert.Empty(roleManifest.LinkConsumers("role-3"))
 }
 
 func TestLoadRoleManifestColocatedContainers(t *testing.T) {
@@ -1102,7 +1171,7 @@ func TestLoadRoleManifestColocatedContainersValidationMissingRole(t *testing.T)
 		ReleasePaths: []string{torReleasePath, ntpReleasePath},
 		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache")})
 	assert.Nil(roleManifest)
-	assert.EqualError(err, `instance_groups[main-role].colocated_containers[0]: Invalid value: "to-be-colocated-typo": There is no such instance group defined`)
+	assert.EqualError(err, roleManifestPath+`:11:11: instance_groups[main-role].colocated_containers[0]: Invalid value: "to-be-colocated-typo": There is no such instance group defined`)
 }
 
 func TestLoadRoleManifestColocatedContainersValidationUsusedRole(t *testing.T) {
@@ -1121,9 +1190,9 @@ func TestLoadRoleManifestColocatedContainersValidationUsusedRole(t *testing.T) {
 			AllowMissingScripts: true,
 		}})
 	assert.Nil(roleManifest)
-	assert.EqualError(err, "instance_group[to-be-colocated].job[ntpd].consumes[ntp-server]: Required value: failed to resolve provider ntp-server (type ntpd)\n"+
-		"instance_group[orphaned].job[ntpd].consumes[ntp-server]: Required value: failed to resolve provider ntp-server (type ntpd)\n"+
-		"instance_group[orphaned]: Not found: \"instance group is of type colocated container, but is not used by any other instance group as such\"")
+	assert.EqualError(err, roleManifestPath+":21:5: instance_group[to-be-colocated].job[ntpd].consumes[ntp-server]: Required value: failed to resolve provider ntp-server (type ntpd)\n"+
+		roleManifestPath+":31:5: instance_group[orphaned].job[ntpd].consumes[ntp-server]: Required value: failed to resolve provider ntp-server (type ntpd)\n"+
+		roleManifestPath+":28:3: instance_group[orphaned]: Not found: \"instance group is of type colocated container, but is not used by any other instance group as such\"")
 }
 
 func TestLoadRoleManifestColocatedContainersValidationPortCollisions(t *testing.T) {
@@ -1142,8 +1211,8 @@ func TestLoadRoleManifestColocatedContainersValidationPortCollisions(t *testing.
 			AllowMissingScripts: true,
 		}})
 	assert.Nil(roleManifest)
-	assert.EqualError(err, "instance_group[main-role]: Invalid value: \"TCP/10443\": port collision, the same protocol/port is used by: main-role, to-be-colocated"+"\n"+
-		"instance_group[main-role]: Invalid value: \"TCP/80\": port collision, the same protocol/port is used by: main-role, to-be-colocated")
+	assert.EqualError(err, roleManifestPath+":3:3: instance_group[main-role]: Invalid value: \"TCP/10443\": port collision, the same protocol/port is used by: main-role, to-be-colocated"+"\n"+
+		roleManifestPath+":3:3: instance_group[main-role]: Invalid value: \"TCP/80\": port collision, the same protocol/port is used by: main-role, to-be-colocated")
 }
 
 func TestLoadRoleManifestColocatedContainersValidationPortCollisionsWithProtocols(t *testing.T) {
@@ -1197,9 +1266,9 @@ func TestLoadRoleManifestColocatedContainersValidationOfSharedVolumes(t *testing
 			AllowMissingScripts: true,
 		}})
 	assert.Nil(roleManifest)
-	assert.EqualError(err, "instance_group[to-be-colocated]: Invalid value: \"/mnt/foobAr\": colocated instance group specifies a shared volume with tag mount-share, which path does not match the path of the main instance group shared volume with the same tag\n"+
-		"instance_group[main-role]: Required value: container must use shared volumes of the main instance group: vcap-logs\n"+
-		"instance_group[main-role]: Required value: container must use shared volumes of the main instance group: vcap-store")
+	assert.EqualError(err, roleManifestPath+":30:3: instance_group[to-be-colocated]: Invalid value: \"/mnt/foobAr\": colocated instance group specifies a shared volume with tag mount-share, which path does not match the path of the main instance group shared volume with the same tag\n"+
+		roleManifestPath+":3:3: instance_group[main-role]: Required value: container must use shared volumes of the main instance group: vcap-logs\n"+
+		roleManifestPath+":3:3: instance_group[main-role]: Required value: container must use shared volumes of the main instance group: vcap-store")
 }
 
 func TestLoadRoleManifestWithReleaseReferences(t *testing.T) {
@@ -1218,3 +1287,104 @@ func TestLoadRoleManifestWithReleaseReferences(t *testing.T) {
 	assert.Equal(t, roleManifestPath, roleManifest.manifestFilePath)
 	assert.Len(t, roleManifest.InstanceGroups, 1)
 }
+
+func TestLoadRoleManifestWithDevReleaseReferences(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/model/dev-release-references.yml")
+	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+		ValidationOptions: RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+
+	require.Len(t, roleManifest.LoadedReleases, 1)
+	release := roleManifest.LoadedReleases[0]
+	assert.Equal(t, "tor", release.Name)
+	assert.Equal(t, "0.3.5+dev.3", release.Version)
+	assert.False(t, release.FinalRelease)
+	assert.Equal(t, filepath.Join(workDir, "../test-assets/tor-boshrelease"), release.Path)
+	assert.Len(t, roleManifest.InstanceGroups, 1)
+	assert.Equal(t, release, roleManifest.InstanceGroups[0].JobReferences[0].Release)
+}
+
+func TestLoadRoleManifestWithReleaseReferenceMissingSource(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/model/release-references-missing-source.yml")
+	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+		ValidationOptions: RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Nil(t, roleManifest)
+	assert.Contains(t, err.Error(), "releases[tor]: Required value: Release must have either a url or a path")
+	assert.Len(t, err, 1, "The release must not be loaded after the error")
+}
+
+func TestLoadRoleManifestWithReleaseReferenceURLAndPath(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/model/release-references-url-and-path.yml")
+	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+		ValidationOptions: RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Nil(t, roleManifest)
+	assert.Contains(t, err.Error(), `releases[tor]: Invalid value: "../../tor-boshrelease": Release must have either a url or a path, not both`)
+	require.IsType(t, validation.ErrorList{}, err)
+	assert.Len(t, err, 1, "The release must not be downloaded after the error")
+	assert.Equal(t, "releases", err.(validation.ErrorList)[0].Rule)
+}
+
+func TestLoadRoleManifestWithReleaseReferenceBadSHA1(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not the release you are looking for"))
+	}))
+	defer server.Close()
+
+	manifestDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(manifestDir)
+
+	roleManifestPath := filepath.Join(manifestDir, "role-manifest.yml")
+	err = ioutil.WriteFile(roleManifestPath, []byte(fmt.Sprintf(`---
+releases:
+- name: tor
+  version: "0.3.5"
+  url: %s/tor.tgz
+  sha1: 4586760d3cb6efb45b64309568290a8b357bc2c5
+instance_groups:
+- name: myrole
+  jobs:
+  - name: tor
+    release: tor
+`, server.URL)), 0644)
+	require.NoError(t, err)
+
+	roleManifest, err := LoadRoleManifest(roleManifestPath, LoadRoleManifestOptions{
+		BOSHCacheDir: filepath.Join(workDir, "../test-assets/bosh-cache"),
+		ValidationOptions: RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Nil(t, roleManifest)
+	assert.Contains(t, err.Error(), "is different than manifest sha1 (4586760d3cb6efb45b64309568290a8b357bc2c5) for release tor")
+
+	unpackedPath := filepath.Join(manifestDir, ".final_releases", "sha1", "4586760d3cb6efb45b64309568290a8b357bc2c5")
+	_, err = os.Stat(unpackedPath)
+	assert.True(t, os.IsNotExist(err), "partial release directory should have been removed")
+	_, err = os.Stat(unpackedPath + ".tgz")
+	assert.True(t, os.IsNotExist(err), "release tarball should have been removed")
+}
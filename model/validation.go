@@ -13,6 +13,87 @@ import (
 	"code.cloudfoundry.org/fissile/validation"
 )
 
+// The rules checked by the validation of the role manifest, as reported and
+// suppressed by their IDs; see docs/validator-description.md
+var (
+	ruleTemplateKeys              = validation.Rule{ID: "template-keys", Severity: validation.SeverityError}
+	ruleInstanceGroupType         = validation.Rule{ID: "instance-group-type", Severity: validation.SeverityError}
+	ruleInstanceGroupRun          = validation.Rule{ID: "instance-group-run", Severity: validation.SeverityError}
+	ruleInstanceGroupTags         = validation.Rule{ID: "instance-group-tags", Severity: validation.SeverityError}
+	ruleFlightStage               = validation.Rule{ID: "flight-stage", Severity: validation.SeverityError}
+	ruleHealthCheck               = validation.Rule{ID: "health-check", Severity: validation.SeverityError}
+	ruleMemory                    = validation.Rule{ID: "memory", Severity: validation.SeverityError}
+	ruleCPU                       = validation.Rule{ID: "cpu", Severity: validation.SeverityError}
+	ruleAutoscaling               = validation.Rule{ID: "autoscaling", Severity: validation.SeverityError}
+	rulePorts                     = validation.Rule{ID: "ports", Severity: validation.SeverityError}
+	rulePodSecurityPolicy         = validation.Rule{ID: "pod-security-policy", Severity: validation.SeverityError}
+	ruleServiceAccounts           = validation.Rule{ID: "service-accounts", Severity: validation.SeverityError}
+	ruleVolumes                   = validation.Rule{ID: "volumes", Severity: validation.SeverityError}
+	ruleActivePassiveProbe        = validation.Rule{ID: "active-passive-probe", Severity: validation.SeverityError}
+	ruleJobReferences             = validation.Rule{ID: "job-references", Severity: validation.SeverityError}
+	ruleColocatedContainers       = validation.Rule{ID: "colocated-containers", Severity: validation.SeverityError}
+	ruleLinks                     = validation.Rule{ID: "links", Severity: validation.SeverityError}
+	ruleVariableType              = validation.Rule{ID: "variable-type", Severity: validation.SeverityError}
+	ruleVariableDuplicates        = validation.Rule{ID: "variable-duplicates", Severity: validation.SeverityError}
+	ruleVariablePreviousNames     = validation.Rule{ID: "variable-previous-names", Severity: validation.SeverityError}
+	ruleVariableUsage             = validation.Rule{ID: "variable-usage", Severity: validation.SeverityError}
+	ruleTemplateUsage             = validation.Rule{ID: "template-usage", Severity: validation.SeverityError}
+	ruleColocatedContainerUsage   = validation.Rule{ID: "colocated-container-usage", Severity: validation.SeverityError}
+	ruleColocatedContainerPorts   = validation.Rule{ID: "colocated-container-ports", Severity: validation.SeverityError}
+	ruleColocatedContainerVolumes = validation.Rule{ID: "colocated-container-volumes", Severity: validation.SeverityError}
+	ruleVariableDescriptions      = validation.Rule{ID: "variable-descriptions", Severity: validation.SeverityError}
+	ruleScripts                   = validation.Rule{ID: "scripts", Severity: validation.SeverityError}
+	ruleReleases                  = validation.Rule{ID: "releases", Severity: validation.SeverityError}
+	ruleSuppressions              = validation.RuleSuppressions
+)
+
+// The sorting rules, which fissile validate --fix knows to fix
+var (
+	RuleVariableSorting = validation.Rule{ID: "variable-sorting", Severity: validation.SeverityWarning}
+	RuleTemplateSorting = validation.Rule{ID: "template-sorting", Severity: validation.SeverityWarning}
+)
+
+// roleManifestRules are the rules checked by the validation of the role
+// manifest
+var roleManifestRules = []validation.Rule{
+	ruleTemplateKeys, ruleInstanceGroupType, ruleInstanceGroupRun,
+	ruleInstanceGroupTags, ruleFlightStage, ruleHealthCheck, ruleMemory,
+	ruleCPU, ruleAutoscaling, rulePorts, rulePodSecurityPolicy,
+	ruleServiceAccounts, ruleVolumes, ruleActivePassiveProbe,
+	ruleJobReferences, ruleColocatedContainers, ruleLinks, ruleVariableType,
+	RuleVariableSorting, ruleVariableDuplicates, ruleVariablePreviousNames,
+	ruleVariableUsage, ruleTemplateUsage, ruleColocatedContainerUsage,
+	ruleColocatedContainerPorts, ruleColocatedContainerVolumes,
+	ruleVariableDescriptions, RuleTemplateSorting, ruleScripts,
+	ruleReleases, ruleSuppressions,
+}
+
+// validateReleaseReferences tests whether each release referenced by the role
+// manifest is either a dev release at a path, or a final release at a url
+func validateReleaseReferences(releaseRefs []*ReleaseRef) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	for _, releaseRef := range releaseRefs {
+		field := fmt.Sprintf("releases[%s]", releaseRef.Name)
+		switch {
+		case releaseRef.URL != "" && releaseRef.Path != "":
+			allErrs = append(allErrs, validation.Invalid(field, releaseRef.Path,
+				"Release must have either a url or a path, not both"))
+		case releaseRef.URL == "" && releaseRef.Path == "":
+			allErrs = append(allErrs, validation.Required(field,
+				"Release must have either a url or a path"))
+		}
+	}
+	return allErrs
+}
+
+// validateSuppressions tests whether the suppressions of the role manifest
+// are complete, and only silence rules reporting warnings or infos
+func validateSuppressions(roleManifest *RoleManifest) validation.ErrorList {
+	field := "validation.suppressions"
+	allErrs := validation.ValidateSuppressions(roleManifest.Validation.Suppressions, field)
+	return append(allErrs, validation.ValidateSuppressedRules(roleManifest.Validation.Suppressions, field, roleManifestRules)...)
+}
+
 // validateVariableDescriptions tests whether all variables have descriptions
 func validateVariableDescriptions(roleManifest *RoleManifest) validation.ErrorList {
 	allErrs := validation.ErrorList{}
@@ -176,7 +257,7 @@ func validateVariableSorting(variables Variables) validation.ErrorList {
 				fmt.Sprintf("Does not sort before '%s'", cv.Name)))
 		} else if cv.Name == previousName {
 			allErrs = append(allErrs, validation.Invalid("variables",
-				previousName, "Appears more than once"))
+				previousName, "Appears more than once").WithRule(ruleVariableDuplicates))
 		}
 		previousName = cv.Name
 	}
@@ -419,15 +500,16 @@ func validateTemplateKeysAndValues(roleManifest *RoleManifest) validation.ErrorL
 func validateRoleRun(instanceGroup *InstanceGroup, roleManifest *RoleManifest, declared CVMap) validation.ErrorList {
 	allErrs := validation.ErrorList{}
 
-	allErrs = append(allErrs, normalizeFlightStage(*instanceGroup)...)
-	allErrs = append(allErrs, validateHealthCheck(*instanceGroup)...)
-	allErrs = append(allErrs, validateRoleMemory(*instanceGroup)...)
-	allErrs = append(allErrs, validateRoleCPU(*instanceGroup)...)
+	allErrs = append(allErrs, normalizeFlightStage(*instanceGroup).WithRule(ruleFlightStage)...)
+	allErrs = append(allErrs, validateHealthCheck(*instanceGroup).WithRule(ruleHealthCheck)...)
+	allErrs = append(allErrs, validateRoleMemory(*instanceGroup).WithRule(ruleMemory)...)
+	allErrs = append(allErrs, validateRoleCPU(*instanceGroup).WithRule(ruleCPU)...)
+	allErrs = append(allErrs, validateRoleAutoscaling(*instanceGroup).WithRule(ruleAutoscaling)...)
 
 	// TODO this validation does not belong to role run? is it safe to move it?
 	for _, job := range instanceGroup.JobReferences {
 		for idx := range job.ContainerProperties.BoshContainerization.Ports {
-			allErrs = append(allErrs, validateExposedPorts(instanceGroup.Name, job.Name, &job.ContainerProperties.BoshContainerization.Ports[idx])...)
+			allErrs = append(allErrs, validateExposedPorts(instanceGroup.Name, job.Name, &job.ContainerProperties.BoshContainerization.Ports[idx]).WithRule(rulePorts)...)
 		}
 
 		// Validate pod security policy, or default to least
@@ -439,7 +521,7 @@ func validateRoleRun(instanceGroup *InstanceGroup, roleManifest *RoleManifest, d
 				ref := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization.pod-security-policy",
 					instanceGroup.Name, job.Name)
 				allErrs = append(allErrs, validation.Invalid(
-					ref, job.ContainerProperties.BoshContainerization.PodSecurityPolicy, msg))
+					ref, job.ContainerProperties.BoshContainerization.PodSecurityPolicy, msg).WithRule(rulePodSecurityPolicy))
 			}
 		}
 	}
@@ -448,7 +530,7 @@ func validateRoleRun(instanceGroup *InstanceGroup, roleManifest *RoleManifest, d
 		accountName := instanceGroup.Run.ServiceAccount
 		if _, ok := roleManifest.Configuration.Authorization.Accounts[accountName]; !ok {
 			allErrs = append(allErrs, validation.NotFound(
-				fmt.Sprintf("instance_groups[%s].run.service-account", instanceGroup.Name), accountName))
+				fmt.Sprintf("instance_groups[%s].run.service-account", instanceGroup.Name), accountName).WithRule(ruleServiceAccounts))
 		}
 	} else {
 		// Make the default ("default" (sic!)) explicit.
@@ -466,7 +548,7 @@ func validateRoleRun(instanceGroup *InstanceGroup, roleManifest *RoleManifest, d
 			allErrs = append(allErrs, validation.Invalid(
 				fmt.Sprintf("instance_groups[%s].run.volumes[%s]", instanceGroup.Name, volume.Tag),
 				volume.Type,
-				fmt.Sprintf("Invalid volume type '%s'", volume.Type)))
+				fmt.Sprintf("Invalid volume type '%s'", volume.Type)).WithRule(ruleVolumes))
 		}
 	}
 
@@ -536,6 +618,10 @@ func validateExposedPorts(name, jobName string, exposedPorts *JobExposedPort) va
 				exposedPorts.Count, exposedPorts.Max)))
 	}
 
+	if exposedPorts.Ingress != nil {
+		allErrs = append(allErrs, validateExposedPortIngress(fieldName+".ingress", exposedPorts)...)
+	}
+
 	// Clear out legacy fields to make sure they aren't still be used elsewhere in the code
 	exposedPorts.Internal = ""
 	exposedPorts.External = ""
@@ -543,6 +629,37 @@ func validateExposedPorts(name, jobName string, exposedPorts *JobExposedPort) va
 	return allErrs
 }
 
+// validateExposedPortIngress validates the ingress of an exposed port, which
+// must be a single, public TCP port
+func validateExposedPortIngress(fieldName string, exposedPorts *JobExposedPort) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	if exposedPorts.Protocol != "TCP" {
+		allErrs = append(allErrs, validation.Invalid(fieldName, exposedPorts.Protocol,
+			"ingress is only supported for TCP ports"))
+	}
+	if !exposedPorts.Public {
+		allErrs = append(allErrs, validation.Invalid(fieldName, exposedPorts.Public,
+			"ingress is only supported for public ports"))
+	}
+	if exposedPorts.Max != 1 || exposedPorts.CountIsConfigurable {
+		allErrs = append(allErrs, validation.Invalid(fieldName, exposedPorts.Max,
+			"ingress is only supported for single ports"))
+	}
+
+	if len(exposedPorts.Ingress.Hosts) == 0 {
+		allErrs = append(allErrs, validation.Required(fieldName+".hosts", ""))
+	}
+	for index, path := range exposedPorts.Ingress.Paths {
+		if !strings.HasPrefix(path, "/") {
+			allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.paths[%d]", fieldName, index), path,
+				"must be an absolute path"))
+		}
+	}
+
+	return allErrs
+}
+
 // validateRoleMemory validates memory requests and limits, and
 // converts the old key (`memory`, run.MemRequest), to the new
 // form. Afterward only run.Memory is valid.
@@ -615,6 +732,73 @@ func validateRoleCPU(instanceGroup InstanceGroup) validation.ErrorList {
 	return allErrs
 }
 
+// validateRoleAutoscaling validates the autoscaling targets against the
+// scaling limits and resource requests. It must run after validateRoleMemory
+// and validateRoleCPU.
+func validateRoleAutoscaling(instanceGroup InstanceGroup) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	autoscaling := instanceGroup.Run.Autoscaling
+	if autoscaling == nil {
+		return allErrs
+	}
+
+	field := fmt.Sprintf("instance_groups[%s].run.autoscaling", instanceGroup.Name)
+
+	if instanceGroup.Type != RoleTypeBosh {
+		allErrs = append(allErrs, validation.Invalid(field, instanceGroup.Type,
+			"Only instance groups of type bosh can be autoscaled"))
+	}
+
+	scaling := instanceGroup.Run.Scaling
+	if scaling.Min == scaling.Max {
+		allErrs = append(allErrs, validation.Invalid(field, scaling.Max,
+			"Autoscaling needs scaling.max to be greater than scaling.min"))
+	}
+	if scaling.MustBeOdd {
+		allErrs = append(allErrs, validation.Invalid(field, scaling.MustBeOdd,
+			"Autoscaling cannot keep the instance count odd"))
+	}
+
+	if autoscaling.CPUUtilization == nil && autoscaling.MemoryUtilization == nil && len(autoscaling.Metrics) == 0 {
+		allErrs = append(allErrs, validation.Required(field,
+			"At least one of cpu-utilization, memory-utilization or metrics is required"))
+	}
+
+	if autoscaling.CPUUtilization != nil {
+		if *autoscaling.CPUUtilization < 1 {
+			allErrs = append(allErrs, validation.Invalid(field+".cpu-utilization", *autoscaling.CPUUtilization,
+				"must be a positive percentage"))
+		}
+		if instanceGroup.Run.CPU == nil || instanceGroup.Run.CPU.Request == nil {
+			allErrs = append(allErrs, validation.Required(fmt.Sprintf("instance_groups[%s].run.cpu.request", instanceGroup.Name),
+				"Autoscaling by CPU utilization needs a CPU request"))
+		}
+	}
+
+	if autoscaling.MemoryUtilization != nil {
+		if *autoscaling.MemoryUtilization < 1 {
+			allErrs = append(allErrs, validation.Invalid(field+".memory-utilization", *autoscaling.MemoryUtilization,
+				"must be a positive percentage"))
+		}
+		if instanceGroup.Run.Memory == nil || instanceGroup.Run.Memory.Request == nil {
+			allErrs = append(allErrs, validation.Required(fmt.Sprintf("instance_groups[%s].run.mem.request", instanceGroup.Name),
+				"Autoscaling by memory utilization needs a memory request"))
+		}
+	}
+
+	for index, metric := range autoscaling.Metrics {
+		if metric.Name == "" {
+			allErrs = append(allErrs, validation.Required(fmt.Sprintf("%s.metrics[%d].name", field, index), ""))
+		}
+		if metric.AverageValue == "" {
+			allErrs = append(allErrs, validation.Required(fmt.Sprintf("%s.metrics[%d].average-value", field, index), ""))
+		}
+	}
+
+	return allErrs
+}
+
 // validateHealthCheck reports a instance group with conflicting health checks
 // in its probes
 func validateHealthCheck(instanceGroup InstanceGroup) validation.ErrorList {
@@ -794,15 +978,17 @@ func validateRoleTags(instanceGroup *InstanceGroup) validation.ErrorList {
 	var allErrs validation.ErrorList
 
 	acceptableRoleTypes := map[RoleTag][]RoleType{
-		RoleTagActivePassive:     []RoleType{RoleTypeBosh},
-		RoleTagSequentialStartup: []RoleType{RoleTypeBosh},
-		RoleTagStopOnFailure:     []RoleType{RoleTypeBoshTask},
+		RoleTagActivePassive:      []RoleType{RoleTypeBosh},
+		RoleTagSequentialStartup:  []RoleType{RoleTypeBosh},
+		RoleTagStopOnFailure:      []RoleType{RoleTypeBoshTask},
+		RoleTagNoDisruptionBudget: []RoleType{RoleTypeBosh},
 	}
 
 	for tagNum, tag := range instanceGroup.Tags {
 		switch tag {
 		case RoleTagStopOnFailure:
 		case RoleTagSequentialStartup:
+		case RoleTagNoDisruptionBudget:
 		case RoleTagActivePassive:
 			if instanceGroup.Run == nil || instanceGroup.Run.ActivePassiveProbe == "" {
 				allErrs = append(allErrs, validation.Required(
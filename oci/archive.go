@@ -0,0 +1,364 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// dockerArchiveManifest is an entry of the manifest.json of an image archive
+// as written by `docker save`
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// archiveFile is a file extracted from an image archive
+type archiveFile struct {
+	path       string
+	descriptor Descriptor
+}
+
+// Import adds the image found at source to the layout, under the given name.
+// The source is either an image archive written by `docker save` (possibly
+// gzipped), or an OCI image layout directory holding a single image.
+func (l *Layout) Import(source, name string) (*Image, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("Error importing image %s: %s", source, err.Error())
+	}
+
+	if info.IsDir() {
+		err = l.importLayout(source, name)
+	} else {
+		err = l.importDockerArchive(source, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error importing image %s: %s", source, err.Error())
+	}
+
+	return l.Image(name)
+}
+
+// importLayout copies the single image of another OCI image layout, picking
+// the one for the current architecture from multi-platform images
+func (l *Layout) importLayout(dir, name string) error {
+	source := &Layout{dir: dir}
+
+	index, err := source.readIndex()
+	if err != nil {
+		return err
+	}
+
+	manifests := index.Manifests
+	for {
+		descriptor, err := pickManifest(manifests)
+		if err != nil {
+			return err
+		}
+
+		if descriptor.MediaType != MediaTypeImageIndex {
+			return l.copyImage(source, descriptor, name)
+		}
+
+		var nested Index
+		if err := source.readJSONBlob(descriptor.Digest, &nested); err != nil {
+			return err
+		}
+		manifests = nested.Manifests
+	}
+}
+
+// pickManifest returns the only manifest, or the one for the current platform
+func pickManifest(manifests []Descriptor) (Descriptor, error) {
+	if len(manifests) == 1 {
+		return manifests[0], nil
+	}
+
+	for _, manifest := range manifests {
+		if manifest.Platform != nil && manifest.Platform.OS == "linux" && manifest.Platform.Architecture == runtime.GOARCH {
+			return manifest, nil
+		}
+	}
+
+	return Descriptor{}, fmt.Errorf("Expected exactly one image, found %d", len(manifests))
+}
+
+// copyImage copies the blobs of an image from another layout, and tags it
+func (l *Layout) copyImage(source *Layout, descriptor Descriptor, name string) error {
+	var manifest Manifest
+	if err := source.readJSONBlob(descriptor.Digest, &manifest); err != nil {
+		return err
+	}
+
+	blobs := append([]Descriptor{descriptor, manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if err := l.copyBlob(source.BlobPath(blob.Digest), blob.Digest); err != nil {
+			return err
+		}
+	}
+
+	var config ImageConfig
+	if err := l.readJSONBlob(manifest.Config.Digest, &config); err != nil {
+		return err
+	}
+	descriptor.Annotations = nil
+	descriptor.Platform = &Platform{Architecture: config.Architecture, OS: config.OS}
+
+	return l.tag(name, descriptor)
+}
+
+// copyBlob copies a file into the layout as a blob, verifying its digest
+func (l *Layout) copyBlob(sourcePath, digest string) error {
+	if _, err := os.Stat(l.BlobPath(digest)); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	descriptor, err := l.writeBlob(file, "")
+	if err != nil {
+		return err
+	}
+	if descriptor.Digest != digest {
+		os.Remove(l.BlobPath(descriptor.Digest))
+		return fmt.Errorf("Digest mismatch for %s: expected %s, got %s", sourcePath, digest, descriptor.Digest)
+	}
+
+	return nil
+}
+
+// importDockerArchive converts an image archive written by `docker save`
+func (l *Layout) importDockerArchive(archivePath, name string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stream, err := decompress(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+
+	// The manifest comes last in the archive, so keep every file until the
+	// end; the layers are moved into place as blobs afterwards
+	tempDir, err := ioutil.TempDir(filepath.Join(l.dir, "blobs"), "import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]archiveFile{}
+
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		tempFile, err := ioutil.TempFile(tempDir, "file-")
+		if err != nil {
+			return err
+		}
+		descriptor, err := copyDigested(tempFile, tarReader)
+		if closeErr := tempFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		files[path.Clean(header.Name)] = archiveFile{path: tempFile.Name(), descriptor: descriptor}
+	}
+
+	manifestFile, ok := files["manifest.json"]
+	if !ok {
+		return fmt.Errorf("No manifest.json found; not an image archive")
+	}
+	var manifests []dockerArchiveManifest
+	if err := readJSONFile(manifestFile.path, &manifests); err != nil {
+		return err
+	}
+	if len(manifests) != 1 {
+		return fmt.Errorf("Expected exactly one image in the archive, found %d", len(manifests))
+	}
+
+	configFile, ok := files[path.Clean(manifests[0].Config)]
+	if !ok {
+		return fmt.Errorf("Config %s not found in the archive", manifests[0].Config)
+	}
+	var config ImageConfig
+	if err := readJSONFile(configFile.path, &config); err != nil {
+		return err
+	}
+
+	var layers []Descriptor
+	for _, layerName := range manifests[0].Layers {
+		layer, ok := files[path.Clean(layerName)]
+		if !ok {
+			return fmt.Errorf("Layer %s not found in the archive", layerName)
+		}
+		if err := l.moveBlob(layer.path, layer.descriptor.Digest); err != nil {
+			return err
+		}
+		layers = append(layers, layer.descriptor)
+	}
+
+	// Keep the config as it is, so the image ID stays the same
+	if err := l.moveBlob(configFile.path, configFile.descriptor.Digest); err != nil {
+		return err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		Config: Descriptor{
+			MediaType: MediaTypeImageConfig,
+			Digest:    configFile.descriptor.Digest,
+			Size:      configFile.descriptor.Size,
+		},
+		Layers: layers,
+	}
+	manifestDescriptor, err := l.writeJSONBlob(manifest, MediaTypeImageManifest)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor.Platform = &Platform{Architecture: config.Architecture, OS: config.OS}
+
+	return l.tag(name, manifestDescriptor)
+}
+
+// copyDigested copies reader to writer, returning the digest and size of the
+// contents, and whether they are a gzipped or plain layer
+func copyDigested(writer io.Writer, reader io.Reader) (Descriptor, error) {
+	digester := newDigester()
+	bufferedReader := bufio.NewReader(reader)
+
+	mediaType := MediaTypeImageLayer
+	if isGzip(bufferedReader) {
+		mediaType = MediaTypeImageLayerGzip
+	}
+
+	size, err := io.Copy(io.MultiWriter(writer, digester), bufferedReader)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	return Descriptor{MediaType: mediaType, Digest: digester.digest(), Size: size}, nil
+}
+
+// WriteDockerArchive writes the image with the given name as an image archive
+// that `docker load` understands, tagged with the name
+func (l *Layout) WriteDockerArchive(name, archivePath string) error {
+	image, err := l.Image(name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+
+	configName := strings.TrimPrefix(image.ID(), "sha256:") + ".json"
+	if err := l.addBlobToTar(tarWriter, image.ID(), configName); err != nil {
+		return err
+	}
+
+	manifest := dockerArchiveManifest{
+		Config:   configName,
+		RepoTags: []string{name},
+	}
+	for _, layer := range image.Manifest.Layers {
+		layerName := strings.TrimPrefix(layer.Digest, "sha256:") + "/layer.tar"
+		if err := l.addBlobToTar(tarWriter, layer.Digest, layerName); err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, layerName)
+	}
+
+	contents, err := json.Marshal([]dockerArchiveManifest{manifest})
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:     "manifest.json",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(contents)),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(contents); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// addBlobToTar copies a blob into an image archive
+func (l *Layout) addBlobToTar(tarWriter *tar.Writer, digest, name string) error {
+	blob, err := os.Open(l.BlobPath(digest))
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	info, err := blob.Stat()
+	if err != nil {
+		return err
+	}
+
+	if dir := path.Dir(name); dir != "." {
+		header := &tar.Header{
+			Name:     dir + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+			ModTime:  info.ModTime(),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+	}
+
+	header := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tarWriter, blob)
+	return err
+}
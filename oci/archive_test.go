@@ -0,0 +1,146 @@
+package oci
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportDockerArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := OpenLayout(filepath.Join(tempDir, "layout"))
+	require.NoError(t, err)
+
+	stemcellPath := filepath.Join(tempDir, "stemcell.tar")
+	writeStemcellArchive(t, stemcellPath)
+
+	image, err := layout.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+
+	// The config is kept as is, so the image ID matches docker's
+	config, err := ioutil.ReadFile(layout.BlobPath(image.ID()))
+	require.NoError(t, err)
+	configDigester := newDigester()
+	configDigester.Write(config)
+	assert.Equal(configDigester.digest(), image.ID())
+
+	require.Len(t, image.Manifest.Layers, 1)
+	assert.Equal(MediaTypeImageLayer, image.Manifest.Layers[0].MediaType)
+	assert.Equal(image.Config.RootFS.DiffIDs[0], image.Manifest.Layers[0].Digest)
+	assert.Equal([]string{"/bin/bash"}, image.Config.Config.Cmd)
+
+	// Importing again reuses the blobs
+	again, err := layout.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+	assert.Equal(image.Descriptor.Digest, again.Descriptor.Digest)
+
+	// Anything else is refused
+	_, err = layout.Import(filepath.Join(tempDir, "missing.tar"), "missing:latest")
+	assert.Error(err)
+
+	bogusPath := filepath.Join(tempDir, "bogus.tar")
+	require.NoError(t, ioutil.WriteFile(bogusPath, tarContents(t, tarEntry{name: "file", typeflag: tar.TypeReg}), 0644))
+	_, err = layout.Import(bogusPath, "bogus:latest")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "not an image archive")
+	}
+}
+
+func TestImportLayout(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	source, err := OpenLayout(filepath.Join(tempDir, "source"))
+	require.NoError(t, err)
+	stemcellPath := filepath.Join(tempDir, "stemcell.tar")
+	writeStemcellArchive(t, stemcellPath)
+	original, err := source.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+
+	layout, err := OpenLayout(filepath.Join(tempDir, "layout"))
+	require.NoError(t, err)
+	image, err := layout.Import(source.Dir(), "stemcell:1.0")
+	require.NoError(t, err)
+
+	assert.Equal(original.Descriptor.Digest, image.Descriptor.Digest)
+	assert.Equal(original.ID(), image.ID())
+	assert.Equal("stemcell:1.0", image.Name)
+	_, err = os.Stat(layout.BlobPath(image.Manifest.Layers[0].Digest))
+	assert.NoError(err)
+}
+
+func TestWriteDockerArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := OpenLayout(filepath.Join(tempDir, "layout"))
+	require.NoError(t, err)
+
+	stemcellPath := filepath.Join(tempDir, "stemcell.tar")
+	writeStemcellArchive(t, stemcellPath)
+	_, err = layout.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+
+	image, err := layout.Build("role:1.0", func(tarWriter *tar.Writer) error {
+		writeTarEntry(t, tarWriter, tarEntry{name: "Dockerfile", typeflag: tar.TypeReg, content: "FROM stemcell:latest\nADD root /\n"})
+		writeTarEntry(t, tarWriter, tarEntry{name: "root/run.sh", typeflag: tar.TypeReg, content: "run"})
+		return nil
+	})
+	require.NoError(t, err)
+
+	archivePath := filepath.Join(tempDir, "role.tar")
+	require.NoError(t, layout.WriteDockerArchive("role:1.0", archivePath))
+
+	file, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var manifests []dockerArchiveManifest
+	names := []string{}
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		if header.Name == "manifest.json" {
+			require.NoError(t, json.NewDecoder(tarReader).Decode(&manifests))
+		}
+	}
+
+	require.Len(t, manifests, 1)
+	assert.Equal([]string{"role:1.0"}, manifests[0].RepoTags)
+	assert.Len(manifests[0].Layers, 2)
+	assert.Contains(names, manifests[0].Config)
+	for _, layer := range manifests[0].Layers {
+		assert.Contains(names, layer)
+	}
+
+	// The archive can be imported again, to the same image
+	other, err := OpenLayout(filepath.Join(tempDir, "other"))
+	require.NoError(t, err)
+	imported, err := other.Import(archivePath, "role:1.0")
+	require.NoError(t, err)
+	assert.Equal(image.ID(), imported.ID())
+	assert.Equal(image.Manifest.Layers, imported.Manifest.Layers)
+}
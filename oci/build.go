@@ -0,0 +1,440 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// instruction is a single instruction of a Dockerfile
+type instruction struct {
+	command string
+	args    string
+}
+
+// String returns the instruction as it appears in the image history
+func (i instruction) String() string {
+	return fmt.Sprintf("%s %s", i.command, i.args)
+}
+
+// Build creates an image from the docker build context written by populator,
+// and stores it in the layout under the given name. The context is the same
+// fissile would send to the docker daemon, so only the Dockerfile
+// instructions fissile uses are supported: FROM, ADD from the context, LABEL,
+// ENTRYPOINT and MAINTAINER. The base image named by FROM must be in the
+// layout already. Every ADD instruction adds a layer to the image.
+func (l *Layout) Build(name string, populator func(*tar.Writer) error) (*Image, error) {
+	contextFile, err := l.tempFile("context-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(contextFile.Name())
+	defer contextFile.Close()
+
+	tarWriter := tar.NewWriter(contextFile)
+	if err := populator(tarWriter); err != nil {
+		return nil, fmt.Errorf("Error creating build context for %s: %s", name, err.Error())
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	instructions, err := readDockerfile(contextFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Dockerfile for %s: %s", name, err.Error())
+	}
+	if len(instructions) == 0 || instructions[0].command != "FROM" {
+		return nil, fmt.Errorf("Dockerfile for %s does not start with FROM", name)
+	}
+
+	base, err := l.Image(strings.TrimSpace(instructions[0].args))
+	if err != nil {
+		return nil, fmt.Errorf("Error finding base image of %s: %s", name, err.Error())
+	}
+
+	config := base.Config
+	layers := append([]Descriptor{}, base.Manifest.Layers...)
+	config.RootFS.DiffIDs = append([]string{}, config.RootFS.DiffIDs...)
+	config.History = append([]History{}, config.History...)
+	config.Config.Labels = copyLabels(config.Config.Labels)
+	if config.RootFS.Type == "" {
+		config.RootFS.Type = "layers"
+	}
+	if config.OS == "" {
+		config.OS = "linux"
+	}
+	if config.Architecture == "" {
+		config.Architecture = runtime.GOARCH
+	}
+
+	// Only keep history when it matches the layers, as it would be wrong
+	// otherwise
+	keepHistory := len(config.History) > 0 || len(layers) == 0
+
+	created := time.Now().UTC()
+	config.Created = &created
+
+	for _, step := range instructions[1:] {
+		emptyLayer := true
+
+		switch step.command {
+		case "ADD", "COPY":
+			source, destination, err := parseAddArgs(step.args)
+			if err != nil {
+				return nil, fmt.Errorf("Error in Dockerfile for %s: %s: %s", name, step, err.Error())
+			}
+			layer, diffID, err := l.writeLayer(contextFile, source, destination)
+			if err != nil {
+				return nil, fmt.Errorf("Error creating layer for %s: %s: %s", name, step, err.Error())
+			}
+			layers = append(layers, layer)
+			config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+			emptyLayer = false
+		case "LABEL":
+			labels, err := parseLabels(step.args)
+			if err != nil {
+				return nil, fmt.Errorf("Error in Dockerfile for %s: %s: %s", name, step, err.Error())
+			}
+			for key, value := range labels {
+				config.Config.Labels[key] = value
+			}
+		case "ENTRYPOINT":
+			var entrypoint []string
+			if err := json.Unmarshal([]byte(step.args), &entrypoint); err != nil {
+				return nil, fmt.Errorf("Error in Dockerfile for %s: %s: only the JSON form is supported", name, step)
+			}
+			config.Config.Entrypoint = entrypoint
+			// As with docker, a new entrypoint drops the command of the base
+			config.Config.Cmd = nil
+		case "MAINTAINER":
+			config.Author = strings.TrimSpace(step.args)
+		default:
+			return nil, fmt.Errorf("Error in Dockerfile for %s: %s is not supported without docker", name, step.command)
+		}
+
+		if keepHistory {
+			config.History = append(config.History, History{
+				Created:    &created,
+				CreatedBy:  step.String(),
+				EmptyLayer: emptyLayer,
+			})
+		}
+	}
+	if !keepHistory {
+		config.History = nil
+	}
+
+	return l.writeImage(name, config, layers)
+}
+
+// readDockerfile returns the instructions of the Dockerfile in the build
+// context
+func readDockerfile(contextFile *os.File) ([]instruction, error) {
+	if _, err := contextFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tarReader := tar.NewReader(contextFile)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No Dockerfile in the build context")
+		} else if err != nil {
+			return nil, err
+		}
+		if path.Clean(header.Name) == "Dockerfile" {
+			return parseDockerfile(tarReader)
+		}
+	}
+}
+
+// parseDockerfile splits a Dockerfile into instructions, joining continued
+// lines and dropping comments
+func parseDockerfile(reader io.Reader) ([]instruction, error) {
+	var instructions []instruction
+	var current string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if current == "" && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		current += line
+
+		parts := strings.SplitN(current, " ", 2)
+		step := instruction{command: strings.ToUpper(parts[0])}
+		if len(parts) == 2 {
+			step.args = strings.TrimSpace(parts[1])
+		}
+		instructions = append(instructions, step)
+		current = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return instructions, nil
+}
+
+// parseAddArgs returns the source and destination of an ADD instruction
+func parseAddArgs(args string) (string, string, error) {
+	var parts []string
+	if strings.HasPrefix(args, "[") {
+		if err := json.Unmarshal([]byte(args), &parts); err != nil {
+			return "", "", err
+		}
+	} else {
+		parts = strings.Fields(args)
+	}
+
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("expected exactly one source and one destination")
+	}
+	if strings.Contains(parts[0], "://") {
+		return "", "", fmt.Errorf("remote sources are not supported")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// parseLabels returns the labels of a LABEL instruction, i.e. a list of
+// key=value pairs where both sides may be double quoted
+func parseLabels(args string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	rest := strings.TrimSpace(args)
+	for rest != "" {
+		key, remainder, err := parseLabelWord(rest, "= \t")
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(remainder, "=") {
+			return nil, fmt.Errorf("expected key=value pairs")
+		}
+
+		value, remainder, err := parseLabelWord(remainder[1:], " \t")
+		if err != nil {
+			return nil, err
+		}
+
+		labels[key] = value
+		rest = strings.TrimSpace(remainder)
+	}
+
+	return labels, nil
+}
+
+// parseLabelWord returns the (possibly quoted) word at the start of text, and
+// what follows it. Unquoted words end at any of the given terminators.
+func parseLabelWord(text, terminators string) (string, string, error) {
+	if !strings.HasPrefix(text, `"`) {
+		end := strings.IndexAny(text, terminators)
+		if end < 0 {
+			return text, "", nil
+		}
+		return text[:end], text[end:], nil
+	}
+
+	var word strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				word.WriteByte(text[i])
+			}
+		case '"':
+			return word.String(), text[i+1:], nil
+		default:
+			word.WriteByte(text[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quote in %s", text)
+}
+
+// writeLayer creates a gzipped layer holding the files below source in the
+// build context, placed at destination as ADD would. It returns the layer and
+// its diff ID, the digest of the uncompressed layer.
+func (l *Layout) writeLayer(contextFile *os.File, source, destination string) (Descriptor, string, error) {
+	if _, err := contextFile.Seek(0, io.SeekStart); err != nil {
+		return Descriptor{}, "", err
+	}
+
+	layerFile, err := l.tempFile("layer-")
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	defer os.Remove(layerFile.Name())
+	defer layerFile.Close()
+
+	layerDigester := newDigester()
+	counter := &countingWriter{}
+	gzipWriter := gzip.NewWriter(io.MultiWriter(layerFile, layerDigester, counter))
+	diffIDDigester := newDigester()
+	layerWriter := tar.NewWriter(io.MultiWriter(gzipWriter, diffIDDigester))
+
+	toDirectory := strings.HasSuffix(destination, "/")
+	source = strings.Trim(path.Clean("/"+source), "/")
+	destination = path.Clean("/" + destination)
+
+	written := map[string]bool{}
+	found := false
+
+	tarReader := tar.NewReader(contextFile)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Descriptor{}, "", err
+		}
+
+		target, ok := addTarget(path.Clean(header.Name), source, destination, toDirectory, header.Typeflag == tar.TypeDir)
+		if !ok {
+			continue
+		}
+		found = true
+
+		if target == "" {
+			// The destination is the root directory
+			continue
+		}
+
+		if err := writeParentDirs(layerWriter, target, written, header.ModTime); err != nil {
+			return Descriptor{}, "", err
+		}
+
+		// Files added by docker belong to root
+		header.Name = target
+		header.Uid = 0
+		header.Gid = 0
+		header.Uname = ""
+		header.Gname = ""
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+			written[target] = true
+		}
+		if header.Typeflag == tar.TypeLink {
+			linkTarget, ok := addTarget(path.Clean(header.Linkname), source, destination, toDirectory, false)
+			if !ok {
+				return Descriptor{}, "", fmt.Errorf("%s links outside of %s", header.Name, source)
+			}
+			header.Linkname = linkTarget
+		}
+
+		if err := layerWriter.WriteHeader(header); err != nil {
+			return Descriptor{}, "", err
+		}
+		if _, err := io.Copy(layerWriter, tarReader); err != nil {
+			return Descriptor{}, "", err
+		}
+	}
+
+	if !found {
+		return Descriptor{}, "", fmt.Errorf("%s not found in the build context", source)
+	}
+
+	if err := layerWriter.Close(); err != nil {
+		return Descriptor{}, "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return Descriptor{}, "", err
+	}
+	if err := layerFile.Close(); err != nil {
+		return Descriptor{}, "", err
+	}
+
+	layer := Descriptor{
+		MediaType: MediaTypeImageLayerGzip,
+		Digest:    layerDigester.digest(),
+		Size:      counter.count,
+	}
+	if err := l.moveBlob(layerFile.Name(), layer.Digest); err != nil {
+		return Descriptor{}, "", err
+	}
+
+	return layer, diffIDDigester.digest(), nil
+}
+
+// addTarget returns where the build context entry name ends up in the image
+// when ADDing source to destination, without leading slash, or false if the
+// entry is not part of source
+func addTarget(name, source, destination string, toDirectory, isDir bool) (string, bool) {
+	name = strings.Trim(name, "/")
+
+	var relPath string
+	switch {
+	case name == source && !isDir:
+		// A single file goes into the destination directory, or replaces
+		// the destination
+		if toDirectory {
+			relPath = path.Base(source)
+		}
+	case name == source || source == "" || source == ".":
+		relPath = name
+		if name == source {
+			relPath = ""
+		}
+	case strings.HasPrefix(name, source+"/"):
+		relPath = strings.TrimPrefix(name, source+"/")
+	default:
+		return "", false
+	}
+
+	return strings.TrimPrefix(path.Join(destination, relPath), "/"), true
+}
+
+// writeParentDirs adds the directories leading to target to the layer, unless
+// they were added already
+func writeParentDirs(writer *tar.Writer, target string, written map[string]bool, modTime time.Time) error {
+	dir := path.Dir(target)
+	if dir == "." || dir == "/" || written[dir] {
+		return nil
+	}
+
+	if err := writeParentDirs(writer, dir, written, modTime); err != nil {
+		return err
+	}
+
+	written[dir] = true
+	return writer.WriteHeader(&tar.Header{
+		Name:     dir + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range labels {
+		result[key] = value
+	}
+	return result
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	count int64
+}
+
+// Write implements io.Writer for countingWriter
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
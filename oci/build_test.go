@@ -0,0 +1,176 @@
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layerEntries returns the headers of the entries of a gzipped layer, by name,
+// checking the layer matches its diff ID
+func layerEntries(t *testing.T, layout *Layout, layer Descriptor, diffID string) map[string]*tar.Header {
+	file, err := os.Open(layout.BlobPath(layer.Digest))
+	require.NoError(t, err)
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	diffIDDigester := newDigester()
+	tarReader := tar.NewReader(io.TeeReader(gzipReader, diffIDDigester))
+
+	entries := map[string]*tar.Header{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		entries[header.Name] = header
+	}
+	_, err = io.Copy(ioutil.Discard, gzipReader)
+	require.NoError(t, err)
+	assert.Equal(t, diffID, diffIDDigester.digest())
+
+	return entries
+}
+
+func TestLayoutBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := OpenLayout(filepath.Join(tempDir, "layout"))
+	require.NoError(t, err)
+
+	stemcellPath := filepath.Join(tempDir, "stemcell.tar")
+	writeStemcellArchive(t, stemcellPath)
+	stemcell, err := layout.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+
+	image, err := layout.Build("role:1.0", func(tarWriter *tar.Writer) error {
+		writeTarEntry(t, tarWriter, tarEntry{name: "Dockerfile", typeflag: tar.TypeReg, content: `
+FROM stemcell:latest
+
+# Comments are skipped
+MAINTAINER cloudfoundry@suse.example
+LABEL "instance_group"="role" version.generator.fissile=1.2.3
+LABEL  "fingerprint.abc"="ruby"  "fingerprint.def"="go \"1.4\""
+
+ADD packages-src /var/vcap/packages-src/
+ADD root /
+
+ENTRYPOINT ["/usr/bin/dumb-init", "/opt/fissile/run.sh"]
+`})
+		writeTarEntry(t, tarWriter, tarEntry{name: "packages-src/abc/bin/ruby", typeflag: tar.TypeReg, content: "ruby"})
+		writeTarEntry(t, tarWriter, tarEntry{name: "root/opt/fissile/", typeflag: tar.TypeDir})
+		writeTarEntry(t, tarWriter, tarEntry{name: "root/opt/fissile/run.sh", typeflag: tar.TypeReg, content: "run"})
+		writeTarEntry(t, tarWriter, tarEntry{name: "unused", typeflag: tar.TypeReg, content: "unused"})
+		return nil
+	})
+	require.NoError(t, err)
+
+	reloaded, err := layout.Image("role:1.0")
+	require.NoError(t, err)
+	assert.Equal(image.ID(), reloaded.ID())
+
+	config := reloaded.Config
+	assert.Equal("cloudfoundry@suse.example", config.Author)
+	assert.Equal(map[string]string{
+		"stemcell":                  "yes",
+		"instance_group":            "role",
+		"version.generator.fissile": "1.2.3",
+		"fingerprint.abc":           "ruby",
+		"fingerprint.def":           `go "1.4"`,
+	}, config.Config.Labels)
+	assert.Equal([]string{"/usr/bin/dumb-init", "/opt/fissile/run.sh"}, config.Config.Entrypoint)
+	assert.Nil(config.Config.Cmd)
+	assert.Equal([]string{"PATH=/bin"}, config.Config.Env)
+
+	// The stemcell layer comes first, then one layer per ADD
+	require.Len(t, reloaded.Manifest.Layers, 3)
+	require.Len(t, config.RootFS.DiffIDs, 3)
+	assert.Equal(stemcell.Manifest.Layers[0], reloaded.Manifest.Layers[0])
+	assert.Equal(stemcell.Config.RootFS.DiffIDs[0], config.RootFS.DiffIDs[0])
+	assert.Len(config.History, 7)
+	assert.Equal("ADD root /", config.History[5].CreatedBy)
+	assert.False(config.History[5].EmptyLayer)
+	assert.True(config.History[6].EmptyLayer)
+
+	packages := layerEntries(t, layout, reloaded.Manifest.Layers[1], config.RootFS.DiffIDs[1])
+	assert.Len(packages, 6)
+	for _, name := range []string{"var/", "var/vcap/", "var/vcap/packages-src/", "var/vcap/packages-src/abc/", "var/vcap/packages-src/abc/bin/"} {
+		if assert.Contains(packages, name) {
+			assert.Equal(byte(tar.TypeDir), packages[name].Typeflag, name)
+		}
+	}
+	if assert.Contains(packages, "var/vcap/packages-src/abc/bin/ruby") {
+		assert.Equal(0, packages["var/vcap/packages-src/abc/bin/ruby"].Uid)
+	}
+
+	root := layerEntries(t, layout, reloaded.Manifest.Layers[2], config.RootFS.DiffIDs[2])
+	assert.Len(root, 3)
+	assert.Contains(root, "opt/")
+	assert.Contains(root, "opt/fissile/")
+	assert.Contains(root, "opt/fissile/run.sh")
+}
+
+func TestLayoutBuildErrors(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := OpenLayout(tempDir)
+	require.NoError(t, err)
+	_, err = layout.writeImage("base:latest", ImageConfig{OS: "linux"}, nil)
+	require.NoError(t, err)
+
+	for dockerfile, message := range map[string]string{
+		"FROM missing:latest\n":              "Error finding base image",
+		"LABEL a=b\n":                        "does not start with FROM",
+		"FROM base:latest\nRUN true\n":       "RUN is not supported",
+		"FROM base:latest\nADD nothing /\n":  "nothing not found in the build context",
+		"FROM base:latest\nLABEL \"a=b\n":    "unterminated quote",
+		"FROM base:latest\nENTRYPOINT run\n": "only the JSON form is supported",
+	} {
+		_, err := layout.Build("image:latest", func(tarWriter *tar.Writer) error {
+			writeTarEntry(t, tarWriter, tarEntry{name: "Dockerfile", typeflag: tar.TypeReg, content: dockerfile})
+			return nil
+		})
+		if assert.Error(t, err, dockerfile) {
+			assert.Contains(t, err.Error(), message, dockerfile)
+		}
+	}
+}
+
+func TestAddTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, sample := range []struct {
+		name, source, destination string
+		toDirectory, isDir        bool
+		target                    string
+		ok                        bool
+	}{
+		{"root/etc/hosts", "root", "/", true, false, "etc/hosts", true},
+		{"root", "root", "/", true, true, "", true},
+		{"rootless/etc", "root", "/", true, false, "", false},
+		{"src/a", "src", "/dest", true, false, "dest/a", true},
+		{"src", "src", "/dest", true, true, "dest", true},
+		{"file", "file", "/dest", true, false, "dest/file", true},
+		{"file", "file", "/dest", false, false, "dest", true},
+	} {
+		target, ok := addTarget(sample.name, sample.source, sample.destination, sample.toDirectory, sample.isDir)
+		assert.Equal(sample.ok, ok, sample.name)
+		assert.Equal(sample.target, target, sample.name)
+	}
+}
@@ -0,0 +1,422 @@
+package oci
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Media types and annotations used in image layouts
+const (
+	MediaTypeImageIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageLayer     = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeImageLayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// AnnotationRefName holds the image name in the layout index
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+
+	layoutVersion = "1.0.0"
+)
+
+// Descriptor references a blob in the layout
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// Platform describes what an image runs on
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Index lists the images in a layout
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest lists the config and layers of an image
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// ImageConfig is the configuration of an image. Docker image configs are a
+// superset of this, so they can be read as well.
+type ImageConfig struct {
+	Created      *time.Time    `json:"created,omitempty"`
+	Author       string        `json:"author,omitempty"`
+	Architecture string        `json:"architecture"`
+	OS           string        `json:"os"`
+	Config       RuntimeConfig `json:"config"`
+	RootFS       RootFS        `json:"rootfs"`
+	History      []History     `json:"history,omitempty"`
+}
+
+// RuntimeConfig holds the parameters for running a container from an image
+type RuntimeConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// RootFS lists the uncompressed digests of the layers of an image
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// History describes how a layer of an image was created
+type History struct {
+	Created    *time.Time `json:"created,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	EmptyLayer bool       `json:"empty_layer,omitempty"`
+}
+
+// Image is an image stored in a layout
+type Image struct {
+	Name       string
+	Descriptor Descriptor
+	Manifest   Manifest
+	Config     ImageConfig
+}
+
+// ID returns the image ID, i.e. the digest of its config, as docker does
+func (i *Image) ID() string {
+	return i.Manifest.Config.Digest
+}
+
+// Layout is an OCI image layout directory. It holds blobs by digest, so
+// layers shared between images are stored only once.
+type Layout struct {
+	dir string
+	// mutex guards index.json
+	mutex sync.Mutex
+}
+
+// OpenLayout opens the image layout in dir, creating it if necessary
+func OpenLayout(dir string) (*Layout, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("Error creating image layout %s: %s", dir, err.Error())
+	}
+
+	layoutPath := filepath.Join(dir, "oci-layout")
+	if _, err := os.Stat(layoutPath); os.IsNotExist(err) {
+		contents := fmt.Sprintf(`{"imageLayoutVersion":"%s"}`, layoutVersion)
+		if err := ioutil.WriteFile(layoutPath, []byte(contents), 0644); err != nil {
+			return nil, fmt.Errorf("Error creating image layout %s: %s", dir, err.Error())
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	layout := &Layout{dir: dir}
+
+	indexPath := filepath.Join(dir, "index.json")
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		if err := layout.writeIndex(&Index{SchemaVersion: 2, Manifests: []Descriptor{}}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// Dir returns the directory of the layout
+func (l *Layout) Dir() string {
+	return l.dir
+}
+
+// HasImage returns true if the layout holds an image with the given name
+func (l *Layout) HasImage(name string) (bool, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return false, err
+	}
+
+	_, found := findRef(index, name)
+	return found, nil
+}
+
+// ImageNames returns the names of all images in the layout, sorted
+func (l *Layout) ImageNames() ([]string, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, manifest := range index.Manifests {
+		if name, ok := manifest.Annotations[AnnotationRefName]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Image returns the image with the given name
+func (l *Layout) Image(name string) (*Image, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, found := findRef(index, name)
+	if !found {
+		return nil, fmt.Errorf("Image %s not found in %s", name, l.dir)
+	}
+
+	image := &Image{Name: name, Descriptor: descriptor}
+	if err := l.readJSONBlob(descriptor.Digest, &image.Manifest); err != nil {
+		return nil, err
+	}
+	if err := l.readJSONBlob(image.Manifest.Config.Digest, &image.Config); err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// BlobPath returns the path of the blob with the given digest
+func (l *Layout) BlobPath(digest string) string {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return filepath.Join(l.dir, "blobs", "invalid", digest)
+	}
+	return filepath.Join(l.dir, "blobs", parts[0], parts[1])
+}
+
+// writeImage stores the config and manifest of an image whose layers are
+// already in the layout, and tags it with the given name
+func (l *Layout) writeImage(name string, config ImageConfig, layers []Descriptor) (*Image, error) {
+	configDescriptor, err := l.writeJSONBlob(config, MediaTypeImageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		Config:        configDescriptor,
+		Layers:        layers,
+	}
+	if manifest.Layers == nil {
+		manifest.Layers = []Descriptor{}
+	}
+
+	manifestDescriptor, err := l.writeJSONBlob(manifest, MediaTypeImageManifest)
+	if err != nil {
+		return nil, err
+	}
+	manifestDescriptor.Platform = &Platform{Architecture: config.Architecture, OS: config.OS}
+
+	if err := l.tag(name, manifestDescriptor); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Name:       name,
+		Descriptor: manifestDescriptor,
+		Manifest:   manifest,
+		Config:     config,
+	}, nil
+}
+
+// tag records the manifest as the image with the given name, replacing any
+// image of that name
+func (l *Layout) tag(name string, descriptor Descriptor) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+
+	manifests := []Descriptor{}
+	for _, manifest := range index.Manifests {
+		if manifest.Annotations[AnnotationRefName] != name {
+			manifests = append(manifests, manifest)
+		}
+	}
+
+	descriptor.Annotations = map[string]string{AnnotationRefName: name}
+	index.Manifests = append(manifests, descriptor)
+
+	return l.writeIndex(index)
+}
+
+func findRef(index *Index, name string) (Descriptor, bool) {
+	for _, manifest := range index.Manifests {
+		if manifest.Annotations[AnnotationRefName] == name {
+			return manifest, true
+		}
+	}
+	return Descriptor{}, false
+}
+
+func (l *Layout) readIndex() (*Index, error) {
+	var index Index
+	if err := readJSONFile(filepath.Join(l.dir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+func (l *Layout) writeIndex(index *Index) error {
+	contents, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	// Replace the index atomically so readers never see a partial one
+	tempFile, err := ioutil.TempFile(l.dir, "index.json.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(contents); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), filepath.Join(l.dir, "index.json"))
+}
+
+// writeBlob stores the contents of reader as a blob
+func (l *Layout) writeBlob(reader io.Reader, mediaType string) (Descriptor, error) {
+	tempFile, err := l.tempFile("blob-")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer os.Remove(tempFile.Name())
+
+	digester := newDigester()
+	size, err := io.Copy(io.MultiWriter(tempFile, digester), reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	descriptor := Descriptor{
+		MediaType: mediaType,
+		Digest:    digester.digest(),
+		Size:      size,
+	}
+
+	return descriptor, l.moveBlob(tempFile.Name(), descriptor.Digest)
+}
+
+// moveBlob moves a file into place as the blob with the given digest. Blobs
+// are immutable, so an existing one is kept.
+func (l *Layout) moveBlob(path, digest string) error {
+	if _, err := os.Stat(l.BlobPath(digest)); err == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path, l.BlobPath(digest))
+}
+
+func (l *Layout) writeJSONBlob(value interface{}, mediaType string) (Descriptor, error) {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return l.writeBlob(strings.NewReader(string(contents)), mediaType)
+}
+
+func (l *Layout) readJSONBlob(digest string, value interface{}) error {
+	return readJSONFile(l.BlobPath(digest), value)
+}
+
+// tempFile creates a temporary file inside the layout, so it can be renamed
+// into the blobs directory
+func (l *Layout) tempFile(prefix string) (*os.File, error) {
+	return ioutil.TempFile(filepath.Join(l.dir, "blobs"), prefix)
+}
+
+// digester computes the digest of what is written to it
+type digester struct {
+	hash.Hash
+}
+
+func newDigester() *digester {
+	return &digester{Hash: sha256.New()}
+}
+
+// digest returns the digest of everything written so far
+func (d *digester) digest() string {
+	return "sha256:" + hex.EncodeToString(d.Sum(nil))
+}
+
+// isGzip returns true if the reader starts with gzipped data
+func isGzip(reader *bufio.Reader) bool {
+	magic, err := reader.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// decompress returns the contents of a possibly gzipped stream
+func decompress(reader *bufio.Reader) (io.Reader, error) {
+	if !isGzip(reader) {
+		return reader, nil
+	}
+	return gzip.NewReader(reader)
+}
+
+func readJSONFile(path string, value interface{}) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(contents, value); err != nil {
+		return fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+}
+
+func tarContents(t *testing.T, entries ...tarEntry) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		writeTarEntry(t, tarWriter, entry)
+	}
+	require.NoError(t, tarWriter.Close())
+	return buf.Bytes()
+}
+
+func writeTarEntry(t *testing.T, tarWriter *tar.Writer, entry tarEntry) {
+	header := &tar.Header{
+		Name:     entry.name,
+		Typeflag: entry.typeflag,
+		Mode:     0644,
+		Size:     int64(len(entry.content)),
+		Uid:      1000,
+	}
+	if entry.typeflag == tar.TypeDir {
+		header.Mode = 0755
+	}
+	require.NoError(t, tarWriter.WriteHeader(header))
+	_, err := tarWriter.Write([]byte(entry.content))
+	require.NoError(t, err)
+}
+
+// writeStemcellArchive writes an image archive as `docker save` would, with a
+// single layer holding /bin/bash
+func writeStemcellArchive(t *testing.T, path string) {
+	layer := tarContents(t,
+		tarEntry{name: "bin/", typeflag: tar.TypeDir},
+		tarEntry{name: "bin/bash", typeflag: tar.TypeReg, content: "bash"},
+	)
+	layerDigester := newDigester()
+	layerDigester.Write(layer)
+
+	config, err := json.Marshal(ImageConfig{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: RuntimeConfig{
+			Env:    []string{"PATH=/bin"},
+			Cmd:    []string{"/bin/bash"},
+			Labels: map[string]string{"stemcell": "yes"},
+		},
+		RootFS:  RootFS{Type: "layers", DiffIDs: []string{layerDigester.digest()}},
+		History: []History{{CreatedBy: "ADD rootfs /"}},
+	})
+	require.NoError(t, err)
+
+	manifest, err := json.Marshal([]dockerArchiveManifest{{
+		Config:   "config.json",
+		RepoTags: []string{"stemcell:latest"},
+		Layers:   []string{"layer/layer.tar"},
+	}})
+	require.NoError(t, err)
+
+	archive := tarContents(t,
+		tarEntry{name: "layer/", typeflag: tar.TypeDir},
+		tarEntry{name: "layer/layer.tar", typeflag: tar.TypeReg, content: string(layer)},
+		tarEntry{name: "config.json", typeflag: tar.TypeReg, content: string(config)},
+		tarEntry{name: "manifest.json", typeflag: tar.TypeReg, content: string(manifest)},
+	)
+	require.NoError(t, ioutil.WriteFile(path, archive, 0644))
+}
+
+func TestOpenLayout(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layoutDir := filepath.Join(tempDir, "layout")
+	layout, err := OpenLayout(layoutDir)
+	require.NoError(t, err)
+	assert.Equal(layoutDir, layout.Dir())
+
+	contents, err := ioutil.ReadFile(filepath.Join(layoutDir, "oci-layout"))
+	require.NoError(t, err)
+	assert.JSONEq(`{"imageLayoutVersion":"1.0.0"}`, string(contents))
+
+	found, err := layout.HasImage("missing:latest")
+	require.NoError(t, err)
+	assert.False(found)
+
+	_, err = layout.Image("missing:latest")
+	assert.Error(err)
+
+	// Opening it again keeps what is there
+	stemcellPath := filepath.Join(tempDir, "stemcell.tar")
+	writeStemcellArchive(t, stemcellPath)
+	_, err = layout.Import(stemcellPath, "stemcell:latest")
+	require.NoError(t, err)
+
+	layout, err = OpenLayout(layoutDir)
+	require.NoError(t, err)
+	found, err = layout.HasImage("stemcell:latest")
+	require.NoError(t, err)
+	assert.True(found)
+}
+
+func TestLayoutTagReplaces(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := OpenLayout(tempDir)
+	require.NoError(t, err)
+
+	first, err := layout.writeImage("image:latest", ImageConfig{OS: "linux", Author: "first"}, nil)
+	require.NoError(t, err)
+	second, err := layout.writeImage("image:latest", ImageConfig{OS: "linux", Author: "second"}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(first.ID(), second.ID())
+
+	index, err := layout.readIndex()
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 1)
+	assert.Equal(second.Descriptor.Digest, index.Manifests[0].Digest)
+	assert.Equal("image:latest", index.Manifests[0].Annotations[AnnotationRefName])
+
+	_, err = layout.writeImage("another:latest", ImageConfig{OS: "linux"}, nil)
+	require.NoError(t, err)
+	names, err := layout.ImageNames()
+	require.NoError(t, err)
+	assert.Equal([]string{"another:latest", "image:latest"}, names)
+
+	image, err := layout.Image("image:latest")
+	require.NoError(t, err)
+	assert.Equal("second", image.Config.Author)
+	assert.Equal([]Descriptor{}, image.Manifest.Layers)
+}
@@ -0,0 +1,354 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dockerHubHost is where the registry API of docker.io is served
+const dockerHubHost = "registry-1.docker.io"
+
+// Client talks to a docker registry using the registry v2 API
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	// mutex guards the fields below
+	mutex sync.Mutex
+	// challenge is the authentication the registry asks for, once known
+	challenge *challenge
+	// authorizations caches the Authorization header per token scope
+	authorizations map[string]string
+	// blobRepositories records a repository holding each blob pushed
+	blobRepositories map[string]string
+}
+
+// challenge is a parsed WWW-Authenticate header
+type challenge struct {
+	scheme     string
+	parameters map[string]string
+}
+
+// NewClient creates a client for the registry at the given host, as used in
+// image names (e.g. docker.io or registry.example.com:5000). Registries on
+// the local host are accessed via plain HTTP, like docker does; all others
+// require HTTPS. The credentials are optional.
+func NewClient(host, username, password string) (*Client, error) {
+	if host == "" {
+		return nil, fmt.Errorf("No registry given")
+	}
+	if strings.Contains(host, "/") {
+		return nil, fmt.Errorf("Invalid registry '%s', expected a host name with an optional port", host)
+	}
+
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubHost
+	}
+
+	scheme := "https"
+	if isLocalHost(host) {
+		scheme = "http"
+	}
+
+	return &Client{
+		baseURL:        fmt.Sprintf("%s://%s", scheme, host),
+		username:       username,
+		password:       password,
+		httpClient:     http.DefaultClient,
+		authorizations: map[string]string{},
+	}, nil
+}
+
+// isLocalHost returns true if the registry host is on the local machine
+func isLocalHost(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// do sends a request for the given repositories, authenticating as needed.
+// The first repository is accessed for pushing, the others for pulling only.
+// Requests are retried once with a fresh token if the registry rejects the
+// cached one, provided the body can be sent again.
+func (c *Client) do(method, path string, body io.Reader, headers map[string]string, repositories ...string) (*http.Response, error) {
+	requestURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		requestURL = c.baseURL + path
+	}
+
+	// Keep net/http from closing files, so they can be sent again
+	requestBody := body
+	if readCloser, ok := body.(io.ReadCloser); ok {
+		requestBody = ioutil.NopCloser(readCloser)
+	}
+
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(method, requestURL, requestBody)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		if contentLength := request.Header.Get("Content-Length"); contentLength != "" {
+			// net/http only knows the length of in-memory bodies
+			request.ContentLength, err = strconv.ParseInt(contentLength, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		authorization, err := c.authorize(repositories...)
+		if err != nil {
+			return nil, err
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		response, err := c.httpClient.Do(request)
+		if err != nil || response.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return response, err
+		}
+
+		seeker, seekable := body.(io.Seeker)
+		if body != nil && !seekable {
+			return response, nil
+		}
+		if seekable {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return response, nil
+			}
+		}
+		response.Body.Close()
+		c.forgetAuthorization(authorization)
+	}
+}
+
+// forgetAuthorization drops a cached token the registry no longer accepts
+func (c *Client) forgetAuthorization(authorization string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, value := range c.authorizations {
+		if value == authorization {
+			delete(c.authorizations, key)
+		}
+	}
+}
+
+// authorize returns the Authorization header to use for the repositories
+func (c *Client) authorize(repositories ...string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.challenge == nil {
+		authChallenge, err := c.fetchChallenge()
+		if err != nil {
+			return "", err
+		}
+		c.challenge = authChallenge
+	}
+
+	switch c.challenge.scheme {
+	case "":
+		return "", nil
+	case "basic":
+		if c.username == "" {
+			return "", fmt.Errorf("Registry %s requires credentials", c.baseURL)
+		}
+		return "Basic " + basicAuth(c.username, c.password), nil
+	case "bearer":
+		var scopes []string
+		for i, repository := range repositories {
+			if i == 0 {
+				scopes = append(scopes, fmt.Sprintf("repository:%s:pull,push", repository))
+			} else {
+				scopes = append(scopes, fmt.Sprintf("repository:%s:pull", repository))
+			}
+		}
+		key := strings.Join(scopes, " ")
+
+		if authorization, ok := c.authorizations[key]; ok {
+			return authorization, nil
+		}
+
+		token, err := c.fetchToken(scopes)
+		if err != nil {
+			return "", err
+		}
+		c.authorizations[key] = "Bearer " + token
+		return c.authorizations[key], nil
+	default:
+		return "", fmt.Errorf("Registry %s requires unsupported authentication %s", c.baseURL, c.challenge.scheme)
+	}
+}
+
+// fetchChallenge asks the registry which authentication it requires
+func (c *Client) fetchChallenge() (*challenge, error) {
+	response, err := c.httpClient.Get(c.baseURL + "/v2/")
+	if err != nil {
+		return nil, fmt.Errorf("Error contacting registry %s: %s", c.baseURL, err.Error())
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return &challenge{}, nil
+	case http.StatusUnauthorized:
+		return parseChallenge(response.Header.Get("WWW-Authenticate"))
+	default:
+		return nil, fmt.Errorf("Registry %s does not support the v2 API: %s", c.baseURL, response.Status)
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+//
+//	Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(header string) (*challenge, error) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("Registry requires authentication, but did not say which")
+	}
+
+	result := &challenge{
+		scheme:     strings.ToLower(parts[0]),
+		parameters: map[string]string{},
+	}
+	if len(parts) == 1 {
+		return result, nil
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		equals := strings.Index(rest, "=")
+		if equals < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:equals]))
+		rest = rest[equals+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid authentication challenge %s", header)
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		result.parameters[key] = value
+
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return result, nil
+}
+
+// fetchToken gets a bearer token for the scopes from the token service named
+// in the challenge
+func (c *Client) fetchToken(scopes []string) (string, error) {
+	realm := c.challenge.parameters["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("Registry %s did not name a token service", c.baseURL)
+	}
+
+	query := url.Values{}
+	if service := c.challenge.parameters["service"]; service != "" {
+		query.Set("service", service)
+	}
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+
+	tokenURL := realm
+	if strings.Contains(realm, "?") {
+		tokenURL += "&" + query.Encode()
+	} else {
+		tokenURL += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequest("GET", tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		request.SetBasicAuth(c.username, c.password)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("Error authenticating with registry %s: %s", c.baseURL, err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error authenticating with registry %s: %s", c.baseURL, response.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("Error authenticating with registry %s: %s", c.baseURL, err.Error())
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	if tokenResponse.AccessToken != "" {
+		return tokenResponse.AccessToken, nil
+	}
+	return "", fmt.Errorf("Error authenticating with registry %s: no token received", c.baseURL)
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// responseError describes an unexpected response from the registry
+func responseError(action string, response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+
+	var registryErrors struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &registryErrors); err == nil && len(registryErrors.Errors) > 0 {
+		var messages []string
+		for _, registryError := range registryErrors.Errors {
+			messages = append(messages, fmt.Sprintf("%s: %s", registryError.Code, registryError.Message))
+		}
+		return fmt.Errorf("Error %s: %s (%s)", action, response.Status, strings.Join(messages, "; "))
+	}
+
+	return fmt.Errorf("Error %s: %s", action, response.Status)
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient(t *testing.T) {
+	assert := assert.New(t)
+
+	for host, baseURL := range map[string]string{
+		"docker.io":                    "https://registry-1.docker.io",
+		"registry.example.com:5000":    "https://registry.example.com:5000",
+		"localhost:5000":               "http://localhost:5000",
+		"127.0.0.1:5000":               "http://127.0.0.1:5000",
+		"[::1]:5000":                   "http://[::1]:5000",
+		"registry.example.com":         "https://registry.example.com",
+		"registry.example.com:443":     "https://registry.example.com:443",
+		"localhost.example.com":        "https://localhost.example.com",
+		"127.0.0.1.example.com:5000":   "https://127.0.0.1.example.com:5000",
+		"registry-1.docker.io:443":     "https://registry-1.docker.io:443",
+		"index.docker.io":              "https://registry-1.docker.io",
+		"registry.example.com:5000/v2": "",
+		"":                             "",
+	} {
+		client, err := NewClient(host, "", "")
+		if baseURL == "" {
+			assert.Error(err, host)
+			continue
+		}
+		if assert.NoError(err, host) {
+			assert.Equal(baseURL, client.baseURL, host)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	assert := assert.New(t)
+
+	result, err := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+	require.NoError(t, err)
+	assert.Equal("bearer", result.scheme)
+	assert.Equal(map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull",
+	}, result.parameters)
+
+	result, err = parseChallenge(`Basic realm=registry`)
+	require.NoError(t, err)
+	assert.Equal("basic", result.scheme)
+	assert.Equal("registry", result.parameters["realm"])
+
+	_, err = parseChallenge("")
+	assert.Error(err)
+
+	_, err = parseChallenge(`Bearer realm="unterminated`)
+	assert.Error(err)
+}
+
+func TestClientAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeRegistry := testhelpers.NewFakeRegistry("user", "secret")
+	defer fakeRegistry.Close()
+
+	client, err := NewClient(fakeRegistry.Host(), "user", "secret")
+	require.NoError(t, err)
+	exists, err := client.hasBlob("org/image", "sha256:0000")
+	assert.NoError(err)
+	assert.False(exists)
+
+	client, err = NewClient(fakeRegistry.Host(), "user", "wrong")
+	require.NoError(t, err)
+	_, err = client.hasBlob("org/image", "sha256:0000")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "401")
+	}
+}
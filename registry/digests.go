@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DigestManifest maps image names, including registry and tag, to the digest
+// of their manifest in the registry. It is written when pushing images, so
+// generated charts can reference the images by digest.
+type DigestManifest map[string]string
+
+// ReadDigestManifest reads the digest manifest at path. A missing file is an
+// empty manifest.
+func ReadDigestManifest(path string) (DigestManifest, error) {
+	manifest := DigestManifest{}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(contents, &manifest); err != nil {
+		return nil, fmt.Errorf("Error reading digest manifest %s: %s", path, err.Error())
+	}
+
+	return manifest, nil
+}
+
+// Write stores the digest manifest at path
+func (m DigestManifest) Write(path string) error {
+	contents, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
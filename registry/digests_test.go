@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "image-digests.yml")
+
+	manifest, err := ReadDigestManifest(path)
+	require.NoError(t, err)
+	assert.Empty(manifest)
+
+	manifest["registry.example.com/org/repo-role:1234"] = "sha256:abcd"
+	require.NoError(t, manifest.Write(path))
+
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal("registry.example.com/org/repo-role:1234: sha256:abcd\n", string(contents))
+
+	manifest, err = ReadDigestManifest(path)
+	require.NoError(t, err)
+	assert.Equal(DigestManifest{"registry.example.com/org/repo-role:1234": "sha256:abcd"}, manifest)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("- not a map"), 0644))
+	_, err = ReadDigestManifest(path)
+	assert.Error(err)
+}
@@ -0,0 +1,225 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/oci"
+)
+
+// PushResult describes an image pushed to a registry
+type PushResult struct {
+	// Digest is the digest of the image manifest
+	Digest string
+	// BlobsPushed is the number of blobs uploaded
+	BlobsPushed int
+	// BlobsSkipped is the number of blobs the registry had already
+	BlobsSkipped int
+}
+
+// SplitImageName splits an image name as used by docker into the registry
+// host, the repository and the tag
+func SplitImageName(imageName string) (string, string, string, error) {
+	name := imageName
+	tag := "latest"
+	if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		name, tag = name[:colon], name[colon+1:]
+	}
+
+	slash := strings.Index(name, "/")
+	if slash < 0 {
+		return "", "", "", fmt.Errorf("Image name %s does not include a registry", imageName)
+	}
+
+	host, repository := name[:slash], name[slash+1:]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "", "", "", fmt.Errorf("Image name %s does not include a registry", imageName)
+	}
+
+	return host, repository, tag, nil
+}
+
+// PushImage pushes the image with the given name in the layout to the
+// registry, as repository:tag. Blobs the registry has already are not
+// uploaded again, and blobs pushed to other repositories are mounted instead.
+func (c *Client) PushImage(layout *oci.Layout, imageName, repository, tag string) (*PushResult, error) {
+	image, err := layout.Image(imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PushResult{Digest: image.Descriptor.Digest}
+
+	blobs := append([]oci.Descriptor{}, image.Manifest.Layers...)
+	blobs = append(blobs, image.Manifest.Config)
+	for _, blob := range blobs {
+		uploaded, err := c.pushBlob(layout, repository, blob)
+		if err != nil {
+			return nil, err
+		}
+		if uploaded {
+			result.BlobsPushed++
+		} else {
+			result.BlobsSkipped++
+		}
+	}
+
+	// Push the manifest exactly as stored, so its digest stays the same
+	manifest, err := ioutil.ReadFile(layout.BlobPath(image.Descriptor.Digest))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do("PUT", fmt.Sprintf("/v2/%s/manifests/%s", repository, tag), bytes.NewReader(manifest), map[string]string{
+		"Content-Type": image.Descriptor.MediaType,
+	}, repository)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return nil, responseError(fmt.Sprintf("pushing manifest of %s:%s", repository, tag), response)
+	}
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != "" && digest != result.Digest {
+		return nil, fmt.Errorf("Registry stored the manifest of %s:%s as %s, expected %s", repository, tag, digest, result.Digest)
+	}
+
+	return result, nil
+}
+
+// pushBlob makes sure the registry has the blob in the repository, and
+// returns true if it had to be uploaded
+func (c *Client) pushBlob(layout *oci.Layout, repository string, blob oci.Descriptor) (bool, error) {
+	exists, err := c.hasBlob(repository, blob.Digest)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		c.rememberBlob(blob.Digest, repository)
+		return false, nil
+	}
+
+	uploadURL := fmt.Sprintf("/v2/%s/blobs/uploads/", repository)
+	repositories := []string{repository}
+
+	if source, ok := c.blobSource(blob.Digest); ok && source != repository {
+		// Mounting from another repository avoids the upload
+		query := url.Values{"mount": {blob.Digest}, "from": {source}}
+		uploadURL += "?" + query.Encode()
+		repositories = append(repositories, source)
+	}
+
+	response, err := c.do("POST", uploadURL, nil, nil, repositories...)
+	if err != nil {
+		return false, err
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusCreated:
+		c.rememberBlob(blob.Digest, repository)
+		return false, nil
+	case http.StatusAccepted:
+	default:
+		return false, responseError(fmt.Sprintf("starting upload of %s to %s", blob.Digest, repository), response)
+	}
+
+	location, err := c.resolveLocation(response)
+	if err != nil {
+		return false, err
+	}
+	if strings.Contains(location, "?") {
+		location += "&digest=" + url.QueryEscape(blob.Digest)
+	} else {
+		location += "?digest=" + url.QueryEscape(blob.Digest)
+	}
+
+	file, err := os.Open(layout.BlobPath(blob.Digest))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	response, err = c.do("PUT", location, file, map[string]string{
+		"Content-Type":   "application/octet-stream",
+		"Content-Length": strconv.FormatInt(blob.Size, 10),
+	}, repository)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return false, responseError(fmt.Sprintf("uploading %s to %s", blob.Digest, repository), response)
+	}
+
+	c.rememberBlob(blob.Digest, repository)
+	return true, nil
+}
+
+// hasBlob returns true if the registry has the blob in the repository
+func (c *Client) hasBlob(repository, digest string) (bool, error) {
+	response, err := c.do("HEAD", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest), nil, nil, repository)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(fmt.Sprintf("checking for %s in %s", digest, repository), response)
+	}
+}
+
+// resolveLocation returns the absolute URL of the Location header
+func (c *Client) resolveLocation(response *http.Response) (string, error) {
+	location := response.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("Registry did not return an upload location")
+	}
+
+	base, err := url.Parse(c.baseURL + response.Request.URL.Path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := base.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return resolved.String(), nil
+}
+
+// rememberBlob records that the repository holds the blob, so it can be
+// mounted into other repositories
+func (c *Client) rememberBlob(digest, repository string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.blobRepositories == nil {
+		c.blobRepositories = map[string]string{}
+	}
+	c.blobRepositories[digest] = repository
+}
+
+// blobSource returns a repository known to hold the blob
+func (c *Client) blobSource(digest string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	repository, ok := c.blobRepositories[digest]
+	return repository, ok
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/oci"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importTestImage adds an image with the given layers to the layout, via an
+// image archive as written by `docker save`
+func importTestImage(t *testing.T, layout *oci.Layout, name string, layers ...string) *oci.Image {
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	addFile := func(name string, contents []byte) {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write(contents)
+		require.NoError(t, err)
+	}
+
+	var layerNames, diffIDs []string
+	for i, layer := range layers {
+		var layerTar bytes.Buffer
+		layerWriter := tar.NewWriter(&layerTar)
+		require.NoError(t, layerWriter.WriteHeader(&tar.Header{Name: layer, Mode: 0644, Size: int64(len(layer)), Typeflag: tar.TypeReg}))
+		_, err := layerWriter.Write([]byte(layer))
+		require.NoError(t, err)
+		require.NoError(t, layerWriter.Close())
+
+		sum := sha256.Sum256(layerTar.Bytes())
+		diffIDs = append(diffIDs, "sha256:"+hex.EncodeToString(sum[:]))
+		layerNames = append(layerNames, fmt.Sprintf("layer%d.tar", i))
+		addFile(layerNames[i], layerTar.Bytes())
+	}
+
+	config, err := json.Marshal(oci.ImageConfig{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config:       oci.RuntimeConfig{Labels: map[string]string{"name": name}},
+		RootFS:       oci.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	addFile("config.json", config)
+
+	manifest, err := json.Marshal([]map[string]interface{}{{"Config": "config.json", "Layers": layerNames}})
+	require.NoError(t, err)
+	addFile("manifest.json", manifest)
+	require.NoError(t, tarWriter.Close())
+
+	archivePath := filepath.Join(layout.Dir(), "test-archive.tar")
+	require.NoError(t, ioutil.WriteFile(archivePath, archive.Bytes(), 0644))
+	defer os.Remove(archivePath)
+
+	image, err := layout.Import(archivePath, name)
+	require.NoError(t, err)
+	return image
+}
+
+func TestSplitImageName(t *testing.T) {
+	assert := assert.New(t)
+
+	for name, expected := range map[string][]string{
+		"docker.io/org/repo:tag":             {"docker.io", "org/repo", "tag"},
+		"registry.example.com:5000/repo:1.0": {"registry.example.com:5000", "repo", "1.0"},
+		"registry.example.com:5000/org/repo": {"registry.example.com:5000", "org/repo", "latest"},
+		"localhost/a/b/c:d":                  {"localhost", "a/b/c", "d"},
+		"org/repo:tag":                       nil,
+		"repo:tag":                           nil,
+	} {
+		host, repository, tag, err := SplitImageName(name)
+		if expected == nil {
+			assert.Error(err, name)
+			continue
+		}
+		if assert.NoError(err, name) {
+			assert.Equal(expected, []string{host, repository, tag}, name)
+		}
+	}
+}
+
+func TestPushImage(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeRegistry := testhelpers.NewFakeRegistry("user", "secret")
+	defer fakeRegistry.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	layout, err := oci.OpenLayout(tempDir)
+	require.NoError(t, err)
+	first := importTestImage(t, layout, "first:1", "base", "first")
+	second := importTestImage(t, layout, "second:1", "base", "second")
+
+	client, err := NewClient(fakeRegistry.Host(), "user", "secret")
+	require.NoError(t, err)
+
+	result, err := client.PushImage(layout, "first:1", "org/first", "1")
+	require.NoError(t, err)
+	assert.Equal(first.Descriptor.Digest, result.Digest)
+	assert.Equal(3, result.BlobsPushed, "Expected two layers and the config to be pushed")
+	assert.Equal(0, result.BlobsSkipped)
+
+	manifest, err := ioutil.ReadFile(layout.BlobPath(first.Descriptor.Digest))
+	require.NoError(t, err)
+	assert.Equal(manifest, fakeRegistry.Manifests["org/first"]["1"])
+	for _, layer := range first.Manifest.Layers {
+		assert.Contains(fakeRegistry.Blobs["org/first"], layer.Digest)
+	}
+	assert.Contains(fakeRegistry.Blobs["org/first"], first.ID())
+
+	// The shared layer is mounted from the first repository
+	result, err = client.PushImage(layout, "second:1", "org/second", "1")
+	require.NoError(t, err)
+	assert.Equal(second.Descriptor.Digest, result.Digest)
+	assert.Equal(2, result.BlobsPushed)
+	assert.Equal(1, result.BlobsSkipped)
+	assert.Equal(1, fakeRegistry.Mounts)
+	assert.Equal(5, fakeRegistry.Uploads)
+
+	// Pushing again uploads nothing, even with a new client
+	client, err = NewClient(fakeRegistry.Host(), "user", "secret")
+	require.NoError(t, err)
+	result, err = client.PushImage(layout, "second:1", "org/second", "latest")
+	require.NoError(t, err)
+	assert.Equal(0, result.BlobsPushed)
+	assert.Equal(3, result.BlobsSkipped)
+	assert.Equal(5, fakeRegistry.Uploads)
+	assert.Contains(fakeRegistry.Manifests["org/second"], "latest")
+
+	_, err = client.PushImage(layout, "missing:1", "org/missing", "1")
+	assert.Error(err)
+}
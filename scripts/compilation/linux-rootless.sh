@@ -0,0 +1,48 @@
+#!/usr/bin/env bash
+# Runs the compilation script chrooted into the stemcell root filesystem.
+# This is started as root of fresh user and mount namespaces, so the mounts
+# below are only visible to this compilation.
+set -o errexit -o nounset
+
+usage() {
+  echo "${1} not specified" >&2
+  echo "Usage: ${0} <rootfs> <sources> <compiled> <scratch> <package> <version>" >&2
+  exit 1
+}
+
+rootfs="${1:-}"
+sources="${2:-}"
+compiled="${3:-}"
+scratch="${4:-}"
+test -n "${rootfs}" || usage "Root filesystem"
+test -n "${sources}" || usage "Sources directory"
+test -n "${compiled}" || usage "Compilation output directory"
+test -n "${scratch}" || usage "Scratch directory"
+shift 4
+
+# Packages compiled concurrently share the root filesystem; give each of them
+# its own /var/vcap and /tmp
+mkdir -p "${scratch}/vcap" "${scratch}/tmp"
+chmod 1777 "${scratch}/tmp"
+
+mount --bind "${sources}" "${rootfs}/fissile-in"
+mount --bind "${compiled}" "${rootfs}/fissile-out"
+mount --bind "${scratch}/vcap" "${rootfs}/var/vcap"
+mount --bind "${scratch}/tmp" "${rootfs}/tmp"
+mount --rbind /dev "${rootfs}/dev"
+mount --rbind /proc "${rootfs}/proc" \
+  || echo "Warning - could not mount /proc for the compilation" 1>&2
+
+# Name resolution uses a copy of the host's resolv.conf, mounted over the one of
+# the shared root filesystem.  A symlink there may point out of the root
+# filesystem, so it is not used.
+resolv_conf="${rootfs}/etc/resolv.conf"
+if test -L "${resolv_conf}" ; then
+  echo "Warning - not setting up name resolution for the compilation, ${resolv_conf} is a symlink" 1>&2
+elif ! { cp /etc/resolv.conf "${scratch}/resolv.conf" \
+    && { test -e "${resolv_conf}" || touch "${resolv_conf}" ; } \
+    && mount --bind "${scratch}/resolv.conf" "${resolv_conf}" ; } 2>/dev/null ; then
+  echo "Warning - could not set up name resolution for the compilation" 1>&2
+fi
+
+exec chroot "${rootfs}" /bin/bash /fissile-in/compile.sh "$@"
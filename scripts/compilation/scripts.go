@@ -17,6 +17,9 @@ const (
 	CompilationScript = "compile"
 	// PrerequisitesScript is the script that installs prerequisites
 	PrerequisitesScript = "prerequisites"
+	// RootlessScript is the script running the compilation script inside the
+	// stemcell root filesystem, for compilation in a user namespace
+	RootlessScript = "rootless"
 )
 
 // SaveScript will write a script to the disk
@@ -111,6 +111,23 @@ echo "${KUBE_COMPONENT_INDEX}" > /var/vcap/instance/id
     bash {{ script_path $script }}
 {{ end }}
 
+# The BOSH link information names the instance groups and services of the link
+# providers; the resources deployed get the name prefix and suffix of the chart
+if test -n "${KUBE_NAME_PREFIX:-}${KUBE_NAME_SUFFIX:-}" ; then
+  for config_spec in /var/vcap/jobs-src/*/config_spec.json ; do
+    perl -MJSON::PP -0777 -i -pe '
+      my $config = decode_json($_);
+      for my $link (values %{$config->{consumes} || {}}) {
+        for my $key ("role", "service_name") {
+          next unless $link->{$key};
+          $link->{$key} = ($ENV{KUBE_NAME_PREFIX} // "") . $link->{$key} . ($ENV{KUBE_NAME_SUFFIX} // "");
+        }
+      }
+      $_ = encode_json($config);
+    ' "${config_spec}"
+  done
+fi
+
 configgin \
 	--jobs /opt/fissile/job_config.json \
 	--env2conf /opt/fissile/env2conf.yml
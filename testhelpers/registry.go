@@ -0,0 +1,139 @@
+package testhelpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const fakeRegistryToken = "fake-registry-token"
+
+// FakeRegistry is a minimal docker registry serving the v2 API parts needed
+// to push images. It hands out bearer tokens to clients with the right
+// credentials, like most registries do.
+type FakeRegistry struct {
+	Server   *httptest.Server
+	Username string
+	Password string
+
+	mutex sync.Mutex
+	// Blobs holds the blobs of each repository by digest
+	Blobs map[string]map[string][]byte
+	// Manifests holds the manifests of each repository by tag
+	Manifests map[string]map[string][]byte
+	// Uploads counts the blobs uploaded
+	Uploads int
+	// Mounts counts the blobs mounted from other repositories
+	Mounts int
+}
+
+// NewFakeRegistry starts a fake registry; Close it when done
+func NewFakeRegistry(username, password string) *FakeRegistry {
+	registry := &FakeRegistry{
+		Username:  username,
+		Password:  password,
+		Blobs:     map[string]map[string][]byte{},
+		Manifests: map[string]map[string][]byte{},
+	}
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	return registry
+}
+
+// Host returns the host and port of the registry, as used in image names
+func (r *FakeRegistry) Host() string {
+	return strings.TrimPrefix(r.Server.URL, "http://")
+}
+
+// Close stops the registry
+func (r *FakeRegistry) Close() {
+	r.Server.Close()
+}
+
+func (r *FakeRegistry) serve(writer http.ResponseWriter, request *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if request.URL.Path == "/token" {
+		username, password, _ := request.BasicAuth()
+		if username != r.Username || password != r.Password {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(writer, `{"token":"%s"}`, fakeRegistryToken)
+		return
+	}
+
+	if request.Header.Get("Authorization") != "Bearer "+fakeRegistryToken {
+		writer.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, r.Server.URL))
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/v2/")
+	switch {
+	case path == "":
+		writer.WriteHeader(http.StatusOK)
+	case strings.Contains(path, "/blobs/uploads/"):
+		r.serveUpload(writer, request, path)
+	case strings.Contains(path, "/blobs/"):
+		parts := strings.SplitN(path, "/blobs/", 2)
+		if _, ok := r.Blobs[parts[0]][parts[1]]; ok {
+			writer.WriteHeader(http.StatusOK)
+		} else {
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	case strings.Contains(path, "/manifests/") && request.Method == "PUT":
+		parts := strings.SplitN(path, "/manifests/", 2)
+		contents, _ := ioutil.ReadAll(request.Body)
+		if r.Manifests[parts[0]] == nil {
+			r.Manifests[parts[0]] = map[string][]byte{}
+		}
+		r.Manifests[parts[0]][parts[1]] = contents
+		writer.Header().Set("Docker-Content-Digest", digest(contents))
+		writer.WriteHeader(http.StatusCreated)
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *FakeRegistry) serveUpload(writer http.ResponseWriter, request *http.Request, path string) {
+	parts := strings.SplitN(path, "/blobs/uploads/", 2)
+	repository := parts[0]
+	if r.Blobs[repository] == nil {
+		r.Blobs[repository] = map[string][]byte{}
+	}
+
+	switch request.Method {
+	case "POST":
+		query := request.URL.Query()
+		if blob, ok := r.Blobs[query.Get("from")][query.Get("mount")]; ok {
+			r.Blobs[repository][query.Get("mount")] = blob
+			r.Mounts++
+			writer.WriteHeader(http.StatusCreated)
+			return
+		}
+		writer.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/upload-%d?state=fake", repository, r.Uploads))
+		writer.WriteHeader(http.StatusAccepted)
+	case "PUT":
+		contents, _ := ioutil.ReadAll(request.Body)
+		if request.URL.Query().Get("state") != "fake" || digest(contents) != request.URL.Query().Get("digest") {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Blobs[repository][digest(contents)] = contents
+		r.Uploads++
+		writer.WriteHeader(http.StatusCreated)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func digest(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
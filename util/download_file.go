@@ -1,46 +1,137 @@
 package util
 
 import (
-	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"time"
-
-	"github.com/machinebox/progress"
 )
 
 type progressDelegate func(int)
 
+// DownloadOptions controls how DownloadFile deals with failures
+type DownloadOptions struct {
+	// Retries is the number of times a failed download is attempted again
+	Retries int
+	// RetryBackoff is the delay before the first retry; it doubles for every
+	// further attempt
+	RetryBackoff time.Duration
+}
+
+// HTTPStatusError is returned by DownloadFile when the server replies with an
+// unexpected status code
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("Error downloading %s: %s", e.URL, e.Status)
+}
+
+// temporary returns true for server replies that are worth retrying
+func (e *HTTPStatusError) temporary() bool {
+	return e.StatusCode >= 500 ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests
+}
+
 // DownloadFile will download a url to a local file. It's efficient because it will
 // write as it downloads and not load the whole file into memory.
-func DownloadFile(filepath string, url string, progressEvent progressDelegate) error {
+// If the file already exists, only the missing bytes are requested from the
+// server, using an HTTP Range request. Failed downloads are retried with
+// exponential backoff, resuming from wherever the previous attempt stopped.
+// When the server ignores the Range request, the progress starts over at 0.
+func DownloadFile(filepath string, url string, options DownloadOptions, progressEvent progressDelegate) error {
+	backoff := options.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := downloadFileAttempt(filepath, url, progressEvent)
+		if err == nil {
+			return nil
+		}
 
-	// Create the file
-	out, err := os.Create(filepath)
+		if statusErr, ok := err.(*HTTPStatusError); ok && !statusErr.temporary() {
+			return err
+		}
+
+		if attempt >= options.Retries {
+			if attempt == 0 {
+				return err
+			}
+			return fmt.Errorf("Giving up on %s after %d attempts: %s", url, attempt+1, err.Error())
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func downloadFileAttempt(filepath string, url string, progressEvent progressDelegate) error {
+	// Keep whatever a previous attempt left behind
+	var offset int64
+	if info, err := os.Stat(filepath); err == nil {
+		offset = info.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
 	// Get the data
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	size := resp.ContentLength
-	reader := progress.NewReader(resp.Body)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server sends everything; start over
+		flags |= os.O_TRUNC
+		if offset > 0 {
+			offset = 0
+			progressEvent(0)
+		}
+	case http.StatusPartialContent:
+		// Resuming where the previous attempt stopped
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 {
+			// There is nothing left to download
+			progressEvent(100)
+			return nil
+		}
+		fallthrough
+	default:
+		return &HTTPStatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
 
-	go func() {
-		ctx := context.Background()
-		progressChan := progress.NewTicker(ctx, reader, size, 1*time.Second)
+	// Open the file
+	out, err := os.OpenFile(filepath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
 
-		for p := range progressChan {
-			progressEvent(int(p.Percent()))
-		}
-	}()
+	reader := &progressReader{
+		reader:        resp.Body,
+		current:       offset,
+		total:         -1,
+		progressEvent: progressEvent,
+	}
+	if resp.ContentLength >= 0 {
+		reader.total = offset + resp.ContentLength
+	}
 
 	// Write the body to file
 	_, err = io.Copy(out, reader)
@@ -48,5 +139,36 @@ func DownloadFile(filepath string, url string, progressEvent progressDelegate) e
 		return err
 	}
 
+	if reader.total >= 0 && reader.current != reader.total {
+		return fmt.Errorf("Error downloading %s: expected %d bytes, got %d", url, reader.total, reader.current)
+	}
+
+	progressEvent(100)
+
 	return nil
 }
+
+// progressReader reports the percentage of a download completed so far
+// whenever it changes
+type progressReader struct {
+	reader         io.Reader
+	current        int64
+	total          int64
+	lastPercentage int
+	progressEvent  progressDelegate
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.current += int64(n)
+
+	if r.total > 0 {
+		percentage := int(r.current * 100 / r.total)
+		if percentage != r.lastPercentage {
+			r.lastPercentage = percentage
+			r.progressEvent(percentage)
+		}
+	}
+
+	return n, err
+}
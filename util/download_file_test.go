@@ -0,0 +1,166 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var downloadTestContent = []byte(strings.Repeat("fissile release tarball\n", 1000))
+
+func TestDownloadFile(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "release.tgz", time.Time{}, bytes.NewReader(downloadTestContent))
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	target := filepath.Join(tempDir, "release.tgz")
+	lastPercentage := 0
+	err = DownloadFile(target, server.URL, DownloadOptions{}, func(percentage int) {
+		assert.True(percentage >= lastPercentage, "progress should not go backwards")
+		lastPercentage = percentage
+	})
+	assert.NoError(err)
+	assert.Equal(100, lastPercentage)
+
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal(downloadTestContent, content)
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	assert := assert.New(t)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "release.tgz", time.Time{}, bytes.NewReader(downloadTestContent))
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	target := filepath.Join(tempDir, "release.tgz")
+	require.NoError(t, ioutil.WriteFile(target, downloadTestContent[:1000], 0644))
+
+	err = DownloadFile(target, server.URL, DownloadOptions{}, func(int) {})
+	assert.NoError(err)
+	assert.Equal([]string{"bytes=1000-"}, ranges)
+
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal(downloadTestContent, content)
+
+	// A complete file is left alone
+	err = DownloadFile(target, server.URL, DownloadOptions{}, func(int) {})
+	assert.NoError(err)
+
+	content, err = ioutil.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal(downloadTestContent, content)
+}
+
+func TestDownloadFileRangeIgnored(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(downloadTestContent)
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	target := filepath.Join(tempDir, "release.tgz")
+	require.NoError(t, ioutil.WriteFile(target, downloadTestContent[:1000], 0644))
+
+	var percentages []int
+	err = DownloadFile(target, server.URL, DownloadOptions{}, func(percentage int) {
+		percentages = append(percentages, percentage)
+	})
+	assert.NoError(err)
+	if assert.NotEmpty(percentages) {
+		assert.Equal(0, percentages[0], "progress should start over")
+		assert.Equal(100, percentages[len(percentages)-1])
+	}
+
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal(downloadTestContent, content)
+}
+
+func TestDownloadFileRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "release.tgz", time.Time{}, bytes.NewReader(downloadTestContent))
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	target := filepath.Join(tempDir, "release.tgz")
+
+	err = DownloadFile(target, server.URL, DownloadOptions{Retries: 1, RetryBackoff: time.Millisecond}, func(int) {})
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "after 2 attempts")
+		assert.Contains(err.Error(), "503 Service Unavailable")
+	}
+
+	requests = 0
+	err = DownloadFile(target, server.URL, DownloadOptions{Retries: 2, RetryBackoff: time.Millisecond}, func(int) {})
+	assert.NoError(err)
+	assert.Equal(3, requests)
+
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal(downloadTestContent, content)
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	err = DownloadFile(filepath.Join(tempDir, "release.tgz"), server.URL, DownloadOptions{Retries: 5}, func(int) {})
+	if assert.Error(err) {
+		assert.IsType(&HTTPStatusError{}, err)
+		assert.Contains(err.Error(), "404 Not Found")
+	}
+	assert.Equal(1, requests, "client errors should not be retried")
+}
@@ -0,0 +1,330 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// YAMLEditor changes the entries of a YAML file by moving and removing their
+// lines, so that the comments, order and formatting of the rest of the file
+// are kept. Fields are named as for YAMLSource, and have to use block style.
+type YAMLEditor struct {
+	path           string
+	lines          []string
+	missingNewline bool
+	root           *yaml.Node
+}
+
+// NewYAMLEditor parses the contents of a YAML file for editing.
+func NewYAMLEditor(path string, contents []byte) (*YAMLEditor, error) {
+	editor := &YAMLEditor{path: path}
+	text := string(contents)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		editor.missingNewline = true
+		text += "\n"
+	}
+	editor.lines = strings.SplitAfter(text, "\n")
+	editor.lines = editor.lines[:len(editor.lines)-1]
+
+	if err := editor.parse(); err != nil {
+		return nil, err
+	}
+	return editor, nil
+}
+
+// Contents returns the edited contents of the file.
+func (e *YAMLEditor) Contents() []byte {
+	text := strings.Join(e.lines, "")
+	if e.missingNewline {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return []byte(text)
+}
+
+// Has returns true if the field is set, in block style.
+func (e *YAMLEditor) Has(field string) bool {
+	_, err := e.find(field)
+	return err == nil
+}
+
+// SortMapping sorts the entries of the mapping in the field by their keys.
+func (e *YAMLEditor) SortMapping(field string) error {
+	entries, err := e.children(field)
+	if err != nil {
+		return err
+	}
+	return e.sort(entries, func(a, b yamlEntry) bool {
+		return a.key.Value < b.key.Value
+	})
+}
+
+// SortSequence sorts the entries of the sequence in the field by the value
+// of the given key of each entry, like the names of the variables.
+func (e *YAMLEditor) SortSequence(field, key string) error {
+	entries, err := e.children(field)
+	if err != nil {
+		return err
+	}
+	value := func(entry yamlEntry) string {
+		if _, node := lookupKey(entry.value, key); node != nil {
+			return node.Value
+		}
+		return ""
+	}
+	return e.sort(entries, func(a, b yamlEntry) bool {
+		return value(a) < value(b)
+	})
+}
+
+// Remove removes the field, together with the mappings and sequences left
+// empty by that. Top level entries are kept, with an empty value.
+func (e *YAMLEditor) Remove(field string) error {
+	path, err := e.find(field)
+	if err != nil {
+		return err
+	}
+
+	i := len(path) - 1
+	for i > 1 && len(path[i].entries) == 1 {
+		i--
+	}
+
+	step := path[i]
+	entry := step.entries[step.index]
+	if len(step.entries) > 1 {
+		end := entry.end
+		if step.index == len(step.entries)-1 {
+			// Keep the lines separating the parent from what follows
+			end = entry.content
+		}
+		return e.edit(entry.start, end, nil)
+	}
+
+	if i == 0 {
+		return e.edit(entry.start, entry.content, []string{"{}\n"})
+	}
+	owner := path[0].entries[path[0].index]
+	empty := "{}"
+	if entry.key == nil {
+		empty = "[]"
+	}
+	line := owner.key.Line - 1
+	return e.edit(line, owner.content, []string{fmt.Sprintf("%s%s: %s\n",
+		strings.Repeat(" ", owner.key.Column-1), owner.key.Value, empty)})
+}
+
+// yamlEntry is an entry of a block mapping or sequence, spanning the lines
+// from start (including the comments before it) to end. The lines from
+// content on are the blank lines and comments separating it from the next
+// entry.
+type yamlEntry struct {
+	key, value          *yaml.Node
+	column              int
+	start, content, end int
+}
+
+// yamlStep is an entry of a field, together with its siblings
+type yamlStep struct {
+	entries []yamlEntry
+	index   int
+}
+
+func (e *YAMLEditor) parse() error {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(e.lines, "")), &document); err != nil {
+		return fmt.Errorf("Error parsing %s: %s", e.path, err.Error())
+	}
+	e.root = nil
+	if len(document.Content) > 0 {
+		e.root = document.Content[0]
+	}
+	return nil
+}
+
+// edit replaces the lines from start to end, and parses the result. The
+// change is undone if it breaks the file.
+func (e *YAMLEditor) edit(start, end int, replacement []string) error {
+	lines := append([]string{}, e.lines[:start]...)
+	lines = append(lines, replacement...)
+	lines = append(lines, e.lines[end:]...)
+
+	previous := e.lines
+	e.lines = lines
+	if err := e.parse(); err != nil {
+		e.lines = previous
+		e.parse()
+		return err
+	}
+	return nil
+}
+
+func (e *YAMLEditor) sort(entries []yamlEntry, less func(a, b yamlEntry) bool) error {
+	sorted := append([]yamlEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	// The separating lines stay in place, only the entries move
+	var lines []string
+	for i, entry := range sorted {
+		lines = append(lines, e.lines[entry.start:entry.content]...)
+		lines = append(lines, e.lines[entries[i].content:entries[i].end]...)
+	}
+	return e.edit(entries[0].start, entries[len(entries)-1].end, lines)
+}
+
+// children returns the entries of the mapping or sequence in the field
+func (e *YAMLEditor) children(field string) ([]yamlEntry, error) {
+	path, err := e.find(field)
+	if err != nil {
+		return nil, err
+	}
+	entry := path[len(path)-1].entries[path[len(path)-1].index]
+	return e.entries(entry.value, entry.end)
+}
+
+// find returns the entries leading to the field, starting at the top level
+func (e *YAMLEditor) find(field string) ([]yamlStep, error) {
+	segments := splitField(field)
+	if e.root != nil && len(segments) > 0 {
+		path, err := e.findPath(e.root, len(e.lines), segments)
+		if err != nil || path != nil {
+			return path, err
+		}
+	}
+	return nil, fmt.Errorf("Field %s not found in %s", field, e.path)
+}
+
+// findPath returns the entries leading to the segments below the node, or
+// nil if there are none
+func (e *YAMLEditor) findPath(node *yaml.Node, end int, segments []fieldSegment) ([]yamlStep, error) {
+	if len(segments) == 0 {
+		return []yamlStep{}, nil
+	}
+	entries, err := e.entries(node, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys may contain dots, like the names of BOSH properties
+	name := segments[0].name
+	for i := 1; i <= len(segments); i++ {
+		if index := findEntry(entries, name, segments[0].index); index >= 0 {
+			rest, err := e.findPath(entries[index].value, entries[index].end, segments[i:])
+			if err != nil {
+				return nil, err
+			}
+			if rest != nil {
+				return append([]yamlStep{{entries: entries, index: index}}, rest...), nil
+			}
+		}
+		if segments[0].index || i >= len(segments) || segments[i].index {
+			break
+		}
+		name += "." + segments[i].name
+	}
+	return nil, nil
+}
+
+func findEntry(entries []yamlEntry, name string, index bool) int {
+	for i, entry := range entries {
+		switch {
+		case entry.key != nil:
+			if entry.key.Value == name {
+				return i
+			}
+		case index:
+			if n, err := strconv.Atoi(name); err == nil {
+				if n == i {
+					return i
+				}
+				continue
+			}
+			if entry.value.Kind == yaml.ScalarNode && entry.value.Value == name {
+				return i
+			}
+			if _, value := lookupKey(entry.value, "name"); value != nil && value.Value == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// entries returns the entries of a block mapping or sequence, whose last
+// entry ends before the given line
+func (e *YAMLEditor) entries(node *yaml.Node, end int) ([]yamlEntry, error) {
+	if node.Kind != yaml.MappingNode && node.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+	if node.Style&yaml.FlowStyle != 0 && len(node.Content) > 0 {
+		return nil, fmt.Errorf("Can't edit %s, as it uses flow style", e.position(node))
+	}
+
+	var entries []yamlEntry
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			entries = append(entries, e.entry(key, node.Content[i+1], key.Line-1, key.Column-1))
+		}
+	} else {
+		for _, item := range node.Content {
+			// The entry starts at its dash, which may be on a line of its own
+			line := item.Line - 1
+			for line > 0 && !strings.HasPrefix(strings.TrimSpace(e.lines[line]), "-") {
+				line--
+			}
+			entries = append(entries, e.entry(nil, item, line, strings.Index(e.lines[line], "-")))
+		}
+	}
+
+	for i := range entries {
+		if i+1 < len(entries) {
+			entries[i].end = entries[i+1].start
+		} else {
+			entries[i].end = end
+		}
+		if entries[i].end <= entries[i].start {
+			return nil, fmt.Errorf("Can't edit %s, as entries share lines", e.position(node))
+		}
+		entries[i].content = entries[i].end
+		for entries[i].content > entries[i].start+1 && e.separates(e.lines[entries[i].content-1], entries[i].column) {
+			entries[i].content--
+		}
+	}
+	return entries, nil
+}
+
+func (e *YAMLEditor) position(node *yaml.Node) *Position {
+	return &Position{File: e.path, Line: node.Line, Column: node.Column}
+}
+
+// entry returns an entry starting at the given line and column, including
+// the comments right before it at the same indentation
+func (e *YAMLEditor) entry(key, value *yaml.Node, line, column int) yamlEntry {
+	for line > 0 && isComment(e.lines[line-1]) && indentation(e.lines[line-1]) == column {
+		line--
+	}
+	return yamlEntry{key: key, value: value, column: column, start: line}
+}
+
+// separates returns true for blank lines and comments which are not indented
+// below an entry at the given column
+func (e *YAMLEditor) separates(line string, column int) bool {
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	return isComment(line) && indentation(line) <= column
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const editorTestManifest = `---
+# The variables
+variables:
+- name: PORT
+  options:
+    # The port to listen on
+    default: 80
+
+# The domain of the cluster
+- name: DOMAIN
+  options:
+    default: example.com
+- name: CERT
+  options:
+    type: certificate
+
+configuration:
+  templates:
+    # Listen on the given port
+    properties.tor.port: ((PORT))
+    properties.tor.hostname: ((DOMAIN))
+    properties.tor.certificate: |
+      ((CERT))
+
+  # Keep this
+`
+
+func TestYAMLEditorSort(t *testing.T) {
+	t.Parallel()
+
+	editor, err := NewYAMLEditor("manifest.yml", []byte(editorTestManifest))
+	require.NoError(t, err)
+
+	require.NoError(t, editor.SortSequence("variables", "name"))
+	require.NoError(t, editor.SortMapping("configuration.templates"))
+	assert.Equal(t, `---
+# The variables
+variables:
+- name: CERT
+  options:
+    type: certificate
+
+# The domain of the cluster
+- name: DOMAIN
+  options:
+    default: example.com
+- name: PORT
+  options:
+    # The port to listen on
+    default: 80
+
+configuration:
+  templates:
+    properties.tor.certificate: |
+      ((CERT))
+    properties.tor.hostname: ((DOMAIN))
+    # Listen on the given port
+    properties.tor.port: ((PORT))
+
+  # Keep this
+`, string(editor.Contents()))
+
+	assert.EqualError(t, editor.SortMapping("configuration.properties"), "Field configuration.properties not found in manifest.yml")
+}
+
+func TestYAMLEditorRemove(t *testing.T) {
+	t.Parallel()
+
+	editor, err := NewYAMLEditor("opinions.yml", []byte(`properties:
+  tor:
+    # The host name
+    hostname: localhost
+    client_keys:
+      key: value
+  tor.private_key: secret
+other: {a: b}`))
+	require.NoError(t, err)
+
+	require.NoError(t, editor.Remove("properties.tor.private_key"))
+	require.NoError(t, editor.Remove("properties.tor.client_keys.key"))
+	assert.Equal(t, "properties:\n  tor:\n    # The host name\n    hostname: localhost\nother: {a: b}", string(editor.Contents()))
+
+	require.NoError(t, editor.Remove("properties.tor.hostname"))
+	assert.Equal(t, "properties: {}\nother: {a: b}", string(editor.Contents()))
+
+	assert.EqualError(t, editor.Remove("other.a"), "Can't edit opinions.yml:2:8, as it uses flow style")
+	assert.EqualError(t, editor.Remove("properties.tor"), "Field properties.tor not found in opinions.yml")
+}
@@ -13,11 +13,31 @@ type Error struct {
 	Field    string
 	BadValue interface{}
 	Detail   string
+	// Rule is the ID of the check which found the error, if known
+	Rule string
+	// Severity is set by the rule, errors without one are errors
+	Severity Severity
+	// Position is the location of the field in its source file, if known
+	Position *Position
 }
 
 // Error implements the error interface.
 func (v *Error) Error() string {
-	return fmt.Sprintf("%s: %s", v.Field, v.ErrorBody())
+	message := fmt.Sprintf("%s: %s", v.Field, v.ErrorBody())
+	if !v.IsError() {
+		message = fmt.Sprintf("%s: %s", v.Severity, message)
+	}
+	if v.Position != nil {
+		message = fmt.Sprintf("%s: %s", v.Position, message)
+	}
+	return message
+}
+
+// WithRule sets the rule of the error, and its severity, and returns it.
+func (v *Error) WithRule(rule Rule) *Error {
+	v.Rule = rule.ID
+	v.Severity = rule.Severity
+	return v
 }
 
 // ErrorBody returns the error message without the field name.  This is useful
@@ -105,26 +125,26 @@ func (t ErrorType) String() string {
 // NotFound returns a *Error indicating "value not found".  This is
 // used to report failure to find a requested value (e.g. looking up an ID).
 func NotFound(field string, value interface{}) *Error {
-	return &Error{ErrorTypeNotFound, field, value, ""}
+	return &Error{ErrorTypeNotFound, field, value, "", "", "", nil}
 }
 
 // Required returns a *Error indicating "value required".  This is used
 // to report required values that are not provided (e.g. empty strings, null
 // values, or empty arrays).
 func Required(field string, detail string) *Error {
-	return &Error{ErrorTypeRequired, field, "", detail}
+	return &Error{ErrorTypeRequired, field, "", detail, "", "", nil}
 }
 
 // Duplicate returns a *Error indicating "duplicate value".  This is
 // used to report collisions of values that must be unique (e.g. names or IDs).
 func Duplicate(field string, value interface{}) *Error {
-	return &Error{ErrorTypeDuplicate, field, value, ""}
+	return &Error{ErrorTypeDuplicate, field, value, "", "", "", nil}
 }
 
 // Invalid returns a *Error indicating "invalid value".  This is used
 // to report malformed values (e.g. failed regex match, too long, out of bounds).
 func Invalid(field string, value interface{}, detail string) *Error {
-	return &Error{ErrorTypeInvalid, field, value, detail}
+	return &Error{ErrorTypeInvalid, field, value, detail, "", "", nil}
 }
 
 // NotSupported returns a *Error indicating "unsupported value".
@@ -135,7 +155,7 @@ func NotSupported(field string, value interface{}, validValues []string) *Error
 	if validValues != nil && len(validValues) > 0 {
 		detail = "supported values: " + strings.Join(validValues, ", ")
 	}
-	return &Error{ErrorTypeNotSupported, field, value, detail}
+	return &Error{ErrorTypeNotSupported, field, value, detail, "", "", nil}
 }
 
 // Forbidden returns a *Error indicating "forbidden".  This is used to
@@ -143,7 +163,7 @@ func NotSupported(field string, value interface{}, validValues []string) *Error
 // some conditions, but which are not permitted by current conditions (e.g.
 // security policy).
 func Forbidden(field string, detail string) *Error {
-	return &Error{ErrorTypeForbidden, field, "", detail}
+	return &Error{ErrorTypeForbidden, field, "", detail, "", "", nil}
 }
 
 // TooLong returns a *Error indicating "too long".  This is used to
@@ -151,14 +171,14 @@ func Forbidden(field string, detail string) *Error {
 // Invalid, but the returned error will not include the too-long
 // value.
 func TooLong(field string, value interface{}, maxLength int) *Error {
-	return &Error{ErrorTypeTooLong, field, value, fmt.Sprintf("must have at most %d characters", maxLength)}
+	return &Error{ErrorTypeTooLong, field, value, fmt.Sprintf("must have at most %d characters", maxLength), "", "", nil}
 }
 
 // InternalError returns a *Error indicating "internal error".  This is used
 // to signal that an error was found that was not directly related to user
 // input.  The err argument must be non-nil.
 func InternalError(field string, err error) *Error {
-	return &Error{ErrorTypeInternal, field, nil, err.Error()}
+	return &Error{ErrorTypeInternal, field, nil, err.Error(), "", "", nil}
 }
 
 // ErrorList holds a set of Errors.  It is plausible that we might one day have
@@ -176,3 +196,29 @@ func (v *ErrorList) Errors() string {
 
 	return strings.Join(values, "\n")
 }
+
+// Error implements the error interface, so that lists of errors can be
+// returned as they are.
+func (v ErrorList) Error() string {
+	return v.Errors()
+}
+
+// WithRule sets the rule of the errors not having one yet, and returns them.
+func (v ErrorList) WithRule(rule Rule) ErrorList {
+	for _, item := range v {
+		if item.Rule == "" {
+			item.WithRule(rule)
+		}
+	}
+	return v
+}
+
+// Locate sets the position of the errors not having one yet, as found by the
+// locator from their field.
+func (v ErrorList) Locate(locator Locator) {
+	for _, item := range v {
+		if item.Position == nil {
+			item.Position = locator.Locate(item.Field)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells whether an error makes the validation fail
+type Severity string
+
+// The severities of errors. Errors without a severity are errors.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Rule is a check reporting errors, with the severity of its errors
+type Rule struct {
+	ID       string
+	Severity Severity
+}
+
+// RuleSuppressions is the rule reporting suppressions which are incomplete,
+// or name rules which can't be suppressed
+var RuleSuppressions = Rule{ID: "suppressions", Severity: SeverityError}
+
+// Suppression silences the errors of a rule for a field, and the fields
+// below it. Without a field, all errors of the rule are silenced.
+type Suppression struct {
+	Rule   string `yaml:"rule"`
+	Field  string `yaml:"field"`
+	Reason string `yaml:"reason"`
+}
+
+// Matches returns true if the suppression silences the error
+func (s Suppression) Matches(item *Error) bool {
+	if s.Rule != item.Rule {
+		return false
+	}
+	if s.Field == "" || s.Field == item.Field {
+		return true
+	}
+	return strings.HasPrefix(item.Field, s.Field+".") || strings.HasPrefix(item.Field, s.Field+"[")
+}
+
+// IsError returns true if the error makes the validation fail
+func (v *Error) IsError() bool {
+	return v.Severity == "" || v.Severity == SeverityError
+}
+
+// HasErrors returns true if any of the errors makes the validation fail,
+// as opposed to warnings and infos.
+func (v ErrorList) HasErrors() bool {
+	for _, item := range v {
+		if item.IsError() {
+			return true
+		}
+	}
+	return false
+}
+
+// Strict turns the warnings into errors.
+func (v ErrorList) Strict() {
+	for _, item := range v {
+		if item.Severity == SeverityWarning {
+			item.Severity = SeverityError
+		}
+	}
+}
+
+// Suppress returns the errors not silenced by any of the suppressions.
+// Only warnings and infos are silenced; the later checks, and building, rely
+// on the inputs having no errors.
+func (v ErrorList) Suppress(suppressions []Suppression) ErrorList {
+	result := ErrorList{}
+	for _, item := range v {
+		suppressed := false
+		for _, suppression := range suppressions {
+			if !item.IsError() && suppression.Matches(item) {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// ValidateSuppressions checks that the suppressions name a rule, and give a
+// reason for silencing it.
+func ValidateSuppressions(suppressions []Suppression, field string) ErrorList {
+	allErrs := ErrorList{}
+	for idx, suppression := range suppressions {
+		if suppression.Rule == "" {
+			allErrs = append(allErrs, Required(fmt.Sprintf("%s[%d].rule", field, idx), ""))
+		}
+		if strings.TrimSpace(suppression.Reason) == "" {
+			allErrs = append(allErrs, Required(fmt.Sprintf("%s[%d].reason", field, idx),
+				"Suppressions need a reason"))
+		}
+	}
+	return allErrs
+}
+
+// ValidateSuppressedRules checks that the suppressions don't name any of the
+// given rules reporting errors, as only warnings and infos can be suppressed.
+func ValidateSuppressedRules(suppressions []Suppression, field string, rules []Rule) ErrorList {
+	allErrs := ErrorList{}
+	for idx, suppression := range suppressions {
+		for _, rule := range rules {
+			if rule.ID == suppression.Rule && (rule.Severity == "" || rule.Severity == SeverityError) {
+				allErrs = append(allErrs, Forbidden(fmt.Sprintf("%s[%d].rule", field, idx),
+					fmt.Sprintf("Rule %s reports errors, only warnings and infos can be suppressed", rule.ID)))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,61 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorListSeverities(t *testing.T) {
+	t.Parallel()
+
+	warning := Rule{ID: "sorting", Severity: SeverityWarning}
+	errs := ErrorList{Invalid("variables", "B", "Does not sort before 'A'").WithRule(warning)}
+	assert.False(t, errs.HasErrors())
+	assert.Equal(t, `warning: variables: Invalid value: "B": Does not sort before 'A'`, errs.Errors())
+
+	errs = append(errs, Required("variables[A].description", "").WithRule(Rule{ID: "info", Severity: SeverityInfo}))
+	errs.Strict()
+	assert.True(t, errs.HasErrors())
+	assert.Equal(t, SeverityError, errs[0].Severity)
+	assert.Equal(t, SeverityInfo, errs[1].Severity, "Only warnings become errors")
+}
+
+func TestErrorListSuppress(t *testing.T) {
+	t.Parallel()
+
+	rule := Rule{ID: "memory", Severity: SeverityWarning}
+	errs := ErrorList{
+		Invalid("instance_groups[api].run.memory", -1, "").WithRule(rule),
+		Invalid("instance_groups[api-worker].run.memory", -1, "").WithRule(rule),
+		Invalid("instance_groups[db].run.memory", -1, "").WithRule(rule),
+		Invalid("instance_groups[api].run.cpu", -1, "").WithRule(Rule{ID: "cpu"}),
+	}
+
+	remaining := errs.Suppress([]Suppression{{Rule: "memory", Field: "instance_groups[api]", Reason: "Set later"}})
+	assert.Equal(t, ErrorList{errs[1], errs[2], errs[3]}, remaining)
+
+	remaining = errs.Suppress([]Suppression{{Rule: "memory", Reason: "Set later"}})
+	assert.Equal(t, ErrorList{errs[3]}, remaining)
+
+	remaining = errs.Suppress([]Suppression{{Rule: "cpu", Reason: "Set later"}})
+	assert.Equal(t, errs, remaining, "Errors are not suppressed")
+}
+
+func TestValidateSuppressedRules(t *testing.T) {
+	t.Parallel()
+
+	rules := []Rule{
+		{ID: "memory", Severity: SeverityError},
+		{ID: "sorting", Severity: SeverityWarning},
+		{ID: "descriptions", Severity: SeverityInfo},
+	}
+	suppressions := []Suppression{
+		{Rule: "sorting", Reason: "Grouped"},
+		{Rule: "memory", Reason: "Set later"},
+		{Rule: "descriptions", Reason: "Obvious"},
+		{Rule: "unknown", Reason: "Checked elsewhere"},
+	}
+	assert.EqualError(t, ValidateSuppressedRules(suppressions, "validation.suppressions", rules),
+		"validation.suppressions[1].rule: Forbidden: Rule memory reports errors, only warnings and infos can be suppressed")
+}
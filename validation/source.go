@@ -0,0 +1,254 @@
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Position is the location of a value in a source file
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String returns the position in the usual file:line:column form.
+func (p *Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Locator finds the position of a field in the sources it was read from.
+type Locator interface {
+	// Locate returns the position of the field, or nil if it is unknown.
+	Locate(field string) *Position
+}
+
+// LocatorFunc is a function used as a Locator.
+type LocatorFunc func(field string) *Position
+
+// Locate calls the function.
+func (f LocatorFunc) Locate(field string) *Position {
+	return f(field)
+}
+
+// YAMLSource keeps the positions of the nodes of a YAML file, so that
+// fields can be located by their path, like
+// `instance_groups[api].jobs[cc].consumes[db]`. Names in brackets select
+// the entry of a list with that name, numbers the entry at that index.
+type YAMLSource struct {
+	path string
+	root *yaml.Node
+}
+
+// NewYAMLSource parses the contents of a YAML file, keeping the positions of
+// its nodes.
+func NewYAMLSource(path string, contents []byte) (*YAMLSource, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err.Error())
+	}
+
+	source := &YAMLSource{path: path}
+	if len(document.Content) > 0 {
+		source.root = document.Content[0]
+	}
+	return source, nil
+}
+
+// Locate returns the position of the field, or of its closest parent set in
+// the source, as the value of the field may be a default.
+func (s *YAMLSource) Locate(field string) *Position {
+	position, _ := s.Lookup(field)
+	return position
+}
+
+// Lookup returns the position of the deepest part of the field set in the
+// source, and the number of parts of the field below it which are not.
+func (s *YAMLSource) Lookup(field string) (*Position, int) {
+	segments := splitField(field)
+	if s == nil || s.root == nil {
+		return nil, len(segments)
+	}
+
+	node := s.root
+	var found *yaml.Node
+	for i := 0; i < len(segments); i++ {
+		var key, value *yaml.Node
+		if segments[i].index {
+			value = lookupIndex(node, segments[i].name)
+			key = value
+		} else {
+			// Keys may contain dots, like the names of BOSH properties
+			name := segments[i].name
+			for j := i; ; j++ {
+				key, value = lookupKey(node, name)
+				if key != nil {
+					i = j
+					break
+				}
+				if j+1 >= len(segments) || segments[j+1].index {
+					break
+				}
+				name += "." + segments[j+1].name
+			}
+		}
+		if value == nil {
+			return s.position(found), len(segments) - i
+		}
+		node, found = resolveAlias(value), key
+	}
+	return s.position(found), 0
+}
+
+func (s *YAMLSource) position(node *yaml.Node) *Position {
+	if node == nil {
+		return nil
+	}
+	return &Position{File: s.path, Line: node.Line, Column: node.Column}
+}
+
+type fieldSegment struct {
+	name  string
+	index bool
+}
+
+// splitField splits the path of a field into the names and indices (in
+// brackets) of its parts
+func splitField(field string) []fieldSegment {
+	var segments []fieldSegment
+	for len(field) > 0 {
+		switch field[0] {
+		case '.':
+			field = field[1:]
+		case '[':
+			end := strings.Index(field, "]")
+			if end < 0 {
+				end = len(field)
+				field += "]"
+			}
+			segments = append(segments, fieldSegment{name: field[1:end], index: true})
+			field = field[end+1:]
+		default:
+			end := strings.IndexAny(field, ".[")
+			if end < 0 {
+				end = len(field)
+			}
+			segments = append(segments, fieldSegment{name: field[:end]})
+			field = field[end:]
+		}
+	}
+	return segments
+}
+
+// lookupKey returns the key and the value of the named mapping entry. Fields
+// use singular and plural names, as well as dashes and underscores,
+// interchangeably.
+func lookupKey(node *yaml.Node, name string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var candidates []string
+	for _, candidate := range []string{
+		name,
+		strings.Replace(name, "-", "_", -1),
+		strings.Replace(name, "_", "-", -1),
+	} {
+		candidates = append(candidates, candidate, candidate+"s")
+	}
+	for _, candidate := range candidates {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == candidate {
+				return node.Content[i], node.Content[i+1]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lookupIndex returns the entry of a list at the given index, or with the
+// given name, or the value of the given key of a mapping
+func lookupIndex(node *yaml.Node, index string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == index {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(index); err == nil {
+			if i >= 0 && i < len(node.Content) {
+				return node.Content[i]
+			}
+			return nil
+		}
+		for _, item := range node.Content {
+			item = resolveAlias(item)
+			if item.Kind == yaml.ScalarNode && item.Value == index {
+				return item
+			}
+			if _, name := lookupKey(item, "name"); name != nil && name.Value == index {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// EnvSource keeps the positions of the variables set by env files
+type EnvSource map[string]*Position
+
+// NewEnvSource reads the positions of the variables set by the env files.
+// As with the values, later files override earlier ones.
+func NewEnvSource(paths ...string) (EnvSource, error) {
+	source := EnvSource{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			text := scanner.Text()
+			trimmed := strings.TrimSpace(text)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			trimmed = strings.TrimPrefix(trimmed, "export ")
+			end := strings.IndexAny(trimmed, "=:")
+			if end < 0 {
+				continue
+			}
+			name := strings.TrimSpace(trimmed[:end])
+			source[name] = &Position{
+				File:   path,
+				Line:   line,
+				Column: strings.Index(text, name) + 1,
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return source, nil
+}
+
+// Locate returns the position of the variable named by the field.
+func (s EnvSource) Locate(field string) *Position {
+	return s[field]
+}
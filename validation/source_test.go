@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sourceTestYAML = `---
+instance_groups:
+- name: api
+  jobs:
+  - name: cc
+    properties:
+      bosh_containerization:
+        ports:
+        - name: http
+          internal: 80
+configuration:
+  templates:
+    properties.cc.port: '((PORT))'
+`
+
+func TestYAMLSourceLookup(t *testing.T) {
+	t.Parallel()
+
+	source, err := NewYAMLSource("manifest.yml", []byte(sourceTestYAML))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		field    string
+		expected string
+		missing  int
+	}{
+		{"instance_groups[api]", "manifest.yml:3:3", 0},
+		{"instance-group[api].jobs[0].name", "manifest.yml:5:5", 0},
+		{"instance_groups[api].jobs[cc].properties.bosh_containerization.ports[http].internal", "manifest.yml:10:11", 0},
+		{"instance_groups[api].jobs[cc].properties.bosh_containerization.ports[http].external", "manifest.yml:9:11", 1},
+		{"configuration.templates[properties.cc.port]", "manifest.yml:13:25", 0},
+		{"instance_groups[other].run.memory", "manifest.yml:2:1", 3},
+	}
+	for _, testCase := range testCases {
+		position, missing := source.Lookup(testCase.field)
+		if assert.NotNil(t, position, testCase.field) {
+			assert.Equal(t, testCase.expected, position.String(), testCase.field)
+		}
+		assert.Equal(t, testCase.missing, missing, testCase.field)
+	}
+
+	assert.Nil(t, source.Locate("variables"))
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fissile-env-source")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	require.NoError(t, ioutil.WriteFile(first, []byte("# Comment\nDOMAIN=example.com\n  PORT=80\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(second, []byte("\nexport PORT=8080\n"), 0644))
+
+	source, err := NewEnvSource(first, second)
+	require.NoError(t, err)
+
+	assert.Equal(t, &Position{File: first, Line: 2, Column: 1}, source.Locate("DOMAIN"))
+	assert.Equal(t, &Position{File: second, Line: 2, Column: 8}, source.Locate("PORT"))
+	assert.Nil(t, source.Locate("MISSING"))
+}
+
+func TestErrorListLocate(t *testing.T) {
+	t.Parallel()
+
+	known := &Position{File: "other.yml", Line: 1, Column: 1}
+	errs := ErrorList{Required("a", ""), Required("b", ""), &Error{Type: ErrorTypeRequired, Field: "c", Position: known}}
+	errs.Locate(LocatorFunc(func(field string) *Position {
+		if field == "a" {
+			return &Position{File: "manifest.yml", Line: 2, Column: 3}
+		}
+		return &Position{File: "manifest.yml", Line: 4, Column: 5}
+	}))
+
+	assert.Equal(t, "manifest.yml:2:3: a: Required value\nmanifest.yml:4:5: b: Required value\nother.yml:1:1: c: Required value", errs.Errors())
+}